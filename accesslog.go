@@ -0,0 +1,47 @@
+package plumbus
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// AccessLogger logs a message with alternating keys and values, like the
+// Info method of *slog.Logger or the Infow method of zap's SugaredLogger
+type AccessLogger func(msg string, keysAndValues ...interface{})
+
+// AccessLog is a hook for AfterResponse that logs each request with its
+// method, the pattern of the route that matched (such as
+// "/user/:userId/name" rather than "/user/10/name"), the path, status,
+// duration, and the sizes of the request and response bodies, as in:
+//
+//	mux.AfterResponse(plumbus.AccessLog(slog.Default().Info))
+//
+// With a nil logger, each request is logged with the log package as
+// key=value pairs.
+func AccessLog(logger AccessLogger) func(req *http.Request, info ResponseInfo) {
+	if logger == nil {
+		logger = logKeysAndValues
+	}
+	return func(req *http.Request, info ResponseInfo) {
+		logger("request",
+			"method", req.Method,
+			"route", info.Route.Pattern,
+			"path", req.URL.Path,
+			"status", info.Status,
+			"duration", info.Duration,
+			"request_bytes", req.ContentLength,
+			"response_bytes", info.BytesWritten,
+		)
+	}
+}
+
+func logKeysAndValues(msg string, keysAndValues ...interface{}) {
+	var line strings.Builder
+	line.WriteString(msg)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fmt.Fprintf(&line, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	log.Print(line.String())
+}
@@ -0,0 +1,237 @@
+package plumbus
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+// AsyncAPI is an AsyncAPI 3.0 document describing the streaming routes of
+// a mux, made by ServeMux.AsyncAPI
+type AsyncAPI struct {
+	AsyncAPI   string                        `json:"asyncapi"`
+	Info       OpenAPIInfo                   `json:"info"`
+	Channels   map[string]*AsyncAPIChannel   `json:"channels"`
+	Operations map[string]*AsyncAPIOperation `json:"operations"`
+	Components OpenAPIComponents             `json:"components"`
+}
+
+type AsyncAPIChannel struct {
+	Address     string                      `json:"address"`
+	Description string                      `json:"description,omitempty"`
+	Parameters  map[string]AsyncAPIParam    `json:"parameters,omitempty"`
+	Messages    map[string]*AsyncAPIMessage `json:"messages"`
+}
+
+type AsyncAPIParam struct {
+	Description string `json:"description,omitempty"`
+}
+
+type AsyncAPIMessage struct {
+	Name        string         `json:"name"`
+	ContentType string         `json:"contentType,omitempty"`
+	Payload     *OpenAPISchema `json:"payload,omitempty"`
+}
+
+// AsyncAPIOperation is the messages the mux sends on a channel, with an
+// Action of "send", or receives on it, with an Action of "receive"
+type AsyncAPIOperation struct {
+	Action   string        `json:"action"`
+	Channel  AsyncAPIRef   `json:"channel"`
+	Messages []AsyncAPIRef `json:"messages"`
+}
+
+type AsyncAPIRef struct {
+	Ref string `json:"$ref"`
+}
+
+// Sends documents a message the route sends to the client: an event
+// whose Type is name, for a handler returning an EventStream, or a
+// message named name, for a websocket handler. The payload is an example
+// of the message's data, and its type gives the data's schema.
+func (r *Route) Sends(name string, payload interface{}) *Route {
+	return r.addMessage(name, payload, true)
+}
+
+// Receives documents a message that the client sends to a websocket
+// route, like Sends does for the messages it sends.
+func (r *Route) Receives(name string, payload interface{}) *Route {
+	return r.addMessage(name, payload, false)
+}
+
+// routeMessage is a message declared with Sends or Receives
+type routeMessage struct {
+	name    string
+	payload interface{}
+	sent    bool
+}
+
+func (r *Route) addMessage(name string, payload interface{}, sent bool) *Route {
+	if r.node.messages == nil {
+		r.node.messages = map[string][]routeMessage{}
+	}
+	r.node.messages[r.method] = append(r.node.messages[r.method], routeMessage{name, payload, sent})
+	return r
+}
+
+// AsyncAPI describes the mux's streaming routes as an AsyncAPI 3.0
+// document: routes that send server-sent events or stream NDJSON, and
+// websocket routes. Each one is a channel whose messages are declared
+// with Route.Sends and Route.Receives, except that the values streamed
+// from a channel of another type than Event are described by their type.
+func (sm *ServeMux) AsyncAPI(info OpenAPIInfo) *AsyncAPI {
+	doc := &AsyncAPI{
+		AsyncAPI:   "3.0.0",
+		Info:       info,
+		Channels:   map[string]*AsyncAPIChannel{},
+		Operations: map[string]*AsyncAPIOperation{},
+	}
+	b := &openAPIBuilder{
+		doc: &OpenAPI{
+			Components: OpenAPIComponents{Schemas: map[string]*OpenAPISchema{}},
+		},
+		operationIDs: map[string]bool{},
+	}
+
+	nodes := sm.Paths.flatten()
+	patterns := make([]string, 0, len(nodes))
+	for pattern := range nodes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		node := nodes[pattern]
+		for _, route := range routeInfos(pattern, node) {
+			handler := methodOrHandler(node.originalHandler, route.Method)
+			b.addChannel(doc, pattern, route.Method, handler, node)
+		}
+	}
+
+	doc.Components.Schemas = b.doc.Components.Schemas
+	return doc
+}
+
+func (b *openAPIBuilder) addChannel(doc *AsyncAPI, pattern, method string, handler interface{}, node *Paths) {
+	typ := reflect.TypeOf(handler)
+	if typ == nil || typ.Kind() != reflect.Func || !adapted(handler) {
+		return
+	}
+	info, err := generate.CollectInfo(typ)
+	if err != nil {
+		return
+	}
+
+	var streamed reflect.Type
+	events := false
+	for _, output := range info.Outputs {
+		if output.ConversionType != generate.ConvertBody || output.Type.Kind() != reflect.Chan {
+			continue
+		}
+		if output.Type.Elem() == openAPIEventType {
+			events = true
+		} else {
+			streamed = output.Type.Elem()
+		}
+	}
+	if !events && streamed == nil && info.WebSocketIndex < 0 {
+		return
+	}
+
+	id := b.operationID(handler)
+	if id == "" {
+		id = channelID(pattern, method)
+	}
+	channel := &AsyncAPIChannel{
+		Address:     openAPIPath(pattern),
+		Description: cleanupText(strings.Join(node.documentation, "\n")),
+		Messages:    map[string]*AsyncAPIMessage{},
+	}
+	for _, param := range getSegments(openAPIPath(pattern)) {
+		if strings.HasPrefix(param, "{") {
+			if channel.Parameters == nil {
+				channel.Parameters = map[string]AsyncAPIParam{}
+			}
+			channel.Parameters[strings.Trim(param, "{}")] = AsyncAPIParam{}
+		}
+	}
+
+	var sent, received []AsyncAPIRef
+	add := func(name string, message *AsyncAPIMessage, send bool) {
+		channel.Messages[name] = message
+		ref := AsyncAPIRef{Ref: "#/channels/" + id + "/messages/" + name}
+		if send {
+			sent = append(sent, ref)
+		} else {
+			received = append(received, ref)
+		}
+	}
+
+	if streamed != nil {
+		add(typeName(streamed), b.message(typeName(streamed), reflect.Zero(streamed).Interface()), true)
+	}
+	for _, key := range []string{"", method} {
+		for _, m := range node.messages[key] {
+			add(m.name, b.message(m.name, m.payload), m.sent)
+		}
+		if method == "" {
+			break
+		}
+	}
+	if events && len(sent) == 0 {
+		add("message", &AsyncAPIMessage{Name: "message"}, true)
+	}
+
+	doc.Channels[id] = channel
+	if len(sent) > 0 {
+		doc.Operations["send"+upperFirst(id)] = &AsyncAPIOperation{
+			Action:   "send",
+			Channel:  AsyncAPIRef{Ref: "#/channels/" + id},
+			Messages: sent,
+		}
+	}
+	if len(received) > 0 {
+		doc.Operations["receive"+upperFirst(id)] = &AsyncAPIOperation{
+			Action:   "receive",
+			Channel:  AsyncAPIRef{Ref: "#/channels/" + id},
+			Messages: received,
+		}
+	}
+}
+
+// message describes a message by the type of its example payload
+func (b *openAPIBuilder) message(name string, payload interface{}) *AsyncAPIMessage {
+	message := &AsyncAPIMessage{Name: name}
+	switch payload.(type) {
+	case nil:
+	case string:
+		message.ContentType = "text/plain"
+		message.Payload = &OpenAPISchema{Type: "string"}
+	default:
+		message.ContentType = "application/json"
+		message.Payload = b.schema(reflect.TypeOf(payload))
+	}
+	return message
+}
+
+// channelID names the channel of a route whose handler has no name of
+// its own, as in "getOrdersOrderIdUpdates" for GET /orders/:orderId/updates
+func channelID(pattern, method string) string {
+	id := strings.ToLower(method)
+	for _, segment := range getSegments(openAPIPath(pattern)) {
+		id += upperFirst(strings.Trim(segment, "{}"))
+	}
+	if id == "" {
+		return "root"
+	}
+	return id
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,98 @@
+package plumbus
+
+import (
+	"net/http"
+	"strings"
+)
+
+// BearerToken is a handler argument for the token in a request's
+// "Authorization: Bearer <token>" header. Requests without one get a 401.
+type BearerToken string
+
+func (t *BearerToken) FromRequest(req *http.Request) error {
+	scheme, token, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return ErrorUnauthorized("Bearer", "missing bearer token")
+	}
+	*t = BearerToken(token)
+	return nil
+}
+
+func (t *BearerToken) SecuritySchemes(mux *ServeMux) map[string]*OpenAPISecurityScheme {
+	return map[string]*OpenAPISecurityScheme{
+		"bearerAuth": {Type: "http", Scheme: "bearer"},
+	}
+}
+
+// BasicAuth is a handler argument for the user and password of a request
+// with HTTP basic authentication. Requests without them get a 401.
+type BasicAuth struct {
+	User string
+	Pass string
+}
+
+func (ba *BasicAuth) FromRequest(req *http.Request) error {
+	user, pass, ok := req.BasicAuth()
+	if !ok {
+		return ErrorUnauthorized(`Basic realm="restricted", charset="UTF-8"`, "missing basic authentication")
+	}
+	ba.User, ba.Pass = user, pass
+	return nil
+}
+
+func (ba *BasicAuth) SecuritySchemes(mux *ServeMux) map[string]*OpenAPISecurityScheme {
+	return map[string]*OpenAPISecurityScheme{
+		"basicAuth": {Type: "http", Scheme: "basic"},
+	}
+}
+
+// APIKey is a handler argument for an API key sent in the X-API-Key
+// header or the api_key query param, or wherever the mux says with
+// SetAPIKeyParams. Requests without one get a 401.
+type APIKey string
+
+func (k *APIKey) FromRequest(req *http.Request) error {
+	header, query := apiKeyParams(muxFromRequest(req))
+
+	key := ""
+	if header != "" {
+		key = req.Header.Get(header)
+	}
+	if key == "" && query != "" {
+		key = req.URL.Query().Get(query)
+	}
+	if key == "" {
+		return ErrorUnauthorized("APIKey", "missing API key")
+	}
+	*k = APIKey(key)
+	return nil
+}
+
+// SecuritySchemes describes the header and query param the key can be
+// sent in as the apiKeyHeader and apiKeyQuery schemes
+func (k *APIKey) SecuritySchemes(mux *ServeMux) map[string]*OpenAPISecurityScheme {
+	header, query := apiKeyParams(mux)
+	schemes := map[string]*OpenAPISecurityScheme{}
+	if header != "" {
+		schemes["apiKeyHeader"] = &OpenAPISecurityScheme{Type: "apiKey", In: "header", Name: header}
+	}
+	if query != "" {
+		schemes["apiKeyQuery"] = &OpenAPISecurityScheme{Type: "apiKey", In: "query", Name: query}
+	}
+	return schemes
+}
+
+func apiKeyParams(sm *ServeMux) (header, query string) {
+	if sm != nil && (sm.apiKeyHeader != "" || sm.apiKeyQuery != "") {
+		return sm.apiKeyHeader, sm.apiKeyQuery
+	}
+	return "X-API-Key", "api_key"
+}
+
+// SetAPIKeyParams sets the header and query param that APIKey arguments
+// are taken from. Either can be "" to not look there.
+func (sm *ServeMux) SetAPIKeyParams(header, query string) {
+	sm.apiKeyHeader = header
+	sm.apiKeyQuery = query
+}
@@ -0,0 +1,169 @@
+package plumbus
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Requirements are what a route requires of the client to be allowed,
+// declared with RequireScope and RequireRole
+type Requirements struct {
+	Scopes []string
+	Roles  []string
+}
+
+// Authorizer decides whether a request meets the requirements of its
+// route, given the decoded arguments of the handler, such as the claims
+// of an authentication token. Requests it doesn't allow get a 403.
+type Authorizer func(req *http.Request, required Requirements, args []interface{}) bool
+
+// SetAuthorizer sets how the mux checks the requirements of routes
+// declared with RequireScope and RequireRole, as in:
+//
+//	mux.SetAuthorizer(func(req *http.Request, required plumbus.Requirements, args []interface{}) bool {
+//		for _, arg := range args {
+//			if claims, ok := arg.(jwt.Claims); ok {
+//				return hasScopes(claims, required.Scopes)
+//			}
+//		}
+//		return false
+//	})
+//
+// It's called after the handler's arguments are decoded, and after any
+// interceptors. The routes of a mounted or Host mux use its authorizer,
+// or else that of the mux it's part of. Requests to routes with
+// requirements are an error if there's no authorizer.
+func (sm *ServeMux) SetAuthorizer(authorizer Authorizer) {
+	sm.authorizer = authorizer
+}
+
+// RequireScope requires clients to have the scopes to use the route, as
+// checked by the mux's Authorizer. For a route registered with a method
+// helper like POST, it only applies to that method.
+func (r *Route) RequireScope(scopes ...string) *Route {
+	required := r.requirements()
+	required.Scopes = append(required.Scopes, scopes...)
+	return r
+}
+
+// RequireRole requires clients to have the roles to use the route, as
+// checked by the mux's Authorizer. For a route registered with a method
+// helper like POST, it only applies to that method.
+func (r *Route) RequireRole(roles ...string) *Route {
+	required := r.requirements()
+	required.Roles = append(required.Roles, roles...)
+	return r
+}
+
+func (r *Route) requirements() *Requirements {
+	for _, handler := range r.handlers() {
+		if !adapted(handler) {
+			panic(fmt.Errorf(
+				"route %s can't have requirements, since its handler %s isn't a function plumbus calls",
+				r.node.pattern,
+				handlerName(handler),
+			))
+		}
+	}
+
+	if r.node.requirements == nil {
+		r.node.requirements = map[string]*Requirements{}
+	}
+	required, ok := r.node.requirements[r.method]
+	if !ok {
+		required = &Requirements{}
+		r.node.requirements[r.method] = required
+	}
+	return required
+}
+
+// handlers lists the handlers the route's requirements apply to
+func (r *Route) handlers() []interface{} {
+	var methods *ByMethod
+	switch handler := r.node.originalHandler.(type) {
+	case ByMethod:
+		methods = &handler
+	case *ByMethod:
+		methods = handler
+	default:
+		return []interface{}{handler}
+	}
+
+	if r.method != "" {
+		return []interface{}{methodHandler(methods, r.method)}
+	}
+	handlers := []interface{}{}
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"} {
+		if handler := methodHandler(methods, method); handler != nil {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers
+}
+
+// adapted checks that the handler is called through an adaptor, which
+// is where requirements are checked
+func adapted(handler interface{}) bool {
+	switch handler.(type) {
+	case nil, func(http.ResponseWriter, *http.Request), http.Handler, ByMethod, *ByMethod:
+		return false
+	}
+	return true
+}
+
+func methodHandler(methods *ByMethod, method string) interface{} {
+	var handler interface{}
+	switch method {
+	case "GET":
+		handler = methods.GET
+	case "POST":
+		handler = methods.POST
+	case "PUT":
+		handler = methods.PUT
+	case "PATCH":
+		handler = methods.PATCH
+	case "DELETE":
+		handler = methods.DELETE
+	case "OPTIONS":
+		handler = methods.OPTIONS
+	}
+	return typedFunc(handler)
+}
+
+// authorize checks the requirements of the request's route with the
+// Authorizer of the innermost mux the route was found through that has one
+func authorize(req *http.Request, args []Arg) error {
+	node, _ := req.Context().Value(routeNodeKey).(*Paths)
+	if node == nil || node.requirements == nil {
+		return nil
+	}
+
+	method := req.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	var required Requirements
+	for _, key := range []string{"", method} {
+		if r, ok := node.requirements[key]; ok {
+			required.Scopes = append(required.Scopes, r.Scopes...)
+			required.Roles = append(required.Roles, r.Roles...)
+		}
+	}
+	if len(required.Scopes) == 0 && len(required.Roles) == 0 {
+		return nil
+	}
+
+	sm := routeMux(req, func(mux *ServeMux) bool { return mux.authorizer != nil })
+	if sm == nil || sm.authorizer == nil {
+		return errors.New("route has requirements, but the mux has no authorizer set with SetAuthorizer")
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value()
+	}
+	if !sm.authorizer(req, required, values) {
+		return Error(http.StatusForbidden, "not allowed")
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+package plumbus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+// BindStruct fills the fields of the struct that dst points to from the
+// request. Only fields with a `plumbus` tag are filled, and the tag names
+// where the field comes from:
+//
+//	UserId    string  `plumbus:"path=userId"`
+//	Limit     *int    `plumbus:"query=limit"`
+//	RequestId string  `plumbus:"header=X-Request-Id"`
+//	Session   string  `plumbus:"cookie=session"`
+//	User      *User   `plumbus:"body"`
+//	Page      int     `plumbus:"query=page,default=1"`
+//
+// Like query param types, pointer fields are optional and others are
+// required, unless the tag gives a default. Body fields are decoded as
+// json. A bad tag, or a field of a type a param can't be set to, makes
+// registering a handler taking the struct panic.
+func BindStruct(req *http.Request, dst interface{}) error {
+	val := reflect.ValueOf(dst).Elem()
+	fields, err := bindFields(val.Type())
+	if err != nil {
+		return err
+	}
+
+	var query map[string][]string
+	var errs ValidationErrors
+	for _, bound := range fields {
+		tag, field := bound.tag, val.Field(bound.index)
+		if tag.source == "body" {
+			err := bindBody(req, field)
+			if errs, err = CollectErrors(errs, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var values []string
+		switch tag.source {
+		case "path":
+			values = PathParams(req)[tag.name]
+		case "query":
+			if query == nil {
+				query = req.URL.Query()
+			}
+			values = query[tag.name]
+		case "header":
+			values = req.Header.Values(tag.name)
+		case "cookie":
+			if cookie, err := req.Cookie(tag.name); err == nil {
+				values = []string{cookie.Value}
+			}
+		}
+
+		if len(values) == 0 && tag.hasDefault {
+			values = []string{tag.def}
+		}
+
+		err := bindParam(field, tag.source, tag.name, values)
+		if errs, err = CollectErrors(errs, err); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+type bindTag struct {
+	source     string
+	name       string
+	def        string
+	hasDefault bool
+}
+
+// parseBindTag splits a tag like "query=limit,default=50" into its source,
+// name, and default, reporting whether the field is bound at all
+func parseBindTag(tag string) (bindTag, bool, error) {
+	if tag == "" || tag == "-" {
+		return bindTag{}, false, nil
+	}
+	if tag == "body" {
+		return bindTag{source: "body"}, true, nil
+	}
+
+	options := strings.Split(tag, ",")
+	parts := strings.SplitN(options[0], "=", 2)
+	if len(parts) != 2 {
+		return bindTag{}, false, fmt.Errorf("bad plumbus tag %q, expected source=name", tag)
+	}
+
+	switch parts[0] {
+	case "path", "query", "header", "cookie":
+	default:
+		return bindTag{}, false, fmt.Errorf("bad plumbus tag %q, unknown source %s", tag, parts[0])
+	}
+
+	result := bindTag{source: parts[0], name: parts[1]}
+	for _, option := range options[1:] {
+		if !strings.HasPrefix(option, "default=") {
+			return bindTag{}, false, fmt.Errorf("bad plumbus tag %q, unknown option %s", tag, option)
+		}
+		result.def = strings.TrimPrefix(option, "default=")
+		result.hasDefault = true
+	}
+
+	return result, true, nil
+}
+
+// boundField is a field of a struct filled by BindStruct
+type boundField struct {
+	index int
+	tag   bindTag
+}
+
+type bindPlan struct {
+	fields []boundField
+	err    error
+}
+
+// bindPlans keeps the bound fields of each struct type, so the tags are
+// only parsed once
+var bindPlans struct {
+	sync.RWMutex
+	byType map[reflect.Type]*bindPlan
+}
+
+// bindFields lists the fields of a struct filled by BindStruct, checking
+// their tags, that the fields bound to params are of types a param can
+// be set to, and the validate tags of the body
+func bindFields(typ reflect.Type) ([]boundField, error) {
+	bindPlans.RLock()
+	plan, ok := bindPlans.byType[typ]
+	bindPlans.RUnlock()
+	if ok {
+		return plan.fields, plan.err
+	}
+
+	plan = &bindPlan{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok, err := parseBindTag(field.Tag.Get("plumbus"))
+		if err == nil && ok && tag.source != "body" {
+			err = checkParamType(reflectElem(field.Type))
+		}
+		if err == nil && ok && tag.source == "body" {
+			err = checkValidateTags(field.Type)
+		}
+		if err != nil {
+			plan = &bindPlan{err: fmt.Errorf("field %s of %s: %v", field.Name, typ, err)}
+			break
+		}
+		if ok {
+			plan.fields = append(plan.fields, boundField{index: i, tag: tag})
+		}
+	}
+
+	bindPlans.Lock()
+	if bindPlans.byType == nil {
+		bindPlans.byType = map[reflect.Type]*bindPlan{}
+	}
+	bindPlans.byType[typ] = plan
+	bindPlans.Unlock()
+	return plan.fields, plan.err
+}
+
+// checkInputs checks the tags of the structs a handler binds or takes
+// as its body and the types of its params, so that a mistake in them is
+// found when the handler is registered rather than while serving a
+// request
+func checkInputs(info *generate.Info) error {
+	for _, input := range info.Inputs {
+		switch input.ConversionType {
+		case generate.ConvertStruct:
+			if _, err := bindFields(reflectElem(input.Type)); err != nil {
+				return err
+			}
+		case generate.ConvertRegisteredParam:
+			if err := checkParamType(reflectElem(input.Type)); err != nil {
+				return err
+			}
+		case generate.ConvertBody:
+			if err := checkValidateTags(input.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkParamType checks that setParam can set a param of the type
+func checkParamType(typ reflect.Type) error {
+	if isTimeType(typ) {
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return nil
+	}
+	_, err := paramKind(typ)
+	return err
+}
+
+func bindBody(req *http.Request, field reflect.Value) error {
+	err := decodeBody(req, field.Addr().Interface())
+	if err == io.EOF && field.Kind() == reflect.Ptr {
+		return nil
+	}
+	if err == io.EOF {
+		return Error(http.StatusBadRequest, "missing request body")
+	}
+	if err != nil {
+		return err
+	}
+	return ValidateStruct(field.Addr().Interface())
+}
+
+func bindParam(field reflect.Value, source, name string, values []string) error {
+	if len(values) == 0 {
+		if isDefaulter(field.Type()) {
+			if field.Kind() == reflect.Ptr {
+				field.Set(reflect.New(field.Type().Elem()))
+				field = field.Elem()
+			}
+			SetParamDefault(field.Addr().Interface())
+			return nil
+		}
+		if field.Kind() == reflect.Ptr {
+			return nil
+		}
+		return ParamError(source, name, "is required")
+	}
+
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	if err := CheckEnum(values[0], field.Interface()); err != nil {
+		return ParamError(source, name, err.Error())
+	}
+
+	if err := setParam(field, values[0]); err != nil {
+		return ParamError(source, name, err.Error())
+	}
+
+	return nil
+}
+
+// SetParam converts value to the type that dst points to
+func SetParam(dst interface{}, value string) error {
+	return setParam(reflect.ValueOf(dst).Elem(), value)
+}
+
+var defaulterType = reflect.TypeOf((*Defaulter)(nil)).Elem()
+
+// isDefaulter checks whether a param type, or the type it points to, has
+// a Default() method
+func isDefaulter(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Implements(defaulterType)
+}
+
+// SetParamDefault sets the param that dst points to to the value of its
+// Default() method, which must be convertible to the param's type
+func SetParamDefault(dst interface{}) {
+	val := reflect.ValueOf(dst).Elem()
+	def := val.Interface().(Defaulter).Default()
+	val.Set(reflect.ValueOf(def).Convert(val.Type()))
+}
+
+// CheckEnum checks that value is one of the values allowed by the param,
+// if the param's type has an Enum() method
+func CheckEnum(value string, param interface{}) error {
+	enumer, ok := param.(Enumer)
+	if !ok {
+		return nil
+	}
+
+	allowed := enumer.Enum()
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected to be one of %s", strings.Join(allowed, ", "))
+}
+
+var paramKinds struct {
+	sync.RWMutex
+	registered map[reflect.Type]func(string) (interface{}, error)
+
+	// byParamType keeps the func found for each param type
+	byParamType map[reflect.Type]func(string) (interface{}, error)
+}
+
+// RegisterParamKind lets params of types other than strings, numbers,
+// bools, and times be parsed with the given func, as in:
+//
+//	plumbus.RegisterParamKind(reflect.TypeOf(uuid.UUID{}), func(s string) (interface{}, error) {
+//		return uuid.Parse(s)
+//	})
+//
+// A param type defined from the registered type, like
+// `type userIdPathParam uuid.UUID`, is parsed the same way. Kinds are
+// registered before the handlers taking them.
+func RegisterParamKind(typ reflect.Type, parse func(string) (interface{}, error)) {
+	paramKinds.Lock()
+	if paramKinds.registered == nil {
+		paramKinds.registered = map[reflect.Type]func(string) (interface{}, error){}
+	}
+	paramKinds.registered[typ] = parse
+	paramKinds.byParamType = nil
+	paramKinds.Unlock()
+
+	// a struct checked before may bind a param of the type
+	bindPlans.Lock()
+	bindPlans.byType = nil
+	bindPlans.Unlock()
+}
+
+// paramKind finds the func registered to parse params of the type: the
+// one registered for the type itself, or else for the one type it's
+// defined from. It's found once for each type, when the handlers taking
+// it are registered.
+func paramKind(typ reflect.Type) (func(string) (interface{}, error), error) {
+	paramKinds.RLock()
+	parse, ok := paramKinds.byParamType[typ]
+	paramKinds.RUnlock()
+	if ok {
+		return parse, nil
+	}
+
+	paramKinds.Lock()
+	defer paramKinds.Unlock()
+	parse, ok = paramKinds.registered[typ]
+	if !ok {
+		// a type defined from another has the same underlying type, so
+		// it's convertible to that type and to no other of its kind
+		var matches []string
+		for registered, p := range paramKinds.registered {
+			if typ.Kind() == registered.Kind() && typ.ConvertibleTo(registered) {
+				parse = p
+				matches = append(matches, registered.String())
+			}
+		}
+		switch {
+		case len(matches) == 0:
+			return nil, fmt.Errorf("can't bind a parameter to a field of type %s, use plumbus.RegisterParamKind", typ)
+		case len(matches) > 1:
+			sort.Strings(matches)
+			return nil, fmt.Errorf("can't tell which kind a parameter of type %s is, it could be any of %s", typ, strings.Join(matches, ", "))
+		}
+	}
+
+	if paramKinds.byParamType == nil {
+		paramKinds.byParamType = map[reflect.Type]func(string) (interface{}, error){}
+	}
+	paramKinds.byParamType[typ] = parse
+	return parse, nil
+}
+
+// setParam converts the string to the kind of the field and sets it
+func setParam(field reflect.Value, value string) error {
+	if isTimeType(field.Type()) {
+		t, err := ParseTimeParam(value, field.Interface())
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t).Convert(field.Type()))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected to be integer value")
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected to be unsigned integer value")
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected to be number value")
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected to be boolean value")
+		}
+		field.SetBool(b)
+	default:
+		parse, err := paramKind(field.Type())
+		if err != nil {
+			// the handlers' param types are checked when they're registered
+			panic(err)
+		}
+		parsed, err := parse(value)
+		if err != nil {
+			return fmt.Errorf("couldn't be parsed: %s", err.Error())
+		}
+		v := reflect.ValueOf(parsed)
+		if !v.IsValid() || !v.Type().ConvertibleTo(field.Type()) {
+			// the parse func returned nothing, or a value of another
+			// type, without an error
+			return fmt.Errorf("couldn't be parsed")
+		}
+		field.Set(v.Convert(field.Type()))
+	}
+	return nil
+}
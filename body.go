@@ -0,0 +1,337 @@
+package plumbus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+// DecoderFunc decodes a request body into the value that dst points to
+type DecoderFunc func(body io.Reader, dst interface{}) error
+
+var decoders = struct {
+	sync.RWMutex
+	byMediaType map[string]DecoderFunc
+}{
+	byMediaType: map[string]DecoderFunc{
+		"application/json": func(body io.Reader, dst interface{}) error {
+			return json.NewDecoder(body).Decode(dst)
+		},
+	},
+}
+
+// RegisterDecoder sets how request bodies of the media type are decoded,
+// as in:
+//
+//	plumbus.RegisterDecoder("application/xml", func(body io.Reader, dst interface{}) error {
+//		return xml.NewDecoder(body).Decode(dst)
+//	})
+//
+// Decoders can be registered at any time, even while requests are being
+// served.
+func RegisterDecoder(mediaType string, decoder DecoderFunc) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	decoders.byMediaType[mediaType] = decoder
+}
+
+// DecodeBody decodes the request body into the value that dst points to,
+// using the decoder registered for its Content-Type. Form posts
+// (including multipart forms) are decoded from their fields, media types
+// ending in +json as json, and any other content type is a 415.
+func DecodeBody(req *http.Request, dst interface{}) error {
+	err := decodeBody(req, dst)
+	if err == io.EOF {
+		return Error(http.StatusBadRequest, "missing request body")
+	}
+	return err
+}
+
+// ReadBody reads the whole request body
+func ReadBody(req *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, bodyError(err, "reading body")
+	}
+	return body, nil
+}
+
+// bodyError turns an error reading the body into a 413 if the body was
+// over the limit set by MaxBodyBytes, or a 400 otherwise
+func bodyError(err error, doing string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Errorf(
+			http.StatusRequestEntityTooLarge,
+			"request body larger than %d bytes",
+			tooLarge.Limit,
+		)
+	}
+	return Errorf(http.StatusBadRequest, "%s: %s", doing, err.Error())
+}
+
+// MaxBodyBytes is middleware that limits request bodies to n bytes, as
+// in mux.Use(plumbus.MaxBodyBytes(1 << 20)). Requests with larger bodies
+// get a 413 response.
+func MaxBodyBytes(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > n {
+				HandleResponseError(res, req, Errorf(
+					http.StatusRequestEntityTooLarge,
+					"request body larger than %d bytes",
+					n,
+				))
+				return
+			}
+			req.Body = http.MaxBytesReader(res, req.Body, n)
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// decodeBody is DecodeBody without turning an empty body (io.EOF) into an
+// error, so that callers can tell it apart
+func decodeBody(req *http.Request, dst interface{}) error {
+	mt := mediaType(req)
+	if !bodyTypeAllowed(req, mt) {
+		return unsupportedMediaType(req)
+	}
+
+	switch mt {
+	case "application/x-www-form-urlencoded":
+		if err := req.ParseForm(); err != nil {
+			return bodyError(err, "decoding form")
+		}
+		return decodeForm(req.PostForm, dst)
+	case "multipart/form-data":
+		if err := parseMultipartForm(req); err != nil {
+			return err
+		}
+		return decodeForm(req.PostForm, dst)
+	}
+
+	decoders.RLock()
+	decoder, ok := decoders.byMediaType[mt]
+	if !ok && strings.HasSuffix(mt, "+json") {
+		decoder, ok = decoders.byMediaType["application/json"]
+	}
+	decoders.RUnlock()
+	if !ok {
+		return unsupportedMediaType(req)
+	}
+
+	err := decoder(req.Body, dst)
+	if err != nil && err != io.EOF {
+		return bodyError(err, "decoding "+mt)
+	}
+	return err
+}
+
+func unsupportedMediaType(req *http.Request) error {
+	return Errorf(
+		http.StatusUnsupportedMediaType,
+		"unsupported content type %q",
+		req.Header.Get("Content-Type"),
+	)
+}
+
+// mediaType is the request's Content-Type without any parameters. A
+// request without a Content-Type is taken to be json.
+func mediaType(req *http.Request) string {
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		return "application/json"
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
+
+// bodyTypeAllowed checks the media type against the mux's allow-list set
+// by SetBodyContentTypes
+func bodyTypeAllowed(req *http.Request, mt string) bool {
+	sm := muxFromRequest(req)
+	if sm == nil || sm.bodyContentTypes == nil {
+		return true
+	}
+	for _, allowed := range sm.bodyContentTypes {
+		if mt == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeForm fills the fields of the struct that dst points to from form
+// values. A field is named by its `form` tag, or else like it is in json.
+// Missing fields are left alone, and slice fields take every value.
+func decodeForm(form url.Values, dst interface{}) error {
+	val := reflect.ValueOf(dst).Elem()
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return Errorf(
+			http.StatusUnsupportedMediaType,
+			"can't decode a form into %s",
+			val.Type(),
+		)
+	}
+
+	var errs ValidationErrors
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := formName(field)
+		values := form[name]
+		if name == "" || len(values) == 0 {
+			continue
+		}
+
+		if err := setFormField(val.Field(i), values); err != nil {
+			errs = append(errs, FieldError{Field: name, In: "form", Message: err.Error()})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func formName(field reflect.StructField) string {
+	if name, ok := field.Tag.Lookup("form"); ok {
+		name = strings.Split(name, ",")[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	}
+	if strings.Split(field.Tag.Get("json"), ",")[0] == "-" {
+		return ""
+	}
+	return generate.FieldName(field)
+}
+
+func setFormField(field reflect.Value, values []string) error {
+	// a body field may be of any type, but a form value can only be set
+	// to the types a param can be
+	typ := field.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if checkParamType(typ) != nil {
+		return fmt.Errorf("can't be set from a form")
+	}
+
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	if field.Kind() != reflect.Slice {
+		return setParam(field, values[0])
+	}
+
+	slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i, value := range values {
+		if err := setParam(slice.Index(i), value); err != nil {
+			return fmt.Errorf("value %d %s", i, err.Error())
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
+const defaultMultipartMemory = 32 << 20
+
+func parseMultipartForm(req *http.Request) error {
+	if req.MultipartForm != nil {
+		return nil
+	}
+
+	memory := int64(defaultMultipartMemory)
+	if sm := muxFromRequest(req); sm != nil && sm.multipartMemory > 0 {
+		memory = sm.multipartMemory
+	}
+
+	if err := req.ParseMultipartForm(memory); err != nil {
+		return bodyError(err, "decoding multipart form")
+	}
+	return nil
+}
+
+// FormFile opens the file uploaded in the named field of a multipart
+// form, or the only file uploaded if name is "". A missing file gives nil,
+// unless it's required.
+func FormFile(req *http.Request, name string, required bool) (*File, error) {
+	field := name
+	if field == "" {
+		field = "file"
+	}
+
+	if mediaType(req) != "multipart/form-data" {
+		if !required {
+			return nil, nil
+		}
+		return nil, ParamError("form", field, "is required, as a multipart form upload")
+	}
+
+	if err := parseMultipartForm(req); err != nil {
+		return nil, err
+	}
+
+	var headers []*multipart.FileHeader
+	if name != "" {
+		headers = req.MultipartForm.File[name]
+	} else if len(req.MultipartForm.File) > 1 {
+		return nil, Error(http.StatusBadRequest, "expected only one file to be uploaded")
+	} else {
+		for _, h := range req.MultipartForm.File {
+			headers = h
+		}
+	}
+
+	if len(headers) == 0 {
+		if !required {
+			return nil, nil
+		}
+		return nil, ParamError("form", field, "is required")
+	}
+
+	header := headers[0]
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Name:        header.Filename,
+		Size:        header.Size,
+		ContentType: header.Header.Get("Content-Type"),
+		ReadCloser:  f,
+	}, nil
+}
@@ -0,0 +1,249 @@
+package plumbus
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+// clientRoute is a route as called by a generated client
+type clientRoute struct {
+	handler     interface{}
+	name        string
+	method      string
+	pattern     string
+	summary     string
+	description string
+	deprecated  bool
+
+	// params has the path params first, in the order of the pattern
+	params []*clientParam
+
+	body          reflect.Type
+	bodyKind      clientKind
+	bodyRequired  bool
+	bodyMediaType string
+	fileField     string
+
+	result     reflect.Type
+	resultKind clientKind
+}
+
+// clientKind is how a body or result is sent
+type clientKind int
+
+const (
+	clientNone clientKind = iota
+	clientJSON
+	clientText
+	clientRaw
+	clientFile
+)
+
+type clientParam struct {
+	name     string
+	in       string
+	typ      reflect.Type
+	required bool
+	catchAll bool
+}
+
+// clientRoutes lists the routes a client can call, sorted by pattern and
+// method. Routes served by websockets or streams, and routes whose
+// handler isn't a function, are left out.
+func (sm *ServeMux) clientRoutes() []*clientRoute {
+	nodes := sm.Paths.flatten()
+	patterns := make([]string, 0, len(nodes))
+	for pattern := range nodes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var routes []*clientRoute
+	names := map[string]bool{}
+	for _, pattern := range patterns {
+		node := nodes[pattern]
+		for _, info := range routeInfos(pattern, node) {
+			handler := methodOrHandler(node.originalHandler, info.Method)
+			route := clientRouteFor(pattern, info.Method, handler, node)
+			if route == nil {
+				continue
+			}
+
+			name := route.name
+			for i := 2; names[route.name]; i++ {
+				route.name = name + strconv.Itoa(i)
+			}
+			names[route.name] = true
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func clientRouteFor(pattern, method string, handler interface{}, node *Paths) *clientRoute {
+	typ := reflect.TypeOf(handler)
+	if typ == nil || typ.Kind() != reflect.Func || !adapted(handler) {
+		return nil
+	}
+	info, err := generate.CollectInfo(typ)
+	if err != nil || info.WebSocketIndex != -1 {
+		return nil
+	}
+
+	meta := node.metadataFor(method)
+	route := &clientRoute{
+		handler:     handler,
+		pattern:     pattern,
+		summary:     meta.summary,
+		description: cleanupText(strings.Join(node.documentation, "\n")),
+		deprecated:  meta.deprecated,
+	}
+
+	params := map[string]*clientParam{}
+	var others []*clientParam
+	addParam := func(param *clientParam) {
+		if param.in == "path" {
+			params[param.name] = param
+		} else {
+			others = append(others, param)
+		}
+	}
+
+	for _, input := range info.Inputs {
+		switch input.ConversionType {
+		case generate.ConvertBody:
+			route.body, route.bodyKind, route.bodyRequired = input.Type, clientJSON, !input.IsPointer
+		case generate.ConvertRawBody, generate.ConvertBodyReader:
+			route.body, route.bodyKind, route.bodyRequired = input.Type, clientRaw, true
+		case generate.ConvertFile:
+			route.bodyKind, route.bodyRequired = clientFile, !input.IsPointer
+			route.fileField = input.Name
+			if route.fileField == "" {
+				route.fileField = "file"
+			}
+		case generate.ConvertStruct:
+			structType := reflectElem(input.Type)
+			for i := 0; i < structType.NumField(); i++ {
+				field := structType.Field(i)
+				tag, ok, err := parseBindTag(field.Tag.Get("plumbus"))
+				if !ok || err != nil {
+					continue
+				}
+				if tag.source == "body" {
+					route.body, route.bodyKind, route.bodyRequired = field.Type, clientJSON, field.Type.Kind() != reflect.Ptr
+					continue
+				}
+				addParam(&clientParam{
+					name:     tag.name,
+					in:       tag.source,
+					typ:      reflectElem(field.Type),
+					required: tag.source == "path" || (field.Type.Kind() != reflect.Ptr && !tag.hasDefault),
+				})
+			}
+		case generate.ConvertPlugin:
+			doc := input.PluginDoc()
+			for _, param := range doc.Params {
+				addParam(&clientParam{
+					name:     param.Name,
+					in:       param.Source.String(),
+					typ:      pluginParamType(param),
+					required: param.Required || param.Source == generate.SourcePath,
+				})
+			}
+			if doc.BodyMediaType != "" {
+				route.bodyKind, route.bodyRequired, route.bodyMediaType = clientRaw, !input.IsPointer, doc.BodyMediaType
+			}
+		case generate.ConvertIntParam, generate.ConvertStringParam, generate.ConvertUintParam,
+			generate.ConvertFloatParam, generate.ConvertBoolParam, generate.ConvertTimeParam,
+			generate.ConvertRegisteredParam:
+			addParam(&clientParam{
+				name:     input.Name,
+				in:       input.Source.String(),
+				typ:      reflectElem(input.Type),
+				required: input.Source == generate.SourcePath || (input.Type.Kind() != reflect.Ptr && !input.HasDefault),
+			})
+		}
+	}
+
+	for _, segment := range getSegments(pattern) {
+		var name string
+		catchAll := false
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name, _ = parseVariable(segment[1:])
+		case strings.HasPrefix(segment, "*"):
+			name, catchAll = segment[1:], true
+		default:
+			continue
+		}
+		param, ok := params[name]
+		if !ok {
+			param = &clientParam{name: name, in: "path", typ: reflect.TypeOf("")}
+		}
+		param.required, param.catchAll = true, catchAll
+		route.params = append(route.params, param)
+	}
+	route.params = append(route.params, others...)
+
+	for _, output := range info.Outputs {
+		elem := reflectElem(output.Type)
+		switch {
+		case elem == reflect.TypeOf(Text("")):
+			route.resultKind = clientText
+		case output.ConversionType != generate.ConvertBody:
+		case output.Type.Kind() == reflect.Chan, elem == openAPICreatedType:
+			// streamed, or of a type only known when it's sent
+		case elem == openAPIFileType, elem == openAPIRenderType, output.Type.Implements(openAPIReaderType):
+			route.resultKind = clientRaw
+		case output.Type == reflect.TypeOf(""):
+			route.resultKind = clientText
+		default:
+			route.result, route.resultKind = output.Type, clientJSON
+		}
+	}
+
+	route.method = method
+	if method == "" {
+		route.method = "GET"
+		if route.bodyKind != clientNone {
+			route.method = "POST"
+		}
+	}
+
+	b := &openAPIBuilder{operationIDs: map[string]bool{}}
+	route.name = b.operationID(handler)
+	if route.name == "" {
+		route.name = channelID(pattern, route.method)
+	}
+	route.name = upperFirst(identifier(route.name))
+	return route
+}
+
+// identifier makes a name like "X-Request-Id" or "user_id" into one that
+// can be used in code, like "xRequestId" or "userId"
+func identifier(name string) string {
+	var id strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			upper = id.Len() > 0
+		case upper:
+			id.WriteRune(unicode.ToUpper(r))
+			upper = false
+		case id.Len() == 0:
+			id.WriteRune(unicode.ToLower(r))
+		default:
+			id.WriteRune(r)
+		}
+	}
+	if id.Len() == 0 || unicode.IsDigit([]rune(id.String())[0]) {
+		return "p" + id.String()
+	}
+	return id.String()
+}
@@ -0,0 +1,141 @@
+package plumbus
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP is a handler argument for the address of the client making
+// the request. Requests from the proxies set with SetTrustedProxies are
+// taken to be for the client that the proxies say they're forwarding,
+// from the Forwarded, X-Forwarded-For, or X-Real-IP headers.
+type ClientIP struct {
+	netip.Addr
+}
+
+func (ip *ClientIP) FromRequest(req *http.Request) error {
+	addr := clientIP(req)
+	if !addr.IsValid() {
+		return Errorf(http.StatusBadRequest, "can't tell the client's address from %q", req.RemoteAddr)
+	}
+	ip.Addr = addr
+	return nil
+}
+
+// SetTrustedProxies sets the proxies whose forwarding headers are
+// believed when finding the ClientIP, as addresses or CIDR ranges like
+// "10.0.0.0/8". By default no proxies are trusted, and the client is
+// whoever connected.
+func (sm *ServeMux) SetTrustedProxies(proxies ...string) error {
+	prefixes, err := parsePrefixes(proxies)
+	if err != nil {
+		return err
+	}
+	sm.trustedProxies = prefixes
+	return nil
+}
+
+// parsePrefixes parses addresses and CIDR ranges, taking an address to
+// be a range of just itself
+func parsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP finds the client's address, walking back through the
+// forwarding headers from the nearest hop for as long as each hop is a
+// trusted proxy, since only the entries added by trusted proxies can be
+// believed
+func clientIP(req *http.Request) netip.Addr {
+	remote := parseHostAddr(req.RemoteAddr)
+	sm := muxFromRequest(req)
+	if sm == nil || !remote.IsValid() || !sm.trusts(remote) {
+		return remote
+	}
+
+	hops := forwardedFor(req)
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHostAddr(hops[i])
+		if !hop.IsValid() {
+			break
+		}
+		client = hop
+		if !sm.trusts(hop) {
+			break
+		}
+	}
+	return client
+}
+
+func (sm *ServeMux) trusts(addr netip.Addr) bool {
+	return prefixesContain(sm.trustedProxies, addr)
+}
+
+// forwardedFor lists the addresses the request was forwarded for, from
+// the client to the nearest proxy
+func forwardedFor(req *http.Request) []string {
+	var hops []string
+	if forwarded := req.Header.Values("Forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return hops
+	}
+
+	if xff := req.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		for _, hop := range strings.Split(strings.Join(xff, ","), ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+		return hops
+	}
+
+	if realIP := req.Header.Get("X-Real-IP"); realIP != "" {
+		return []string{strings.TrimSpace(realIP)}
+	}
+	return nil
+}
+
+// parseHostAddr parses an address that may have a port, and may be in
+// brackets if it's IPv6
+func parseHostAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
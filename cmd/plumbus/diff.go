@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jargv/plumbus"
+)
+
+// diff prints the changes between two OpenAPI documents, as in
+// `plumbus diff released.json current.json`, giving the exit code: 1 if
+// any change is breaking, or 0 otherwise
+func diff(beforePath, afterPath string) int {
+	before, after := readOpenAPI(beforePath), readOpenAPI(afterPath)
+
+	code := 0
+	for _, change := range plumbus.DiffOpenAPI(before, after) {
+		fmt.Println(change)
+		if change.Breaking {
+			code = 1
+		}
+	}
+	return code
+}
+
+func readOpenAPI(path string) *plumbus.OpenAPI {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("plumbus: reading %s: %v", path, err)
+	}
+
+	doc := &plumbus.OpenAPI{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		log.Fatalf("plumbus: decoding %s: %v", path, err)
+	}
+	return doc
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
-	"html/template"
+	"bytes"
+	"flag"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"strings"
+	"text/template"
 )
 
 type generator struct {
@@ -15,12 +18,49 @@ type generator struct {
 	Func   string
 	Type   string
 	Target string
+	Verify bool
+}
+
+// packageGenerator is the data for the program generating the adaptors
+// of whole packages
+type packageGenerator struct {
+	Packages []*handlerPackage
+	Verify   bool
+}
+
+// openAPIGenerator is the data for the program generating an OpenAPI
+// document from the routes found by scanning packages
+type openAPIGenerator struct {
+	Packages []*handlerPackage
+	Routes   []*route
+	File     string
+	Title    string
+	Version  string
+	Verify   bool
+}
+
+// testStubsGenerator is the data for the program generating tests for
+// the handlers of the routes found by scanning packages
+type testStubsGenerator struct {
+	Packages []*handlerPackage
+	Routes   []*route
 }
 
 func main() {
 	log.SetFlags(0)
-	if len(os.Args) != 2 {
-		log.Fatalf("plumbus: requires an argument to generate adapter for")
+	verify := flag.Bool("verify", false, "check that the generated files are up to date, instead of generating them")
+	openapi := flag.String("openapi", "", "generate an OpenAPI document into `file` from the routes registered in the packages, or - for stdout")
+	title := flag.String("title", "API", "the title of the OpenAPI document")
+	version := flag.String("version", "1.0", "the version of the OpenAPI document")
+	tests := flag.Bool("tests", false, "generate table-driven tests for the handlers of the routes registered in the packages, into a "+stubsFile+" next to each handler's package")
+	flag.Parse()
+	args := flag.Args()
+
+	if len(args) == 3 && args[0] == "diff" {
+		os.Exit(diff(args[1], args[2]))
+	}
+	if len(args) != 1 {
+		log.Fatalf("plumbus: requires an argument to generate adapter for, a package pattern such as ./..., or diff and two OpenAPI documents to compare")
 	}
 
 	dir, err := os.Getwd()
@@ -29,7 +69,36 @@ func main() {
 	}
 
 	var typ, f string
-	target := os.Args[1]
+	target := args[0]
+
+	if *openapi != "" {
+		if !isPackagePattern(target) {
+			log.Fatalf("plumbus: -openapi requires a package pattern such as ./...")
+		}
+		generateOpenAPI(target, openAPIGenerator{
+			File:    *openapi,
+			Title:   *title,
+			Version: *version,
+			Verify:  *verify,
+		})
+		return
+	}
+
+	if *tests {
+		if !isPackagePattern(target) {
+			log.Fatalf("plumbus: -tests requires a package pattern such as ./...")
+		}
+		if *verify {
+			log.Fatalf("plumbus: -tests can't be verified, the tests are meant to be edited")
+		}
+		generateTestStubs(target)
+		return
+	}
+
+	if isPackagePattern(target) {
+		generatePackages(target, *verify)
+		return
+	}
 
 	if parts := strings.Split(target, "."); len(parts) == 2 {
 		f = parts[1]
@@ -47,23 +116,142 @@ func main() {
 	}
 
 	g := generator{
-		Path: path.Join(dir, target+".adaptor-generated.go"),
-		Pkg:  pkg,
-		Func: f,
-		Type: typ,
+		Path:   path.Join(dir, target+".adaptor-generated.go"),
+		Pkg:    pkg,
+		Func:   f,
+		Type:   typ,
+		Verify: *verify,
 	}
 
 	g.generate()
 }
 
+// isPackagePattern reports whether the target is a package directory,
+// such as "." or "./handlers", or a pattern such as "./..." rather than
+// a function name
+func isPackagePattern(target string) bool {
+	return target == "." || target == ".." ||
+		strings.HasPrefix(target, "./") ||
+		strings.HasPrefix(target, "../") ||
+		strings.HasPrefix(target, "/")
+}
+
+// generatePackages generates one file of adaptors for each package
+// declaring the handlers registered in the packages matching pattern,
+// or checks that the files are up to date
+func generatePackages(pattern string, verify bool) {
+	packages, _, err := scan(pattern)
+	if err != nil {
+		log.Fatalf("plumbus: scanning %s: %v", pattern, err)
+	}
+	if len(packages) == 0 {
+		log.Printf("plumbus: no handlers found in %s", pattern)
+		return
+	}
+
+	for _, p := range packages {
+		p.File = path.Join(p.Dir, packageFile)
+	}
+	runGenerator(packageGeneratorTemplate, packageGenerator{packages, verify}, verify)
+}
+
+// generateOpenAPI generates an OpenAPI document for the routes registered
+// in the packages matching pattern, without running the server: a program
+// registers the same handlers on a mux of its own, at the same patterns,
+// and writes the mux's document. Only routes with constant patterns are
+// found, and the prefixes of mounted muxes aren't followed. Handlers that
+// can't be referred to, such as function literals, are documented as
+// routes without params or results.
+func generateOpenAPI(pattern string, g openAPIGenerator) {
+	packages, routes, err := scan(pattern)
+	if err != nil {
+		log.Fatalf("plumbus: scanning %s: %v", pattern, err)
+	}
+	if len(routes) == 0 {
+		log.Fatalf("plumbus: no routes found in %s", pattern)
+	}
+
+	g.Routes = uniqueRoutes(routes)
+	if g.File != "-" {
+		if g.File, err = filepath.Abs(g.File); err != nil {
+			log.Fatalf("plumbus: %v", err)
+		}
+	}
+	g.Packages = packages
+	runGenerator(openAPIGeneratorTemplate, g, g.Verify)
+}
+
+// generateTestStubs generates a file of table-driven tests for each
+// package declaring the handlers of the routes registered in the packages
+// matching pattern, leaving any file that's already there alone. Like
+// generateOpenAPI, a program registers the handlers on a mux of its own,
+// which makes the tests.
+func generateTestStubs(pattern string) {
+	packages, routes, err := scan(pattern)
+	if err != nil {
+		log.Fatalf("plumbus: scanning %s: %v", pattern, err)
+	}
+
+	g := testStubsGenerator{Packages: packages}
+	for _, r := range uniqueRoutes(routes) {
+		if r.Handler != "" {
+			g.Routes = append(g.Routes, r)
+		}
+	}
+	if len(g.Routes) == 0 {
+		log.Fatalf("plumbus: no routes with handlers to test found in %s", pattern)
+	}
+
+	for _, p := range packages {
+		p.File = path.Join(p.Dir, stubsFile)
+	}
+	runGenerator(testStubsGeneratorTemplate, g, false)
+}
+
+// uniqueRoutes drops the routes registered at the pattern and method of
+// an earlier route. They may be registered on several muxes, but only
+// once on a generator's mux.
+func uniqueRoutes(routes []*route) []*route {
+	var unique []*route
+	seen := map[string]bool{}
+	for _, r := range routes {
+		key := r.Register + " " + r.Pattern
+		if r.Register == "Handle" {
+			key = r.Pattern
+		}
+		if seen[key] {
+			log.Printf("plumbus: skipping %s %s, it's already registered", r.Register, r.Pattern)
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, r)
+	}
+	return unique
+}
+
+// stubsFile is the file the tests of a package's handlers are generated
+// into by -tests
+const stubsFile = "plumbus.stubs_test.go"
+
+// packageFile is the file the adaptors of a package's handlers are
+// generated into by package mode
+const packageFile = "plumbus.adaptor-generated.go"
+
 func (g *generator) generate() {
+	runGenerator(generatorTemplate, g, g.Verify)
+}
+
+// runGenerator writes a program from the template that imports the
+// handlers and generates or verifies their adaptors, and runs it
+func runGenerator(tmpl *template.Template, data interface{}, verify bool) {
 	path := path.Join(os.TempDir(), "plumbus-generator.go")
 	file, err := os.Create(path)
 	if err != nil {
 		log.Fatalf("creating file: %v", err)
 	}
 
-	err = generatorTemplate.Execute(file, g)
+	err = tmpl.Execute(file, data)
+	file.Close()
 	if err != nil {
 		log.Fatalf("failure: %v", err)
 	}
@@ -76,10 +264,17 @@ func (g *generator) generate() {
 	}
 
 	cmd = exec.Command("go", "run", path)
-	out, err = cmd.CombinedOutput()
+	cmd.Stdout = os.Stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil && verify {
+		log.Fatalf("%s", stderr.Bytes())
+	}
 	if err != nil {
-		log.Fatalf("running go generate: %s", string(out))
+		log.Fatalf("running go generate: %s", stderr.String())
 	}
+	os.Stderr.Write(stderr.Bytes())
 }
 
 var generatorTemplate = template.Must(
@@ -105,6 +300,15 @@ var templateString string = `
 		{{else}}
 			f := {{.Pkg}}.{{.Func}}
 		{{end}}
+
+		if verify := {{.Verify}}; verify {
+			if err := generate.VerifyAdaptor(f, "{{.Path}}", "{{.Pkg}}"); err != nil {
+				log.Printf("plumbus: %s", err)
+				os.Exit(1)
+			}
+			return
+		}
+
 		err := generate.Adaptor(f, "{{.Path}}", "{{.Pkg}}")
 		if err != nil {
 			log.Printf("couldn't generate: %s", err)
@@ -119,3 +323,170 @@ var templateString string = `
 		}
 	}
 `
+
+var packageGeneratorTemplate = template.Must(
+	template.New("packageGenerator").
+		Option("missingkey=error").
+		Parse(packageTemplateString),
+)
+
+var packageTemplateString string = `
+	package main
+
+	import (
+		"github.com/jargv/plumbus/generate"
+		"os"
+		"os/exec"
+		"log"
+		{{range .Packages}}
+			{{.Alias}} "{{.Path}}"
+		{{end}}
+	)
+
+	func main(){
+		verify := {{.Verify}}
+		stale := false
+		{{range .Packages}}{
+			handlers := []interface{}{
+				{{range .Handlers}}
+					{{.}},
+				{{end}}
+			}
+
+			if verify {
+				if err := generate.VerifyAdaptors(handlers, "{{.File}}", "{{.Name}}"); err != nil {
+					log.Printf("plumbus: %s", err)
+					stale = true
+				}
+			} else {
+				err := generate.Adaptors(handlers, "{{.File}}", "{{.Name}}")
+				if err != nil {
+					log.Printf("couldn't generate: %s", err)
+					os.Exit(1)
+				}
+
+				cmd := exec.Command("goimports", "-w", "{{.File}}")
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					log.Printf(string(out))
+					panic(err)
+				}
+			}
+		}{{end}}
+
+		if stale {
+			os.Exit(1)
+		}
+	}
+`
+
+var openAPIGeneratorTemplate = template.Must(
+	template.Must(
+		template.New("openAPIGenerator").
+			Option("missingkey=error").
+			Parse(openAPITemplateString),
+	).Parse(routesTemplateString),
+)
+
+// routesTemplateString registers the routes found by scan on mux
+var routesTemplateString string = `
+	{{define "routes"}}
+		// the handlers are registered only to be described, so the
+		// warnings about their adaptors don't matter
+		log.SetOutput(io.Discard)
+		mux := plumbus.NewServeMux()
+		{{range .}}
+			mux.{{.Register}}({{.Pattern}}, {{or .Handler "undocumented"}}{{range .Docs}}, {{.}}{{end}}){{range .Calls}}.{{.}}{{end}}
+		{{end}}
+		log.SetOutput(os.Stderr)
+	{{end}}
+`
+
+var openAPITemplateString string = `
+	package main
+
+	import (
+		"bytes"
+		"encoding/json"
+		"github.com/jargv/plumbus"
+		"io"
+		"log"
+		"net/http"
+		"os"
+		{{range .Packages}}
+			{{.Alias}} "{{.Path}}"
+		{{end}}
+	)
+
+	// undocumented stands in for the handlers that can't be referred to
+	var undocumented = http.NotFoundHandler()
+
+	func main(){
+		{{template "routes" .Routes}}
+
+		doc := mux.OpenAPI(plumbus.OpenAPIInfo{Title: {{printf "%q" .Title}}, Version: {{printf "%q" .Version}}})
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			log.Fatalf("plumbus: %s", err)
+		}
+		data = append(data, '\n')
+
+		file := {{printf "%q" .File}}
+		switch {
+		case file == "-":
+			os.Stdout.Write(data)
+		case {{.Verify}}:
+			current, err := os.ReadFile(file)
+			if err != nil || !bytes.Equal(current, data) {
+				log.Printf("plumbus: %s is out of date, run plumbus -openapi to regenerate it", file)
+				os.Exit(1)
+			}
+		default:
+			if err := os.WriteFile(file, data, 0644); err != nil {
+				log.Fatalf("plumbus: %s", err)
+			}
+		}
+	}
+`
+
+var testStubsGeneratorTemplate = template.Must(
+	template.Must(
+		template.New("testStubsGenerator").
+			Option("missingkey=error").
+			Parse(testStubsTemplateString),
+	).Parse(routesTemplateString),
+)
+
+var testStubsTemplateString string = `
+	package main
+
+	import (
+		"github.com/jargv/plumbus"
+		"io"
+		"log"
+		"os"
+		{{range .Packages}}
+			{{.Alias}} "{{.Path}}"
+		{{end}}
+	)
+
+	func main(){
+		{{template "routes" .Routes}}
+
+		{{range .Packages}}{
+			src, err := mux.TestStubs(plumbus.TestStubsConfig{Package: "{{.Path}}", Name: "{{.Name}}"})
+			if err != nil {
+				log.Printf("couldn't generate: %s", err)
+				os.Exit(1)
+			}
+			if _, err := os.Stat("{{.File}}"); src != nil && err == nil {
+				log.Printf("plumbus: skipping {{.File}}, it already exists")
+			} else if src != nil {
+				if err := os.WriteFile("{{.File}}", src, 0644); err != nil {
+					log.Printf("couldn't generate: %s", err)
+					os.Exit(1)
+				}
+			}
+		}{{end}}
+	}
+`
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const plumbusPath = "github.com/jargv/plumbus"
+
+// handlerCalls are the plumbus functions and methods whose interface{}
+// arguments are handlers
+var handlerCalls = map[string]bool{
+	"Handle":           true,
+	"HandleWith":       true,
+	"GET":              true,
+	"POST":             true,
+	"PUT":              true,
+	"PATCH":            true,
+	"DELETE":           true,
+	"NotFound":         true,
+	"MethodNotAllowed": true,
+	"HandlerFunc":      true,
+}
+
+// handlerPackage is a package declaring handlers found by scan, which
+// get their adaptors generated into one file in Dir
+type handlerPackage struct {
+	Path  string
+	Name  string
+	Dir   string
+	File  string
+	Alias string
+
+	// Handlers are expressions for the handlers in the generator program,
+	// where the package is imported as Alias
+	Handlers []string
+	seen     map[string]bool
+}
+
+// route is a route registered with a constant pattern in the scanned
+// packages, as in mux.GET("/users/:userId", getUser).Summary("Get a user")
+type route struct {
+	// Register is the method of the mux registering the route, such as
+	// Handle or GET
+	Register string
+	Pattern  string
+
+	// Handler is the code for the handler in the generator program, or
+	// "" if it can't be referred to, such as a function literal
+	Handler string
+
+	// Docs are the quoted documentation strings given with the handler,
+	// and Calls are the calls of the Route's methods chained onto the
+	// registration, like `Summary("Get a user")`, whose arguments are
+	// all constants
+	Docs  []string
+	Calls []string
+}
+
+type scanner struct {
+	fset     *token.FileSet
+	importer types.Importer
+	packages map[string]*handlerPackage
+	routes   []*route
+
+	// chained maps a call to the call of a method on its result
+	chained map[*ast.CallExpr]*ast.CallExpr
+}
+
+// scan finds the handlers given to mux.Handle, plumbus.HandlerFunc, and
+// the like, and in plumbus.ByMethod values, along with the routes
+// registered on muxes, in the packages matching pattern: a directory, or
+// a directory followed by "/..." for it and every directory below it.
+func scan(pattern string) ([]*handlerPackage, []*route, error) {
+	dirs, err := packageDirs(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := &scanner{
+		fset:     token.NewFileSet(),
+		packages: map[string]*handlerPackage{},
+		chained:  map[*ast.CallExpr]*ast.CallExpr{},
+	}
+	s.importer = importer.ForCompiler(s.fset, "source", nil)
+
+	for _, dir := range dirs {
+		if err := s.scanDir(dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	packages := make([]*handlerPackage, 0, len(s.packages))
+	for _, p := range s.packages {
+		packages = append(packages, p)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Path < packages[j].Path
+	})
+	aliases := make([]string, 0, 2*len(packages))
+	for i, p := range packages {
+		p.Alias = fmt.Sprintf("p%d", i)
+		aliases = append(aliases, pkgPlaceholder(p.Path), p.Alias+".")
+	}
+	replacer := strings.NewReplacer(aliases...)
+	for _, p := range packages {
+		for j, handler := range p.Handlers {
+			p.Handlers[j] = replacer.Replace(handler)
+		}
+	}
+	for _, r := range s.routes {
+		r.Handler = replacer.Replace(r.Handler)
+	}
+	return packages, s.routes, nil
+}
+
+// pkgPlaceholder stands for the alias of a package in the code for a
+// handler, until the aliases are chosen
+func pkgPlaceholder(path string) string {
+	return "PKG<" + path + ">."
+}
+
+func packageDirs(pattern string) ([]string, error) {
+	root := strings.TrimSuffix(pattern, "...")
+	if root == pattern {
+		return []string{pattern}, nil
+	}
+	if root == "" {
+		root = "."
+	}
+
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		name := info.Name()
+		if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs, err
+}
+
+func (s *scanner) scanDir(dir string) error {
+	// a relative directory would be imported as "."
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	bp, err := build.ImportDir(dir, 0)
+	if _, ok := err.(*build.NoGoError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		file, err := parser.ParseFile(s.fset, filepath.Join(bp.Dir, name), nil, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	conf := types.Config{
+		Importer: s.importer,
+		// the handlers can still be found in a package with type errors
+		Error: func(error) {},
+	}
+	conf.Check(bp.ImportPath, s.fset, files, info)
+
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				if sel, ok := unparen(call.Fun).(*ast.SelectorExpr); ok {
+					if inner, ok := unparen(sel.X).(*ast.CallExpr); ok {
+						s.chained[inner] = call
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				s.call(n, info)
+			case *ast.CompositeLit:
+				s.byMethod(n, info)
+			}
+			return true
+		})
+	}
+	return nil
+}
+
+// call adds the handlers given to a call of a handlerCalls function
+func (s *scanner) call(call *ast.CallExpr, info *types.Info) {
+	var obj types.Object
+	switch fun := unparen(call.Fun).(type) {
+	case *ast.Ident:
+		obj = info.Uses[fun]
+	case *ast.SelectorExpr:
+		obj = info.Uses[fun.Sel]
+	}
+	f, ok := obj.(*types.Func)
+	if !ok || f.Pkg() == nil || f.Pkg().Path() != plumbusPath || !handlerCalls[f.Name()] {
+		return
+	}
+
+	params := f.Type().(*types.Signature).Params()
+	for i, arg := range call.Args {
+		if i >= params.Len() {
+			break
+		}
+		if iface, ok := params.At(i).Type().Underlying().(*types.Interface); ok && iface.Empty() {
+			s.add(arg, info)
+		}
+	}
+
+	if recv := f.Type().(*types.Signature).Recv(); recv != nil && isPlumbusType(recv.Type(), "ServeMux", "Paths") {
+		s.route(call, f, info)
+	}
+}
+
+// route adds the route registered by a call of a mux's Handle, GET, or
+// the like, if its pattern is a constant
+func (s *scanner) route(call *ast.CallExpr, f *types.Func, info *types.Info) {
+	if len(call.Args) == 0 {
+		return
+	}
+	pattern := info.Types[call.Args[0]].Value
+	if pattern == nil || pattern.Kind() != constant.String {
+		return
+	}
+
+	// the middleware doesn't change the documentation
+	register := f.Name()
+	if register == "HandleWith" {
+		register = "Handle"
+	}
+	r := &route{Register: register, Pattern: pattern.ExactString()}
+	params := f.Type().(*types.Signature).Params()
+	for i, arg := range call.Args[1:] {
+		param := params.At(min(i+1, params.Len()-1)).Type()
+		if iface, ok := param.Underlying().(*types.Interface); ok && iface.Empty() {
+			r.Handler = s.handlerCode(arg, info)
+		} else if value := info.Types[arg].Value; value != nil && value.Kind() == constant.String {
+			r.Docs = append(r.Docs, value.ExactString())
+		}
+	}
+
+	for c := s.chained[call]; c != nil; c = s.chained[c] {
+		sel := unparen(c.Fun).(*ast.SelectorExpr)
+		method, ok := info.Uses[sel.Sel].(*types.Func)
+		if !ok || method.Type().(*types.Signature).Recv() == nil || !isPlumbusType(method.Type().(*types.Signature).Recv().Type(), "Route") {
+			break
+		}
+		args := make([]string, len(c.Args))
+		for i, arg := range c.Args {
+			value := info.Types[arg].Value
+			if value == nil {
+				args = nil
+				break
+			}
+			args[i] = value.ExactString()
+		}
+		if args != nil {
+			r.Calls = append(r.Calls, fmt.Sprintf("%s(%s)", method.Name(), strings.Join(args, ", ")))
+		}
+	}
+
+	s.routes = append(s.routes, r)
+}
+
+// handlerCode is the code for a handler in the generator program: a
+// handler that add can refer to, or a plumbus.ByMethod of them
+func (s *scanner) handlerCode(expr ast.Expr, info *types.Info) string {
+	expr = unparen(expr)
+	if unary, ok := expr.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		expr = unparen(unary.X)
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || !isPlumbusType(info.TypeOf(lit), "ByMethod") {
+		handler, _ := s.handler(expr, info)
+		return handler
+	}
+
+	var methods []string
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if handler, _ := s.handler(kv.Value, info); handler != "" {
+			methods = append(methods, fmt.Sprintf("%s: %s", kv.Key, handler))
+		}
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	return "plumbus.ByMethod{" + strings.Join(methods, ", ") + "}"
+}
+
+// isPlumbusType reports whether typ is, or points to, one of the named
+// types of plumbus
+func isPlumbusType(typ types.Type, names ...string) bool {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	named, ok := typ.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != plumbusPath {
+		return false
+	}
+	for _, name := range names {
+		if named.Obj().Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// byMethod adds the handlers in a plumbus.ByMethod value
+func (s *scanner) byMethod(lit *ast.CompositeLit, info *types.Info) {
+	if !isPlumbusType(info.TypeOf(lit), "ByMethod") {
+		return
+	}
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			s.add(kv.Value, info)
+		} else {
+			s.add(elt, info)
+		}
+	}
+}
+
+// add adds a handler that's a named function, a method value, or a
+// method expression. Other handlers, such as function literals, can't be
+// referred to by the generator and are left to the reflection adaptor.
+func (s *scanner) add(expr ast.Expr, info *types.Info) {
+	handler, p := s.handler(expr, info)
+	if p != nil && !p.seen[handler] {
+		p.seen[handler] = true
+		p.Handlers = append(p.Handlers, handler)
+	}
+}
+
+// handler is the code referring to a handler in the generator program,
+// where its package is imported, and the package declaring it, or ""
+// and nil if it can't be referred to
+func (s *scanner) handler(expr ast.Expr, info *types.Info) (string, *handlerPackage) {
+	var f *types.Func
+	var pkg *types.Package
+	var handler string
+	switch e := unparen(expr).(type) {
+	case *ast.Ident:
+		f, _ = info.Uses[e].(*types.Func)
+		handler = "PKG." + e.Name
+	case *ast.SelectorExpr:
+		f, _ = info.Uses[e.Sel].(*types.Func)
+		handler = "PKG." + e.Sel.Name
+		if sel, ok := info.Selections[e]; ok {
+			recv := sel.Recv()
+			ptr, isPtr := recv.(*types.Pointer)
+			if isPtr {
+				recv = ptr.Elem()
+			}
+			named, ok := recv.(*types.Named)
+			if !ok {
+				return "", nil
+			}
+			typ := named.Obj()
+			if !typ.Exported() {
+				log.Printf("plumbus: skipping %s.%s, its type isn't exported", typ.Name(), e.Sel.Name)
+				return "", nil
+			}
+			pkg = typ.Pkg()
+			switch {
+			case sel.Kind() == types.MethodVal:
+				handler = fmt.Sprintf("new(PKG.%s).%s", typ.Name(), e.Sel.Name)
+			case isPtr:
+				handler = fmt.Sprintf("(*PKG.%s).%s", typ.Name(), e.Sel.Name)
+			default:
+				handler = fmt.Sprintf("PKG.%s.%s", typ.Name(), e.Sel.Name)
+			}
+		}
+	}
+	if f == nil || isHTTPHandlerFunc(f) {
+		return "", nil
+	}
+	if pkg == nil {
+		pkg = f.Pkg()
+	}
+	if pkg == nil {
+		return "", nil
+	}
+
+	if !f.Exported() {
+		log.Printf("plumbus: skipping %s.%s, it isn't exported", pkg.Name(), f.Name())
+		return "", nil
+	}
+	if pkg.Name() == "main" {
+		log.Printf("plumbus: skipping %s, can't generate for package main, move handlers into another package", f.Name())
+		return "", nil
+	}
+
+	p, ok := s.packages[pkg.Path()]
+	if !ok {
+		bp, err := build.Import(pkg.Path(), ".", build.FindOnly)
+		if err != nil {
+			log.Printf("plumbus: skipping %s.%s: %v", pkg.Name(), f.Name(), err)
+			return "", nil
+		}
+		p = &handlerPackage{
+			Path: pkg.Path(),
+			Name: pkg.Name(),
+			Dir:  bp.Dir,
+			seen: map[string]bool{},
+		}
+		s.packages[pkg.Path()] = p
+	}
+	return strings.Replace(handler, "PKG.", pkgPlaceholder(p.Path), 1), p
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+// isHTTPHandlerFunc reports whether a function is already a
+// func(http.ResponseWriter, *http.Request), which needs no adaptor
+func isHTTPHandlerFunc(f *types.Func) bool {
+	sig := f.Type().(*types.Signature)
+	return sig.Results().Len() == 0 &&
+		sig.Params().Len() == 2 &&
+		sig.Params().At(0).Type().String() == "net/http.ResponseWriter" &&
+		sig.Params().At(1).Type().String() == "*net/http.Request"
+}
@@ -0,0 +1,103 @@
+package plumbus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagger can be implemented by a handler's result to give its ETag, so
+// that a request whose If-None-Match header has the same ETag gets a 304
+// Not Modified response without a body
+type ETagger interface {
+	ETag() string
+}
+
+// LastModifier can be implemented by a handler's result to give the
+// time it last changed, which is sent in the Last-Modified header. A GET
+// request whose If-Modified-Since header is no earlier gets a 304 Not
+// Modified response without a body.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// SetETags makes the mux give json (or other encoded) responses to GET
+// requests an ETag made from a hash of the body, answering requests whose
+// If-None-Match header has it with 304 Not Modified. Results that are an
+// ETagger use their own ETag instead.
+func (sm *ServeMux) SetETags(enabled bool) {
+	sm.etags = enabled
+}
+
+// quoteETag puts quotes around an ETag, unless it already has them
+func quoteETag(etag string) string {
+	if strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches checks for the etag in an If-None-Match header, using the
+// weak comparison that RFC 7232 calls for
+func etagMatches(req *http.Request, etag string) bool {
+	header := req.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header and, if the request already has that
+// version, responds with a 304
+func notModified(res http.ResponseWriter, req *http.Request, etag string) bool {
+	res.Header().Set("ETag", etag)
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if !etagMatches(req, etag) {
+		return false
+	}
+	res.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// notModifiedSince sets the Last-Modified header and, if the request
+// already has that version, responds with a 304. An If-None-Match header
+// takes precedence over If-Modified-Since.
+func notModifiedSince(res http.ResponseWriter, req *http.Request, modified time.Time) bool {
+	if modified.IsZero() {
+		return false
+	}
+	modified = modified.UTC().Truncate(time.Second)
+	res.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+	res.WriteHeader(http.StatusNotModified)
+	return true
+}
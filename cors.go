@@ -0,0 +1,144 @@
+package plumbus
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures the CORS middleware
+type CORSOptions struct {
+	// AllowedOrigins are the origins that may make cross-origin requests,
+	// such as "https://app.example.com", or "*" for any origin
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods allowed in preflight responses. They
+	// default to the methods that the route handles.
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed in preflight
+	// responses. They default to whichever headers are asked for.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers that the client may read
+	ExposedHeaders []string
+
+	// AllowCredentials lets requests include cookies and authorization
+	AllowCredentials bool
+
+	// MaxAge is how long the client may cache preflight responses
+	MaxAge time.Duration
+}
+
+// CORS is middleware that allows cross-origin requests from the allowed
+// origins, as in:
+//
+//	mux.Use(plumbus.CORS(plumbus.CORSOptions{
+//		AllowedOrigins: []string{"https://app.example.com"},
+//		MaxAge:         time.Hour,
+//	}))
+//
+// It answers preflight OPTIONS requests for every route itself, so
+// handlers (and ByMethod) never see them.
+func CORS(options CORSOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			preflight := req.Method == http.MethodOptions &&
+				req.Header.Get("Access-Control-Request-Method") != ""
+			if preflight && RoutePattern(req) == "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			header := res.Header()
+			header.Add("Vary", "Origin")
+			allowed := options.allowsOrigin(origin)
+			if allowed {
+				if options.allowsAnyOrigin() && !options.AllowCredentials {
+					header.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					header.Set("Access-Control-Allow-Origin", origin)
+				}
+				if options.AllowCredentials {
+					header.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if !preflight {
+				if allowed && len(options.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(options.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			if allowed {
+				methods := options.AllowedMethods
+				if methods == nil {
+					methods = routeMethods(req)
+				}
+				header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+				if options.AllowedHeaders != nil {
+					header.Set("Access-Control-Allow-Headers", strings.Join(options.AllowedHeaders, ", "))
+				} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					header.Set("Access-Control-Allow-Headers", requested)
+				}
+
+				if options.MaxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(options.MaxAge.Seconds())))
+				}
+			}
+			res.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func (options *CORSOptions) allowsOrigin(origin string) bool {
+	for _, allowed := range options.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (options *CORSOptions) allowsAnyOrigin() bool {
+	for _, allowed := range options.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// routeMethods lists the methods that the matched route handles, or the
+// requested method if the route handles any method
+func routeMethods(req *http.Request) []string {
+	requested := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+	node, _ := req.Context().Value(routeNodeKey).(*Paths)
+	if node == nil {
+		return []string{requested}
+	}
+
+	methods := []string{}
+	for _, route := range routeInfos(RoutePattern(req), node) {
+		if route.Method == "" {
+			return []string{requested}
+		}
+		methods = append(methods, route.Method)
+		if route.Method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	return methods
+}
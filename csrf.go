@@ -0,0 +1,132 @@
+package plumbus
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+// CSRFOptions configures the CSRF middleware
+type CSRFOptions struct {
+	// CookieName is the cookie holding the token, "csrf_token" by default
+	CookieName string
+
+	// HeaderName is the request header that can hold the token,
+	// "X-CSRF-Token" by default
+	HeaderName string
+
+	// FieldName is the form field that can hold the token, "csrf_token"
+	// by default
+	FieldName string
+
+	// Secure marks the cookie as only to be sent over https
+	Secure bool
+
+	// Exempt skips the check for requests that don't need it, such as
+	// API requests authenticated with a token rather than a cookie
+	Exempt func(req *http.Request) bool
+}
+
+// CSRF is middleware that protects against cross-site request forgery
+// with a double-submit cookie. Each client gets a random token in a
+// cookie, and requests with unsafe methods like POST must send the same
+// token back in a header or form field, or else get a 403. Use CSRFToken
+// to put the token in forms, as in:
+//
+//	mux.Use(plumbus.CSRF(plumbus.CSRFOptions{
+//		Exempt: func(req *http.Request) bool {
+//			return req.Header.Get("Authorization") != ""
+//		},
+//	}))
+//
+// Reading the form field parses the body the same way that handlers
+// decode forms, so they can still take the form as an argument.
+func CSRF(options CSRFOptions) Middleware {
+	if options.CookieName == "" {
+		options.CookieName = "csrf_token"
+	}
+	if options.HeaderName == "" {
+		options.HeaderName = "X-CSRF-Token"
+	}
+	if options.FieldName == "" {
+		options.FieldName = "csrf_token"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			var token string
+			if cookie, err := req.Cookie(options.CookieName); err == nil && cookie.Value != "" {
+				token = cookie.Value
+			} else {
+				token = newCSRFToken()
+				http.SetCookie(res, &http.Cookie{
+					Name:     options.CookieName,
+					Value:    token,
+					Path:     "/",
+					Secure:   options.Secure,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			req = req.WithContext(context.WithValue(req.Context(), csrfTokenKey, token))
+
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(res, req)
+				return
+			}
+			if options.Exempt != nil && options.Exempt(req) {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			sent, err := options.sentToken(req)
+			if err != nil {
+				HandleResponseError(res, req, err)
+				return
+			}
+			if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				HandleResponseError(res, req, Error(http.StatusForbidden, "missing or invalid CSRF token"))
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// sentToken finds the token sent in the header or form field
+func (options *CSRFOptions) sentToken(req *http.Request) (string, error) {
+	if sent := req.Header.Get(options.HeaderName); sent != "" {
+		return sent, nil
+	}
+
+	switch mediaType(req) {
+	case "application/x-www-form-urlencoded":
+		if err := req.ParseForm(); err != nil {
+			return "", bodyError(err, "decoding form")
+		}
+	case "multipart/form-data":
+		if err := parseMultipartForm(req); err != nil {
+			return "", err
+		}
+	default:
+		return "", nil
+	}
+	return req.PostForm.Get(options.FieldName), nil
+}
+
+// CSRFToken returns the token that the CSRF middleware expects requests
+// to send back, for putting in a hidden form field
+func CSRFToken(req *http.Request) string {
+	token, _ := req.Context().Value(csrfTokenKey).(string)
+	return token
+}
+
+func newCSRFToken() string {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
@@ -0,0 +1,125 @@
+package plumbus
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+func init() {
+	RegisterEncoderFor("text/csv", canEncodeCSV, encodeCSV)
+}
+
+// csvRows finds the slice of structs in v, and the type of its rows
+func csvRows(v interface{}) (reflect.Value, reflect.Type, bool) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return val, nil, false
+	}
+
+	rowType := val.Type().Elem()
+	for rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	return val, rowType, rowType.Kind() == reflect.Struct
+}
+
+// canEncodeCSV reports whether v is a slice of structs, which is all
+// that's encoded as csv
+func canEncodeCSV(v interface{}) bool {
+	_, _, ok := csvRows(v)
+	return ok
+}
+
+// csvFlushRows is how many rows are buffered before they're written out
+const csvFlushRows = 100
+
+// encodeCSV writes a slice of structs as csv, with a header row of the
+// field names. A field is named by its `csv` tag, or else like it is in
+// json, and `csv:"-"` leaves it out.
+func encodeCSV(w io.Writer, v interface{}) error {
+	val, rowType, ok := csvRows(v)
+	if !ok {
+		return fmt.Errorf("can't encode %T as csv, expected a slice of structs", v)
+	}
+
+	var fields []int
+	var header []string
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := csvName(field)
+		if name == "" {
+			continue
+		}
+		fields = append(fields, i)
+		header = append(header, name)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(fields))
+	for i := 0; i < val.Len(); i++ {
+		row := val.Index(i)
+		for row.Kind() == reflect.Ptr && !row.IsNil() {
+			row = row.Elem()
+		}
+		for j, field := range fields {
+			record[j] = ""
+			if row.Kind() == reflect.Struct {
+				record[j] = csvValue(row.Field(field))
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		if i%csvFlushRows == csvFlushRows-1 {
+			writer.Flush()
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvName(field reflect.StructField) string {
+	if name, ok := field.Tag.Lookup("csv"); ok {
+		name = strings.Split(name, ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	if strings.Split(field.Tag.Get("json"), ",")[0] == "-" {
+		return ""
+	}
+	return generate.FieldName(field)
+}
+
+func csvValue(val reflect.Value) string {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return ""
+		}
+		val = val.Elem()
+	}
+	if t, ok := val.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(val.Interface())
+}
@@ -0,0 +1,68 @@
+package plumbus
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+//go:embed swaggerui/*.js swaggerui/*.css swaggerui/index.html
+var swaggerUI embed.FS
+
+var docsPage = template.Must(template.ParseFS(swaggerUI, "swaggerui/index.html"))
+
+// ServeDocs serves the mux's OpenAPI document at prefix+"/openapi.json",
+// and Swagger UI for browsing and trying out its routes at the prefix
+// itself, along with its AsyncAPI document at prefix+"/asyncapi.json",
+// as in:
+//
+//	mux.ServeDocs("/docs", plumbus.OpenAPIInfo{Title: "Orders", Version: "1.0"})
+//
+// The UI's assets are embedded, so the docs work without reaching any
+// other server. The documents are made for each request, so they include
+// routes added after ServeDocs, but not the docs routes themselves.
+func (sm *ServeMux) ServeDocs(prefix string, info OpenAPIInfo) *Route {
+	handler := &docsHandler{mux: sm, info: info}
+	return sm.Handle(strings.TrimSuffix(prefix, "/")+"/*filepath", handler)
+}
+
+type docsHandler struct {
+	mux  *ServeMux
+	info OpenAPIInfo
+}
+
+func (d *docsHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	switch file := PathParam(req, "filepath"); file {
+	case "":
+		// the page refers to its assets relative to the prefix
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			http.Redirect(res, req, req.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		fallthrough
+	case "index.html":
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := docsPage.Execute(res, d.info); err != nil {
+			HandleResponseError(res, req, err)
+		}
+	case "openapi.json":
+		res.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(res).Encode(d.mux.OpenAPI(d.info)); err != nil {
+			HandleResponseError(res, req, err)
+		}
+	case "asyncapi.json":
+		res.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(res).Encode(d.mux.AsyncAPI(d.info)); err != nil {
+			HandleResponseError(res, req, err)
+		}
+	default:
+		assets, _ := fs.Sub(swaggerUI, "swaggerui")
+		r := req.Clone(req.Context())
+		r.URL.Path = "/" + file
+		r.URL.RawPath = ""
+		http.FileServer(http.FS(assets)).ServeHTTP(res, r)
+	}
+}
@@ -1,6 +1,7 @@
 package plumbus
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -23,22 +24,37 @@ type Documentation struct {
 type Endpoint struct {
 	Method       string               `json:"method,omitempty"`
 	Path         string               `json:"path"`
+	Summary      string               `json:"summary,omitempty"`
 	Description  string               `json:"description,omitempty"`
+	Tags         []string             `json:"tags,omitempty"`
+	Deprecated   bool                 `json:"deprecated,omitempty"`
 	RequestBody  string               `json:"requestBody,omitempty"`
 	ResponseBody string               `json:"responseBody,omitempty"`
 	Params       map[string]ParamInfo `json:"params,omitempty"`
 	Notes        []string             `json:"notes,omitempty"`
+
+	// Responses names the body type of each response declared with
+	// Route.Responses or a ResponseDocumenter by status code, with "error"
+	// for an error body and "" for none
+	Responses map[int]string `json:"responses,omitempty"`
 }
 
 type Type struct {
 	Description string      `json:"description,omitempty"`
 	Example     interface{} `json:"example"`
+
+	// Fields describes the fields of a struct type that have a `doc` tag,
+	// by the name they're encoded with
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 type ParamInfo struct {
-	Type        string `json:"type"`
-	Required    bool   `json:"required"`
-	Description string `json:"description,omitempty"`
+	In          string   `json:"in,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Description string   `json:"description,omitempty"`
 }
 
 func (sm *ServeMux) Documentation(introduction ...string) *Documentation {
@@ -56,39 +72,46 @@ func (sm *ServeMux) Documentation(introduction ...string) *Documentation {
 func (d *Documentation) collectEndpoints(paths *Paths) {
 	for path, segment := range paths.flatten() {
 		docs := cleanupText(strings.Join(segment.documentation, "\n"))
-		d.collectEndpoint(path, segment.originalHandler, docs)
+		d.collectEndpoint(path, segment, docs)
 	}
 }
 
-func (d *Documentation) collectEndpoint(path string, handler interface{}, docs string) {
-	switch val := handler.(type) {
+func (d *Documentation) collectEndpoint(path string, node *Paths, docs string) {
+	switch val := node.originalHandler.(type) {
 	case http.HandlerFunc, func(http.ResponseWriter, *http.Request):
-		d.Endpoints = append(d.Endpoints, &Endpoint{
+		e := &Endpoint{
 			Path:        path,
 			Description: docs,
-		})
+		}
+		d.documentMetadata(e, node)
+		d.Endpoints = append(d.Endpoints, e)
 
 	case ByMethod:
-		d.collectMethodEndpoints(path, &val, docs)
+		d.collectMethodEndpoints(path, node, &val, docs)
 
 	case *ByMethod:
-		d.collectMethodEndpoints(path, val, docs)
+		d.collectMethodEndpoints(path, node, val, docs)
 
 	default:
-		e := d.handlerFunctionToEndpoint(handler)
+		e := d.handlerFunctionToEndpoint(val)
 		e.Path = path
 		e.Description = docs
+		d.documentMetadata(e, node)
+		d.documentResponses(e, node, val)
 		d.Endpoints = append(d.Endpoints, e)
 	}
 }
 
-func (d *Documentation) collectMethodEndpoints(path string, handlers *ByMethod, docs string) {
+func (d *Documentation) collectMethodEndpoints(path string, node *Paths, handlers *ByMethod, docs string) {
 	addHandler := func(method string, handler interface{}) {
+		handler = typedFunc(handler)
 		if handler != nil {
 			e := d.handlerFunctionToEndpoint(handler)
 			e.Method = method
 			e.Path = path
 			e.Description = docs
+			d.documentMetadata(e, node)
+			d.documentResponses(e, node, handler)
 			d.Endpoints = append(d.Endpoints, e)
 		}
 	}
@@ -123,9 +146,60 @@ func (d *Documentation) handlerFunctionToEndpoint(handler interface{}) *Endpoint
 			if doc, ok := val.(documenter); ok {
 				e.Notes = append(e.Notes, cleanupText(doc.Documentation()))
 			}
-		case generate.ConvertIntQueryParam, generate.ConvertStringQueryParam:
+		case generate.ConvertContext, generate.ConvertRequest, generate.ConvertResponseWriter:
+			//supplied by the request, nothing to document
+		case generate.ConvertWebSocket:
+			e.Notes = append(e.Notes, "Upgrades the request to a websocket connection.")
+		case generate.ConvertFile:
+			name := input.Name
+			if name == "" {
+				name = "file"
+			}
+
+			if e.Params == nil {
+				e.Params = map[string]ParamInfo{}
+			}
+
+			e.Params[name] = ParamInfo{
+				In:       "form",
+				Type:     "file",
+				Required: !input.IsPointer,
+			}
+		case generate.ConvertRawBody, generate.ConvertBodyReader:
+			e.Notes = append(e.Notes, "The request body is read as is, without decoding.")
+		case generate.ConvertStruct:
+			d.documentStruct(e, input.Type)
+		case generate.ConvertPlugin:
+			doc := input.PluginDoc()
+			if doc.Note != "" {
+				e.Notes = append(e.Notes, cleanupText(doc.Note))
+			}
+			if doc.BodyMediaType != "" {
+				e.Notes = append(e.Notes, fmt.Sprintf("The request body is %s.", doc.BodyMediaType))
+			}
+			for _, param := range doc.Params {
+				if e.Params == nil {
+					e.Params = map[string]ParamInfo{}
+				}
+				e.Params[param.Name] = ParamInfo{
+					In:          param.Source.String(),
+					Type:        paramTypeName(pluginParamType(param)),
+					Required:    param.Required,
+					Description: param.Description,
+				}
+			}
+		case generate.ConvertIntParam, generate.ConvertStringParam, generate.ConvertUintParam,
+			generate.ConvertFloatParam, generate.ConvertBoolParam, generate.ConvertTimeParam,
+			generate.ConvertRegisteredParam:
+			paramType := input.Type
+			if paramType.Kind() == reflect.Ptr {
+				paramType = paramType.Elem()
+			}
+
 			p := ParamInfo{
-				Required: input.Type.Kind() != reflect.Ptr,
+				In:       input.Source.String(),
+				Type:     paramTypeName(paramType),
+				Required: input.Type.Kind() != reflect.Ptr && !input.HasDefault,
 			}
 
 			val := reflect.Zero(input.Type).Interface()
@@ -133,10 +207,13 @@ func (d *Documentation) handlerFunctionToEndpoint(handler interface{}) *Endpoint
 				p.Description = cleanupText(doc.Documentation())
 			}
 
-			if t == generate.ConvertIntQueryParam {
-				p.Type = "string"
-			} else {
-				p.Type = "integer"
+			if input.HasEnum {
+				p.Enum = reflect.Zero(paramType).Interface().(Enumer).Enum()
+			}
+
+			if input.HasDefault {
+				def := reflect.Zero(paramType).Interface().(Defaulter).Default()
+				p.Default = fmt.Sprint(def)
 			}
 
 			if e.Params == nil {
@@ -160,6 +237,8 @@ func (d *Documentation) handlerFunctionToEndpoint(handler interface{}) *Endpoint
 			}
 		case generate.ConvertError:
 			//not much we can do here
+		case generate.ConvertStatus:
+			//the status is only known once the handler runs
 		default:
 			log.Fatalf("unexpected conversion type %s", t)
 		}
@@ -168,6 +247,106 @@ func (d *Documentation) handlerFunctionToEndpoint(handler interface{}) *Endpoint
 	return e
 }
 
+// documentMetadata adds the summary, tags, and deprecation declared for
+// the endpoint's route
+func (d *Documentation) documentMetadata(e *Endpoint, node *Paths) {
+	meta := node.metadataFor(e.Method)
+	e.Summary = meta.summary
+	e.Tags = meta.tags
+	e.Deprecated = meta.deprecated
+}
+
+// documentResponses names the types of the responses declared for the
+// endpoint's route and the results of its handler
+func (d *Documentation) documentResponses(e *Endpoint, node *Paths, handler interface{}) {
+	var results []reflect.Type
+	if typ := reflect.TypeOf(handler); typ != nil && typ.Kind() == reflect.Func {
+		for i := 0; i < typ.NumOut(); i++ {
+			results = append(results, typ.Out(i))
+		}
+	}
+
+	for code, response := range declaredResponses(node, e.Method, results) {
+		if e.Responses == nil {
+			e.Responses = map[int]string{}
+		}
+		switch response.(type) {
+		case nil:
+			e.Responses[code] = ""
+		case error:
+			e.Responses[code] = "error"
+		default:
+			e.Responses[code] = d.mkType(reflect.TypeOf(response))
+		}
+	}
+}
+
+// documentStruct documents the fields of a struct filled by BindStruct
+func (d *Documentation) documentStruct(e *Endpoint, typ reflect.Type) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok, err := parseBindTag(field.Tag.Get("plumbus"))
+		if !ok || err != nil {
+			continue
+		}
+
+		if tag.source == "body" {
+			e.RequestBody = d.mkType(field.Type)
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if e.Params == nil {
+			e.Params = map[string]ParamInfo{}
+		}
+
+		p := ParamInfo{
+			In:       tag.source,
+			Type:     paramTypeName(fieldType),
+			Required: field.Type.Kind() != reflect.Ptr && !tag.hasDefault,
+			Default:  tag.def,
+		}
+
+		if enumer, ok := reflect.Zero(fieldType).Interface().(Enumer); ok {
+			p.Enum = enumer.Enum()
+		}
+
+		e.Params[tag.name] = p
+	}
+}
+
+// paramTypeName names the kind of a parameter for documentation
+func paramTypeName(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// pluginParamType is the type of a param a plugin's argument is made
+// from, a string unless the plugin says otherwise
+func pluginParamType(param generate.PluginParam) reflect.Type {
+	if param.Type == nil {
+		return reflect.TypeOf("")
+	}
+	return reflectElem(param.Type)
+}
+
 func (d *Documentation) mkType(typ reflect.Type) string {
 	name := typeName(typ)
 
@@ -182,12 +361,58 @@ func (d *Documentation) mkType(typ reflect.Type) string {
 		d.Types[name] = &Type{
 			Example:     example,
 			Description: description,
+			Fields:      fieldDocs(typ),
 		}
 	}
 
 	return name
 }
 
+// fieldDocs gathers the `doc` tags of a struct's fields
+func fieldDocs(typ reflect.Type) map[string]string {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var docs map[string]string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		doc, ok := field.Tag.Lookup("doc")
+		if !ok || !field.IsExported() {
+			continue
+		}
+		if docs == nil {
+			docs = map[string]string{}
+		}
+		docs[generate.FieldName(field)] = doc
+	}
+	return docs
+}
+
+// exampleValue decodes the `example` tag of a struct field, which is
+// written as json, except that strings and times don't need quotes
+func exampleValue(field reflect.StructField) (reflect.Value, bool) {
+	example, ok := field.Tag.Lookup("example")
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	data := []byte(example)
+	elem := reflectElem(field.Type)
+	if elem.Kind() == reflect.String || isTimeType(elem) {
+		data, _ = json.Marshal(example)
+	}
+
+	val := reflect.New(field.Type)
+	if err := json.Unmarshal(data, val.Interface()); err != nil {
+		return reflect.Value{}, false
+	}
+	return val.Elem(), true
+}
+
 func typeName(typ reflect.Type) string {
 	name := fmt.Sprintf("%v", typ)
 	parts := strings.Split(name, ".")
@@ -236,7 +461,9 @@ func deepZero(typ reflect.Type) reflect.Value {
 
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Field(i)
-		if needsExample(field) {
+		if example, ok := exampleValue(typ.Field(i)); ok && field.CanSet() {
+			field.Set(example)
+		} else if needsExample(field) {
 			val.Field(i).Set(deepZero(val.Field(i).Type()))
 		}
 	}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
 )
 
@@ -27,7 +28,9 @@ func (sm *ServeMux) DocumentationHTML(intro ...string) http.Handler {
 	})
 }
 
-var page = template.Must(template.New("docs page").Parse(`
+var page = template.Must(template.New("docs page").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`
 <head>
   <style>
 		*{
@@ -64,7 +67,18 @@ var page = template.Must(template.New("docs page").Parse(`
 		<div class="endpoint">
 		  <h2>
 				<span>{{.Method}}</span> <span>{{.Path}}</span>
+				{{- if .Deprecated}} <span>(deprecated)</span>{{end}}
 			</h2>
+			{{if .Summary}}
+			  <p>
+					<b>{{.Summary}}</b>
+				</p>
+			{{end}}
+			{{if .Tags}}
+			  <p>
+					Tags: {{join .Tags ", "}}
+				</p>
+			{{end}}
 			{{if .Description}}
 			  <p>
 					{{.Description}}
@@ -85,7 +99,10 @@ var page = template.Must(template.New("docs page").Parse(`
 								Required
 							{{- else -}}
 								Optional
-							{{- end}} {{$val.Type}}): {{$val.Description}}
+							{{- end}} {{$val.Type}}
+							{{- if $val.Enum}}, one of {{join $val.Enum ", "}}{{end}}
+							{{- if $val.Default}}, default {{$val.Default}}{{end -}}
+							): {{$val.Description}}
 						</div>
 					{{end}}
 				</div>
@@ -106,6 +123,16 @@ var page = template.Must(template.New("docs page").Parse(`
 					</div>
 				</div>
 			{{end}}
+			{{if .Responses}}
+				<div>
+					<h3>Other Responses</h3>
+					{{range $code, $body := .Responses}}
+						<div>
+							<span class="paramName">{{$code}}</span>{{if $body}}: {{$body}}{{end}}
+						</div>
+					{{end}}
+				</div>
+			{{end}}
 		</div>
 	{{end}}
 </body>
@@ -1,6 +1,144 @@
 package plumbus
 
-import "fmt"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// asHTTPError finds the first HTTPError in err's chain, so that wrapping
+// one, as in fmt.Errorf("loading user: %w", err), keeps its status
+func asHTTPError(err error) (HTTPError, bool) {
+	var httperr HTTPError
+	if errors.As(err, &httperr) {
+		return httperr, true
+	}
+	return nil, false
+}
+
+type errorMapping struct {
+	target error
+	typ    reflect.Type
+	code   int
+}
+
+// MapError makes the mux respond with code to errors that are target, or
+// wrap it, as in:
+//
+//	mux.MapError(sql.ErrNoRows, http.StatusNotFound)
+//	mux.MapError(context.DeadlineExceeded, http.StatusGatewayTimeout)
+//
+// so that handlers can return errors that don't know about http. The
+// response has the message of target.
+func (sm *ServeMux) MapError(target error, code int) {
+	sm.errorMappings = append(sm.errorMappings, errorMapping{target: target, code: code})
+}
+
+// MapErrorType makes the mux respond with code to errors of the same type
+// as example, or that wrap one, as in:
+//
+//	mux.MapErrorType(&NotFoundError{}, http.StatusNotFound)
+//
+// The response has the message of the error of that type.
+func (sm *ServeMux) MapErrorType(example error, code int) {
+	sm.errorMappings = append(sm.errorMappings, errorMapping{typ: reflect.TypeOf(example), code: code})
+}
+
+// mapError turns err into an HTTPError using the mux's mappings, if any
+// of them match it
+func (sm *ServeMux) mapError(err error) (HTTPError, bool) {
+	for _, mapping := range sm.errorMappings {
+		if mapping.target != nil && errors.Is(err, mapping.target) {
+			return &simpleError{code: mapping.code, msg: mapping.target.Error()}, true
+		}
+		if mapping.typ != nil {
+			target := reflect.New(mapping.typ)
+			if errors.As(err, target.Interface()) {
+				matched := target.Elem().Interface().(error)
+				return &simpleError{code: mapping.code, msg: matched.Error()}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// mapRouteError maps err with the mappings of the muxes the request's
+// route was found through, innermost first
+func mapRouteError(req *http.Request, err error) (HTTPError, bool) {
+	muxes := routeMuxes(req)
+	for i := len(muxes) - 1; i >= 0; i-- {
+		if httperr, ok := muxes[i].mapError(err); ok {
+			return httperr, true
+		}
+	}
+	return nil, false
+}
+
+// internalError is the HTTPError written for an error that isn't one. It
+// only says what went wrong if the mux is in debug mode, but always has an
+// ID to find it in the logs by.
+type internalError struct {
+	id      string
+	message string
+	stack   string
+}
+
+// handleInternalError logs an error that isn't an HTTPError under a new
+// error ID, and gives the HTTPError to respond with
+func handleInternalError(req *http.Request, err error) *internalError {
+	internal := &internalError{id: newErrorID(), message: "internal server error"}
+	log.Printf(
+		"error handling request: %s %s: [%s] %v",
+		req.Method,
+		req.URL.Path,
+		internal.id,
+		err,
+	)
+
+	hasHook := func(mux *ServeMux) bool { return mux.errorIDHook != nil }
+	if sm := routeMux(req, hasHook); sm != nil && sm.errorIDHook != nil {
+		sm.errorIDHook(req, internal.id, err)
+	}
+
+	if sm := routeMux(req, func(mux *ServeMux) bool { return mux.debug }); sm != nil && sm.debug {
+		if pe, ok := err.(*panicError); ok {
+			internal.message = fmt.Sprintf("panic: %v", pe.recovered)
+			internal.stack = string(pe.stack)
+		} else {
+			// a stack taken here would only show how the error got
+			// written, so it's left out unless the error carries one
+			internal.message = err.Error()
+			var stacked interface{ Stack() []byte }
+			if errors.As(err, &stacked) {
+				internal.stack = string(stacked.Stack())
+			}
+		}
+	}
+	return internal
+}
+
+func newErrorID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+func (ie *internalError) Error() string {
+	return ie.message
+}
+
+func (ie *internalError) ResponseCode() int {
+	return http.StatusInternalServerError
+}
 
 type wrappedError struct {
 	error
@@ -47,3 +185,207 @@ func Errorf(code int, msg string, args ...interface{}) error {
 		msg:  fmt.Sprintf(msg, args...),
 	}
 }
+
+// StructuredError is an HTTPError that gives clients a machine-readable
+// code, details, and metadata, made with NewError, as in:
+//
+//	return nil, plumbus.NewError(http.StatusNotFound).
+//		Code("USER_NOT_FOUND").
+//		Detail("no user with id " + id).
+//		Meta(map[string]interface{}{"id": id})
+type StructuredError struct {
+	status  int
+	code    string
+	message string
+	detail  string
+	meta    map[string]interface{}
+}
+
+// NewError starts a StructuredError with the response status. Its message
+// is the status text, as in "Not Found", unless it's set with Message.
+func NewError(status int) *StructuredError {
+	return &StructuredError{
+		status:  status,
+		message: http.StatusText(status),
+	}
+}
+
+func (se *StructuredError) Code(code string) *StructuredError {
+	se.code = code
+	return se
+}
+
+func (se *StructuredError) Message(message string) *StructuredError {
+	se.message = message
+	return se
+}
+
+func (se *StructuredError) Detail(detail string) *StructuredError {
+	se.detail = detail
+	return se
+}
+
+func (se *StructuredError) Meta(meta map[string]interface{}) *StructuredError {
+	se.meta = meta
+	return se
+}
+
+func (se *StructuredError) Error() string {
+	if se.code != "" {
+		return se.code + ": " + se.message
+	}
+	return se.message
+}
+
+func (se *StructuredError) ResponseCode() int {
+	return se.status
+}
+
+// fields are the parts of the error written along with its message
+func (se *StructuredError) fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	if se.code != "" {
+		fields["code"] = se.code
+	}
+	if se.detail != "" {
+		fields["detail"] = se.detail
+	}
+	if se.meta != nil {
+		fields["meta"] = se.meta
+	}
+	return fields
+}
+
+// RetryAfterer can be implemented by an HTTPError, such as a 429 or 503,
+// to tell clients how long to wait before retrying with a Retry-After
+// header
+type RetryAfterer interface {
+	RetryAfter() time.Duration
+}
+
+type retryError struct {
+	simpleError
+	after time.Duration
+	at    time.Time
+}
+
+func (re *retryError) RetryAfter() time.Duration {
+	if !re.at.IsZero() {
+		return time.Until(re.at)
+	}
+	return re.after
+}
+
+// ErrorRetryAfter is like Error, but tells clients to wait before retrying
+// with a Retry-After header, as in:
+//
+//	return plumbus.ErrorRetryAfter(http.StatusTooManyRequests, 30*time.Second, "slow down")
+func ErrorRetryAfter(code int, after time.Duration, msg string) error {
+	return &retryError{simpleError: simpleError{code: code, msg: msg}, after: after}
+}
+
+// ErrorRetryAt is like ErrorRetryAfter, but gives the time to retry at,
+// which is sent as an http date
+func ErrorRetryAt(code int, at time.Time, msg string) error {
+	return &retryError{simpleError: simpleError{code: code, msg: msg}, at: at}
+}
+
+// setRetryAfter sets the Retry-After header for an error that's a
+// RetryAfterer, in seconds or as a date
+func setRetryAfter(res http.ResponseWriter, err error) {
+	if re, ok := err.(*retryError); ok && !re.at.IsZero() {
+		res.Header().Set("Retry-After", re.at.UTC().Format(http.TimeFormat))
+		return
+	}
+	if retry, ok := err.(RetryAfterer); ok {
+		seconds := int64(math.Ceil(retry.RetryAfter().Seconds()))
+		if seconds < 0 {
+			seconds = 0
+		}
+		res.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+}
+
+type unauthorizedError struct {
+	simpleError
+	challenge string
+}
+
+// ErrorUnauthorized is a 401 error that tells the client how to
+// authenticate with a WWW-Authenticate header, as in:
+//
+//	return plumbus.ErrorUnauthorized(`Bearer realm="api"`, "missing token")
+func ErrorUnauthorized(challenge, msg string) error {
+	return &unauthorizedError{
+		simpleError: simpleError{code: http.StatusUnauthorized, msg: msg},
+		challenge:   challenge,
+	}
+}
+
+// setChallenge sets the WWW-Authenticate header for an error made by
+// ErrorUnauthorized
+func setChallenge(res http.ResponseWriter, err error) {
+	if ue, ok := err.(*unauthorizedError); ok && ue.challenge != "" {
+		res.Header().Set("WWW-Authenticate", ue.challenge)
+	}
+}
+
+// ErrorFormat is how a mux writes error responses
+type ErrorFormat int
+
+const (
+	// ErrorJSON writes errors as {"error": "..."}, along with an "errors"
+	// list for validation errors. This is the default.
+	ErrorJSON ErrorFormat = iota
+
+	// ErrorProblemJSON writes errors as RFC 7807 problem details, with
+	// the Content-Type application/problem+json
+	ErrorProblemJSON
+)
+
+// SetErrorFormat sets how the mux writes error responses
+func (sm *ServeMux) SetErrorFormat(format ErrorFormat) {
+	sm.errorFormat = format
+}
+
+// Problem is an RFC 7807 problem details document
+type Problem struct {
+	Type     string                 `json:"type"`
+	Title    string                 `json:"title"`
+	Status   int                    `json:"status"`
+	Detail   string                 `json:"detail,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Errors   []FieldError           `json:"errors,omitempty"`
+	Code     string                 `json:"code,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+	ErrorID  string                 `json:"error_id,omitempty"`
+}
+
+func writeProblem(res http.ResponseWriter, req *http.Request, err HTTPError) {
+	code := err.ResponseCode()
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(code),
+		Status:   code,
+		Detail:   err.Error(),
+		Instance: req.URL.Path,
+	}
+	if verrs, ok := err.(ValidationErrors); ok {
+		problem.Errors = verrs
+	}
+	if internal, ok := err.(*internalError); ok {
+		problem.ErrorID = internal.id
+	}
+	if se, ok := err.(*StructuredError); ok {
+		problem.Detail = se.message
+		if se.detail != "" {
+			problem.Detail = se.detail
+		}
+		problem.Code = se.code
+		problem.Meta = se.meta
+	}
+
+	res.Header().Set("Content-Type", "application/problem+json")
+	res.WriteHeader(code)
+	writeJSON(res, req, problem)
+}
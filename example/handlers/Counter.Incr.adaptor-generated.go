@@ -1,69 +1,64 @@
-
 package handlers
 
 //code generated by 'go generate', do not edit
 
 import (
-	"github.com/jargv/plumbus"
-	"net/http"
-	"reflect"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/jargv/plumbus"
+	"github.com/jargv/plumbus/generate"
+	"io"
 	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
 )
 
 // avoid unused import errors
+var _ context.Context
+var _ io.Reader
+var _ generate.File
 var _ json.Delim
 var _ log.Logger
 var _ fmt.Formatter
+var _ strconv.NumError
+var _ = utf8.RuneError
 
-func init(){
-	var dummy func(
-		
-	)(
-		
-			*Counter,
-		
-	)
+func init() {
+	var dummy func() *Counter
 
 	typ := reflect.TypeOf(dummy)
 	plumbus.RegisterAdaptor(typ, func(handler interface{}) http.HandlerFunc {
-		callback := handler.(func(
-			
-		)(
-			
-				*Counter,
-			
-		))
+		callback := handler.(func() *Counter)
+
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+
+			var errs plumbus.ValidationErrors
+
+			if len(errs) > 0 {
+				plumbus.HandleResponseError(res, req, errs)
+				return
+			}
 
-		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request){
-			
-			
+			if err := plumbus.RunInterceptors(
+				req,
+			); err != nil {
+				plumbus.HandleResponseError(res, req, err)
+				return
+			}
 
-			
-			
-				result0  := 
-			
+			result0 :=
 
-			callback(
-				
-			)
+				callback()
 
-			
-			
+			// the response body has to be sent last
+			if err := plumbus.EncodeValue(res, req, result0); err != nil {
+				plumbus.HandleResponseError(res, req, err)
+				return
+			}
 
-			
-				
-					
-						{
-							if err := json.NewEncoder(res).Encode(result0); err != nil {
-								plumbus.HandleResponseError(res, req, err)
-								return
-							}
-						}
-					
-				
-			
 		})
 	})
 }
@@ -1,65 +1,65 @@
-
 package handlers
 
 //code generated by 'go generate', do not edit
 
 import (
-	"github.com/jargv/plumbus"
-	"net/http"
-	"reflect"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/jargv/plumbus"
+	"github.com/jargv/plumbus/generate"
+	"io"
 	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
 )
 
 // avoid unused import errors
+var _ context.Context
+var _ io.Reader
+var _ generate.File
 var _ json.Delim
 var _ log.Logger
 var _ fmt.Formatter
+var _ strconv.NumError
+var _ = utf8.RuneError
 
-func init(){
-	var dummy func(
-		
-	)(
-		
-			error,
-		
-	)
+func init() {
+	var dummy func() error
 
 	typ := reflect.TypeOf(dummy)
 	plumbus.RegisterAdaptor(typ, func(handler interface{}) http.HandlerFunc {
-		callback := handler.(func(
-			
-		)(
-			
-				error,
-			
-		))
+		callback := handler.(func() error)
+
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+
+			var errs plumbus.ValidationErrors
+
+			if len(errs) > 0 {
+				plumbus.HandleResponseError(res, req, errs)
+				return
+			}
+
+			if err := plumbus.RunInterceptors(
+				req,
+			); err != nil {
+				plumbus.HandleResponseError(res, req, err)
+				return
+			}
 
-		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request){
-			
-			
+			result0 :=
 
-			
-			
-				result0  := 
-			
+				callback()
 
-			callback(
-				
-			)
+			if result0 != nil {
+				plumbus.HandleResponseError(res, req, result0.(error))
+				return
+			}
 
-			
-			
-				if result0 != nil {
-					plumbus.HandleResponseError(res, req, result0.(error))
-					return
-				}
-			
+			plumbus.WriteEmptyResponse(res, req)
 
-			
-				
-			
 		})
 	})
 }
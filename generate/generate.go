@@ -1,34 +1,122 @@
 package generate
 
 import (
+	"bytes"
 	"fmt"
-	"html/template"
+	"go/format"
 	"os"
 	"reflect"
 	"strings"
+	"text/template"
 )
 
 func Adaptor(handler interface{}, filepath, pkg string) error {
-	typ := reflect.TypeOf(handler)
-	info, err := CollectInfo(typ)
+	return Adaptors([]interface{}{handler}, filepath, pkg)
+}
+
+// Adaptors generates the adaptors for several handlers in one file, as
+// the package mode of the plumbus command does. Handlers with the same
+// signature share an adaptor.
+func Adaptors(handlers []interface{}, filepath, pkg string) error {
+	src, err := source(handlers, pkg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath, src, 0644)
+}
+
+// VerifyAdaptor checks that the adaptor generated into filepath for the
+// handler is up to date, returning an error if the file is missing or
+// differs from what Adaptor would generate now.
+func VerifyAdaptor(handler interface{}, filepath, pkg string) error {
+	return VerifyAdaptors([]interface{}{handler}, filepath, pkg)
+}
+
+// VerifyAdaptors checks the file generated by Adaptors, like
+// VerifyAdaptor does. It's meant for tests and CI, so that a handler
+// whose signature changed since its adaptor was generated is caught
+// before it's served by the slow reflection adaptor, as in:
+//
+//	err := generate.VerifyAdaptor(handlers.GetUser, "handlers/GetUser.adaptor-generated.go", "handlers")
+func VerifyAdaptors(handlers []interface{}, filepath, pkg string) error {
+	want, err := source(handlers, pkg)
 	if err != nil {
 		return err
 	}
-	file, err := os.Create(filepath)
+	have, err := os.ReadFile(filepath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is missing, run go generate", filepath)
+	}
 	if err != nil {
 		return err
 	}
+	// the file may have been through goimports, or edited by hand
+	if formatted, err := format.Source(have); err == nil {
+		have = formatted
+	}
+	if !bytes.Equal(have, want) {
+		return fmt.Errorf("%s is out of date, run go generate", filepath)
+	}
+	return nil
+}
 
+// source is the formatted code of the adaptors for the handlers
+func source(handlers []interface{}, pkg string) ([]byte, error) {
+	var adaptors []map[string]interface{}
+	var imports []string
+	seen := map[reflect.Type]bool{}
+	imported := map[string]bool{}
+	for _, handler := range handlers {
+		typ := reflect.TypeOf(handler)
+		if seen[typ] {
+			continue
+		}
+		seen[typ] = true
+
+		info, err := CollectInfo(typ)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", typ, err)
+		}
+		for _, input := range info.Inputs {
+			if input.Plugin == nil || input.Plugin.Code == "" {
+				continue
+			}
+			for _, path := range input.Plugin.Imports {
+				if !imported[path] {
+					imported[path] = true
+					imports = append(imports, path)
+				}
+			}
+		}
+		adaptors = append(adaptors, map[string]interface{}{
+			"info":       info,
+			"lastOutput": len(info.Outputs) - 1,
+		})
+	}
+
+	typename := func(arg interface{}) string {
+		typename := fmt.Sprintf("%s", arg)
+		return strings.Replace(typename, pkg+".", "", 1)
+	}
 	tmpl, err := template.New("adaptor").
 		Funcs(template.FuncMap{
-			"typename": func(arg interface{}) string {
-				typename := fmt.Sprintf("%s", arg)
-				return strings.Replace(typename, pkg+".", "", 1)
-			},
+			"typename": typename,
 			"typenameElem": func(arg interface{}) string {
 				typename := fmt.Sprintf("%s", arg)
 				return strings.Replace(typename, "*"+pkg+".", "", 1)
 			},
+			"valueTypename": func(typ reflect.Type) string {
+				if typ.Kind() == reflect.Ptr {
+					typ = typ.Elem()
+				}
+				return strings.Replace(typ.String(), pkg+".", "", 1)
+			},
+			"bits": func(typ reflect.Type) int {
+				if typ.Kind() == reflect.Ptr {
+					typ = typ.Elem()
+				}
+				return typ.Bits()
+			},
 			"ConvertBody": func() ConversionType {
 				return ConvertBody
 			},
@@ -38,25 +126,132 @@ func Adaptor(handler interface{}, filepath, pkg string) error {
 			"ConvertCustom": func() ConversionType {
 				return ConvertCustom
 			},
-			"ConvertStringQueryParam": func() ConversionType {
-				return ConvertStringQueryParam
+			"ConvertContext": func() ConversionType {
+				return ConvertContext
+			},
+			"ConvertRequest": func() ConversionType {
+				return ConvertRequest
+			},
+			"ConvertResponseWriter": func() ConversionType {
+				return ConvertResponseWriter
+			},
+			"ConvertStruct": func() ConversionType {
+				return ConvertStruct
+			},
+			"ConvertRawBody": func() ConversionType {
+				return ConvertRawBody
+			},
+			"ConvertBodyReader": func() ConversionType {
+				return ConvertBodyReader
+			},
+			"ConvertFile": func() ConversionType {
+				return ConvertFile
+			},
+			"ConvertStatus": func() ConversionType {
+				return ConvertStatus
+			},
+			"ConvertWebSocket": func() ConversionType {
+				return ConvertWebSocket
+			},
+			"ConvertStringParam": func() ConversionType {
+				return ConvertStringParam
+			},
+			"ConvertIntParam": func() ConversionType {
+				return ConvertIntParam
+			},
+			"ConvertUintParam": func() ConversionType {
+				return ConvertUintParam
+			},
+			"ConvertFloatParam": func() ConversionType {
+				return ConvertFloatParam
+			},
+			"ConvertBoolParam": func() ConversionType {
+				return ConvertBoolParam
 			},
-			"ConvertIntQueryParam": func() ConversionType {
-				return ConvertIntQueryParam
+			"ConvertTimeParam": func() ConversionType {
+				return ConvertTimeParam
+			},
+			"ConvertRegisteredParam": func() ConversionType {
+				return ConvertRegisteredParam
+			},
+			"ConvertPlugin": func() ConversionType {
+				return ConvertPlugin
+			},
+			"pluginCode": func(arg *Converter, i int) (string, error) {
+				return pluginCode(arg.Plugin, PluginArg{
+					Var:  fmt.Sprintf("arg%d", i),
+					Type: typename(arg.Type),
+				})
+			},
+			"SourceHeader": func() ParamSource {
+				return SourceHeader
+			},
+			"SourceCookie": func() ParamSource {
+				return SourceCookie
+			},
+			"SourcePath": func() ParamSource {
+				return SourcePath
+			},
+			"isParam": func(ct ConversionType) bool {
+				return ct.isParam()
+			},
+			"basicKind":    basicKind,
+			"validateCall": validateCall,
+			"validateTags": validateCode,
+			"mayBeChannel": func(typ reflect.Type) bool {
+				return typ.Kind() == reflect.Chan || typ.Kind() == reflect.Interface
 			},
 		}).
 		Option("missingkey=error").
 		Parse(adaptorTemplate)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return tmpl.Execute(file, map[string]interface{}{
-		"info":       info,
-		"package":    pkg,
-		"lastOutput": len(info.Outputs) - 1,
+	var src bytes.Buffer
+	err = tmpl.Execute(&src, map[string]interface{}{
+		"package":  pkg,
+		"imports":  imports,
+		"adaptors": adaptors,
 	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(src.Bytes())
+}
+
+// basicKind is the name of the basic type a param's type is defined
+// from, which its Default() may return, or "" if it isn't one
+func basicKind(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if typ.Name() != typ.Kind().String() {
+			return typ.Kind().String()
+		}
+	}
+	return ""
+}
+
+// validateCall says how an adaptor calls the Validate method of an
+// argument: directly on a "value", on a "pointer" that isn't nil, or
+// else with plumbus.Validate, which finds the method by reflection
+func validateCall(typ reflect.Type) string {
+	switch {
+	case typ.Kind() == reflect.Interface:
+		return "reflect"
+	case typ.Kind() != reflect.Ptr:
+		return "value"
+	case typ.Elem().Kind() == reflect.Ptr || typ.Elem().Kind() == reflect.Interface:
+		return "reflect"
+	}
+	return "pointer"
 }
 
 const adaptorTemplate = `
@@ -65,21 +260,32 @@ package {{.package}}
 //code generated by 'go generate', do not edit
 
 import (
+	"context"
 	"github.com/jargv/plumbus"
+	"github.com/jargv/plumbus/generate"
 	"net/http"
 	"reflect"
 	"encoding/json"
 	"strconv"
 	"fmt"
+	"io"
 	"log"
+	"unicode/utf8"
+	{{range .imports}}
+		"{{.}}"
+	{{end}}
 )
 
 // avoid unused import errors
+var _ context.Context
+var _ io.Reader
+var _ generate.File
 var _ json.Delim
 var _ log.Logger
 var _ fmt.Formatter
 var _ strconv.NumError
-
+var _ = utf8.RuneError
+{{range .adaptors}}
 func init(){
 	var dummy func(
 		{{range $_, $input := .info.Inputs}}
@@ -103,93 +309,249 @@ func init(){
 			{{end}}
 		))
 
+		{{range $i, $arg := .info.Inputs}}
+			{{if eq $arg.ConversionType ConvertPlugin}}
+				{{if not $arg.Plugin.Code}}
+					extract{{$i}} := generate.PluginExtractor("{{$arg.Plugin.Name}}", reflect.TypeOf((*{{typename $arg.Type}})(nil)).Elem())
+				{{end}}
+			{{end}}
+		{{end}}
+
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request){
 			{{if .info.UsesQueryParams}}
 				queryParams := req.URL.Query()
 			{{end}}
+			var errs plumbus.ValidationErrors
 			{{$info := .info}}
 			{{range $i, $arg := $info.Inputs}}
 				var arg{{$i}} {{typename $arg.Type -}}
 				{{if eq $arg.ConversionType ConvertBody}}
-					if err := json.NewDecoder(req.Body).Decode(&arg{{$i}}); err != nil {
-						msg := fmt.Sprintf("{\"error\": \"decoding json: %s\"}", err.Error())
-						http.Error(res, msg, http.StatusBadRequest)
-						return
+					if err := plumbus.DecodeBody(req, &arg{{$i}}); err != nil {
+						if errs, err = plumbus.CollectErrors(errs, err); err != nil {
+							plumbus.HandleResponseError(res, req, err)
+							return
+						}
 					}
 				{{else if eq $arg.ConversionType ConvertCustom}}
 					{{if $arg.IsPointer}}
 						arg{{$i}} = new({{typenameElem $arg.Type}})
 					{{end}}
 					if err := arg{{$i}}.FromRequest(req); err != nil {
+						if errs, err = plumbus.CollectErrors(errs, err); err != nil {
+							plumbus.HandleResponseError(res, req, err)
+							return
+						}
+					}
+				{{else if eq $arg.ConversionType ConvertContext}}
+					arg{{$i}} = req.Context()
+				{{else if eq $arg.ConversionType ConvertRequest}}
+					arg{{$i}} = req
+				{{else if eq $arg.ConversionType ConvertResponseWriter}}
+					arg{{$i}} = res
+				{{else if eq $arg.ConversionType ConvertRawBody}}
+					if body, err := plumbus.ReadBody(req); err != nil {
 						plumbus.HandleResponseError(res, req, err)
 						return
+					} else {
+						arg{{$i}} = body
 					}
-				{{else if eq $arg.ConversionType ConvertStringQueryParam}}
-				  {{if $arg.IsPointer}}
-						if l, sent := queryParams["{{$arg.Name}}"]; sent && len(l) > 0{
-							arg{{$i}} = new({{typenameElem $arg.Type}})
-							*arg{{$i}} = ({{typenameElem $arg.Type}})(l[0])
+				{{else if eq $arg.ConversionType ConvertBodyReader}}
+					arg{{$i}} = req.Body
+				{{else if eq $arg.ConversionType ConvertFile}}
+					if file, err := plumbus.FormFile(req, "{{$arg.Name}}", {{not $arg.IsPointer}}); err != nil {
+						if errs, err = plumbus.CollectErrors(errs, err); err != nil {
+							plumbus.HandleResponseError(res, req, err)
+							return
 						}
+					} else if file != nil {
+						{{if $arg.IsPointer}}
+							arg{{$i}} = (*{{valueTypename $arg.Type}})(file)
+						{{else}}
+							arg{{$i}} = {{valueTypename $arg.Type}}(*file)
+						{{end}}
+					}
+				{{else if eq $arg.ConversionType ConvertStruct}}
+					{{if $arg.IsPointer}}
+						arg{{$i}} = new({{typenameElem $arg.Type}})
+						if err := plumbus.BindStruct(req, arg{{$i}}); err != nil {
 					{{else}}
-						if l, sent := queryParams["{{$arg.Name}}"]; sent && len(l) > 0{
-							arg{{$i}} = {{typename $arg.Type}}(l[0])
-						} else {
-							plumbus.HandleResponseError(
-								res, req,
-								plumbus.Errorf(
-									http.StatusBadRequest,
-									"missing required query parameter '{{$arg.Name}}'",
-								),
-							)
+						if err := plumbus.BindStruct(req, &arg{{$i}}); err != nil {
+					{{end}}
+						if errs, err = plumbus.CollectErrors(errs, err); err != nil {
+							plumbus.HandleResponseError(res, req, err)
 							return
 						}
-					{{end}}
-				{{else if eq $arg.ConversionType ConvertIntQueryParam}}
-				  {
-						{{if $arg.IsPointer}}
-							if l, sent := queryParams["{{$arg.Name}}"]; sent && len(l) > 0 {
-								queryInt, err := strconv.Atoi(l[0])
-								if err != nil {
-									plumbus.HandleResponseError(
-										res, req,
-										plumbus.Errorf(
-											http.StatusBadRequest,
-											"query param '{{$arg.Name}}' expected to be integer value",
-										),
-									)
-									return
-								}
-								arg{{$i}} = new({{typenameElem $arg.Type}})
-								*arg{{$i}} = {{typenameElem $arg.Type}}(queryInt)
-							}
+					}
+				{{else if eq $arg.ConversionType ConvertPlugin}}
+					{
+						var err error
+						{{if $arg.Plugin.Code}}
+							{{pluginCode $arg $i}}
 						{{else}}
-							l, sent := queryParams["{{$arg.Name}}"]
-							if !sent || len(l) == 0 {
-								plumbus.HandleResponseError(
-									res, req,
-									plumbus.Errorf(
-										http.StatusBadRequest,
-										"missing required query parameter '{{$arg.Name}}'",
-									),
-								)
+							var value interface{}
+							if value, err = extract{{$i}}(req); err == nil && value != nil {
+								arg{{$i}} = value.({{typename $arg.Type}})
+							}
+						{{end}}
+						if err != nil {
+							if errs, err = plumbus.CollectErrors(errs, err); err != nil {
+								plumbus.HandleResponseError(res, req, err)
 								return
 							}
-							queryInt, err := strconv.Atoi(l[0])
+						}
+					}
+				{{else if isParam $arg.ConversionType}}
+					{
+						{{if eq $arg.Source SourceHeader}}
+							l := req.Header["{{$arg.Name}}"]
+						{{else if eq $arg.Source SourcePath}}
+							l := plumbus.PathParams(req)["{{$arg.Name}}"]
+						{{else if eq $arg.Source SourceCookie}}
+							var l []string
+							if cookie, err := req.Cookie("{{$arg.Name}}"); err == nil {
+								l = []string{cookie.Value}
+							}
+						{{else}}
+							l := queryParams["{{$arg.Name}}"]
+						{{end}}
+						{{if $arg.HasDefault}}
+							if len(l) == 0 {
+								var value {{valueTypename $arg.Type}}
+								switch def := value.Default().(type) {
+								case {{valueTypename $arg.Type}}:
+									value = def
+								{{- with basicKind $arg.Type}}
+									case {{.}}:
+										value = {{valueTypename $arg.Type}}(def)
+								{{- end}}
+								default:
+									plumbus.SetParamDefault(&value)
+								}
+								{{if $arg.IsPointer}}
+									arg{{$i}} = &value
+								{{else}}
+									arg{{$i}} = value
+								{{end}}
+							}
+						{{else if not $arg.IsPointer}}
+							if len(l) == 0 {
+								errs = append(errs, plumbus.FieldError{
+									Field:   "{{$arg.Name}}",
+									In:      "{{$arg.Source}}",
+									Message: "is required",
+								})
+							}
+						{{end}}
+						if len(l) > 0 {
+							var value {{valueTypename $arg.Type}}
+							{{if $arg.HasEnum}}
+								err := plumbus.CheckEnum(l[0], value)
+							{{else}}
+								var err error
+							{{end}}
+							if err == nil {
+								{{if eq $arg.ConversionType ConvertStringParam}}
+									value = {{valueTypename $arg.Type}}(l[0])
+								{{else if eq $arg.ConversionType ConvertIntParam}}
+									if parsed, perr := strconv.ParseInt(l[0], 10, {{bits $arg.Type}}); perr == nil {
+										value = {{valueTypename $arg.Type}}(parsed)
+									} else {
+										err = fmt.Errorf("expected to be integer value")
+									}
+								{{else if eq $arg.ConversionType ConvertUintParam}}
+									if parsed, perr := strconv.ParseUint(l[0], 10, {{bits $arg.Type}}); perr == nil {
+										value = {{valueTypename $arg.Type}}(parsed)
+									} else {
+										err = fmt.Errorf("expected to be unsigned integer value")
+									}
+								{{else if eq $arg.ConversionType ConvertFloatParam}}
+									if parsed, perr := strconv.ParseFloat(l[0], {{bits $arg.Type}}); perr == nil {
+										value = {{valueTypename $arg.Type}}(parsed)
+									} else {
+										err = fmt.Errorf("expected to be number value")
+									}
+								{{else if eq $arg.ConversionType ConvertBoolParam}}
+									if parsed, perr := strconv.ParseBool(l[0]); perr == nil {
+										value = {{valueTypename $arg.Type}}(parsed)
+									} else {
+										err = fmt.Errorf("expected to be boolean value")
+									}
+								{{else if eq $arg.ConversionType ConvertTimeParam}}
+									if parsed, perr := plumbus.ParseTimeParam(l[0], value); perr == nil {
+										value = {{valueTypename $arg.Type}}(parsed)
+									} else {
+										err = perr
+									}
+								{{else if eq $arg.ConversionType ConvertRegisteredParam}}
+									err = plumbus.SetParam(&value, l[0])
+								{{end}}
+							}
 							if err != nil {
-								plumbus.HandleResponseError(
-									res, req,
-									plumbus.Errorf(
-										http.StatusBadRequest,
-										"query param '{{$arg.Name}}' expected to be integer value",
-									),
-								)
+								errs = append(errs, plumbus.FieldError{
+									Field:   "{{$arg.Name}}",
+									In:      "{{$arg.Source}}",
+									Message: err.Error(),
+								})
+							} else {
+								{{if $arg.IsPointer}}
+									arg{{$i}} = &value
+								{{else}}
+									arg{{$i}} = value
+								{{end}}
+							}
+						}
+					}
+				{{end}}
+				{{if $arg.HasValidateTags}}
+					{{validateTags $arg.Type (printf "arg%d" $i)}}
+				{{end}}
+			{{end}}
+
+			if len(errs) > 0 {
+				plumbus.HandleResponseError(res, req, errs)
+				return
+			}
+
+			{{range $i, $arg := $info.Inputs}}
+				{{if $arg.HasValidate}}
+					{{$call := validateCall $arg.Type}}
+					{{if eq $call "pointer"}}
+						if arg{{$i}} != nil {
+							if err := plumbus.ValidatorError(arg{{$i}}.Validate()); err != nil {
+								plumbus.HandleResponseError(res, req, err)
 								return
 							}
+						}
+					{{else if eq $call "value"}}
+						if err := plumbus.ValidatorError(arg{{$i}}.Validate()); err != nil {
+							plumbus.HandleResponseError(res, req, err)
+							return
+						}
+					{{else}}
+						if err := plumbus.Validate(&arg{{$i}}); err != nil {
+							plumbus.HandleResponseError(res, req, err)
+							return
+						}
+					{{end}}
+				{{end}}
+			{{end}}
 
-							arg{{$i}} = {{typename $arg.Type}}(queryInt)
-						{{end}}
-					}
+			if err := plumbus.RunInterceptors(
+				req,
+				{{range $i, $_ := $info.Inputs}}
+					plumbus.ArgOf(arg{{$i}}),
 				{{end}}
+			); err != nil {
+				plumbus.HandleResponseError(res, req, err)
+				return
+			}
+
+			{{if ge $info.WebSocketIndex 0}}
+				if conn, err := plumbus.UpgradeWebSocket(res, req); err != nil {
+					return
+				} else {
+					arg{{$info.WebSocketIndex}} = conn
+				}
 			{{end}}
 
 			{{$lastOutput := .lastOutput}}
@@ -204,6 +566,10 @@ func init(){
 			)
 
 			{{$lastIsError := .info.LastIsError}}
+			{{if ge $info.WebSocketIndex 0}}
+				plumbus.CloseWebSocket(arg{{$info.WebSocketIndex}}, {{if $lastIsError}}result{{$lastOutput}}{{else}}nil{{end}})
+			{{else}}
+
 			{{if $lastIsError}}
 				if result{{$lastOutput}} != nil {
 					plumbus.HandleResponseError(res, req, result{{$lastOutput}}.(error))
@@ -211,24 +577,45 @@ func init(){
 				}
 			{{end}}
 
-			{{range $i, $_ := .info.Outputs}}
-				{{if or (ne $i $lastOutput) (not $lastIsError)}}
-					{{if eq $i $info.ResponseBodyIndex}}
-						{
-							if err := json.NewEncoder(res).Encode(result{{$i}}); err != nil {
-								plumbus.HandleResponseError(res, req, err)
-								return
-							}
-						}
-					{{else}}
-						if err := result{{$i}}.ToResponse(res); err != nil {
-							plumbus.HandleResponseError(res, req, err)
-							return
-						}
-					{{end}}
+			{{if ge $info.StatusIndex 0}}
+				if result{{$info.StatusIndex}} != 0 {
+					sw, err := plumbus.NewStatusWriter(res, result{{$info.StatusIndex}})
+					if err != nil {
+						plumbus.HandleResponseError(res, req, err)
+						return
+					}
+					defer sw.Finish()
+					res = sw
+				}
+			{{end}}
+
+			{{range $i, $output := .info.Outputs}}
+				{{if eq $output.ConversionType ConvertCustom}}
+					if err := result{{$i}}.ToResponse(res); err != nil {
+						plumbus.HandleResponseError(res, req, err)
+						return
+					}
 				{{end}}
 			{{end}}
+
+			{{if ge $info.ResponseBodyIndex 0}}
+				// the response body has to be sent last
+				{{if mayBeChannel (index $info.Outputs $info.ResponseBodyIndex).Type -}}
+					if err := plumbus.EncodeResponse(res, req, result{{$info.ResponseBodyIndex}}); err != nil {
+				{{- else -}}
+					if err := plumbus.EncodeValue(res, req, result{{$info.ResponseBodyIndex}}); err != nil {
+				{{- end}}
+					plumbus.HandleResponseError(res, req, err)
+					return
+				}
+			{{end}}
+
+			{{if $info.NoContent}}
+				plumbus.WriteEmptyResponse(res, req)
+			{{end}}
+			{{end}}
 		})
 	})
 }
+{{end}}
 `
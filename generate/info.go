@@ -1,33 +1,114 @@
 package generate
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
+	"net/textproto"
 	"reflect"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type ConversionType int
 
-func (ct ConversionType) isQueryParam() bool {
-	return ct == ConvertStringQueryParam ||
-		ct == ConvertIntQueryParam
+func (ct ConversionType) isParam() bool {
+	return ct == ConvertStringParam ||
+		ct == ConvertIntParam ||
+		ct == ConvertUintParam ||
+		ct == ConvertFloatParam ||
+		ct == ConvertBoolParam ||
+		ct == ConvertTimeParam ||
+		ct == ConvertRegisteredParam
 }
 
 const (
 	ConvertBody ConversionType = iota
 	ConvertError
 	ConvertCustom
+	ConvertContext
+	ConvertRequest
+	ConvertResponseWriter
+	ConvertStruct
+	ConvertRawBody
+	ConvertBodyReader
+	ConvertFile
+	ConvertStatus
+	ConvertWebSocket
 
-	ConvertStringQueryParam
-	ConvertIntQueryParam
+	ConvertStringParam
+	ConvertIntParam
+	ConvertUintParam
+	ConvertFloatParam
+	ConvertBoolParam
+	ConvertTimeParam
+	ConvertRegisteredParam
+
+	// ConvertPlugin is an argument made by a registered Plugin
+	ConvertPlugin
+)
+
+const (
+	// Deprecated: use ConvertStringParam, since params aren't only taken
+	// from the query.
+	ConvertStringQueryParam = ConvertStringParam
+
+	// Deprecated: use ConvertIntParam, since params aren't only taken
+	// from the query.
+	ConvertIntQueryParam = ConvertIntParam
+)
+
+// ParamSource is the part of the request a param is taken from
+type ParamSource int
+
+const (
+	SourceQuery ParamSource = iota
+	SourceHeader
+	SourceCookie
+	SourcePath
 )
 
+func (ps ParamSource) String() string {
+	switch ps {
+	case SourceQuery:
+		return "query"
+	case SourceHeader:
+		return "header"
+	case SourceCookie:
+		return "cookie"
+	case SourcePath:
+		return "path"
+	}
+	return fmt.Sprintf("ParamSource(%d)", int(ps))
+}
+
+// paramSuffixes maps the suffix of a param type's name to where the
+// param comes from, as in fooQueryParam or authorizationHeaderParam
+var paramSuffixes = []struct {
+	suffix string
+	source ParamSource
+}{
+	{"QueryParam", SourceQuery},
+	{"HeaderParam", SourceHeader},
+	{"CookieParam", SourceCookie},
+	{"PathParam", SourcePath},
+}
+
 type Converter struct {
-	ConversionType ConversionType
-	Name           string
-	Type           reflect.Type
-	IsPointer      bool
+	ConversionType  ConversionType
+	Name            string
+	Source          ParamSource
+	Type            reflect.Type
+	IsPointer       bool
+	HasDefault      bool
+	HasEnum         bool
+	HasValidate     bool
+	HasValidateTags bool
+
+	// Plugin makes the argument, for ConvertPlugin
+	Plugin *Plugin
 }
 
 type Info struct {
@@ -35,7 +116,10 @@ type Info struct {
 	Outputs           []*Converter
 	UsesQueryParams   bool
 	ResponseBodyIndex int
+	StatusIndex       int
 	LastIsError       bool
+	NoContent         bool
+	WebSocketIndex    int
 }
 
 func CollectInfo(typ reflect.Type) (*Info, error) {
@@ -48,18 +132,35 @@ func CollectInfo(typ reflect.Type) (*Info, error) {
 
 	info := &Info{
 		ResponseBodyIndex: -1,
+		StatusIndex:       -1,
+		WebSocketIndex:    -1,
 	}
 
 	for i := 0; i < typ.NumIn(); i++ {
 		input := inputConverter(typ.In(i))
+		input.HasValidate = input.ConversionType != ConvertContext &&
+			input.ConversionType != ConvertRequest &&
+			input.ConversionType != ConvertResponseWriter &&
+			input.ConversionType != ConvertWebSocket &&
+			hasValidate(input.Type)
+		input.HasValidateTags = input.ConversionType == ConvertBody &&
+			hasValidateTags(input.Type, map[reflect.Type]bool{})
 		info.Inputs = append(info.Inputs, input)
-		if input.ConversionType.isQueryParam() {
+		if input.ConversionType.isParam() && input.Source == SourceQuery {
 			info.UsesQueryParams = true
 		}
+		if input.ConversionType == ConvertWebSocket {
+			info.WebSocketIndex = i
+		}
 	}
 
 	for i := 0; i < typ.NumOut(); i++ {
 		output := outputConverter(typ.Out(i))
+		if i == 0 && hasStatus(typ) {
+			// the leading int of (int, *Result, error) is the status code
+			output.ConversionType = ConvertStatus
+			info.StatusIndex = i
+		}
 		info.Outputs = append(info.Outputs, output)
 		if i == typ.NumOut()-1 {
 			info.LastIsError = output.ConversionType == ConvertError
@@ -70,9 +171,46 @@ func CollectInfo(typ reflect.Type) (*Info, error) {
 		}
 	}
 
+	// a handler that returns nothing but an error has no response, unless
+	// it writes one itself
+	info.NoContent = true
+	for _, output := range info.Outputs {
+		if output.ConversionType != ConvertError {
+			info.NoContent = false
+		}
+	}
+	for _, input := range info.Inputs {
+		if input.ConversionType == ConvertResponseWriter ||
+			input.ConversionType == ConvertWebSocket {
+			info.NoContent = false
+		}
+	}
+
+	// once the request is upgraded, there's no response to write
+	if info.WebSocketIndex != -1 {
+		for _, output := range info.Outputs {
+			if output.ConversionType != ConvertError {
+				return nil, fmt.Errorf(
+					"a websocket handler can only return an error, not %s",
+					output.Type,
+				)
+			}
+		}
+	}
+
 	return info, nil
 }
 
+// hasStatus reports whether the function's results are shaped like
+// (int, *Result, error), where the int is the response's status code. An
+// int in any other position, such as in (int, error), is the body.
+func hasStatus(typ reflect.Type) bool {
+	return typ.NumOut() == 3 &&
+		typ.Out(0) == statusType &&
+		outputConverter(typ.Out(1)).ConversionType == ConvertBody &&
+		outputConverter(typ.Out(2)).ConversionType == ConvertError
+}
+
 func outputConverter(typ reflect.Type) *Converter {
 	conv := &Converter{
 		Type: typ,
@@ -93,9 +231,62 @@ func outputConverter(typ reflect.Type) *Converter {
 	return conv
 }
 
+var (
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	timeType           = reflect.TypeOf(time.Time{})
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	rawBodyType        = reflect.TypeOf([]byte(nil))
+	bodyReaderType     = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	fileType           = reflect.TypeOf(File{})
+	statusType         = reflect.TypeOf(0)
+	wsConnType         = reflect.TypeOf((*WSConn)(nil))
+)
+
 func inputConverter(typ reflect.Type) *Converter {
-	if queryParamConverter := typeIsQueryParam(typ); queryParamConverter != nil {
-		return queryParamConverter
+	switch typ {
+	case contextType:
+		return &Converter{
+			Type:           typ,
+			ConversionType: ConvertContext,
+		}
+	case requestType:
+		return &Converter{
+			Type:           typ,
+			ConversionType: ConvertRequest,
+		}
+	case responseWriterType:
+		return &Converter{
+			Type:           typ,
+			ConversionType: ConvertResponseWriter,
+		}
+	case wsConnType:
+		return &Converter{
+			Type:           typ,
+			ConversionType: ConvertWebSocket,
+		}
+	case rawBodyType:
+		return &Converter{
+			Type:           typ,
+			ConversionType: ConvertRawBody,
+		}
+	case bodyReaderType:
+		return &Converter{
+			Type:           typ,
+			ConversionType: ConvertBodyReader,
+		}
+	}
+
+	if pluginConverter := typeIsPlugin(typ); pluginConverter != nil {
+		return pluginConverter
+	}
+
+	if fileConverter := typeIsFile(typ); fileConverter != nil {
+		return fileConverter
+	}
+
+	if paramConverter := typeIsParam(typ); paramConverter != nil {
+		return paramConverter
 	}
 
 	interfaceType := reflect.TypeOf((*FromRequest)(nil)).Elem()
@@ -107,40 +298,164 @@ func inputConverter(typ reflect.Type) *Converter {
 		}
 	}
 
+	if hasBindTags(typ) {
+		return &Converter{
+			Type:           typ,
+			IsPointer:      typ.Kind() == reflect.Ptr,
+			ConversionType: ConvertStruct,
+		}
+	}
+
 	return &Converter{
 		Type:           typ,
 		ConversionType: ConvertBody,
 	}
 }
 
-func typeIsQueryParam(typ reflect.Type) *Converter {
-	const suffix = "QueryParam"
+// hasValidate checks for a type with a Validate() error method, either on
+// the type itself or on what it points to
+func hasValidate(typ reflect.Type) bool {
+	validatorType := reflect.TypeOf((*Validator)(nil)).Elem()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Implements(validatorType) || reflect.PtrTo(typ).Implements(validatorType)
+}
+
+// hasValidateTags checks for a struct with fields tagged with rules for
+// plumbus.ValidateStruct, including in nested structs and in the
+// elements of slices, arrays, and maps
+func hasValidateTags(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice ||
+		typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return false
+	}
+	seen[typ] = true
 
-	paramType := typ
-	typeName := typ.Name()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if _, ok := field.Tag.Lookup("validate"); ok {
+			return true
+		}
+		if hasValidateTags(field.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBindTags checks for a struct with fields tagged to be filled from
+// the request, as in `plumbus:"query=limit"`
+func hasBindTags(typ reflect.Type) bool {
 	if typ.Kind() == reflect.Ptr {
-		paramType = typ.Elem()
-		typeName = paramType.Name()
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return false
 	}
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := typ.Field(i).Tag.Lookup("plumbus"); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	if !strings.HasSuffix(typeName, suffix) {
-		return nil
+// typeIsFile checks for plumbus.File, or a type like avatarFile defined
+// from it, which names the form field
+func typeIsFile(typ reflect.Type) *Converter {
+	fileParamType := typ
+	if typ.Kind() == reflect.Ptr {
+		fileParamType = typ.Elem()
 	}
 
-	var conv ConversionType
-	switch paramType.Kind() {
-	case reflect.String:
-		conv = ConvertStringQueryParam
-	case reflect.Int:
-		conv = ConvertIntQueryParam
-	default:
-		log.Fatalf("query parameter types must be string or int kind")
+	name := ""
+	if fileParamType != fileType {
+		typeName := fileParamType.Name()
+		if fileParamType.Kind() != reflect.Struct ||
+			!fileParamType.ConvertibleTo(fileType) ||
+			!strings.HasSuffix(typeName, "File") {
+			return nil
+		}
+		name = strings.TrimSuffix(typeName, "File")
 	}
 
 	return &Converter{
-		Name:           strings.TrimSuffix(typeName, suffix),
-		ConversionType: conv,
+		Name:           name,
+		ConversionType: ConvertFile,
 		Type:           typ,
 		IsPointer:      typ.Kind() == reflect.Ptr,
 	}
 }
+
+func typeIsParam(typ reflect.Type) *Converter {
+	paramType := typ
+	typeName := typ.Name()
+	if typ.Kind() == reflect.Ptr {
+		paramType = typ.Elem()
+		typeName = paramType.Name()
+	}
+
+	for _, param := range paramSuffixes {
+		if !strings.HasSuffix(typeName, param.suffix) {
+			continue
+		}
+
+		var conv ConversionType
+		switch paramType.Kind() {
+		case reflect.String:
+			conv = ConvertStringParam
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			conv = ConvertIntParam
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			conv = ConvertUintParam
+		case reflect.Float32, reflect.Float64:
+			conv = ConvertFloatParam
+		case reflect.Bool:
+			conv = ConvertBoolParam
+		case reflect.Struct:
+			conv = ConvertRegisteredParam
+			if paramType.ConvertibleTo(timeType) {
+				conv = ConvertTimeParam
+			}
+		default:
+			//parsed by a func given to plumbus.RegisterParamKind
+			conv = ConvertRegisteredParam
+		}
+
+		defaulterType := reflect.TypeOf((*Defaulter)(nil)).Elem()
+		enumerType := reflect.TypeOf((*Enumer)(nil)).Elem()
+
+		name := strings.TrimSuffix(typeName, param.suffix)
+		if param.source == SourceHeader {
+			name = headerName(name)
+		}
+
+		return &Converter{
+			Name:           name,
+			Source:         param.source,
+			ConversionType: conv,
+			Type:           typ,
+			IsPointer:      typ.Kind() == reflect.Ptr,
+			HasDefault:     paramType.Implements(defaulterType),
+			HasEnum:        paramType.Implements(enumerType),
+		}
+	}
+
+	return nil
+}
+
+// headerName turns a name like xRequestId into a header like X-Request-Id
+func headerName(name string) string {
+	var header strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			header.WriteByte('-')
+		}
+		header.WriteRune(r)
+	}
+	return textproto.CanonicalMIMEHeaderKey(header.String())
+}
@@ -0,0 +1,171 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"text/template"
+)
+
+// Plugin adds a kind of handler argument that plumbus doesn't know, such
+// as a tenant id taken from the host name, to the adaptors of handlers
+// taking it and to the documentation of their routes. A plugin is
+// registered with RegisterPlugin in an init func of the package defining
+// its types, so it's registered in both the server and the program
+// generating its adaptors, as in:
+//
+//	func init() {
+//		generate.RegisterPlugin(&generate.Plugin{
+//			Name:  "tenant",
+//			Match: func(typ reflect.Type) bool { return typ == reflect.TypeOf(ID("")) },
+//			Extract: func(req *http.Request, typ reflect.Type) (interface{}, error) {
+//				return FromHost(req.Host)
+//			},
+//			Code:    "{{.Var}}, err = tenant.FromHost(req.Host)",
+//			Imports: []string{"example.com/tenant"},
+//			Describe: func(typ reflect.Type) generate.PluginDoc {
+//				return generate.PluginDoc{Note: "The tenant is taken from the host name."}
+//			},
+//		})
+//	}
+type Plugin struct {
+	// Name identifies the plugin, and must be unique
+	Name string
+
+	// Match reports whether the plugin makes arguments of a type. The
+	// plugins are checked in the order they're registered, before any
+	// other kind of argument but those given to handlers as is, like
+	// context.Context and *http.Request.
+	Match func(typ reflect.Type) bool
+
+	// Extract makes an argument of the type from a request, for handlers
+	// adapted by reflection or without Code. An error is responded to
+	// like an error from FromRequest.
+	Extract func(req *http.Request, typ reflect.Type) (interface{}, error)
+
+	// Code is the Go code that makes the argument in a generated adaptor,
+	// as a text/template given a PluginArg. It sets {{.Var}}, and sets
+	// err if the argument can't be made. The request is req.
+	Code string
+
+	// Imports are the paths of the packages that Code uses
+	Imports []string
+
+	// Describe documents what an argument of the type takes from the
+	// request. It may be nil.
+	Describe func(typ reflect.Type) PluginDoc
+}
+
+// PluginArg is given to a Plugin's Code
+type PluginArg struct {
+	// Var is the variable to set
+	Var string
+
+	// Type is the argument's type, as written in the generated file
+	Type string
+}
+
+// PluginDoc documents what a plugin's argument takes from a request
+type PluginDoc struct {
+	// Params are the params the argument is made from
+	Params []PluginParam
+
+	// BodyMediaType is the media type of the request body the argument is
+	// decoded from, if it's made from the body
+	BodyMediaType string
+
+	// Note describes the argument in the documentation of the routes
+	Note string
+}
+
+// PluginParam is a param a plugin's argument is made from
+type PluginParam struct {
+	Name        string
+	Source      ParamSource
+	Description string
+	Required    bool
+
+	// Type is the type of the param's value, or string if it's nil
+	Type reflect.Type
+}
+
+var plugins struct {
+	sync.RWMutex
+	list   []*Plugin
+	byName map[string]*Plugin
+}
+
+// RegisterPlugin adds a plugin, panicking if its name is taken
+func RegisterPlugin(plugin *Plugin) {
+	plugins.Lock()
+	defer plugins.Unlock()
+	if plugin.Name == "" || plugin.Match == nil || plugin.Extract == nil {
+		panic(fmt.Errorf("plugin %q needs a Name, Match, and Extract", plugin.Name))
+	}
+	if plugins.byName == nil {
+		plugins.byName = map[string]*Plugin{}
+	}
+	if _, ok := plugins.byName[plugin.Name]; ok {
+		panic(fmt.Errorf("plugin %q is already registered", plugin.Name))
+	}
+	plugins.byName[plugin.Name] = plugin
+	plugins.list = append(plugins.list, plugin)
+}
+
+// PluginExtractor is the Extract func of a registered plugin, for
+// arguments of a type. Generated adaptors use it for plugins without
+// Code.
+func PluginExtractor(name string, typ reflect.Type) func(*http.Request) (interface{}, error) {
+	plugins.RLock()
+	plugin, ok := plugins.byName[name]
+	plugins.RUnlock()
+	if !ok {
+		panic(fmt.Errorf("plugin %q isn't registered", name))
+	}
+	return func(req *http.Request) (interface{}, error) {
+		return plugin.Extract(req, typ)
+	}
+}
+
+// typeIsPlugin checks for a type made by a registered plugin
+func typeIsPlugin(typ reflect.Type) *Converter {
+	plugins.RLock()
+	defer plugins.RUnlock()
+	for _, plugin := range plugins.list {
+		if plugin.Match(typ) {
+			return &Converter{
+				Name:           plugin.Name,
+				ConversionType: ConvertPlugin,
+				Type:           typ,
+				IsPointer:      typ.Kind() == reflect.Ptr,
+				Plugin:         plugin,
+			}
+		}
+	}
+	return nil
+}
+
+// PluginDoc documents the argument made by a plugin, if the converter is
+// for one
+func (c *Converter) PluginDoc() PluginDoc {
+	if c.Plugin == nil || c.Plugin.Describe == nil {
+		return PluginDoc{}
+	}
+	return c.Plugin.Describe(c.Type)
+}
+
+// pluginCode is the code of a generated adaptor making an argument with
+// the plugin's Code
+func pluginCode(plugin *Plugin, arg PluginArg) (string, error) {
+	tmpl, err := template.New(plugin.Name).Option("missingkey=error").Parse(plugin.Code)
+	if err != nil {
+		return "", fmt.Errorf("plugin %q: %v", plugin.Name, err)
+	}
+	var code bytes.Buffer
+	if err := tmpl.Execute(&code, arg); err != nil {
+		return "", fmt.Errorf("plugin %q: %v", plugin.Name, err)
+	}
+	return code.String(), nil
+}
@@ -1,6 +1,11 @@
 package generate
 
-import "net/http"
+import (
+	"io"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
 
 type HTTPError interface {
 	error
@@ -14,3 +19,32 @@ type FromRequest interface {
 type ToResponse interface {
 	ToResponse(http.ResponseWriter) error
 }
+
+type Defaulter interface {
+	Default() interface{}
+}
+
+type Enumer interface {
+	Enum() []string
+}
+
+type Validator interface {
+	Validate() error
+}
+
+// File is an uploaded file from a multipart form. A param of type File
+// takes the only file in the form, and a param of a type defined from it
+// takes the field its name gives, as in `type avatarFile plumbus.File`.
+type File struct {
+	Name        string
+	Size        int64
+	ContentType string
+	io.ReadCloser
+}
+
+// WSConn is a websocket connection. A handler that takes a *WSConn is
+// called once the request is upgraded, after its other params have been
+// converted and validated.
+type WSConn struct {
+	*websocket.Conn
+}
@@ -0,0 +1,344 @@
+package generate
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidateRule is one of the rules of a `validate` tag, like min=1
+type ValidateRule struct {
+	Name    string
+	Arg     string
+	Limit   float64
+	Regexp  *regexp.Regexp
+	Allowed []string
+}
+
+// ParseValidateRules parses the rules of a field's `validate` tag,
+// checking that they can be used on the field's type
+func ParseValidateRules(typ reflect.Type, tag string) ([]ValidateRule, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	var rules []ValidateRule
+	for _, rule := range splitRules(tag) {
+		parts := strings.SplitN(rule, "=", 2)
+		r := ValidateRule{Name: parts[0]}
+		if len(parts) == 2 {
+			r.Arg = parts[1]
+		}
+
+		switch r.Name {
+		case "required":
+		case "min", "max":
+			limit, err := strconv.ParseFloat(r.Arg, 64)
+			if err != nil || math.IsInf(limit, 0) || math.IsNaN(limit) {
+				return nil, fmt.Errorf("bad validate rule %s=%s, expected a number", r.Name, r.Arg)
+			}
+			r.Limit = limit
+			switch typ.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64,
+				reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			default:
+				return nil, fmt.Errorf("validate rules min and max used on %s field", typ)
+			}
+		case "regexp":
+			if typ.Kind() != reflect.String {
+				return nil, fmt.Errorf("validate rule regexp used on %s field", typ)
+			}
+			re, err := regexp.Compile(r.Arg)
+			if err != nil {
+				return nil, fmt.Errorf("bad validate rule regexp=%s: %v", r.Arg, err)
+			}
+			r.Regexp = re
+		case "oneof":
+			r.Allowed = strings.Fields(r.Arg)
+		default:
+			return nil, fmt.Errorf("unknown validate rule %s", r.Name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// splitRules splits a tag on commas, except within a trailing regexp rule
+func splitRules(tag string) []string {
+	var rules []string
+	for tag != "" {
+		if strings.HasPrefix(tag, "regexp=") {
+			return append(rules, tag)
+		}
+		parts := strings.SplitN(tag, ",", 2)
+		rules = append(rules, parts[0])
+		tag = ""
+		if len(parts) == 2 {
+			tag = parts[1]
+		}
+	}
+	return rules
+}
+
+// FieldName is the name of the field in json, or in a form for fields
+// only tagged for forms
+func FieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		name := strings.Split(field.Tag.Get(key), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// validateCode is the code that checks the `validate` tags of the structs
+// that the value of expr may hold, the way plumbus.ValidateStruct does,
+// adding a plumbus.FieldError to errs for each failure. A struct type
+// nested in itself is checked with plumbus.ValidateAt, by reflection.
+func validateCode(typ reflect.Type, expr string) (string, error) {
+	g := &validateGen{inside: map[reflect.Type]bool{}}
+	if err := g.value(typ, expr, nil); err != nil {
+		return "", err
+	}
+	return g.code.String(), nil
+}
+
+type validateGen struct {
+	code   strings.Builder
+	vars   int
+	inside map[reflect.Type]bool
+}
+
+// namePart is a piece of the name of a field, either literal text or
+// code for a string, like an index
+type namePart struct {
+	text    string
+	literal bool
+}
+
+func literal(text string) namePart {
+	return namePart{text: text, literal: true}
+}
+
+// nameCode is the code for the string of a field's name
+func nameCode(name []namePart) string {
+	var parts []string
+	text := ""
+	for _, part := range name {
+		if part.literal {
+			text += part.text
+			continue
+		}
+		if text != "" {
+			parts = append(parts, strconv.Quote(text))
+			text = ""
+		}
+		parts = append(parts, part.text)
+	}
+	if text != "" || len(parts) == 0 {
+		parts = append(parts, strconv.Quote(text))
+	}
+	return strings.Join(parts, " + ")
+}
+
+func (g *validateGen) newVar(prefix string) string {
+	g.vars++
+	return fmt.Sprintf("%s%d", prefix, g.vars)
+}
+
+func (g *validateGen) line(format string, args ...interface{}) {
+	fmt.Fprintf(&g.code, format+"\n", args...)
+}
+
+// value checks the structs that the value of expr may hold, named name
+func (g *validateGen) value(typ reflect.Type, expr string, name []namePart) error {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		if !hasValidateTags(typ, map[reflect.Type]bool{}) {
+			return nil
+		}
+		v := g.newVar("v")
+		g.line("if %s := %s; %s != nil {", v, expr, v)
+		if err := g.value(typ.Elem(), "(*"+v+")", name); err != nil {
+			return err
+		}
+		g.line("}")
+	case reflect.Slice, reflect.Array:
+		if !hasValidateTags(typ.Elem(), map[reflect.Type]bool{}) {
+			return nil
+		}
+		i := g.newVar("i")
+		g.line("for %s := range %s {", i, expr)
+		name := append(name[:len(name):len(name)], literal("["), namePart{text: "strconv.Itoa(" + i + ")"}, literal("]"))
+		if err := g.value(typ.Elem(), expr+"["+i+"]", name); err != nil {
+			return err
+		}
+		g.line("}")
+	case reflect.Map:
+		if !hasValidateTags(typ.Elem(), map[reflect.Type]bool{}) {
+			return nil
+		}
+		k := g.newVar("k")
+		g.line("for _, %s := range plumbus.SortedKeys(%s) {", k, expr)
+		name := append(name[:len(name):len(name)], literal("["), namePart{text: "fmt.Sprint(" + k + ")"}, literal("]"))
+		if err := g.value(typ.Elem(), expr+"["+k+"]", name); err != nil {
+			return err
+		}
+		g.line("}")
+	case reflect.Struct:
+		return g.fields(typ, expr, name)
+	}
+	return nil
+}
+
+// fields checks the rules of the fields of a struct, and the structs
+// they hold
+func (g *validateGen) fields(typ reflect.Type, expr string, name []namePart) error {
+	if !hasValidateTags(typ, map[reflect.Type]bool{}) {
+		return nil
+	}
+	if g.inside[typ] {
+		g.line("errs = append(errs, plumbus.ValidateAt(%s, %s)...)", expr, nameCode(name))
+		return nil
+	}
+	g.inside[typ] = true
+	defer delete(g.inside, typ)
+
+	prefix := name[:len(name):len(name)]
+	if len(name) > 0 {
+		prefix = append(prefix, literal("."))
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldExpr := expr + "." + field.Name
+		fieldName := append(prefix[:len(prefix):len(prefix)], literal(FieldName(field)))
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			rules, err := ParseValidateRules(field.Type, tag)
+			if err != nil {
+				return fmt.Errorf("field %s of %s: %v", field.Name, typ, err)
+			}
+			for _, rule := range rules {
+				g.rule(rule, field.Type, fieldExpr, fieldName)
+			}
+		}
+		if err := g.value(field.Type, fieldExpr, fieldName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rule checks a field's value against one of its rules
+func (g *validateGen) rule(rule ValidateRule, typ reflect.Type, expr string, name []namePart) {
+	fail := func(msg string) {
+		g.line("errs = append(errs, plumbus.FieldError{Field: %s, Message: %s})", nameCode(name), strconv.Quote(msg))
+	}
+
+	if rule.Name == "required" {
+		g.line("if %s {", zeroCheck(typ, expr))
+		fail("is required")
+		g.line("}")
+		return
+	}
+
+	// the other rules skip nil pointers
+	closing := 0
+	for typ.Kind() == reflect.Ptr {
+		v := g.newVar("v")
+		g.line("if %s := %s; %s != nil {", v, expr, v)
+		closing++
+		typ, expr = typ.Elem(), "*"+v
+	}
+
+	switch rule.Name {
+	case "min", "max":
+		size, msg := "float64("+expr+")", "must be"
+		switch typ.Kind() {
+		case reflect.String:
+			size, msg = "float64(utf8.RuneCountInString(string("+expr+")))", "must have length"
+		case reflect.Slice, reflect.Map, reflect.Array:
+			size, msg = "float64(len("+expr+"))", "must have length"
+		}
+		limit := strconv.FormatFloat(rule.Limit, 'g', -1, 64)
+		if rule.Name == "min" {
+			g.line("if %s < %s {", size, limit)
+			fail(msg + " at least " + rule.Arg)
+		} else {
+			g.line("if %s > %s {", size, limit)
+			fail(msg + " at most " + rule.Arg)
+		}
+		g.line("}")
+	case "regexp":
+		g.line("if !plumbus.MatchesRule(%s, string(%s)) {", strconv.Quote(rule.Arg), expr)
+		fail("must match " + rule.Arg)
+		g.line("}")
+	case "oneof":
+		allowed := make([]string, len(rule.Allowed))
+		for i, a := range rule.Allowed {
+			allowed[i] = strconv.Quote(a)
+		}
+		g.line("switch %s {", formatCode(typ, expr))
+		if len(allowed) > 0 {
+			g.line("case %s:", strings.Join(allowed, ", "))
+		}
+		g.line("default:")
+		fail("must be one of " + strings.Join(rule.Allowed, ", "))
+		g.line("}")
+	}
+
+	for ; closing > 0; closing-- {
+		g.line("}")
+	}
+}
+
+// zeroCheck is the code reporting whether the value of expr is the zero
+// value of its type
+func zeroCheck(typ reflect.Type, expr string) string {
+	switch typ.Kind() {
+	case reflect.String:
+		return expr + ` == ""`
+	case reflect.Bool:
+		return "!" + expr
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return expr + " == 0"
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Chan,
+		reflect.Func, reflect.UnsafePointer:
+		return expr + " == nil"
+	}
+	if typ.Comparable() {
+		return "plumbus.IsZero(" + expr + ")"
+	}
+	// a struct or array of values that can't be compared
+	return "reflect.ValueOf(" + expr + ").IsZero()"
+}
+
+// formatCode is the code for the value of expr as fmt.Sprint would write
+// it, as it's compared to the values oneof allows
+func formatCode(typ reflect.Type, expr string) string {
+	if typ.NumMethod() > 0 {
+		// a String or Error method changes how it's written
+		return "fmt.Sprint(" + expr + ")"
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return "string(" + expr + ")"
+	case reflect.Bool:
+		return "strconv.FormatBool(bool(" + expr + "))"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "strconv.FormatInt(int64(" + expr + "), 10)"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "strconv.FormatUint(uint64(" + expr + "), 10)"
+	}
+	return "fmt.Sprint(" + expr + ")"
+}
@@ -0,0 +1,327 @@
+package plumbus
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+// Handle0 adapts a handler without arguments, like Handle1.
+func Handle0[R any](fn func() (R, error)) http.Handler {
+	a := newTypedAdaptor(fn)
+	return a.handler(func(r *typedRequest) {
+		if !r.decoded() || !r.intercept() {
+			return
+		}
+		result, err := fn()
+		respond(r, a.info, result, err)
+	})
+}
+
+// Handle1 adapts a handler with an adaptor made by the compiler from its
+// type parameters, rather than by reflection or by the plumbus command,
+// as in:
+//
+//	mux.Handle("/users/:userId", plumbus.Handle1(getUser))
+//
+// The arguments and result are handled the same as for any other
+// handler, and the route is documented from the handler's signature.
+// Only params and files are still set with reflection. Handle0 through
+// Handle4 cover handlers with up to four arguments that return a result
+// and an error.
+func Handle1[P1, R any](fn func(P1) (R, error)) http.Handler {
+	a := newTypedAdaptor(fn)
+	in1 := newTypedInput[P1](a.info.Inputs[0])
+	return a.handler(func(r *typedRequest) {
+		p1 := in1.decode(r)
+		if !r.decoded() {
+			return
+		}
+		in1.validate(r, &p1)
+		if !r.intercept(ArgOf(p1)) {
+			return
+		}
+		result, err := fn(p1)
+		respond(r, a.info, result, err)
+	})
+}
+
+// Handle2 adapts a handler with two arguments, like Handle1.
+func Handle2[P1, P2, R any](fn func(P1, P2) (R, error)) http.Handler {
+	a := newTypedAdaptor(fn)
+	in1 := newTypedInput[P1](a.info.Inputs[0])
+	in2 := newTypedInput[P2](a.info.Inputs[1])
+	return a.handler(func(r *typedRequest) {
+		p1, p2 := in1.decode(r), in2.decode(r)
+		if !r.decoded() {
+			return
+		}
+		in1.validate(r, &p1)
+		in2.validate(r, &p2)
+		if !r.intercept(ArgOf(p1), ArgOf(p2)) {
+			return
+		}
+		result, err := fn(p1, p2)
+		respond(r, a.info, result, err)
+	})
+}
+
+// Handle3 adapts a handler with three arguments, like Handle1.
+func Handle3[P1, P2, P3, R any](fn func(P1, P2, P3) (R, error)) http.Handler {
+	a := newTypedAdaptor(fn)
+	in1 := newTypedInput[P1](a.info.Inputs[0])
+	in2 := newTypedInput[P2](a.info.Inputs[1])
+	in3 := newTypedInput[P3](a.info.Inputs[2])
+	return a.handler(func(r *typedRequest) {
+		p1, p2, p3 := in1.decode(r), in2.decode(r), in3.decode(r)
+		if !r.decoded() {
+			return
+		}
+		in1.validate(r, &p1)
+		in2.validate(r, &p2)
+		in3.validate(r, &p3)
+		if !r.intercept(ArgOf(p1), ArgOf(p2), ArgOf(p3)) {
+			return
+		}
+		result, err := fn(p1, p2, p3)
+		respond(r, a.info, result, err)
+	})
+}
+
+// Handle4 adapts a handler with four arguments, like Handle1.
+func Handle4[P1, P2, P3, P4, R any](fn func(P1, P2, P3, P4) (R, error)) http.Handler {
+	a := newTypedAdaptor(fn)
+	in1 := newTypedInput[P1](a.info.Inputs[0])
+	in2 := newTypedInput[P2](a.info.Inputs[1])
+	in3 := newTypedInput[P3](a.info.Inputs[2])
+	in4 := newTypedInput[P4](a.info.Inputs[3])
+	return a.handler(func(r *typedRequest) {
+		p1, p2, p3, p4 := in1.decode(r), in2.decode(r), in3.decode(r), in4.decode(r)
+		if !r.decoded() {
+			return
+		}
+		in1.validate(r, &p1)
+		in2.validate(r, &p2)
+		in3.validate(r, &p3)
+		in4.validate(r, &p4)
+		if !r.intercept(ArgOf(p1), ArgOf(p2), ArgOf(p3), ArgOf(p4)) {
+			return
+		}
+		result, err := fn(p1, p2, p3, p4)
+		respond(r, a.info, result, err)
+	})
+}
+
+// typedAdaptor is the adaptor of a handler given to Handle0 through
+// Handle4. Its info is collected once, when the handler is adapted.
+type typedAdaptor struct {
+	fn   interface{}
+	info *generate.Info
+}
+
+func newTypedAdaptor(fn interface{}) *typedAdaptor {
+	info, err := generate.CollectInfo(reflect.TypeOf(fn))
+	if err == nil {
+		err = checkInputs(info)
+	}
+	if err != nil {
+		panic(fmt.Errorf("handler %s: %v", handlerName(fn), err))
+	}
+	if info.WebSocketIndex != -1 {
+		panic(fmt.Errorf("websocket handler %s can't be adapted by its type parameters, use Handle", handlerName(fn)))
+	}
+	return &typedAdaptor{fn: fn, info: info}
+}
+
+func (a *typedAdaptor) handler(serve func(r *typedRequest)) http.Handler {
+	return &typedHandler{
+		fn: a.fn,
+		serve: func(res http.ResponseWriter, req *http.Request) {
+			r := &typedRequest{res: res, req: req}
+			if a.info.UsesQueryParams {
+				r.query = req.URL.Query()
+			}
+			serve(r)
+		},
+	}
+}
+
+// typedHandler is the http.Handler made by Handle0 through Handle4. The
+// routes keep its handler function, so it's documented and authorized
+// like any other.
+type typedHandler struct {
+	fn    interface{}
+	serve http.HandlerFunc
+}
+
+func (h *typedHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	h.serve(res, req)
+}
+
+// typedFunc is the handler function of a handler made by Handle0 through
+// Handle4, or else the handler itself
+func typedFunc(handler interface{}) interface{} {
+	if typed, ok := handler.(*typedHandler); ok {
+		return typed.fn
+	}
+	return handler
+}
+
+// typedRequest is the state of a request served by a typedAdaptor
+type typedRequest struct {
+	res   http.ResponseWriter
+	req   *http.Request
+	query url.Values
+	errs  ValidationErrors
+	err   error
+}
+
+// decoded responds with any error from decoding the arguments, returning
+// whether the handler can go on
+func (r *typedRequest) decoded() bool {
+	if r.err == nil && len(r.errs) > 0 {
+		r.err = r.errs
+	}
+	if r.err != nil {
+		HandleResponseError(r.res, r.req, r.err)
+		return false
+	}
+	return true
+}
+
+// intercept responds with any error from validating the arguments or
+// from the interceptors, returning whether the handler can be called
+func (r *typedRequest) intercept(args ...Arg) bool {
+	if r.err == nil {
+		r.err = RunInterceptors(r.req, args...)
+	}
+	if r.err != nil {
+		HandleResponseError(r.res, r.req, r.err)
+		return false
+	}
+	return true
+}
+
+// typedInput decodes an argument of type P
+type typedInput[P any] struct {
+	converter *generate.Converter
+	get       func(r *typedRequest) (P, error)
+}
+
+func newTypedInput[P any](converter *generate.Converter) *typedInput[P] {
+	in := &typedInput[P]{converter: converter}
+
+	var zero P
+	switch converter.ConversionType {
+	case generate.ConvertBody:
+		in.get = func(r *typedRequest) (p P, err error) {
+			return p, DecodeBody(r.req, &p)
+		}
+	case generate.ConvertCustom:
+		if _, ok := interface{}(&zero).(FromRequest); ok {
+			in.get = func(r *typedRequest) (p P, err error) {
+				return p, interface{}(&p).(FromRequest).FromRequest(r.req)
+			}
+		}
+	case generate.ConvertStruct:
+		if !converter.IsPointer {
+			in.get = func(r *typedRequest) (p P, err error) {
+				return p, BindStruct(r.req, &p)
+			}
+		}
+	case generate.ConvertContext:
+		in.get = func(r *typedRequest) (P, error) {
+			return interface{}(r.req.Context()).(P), nil
+		}
+	case generate.ConvertRequest:
+		in.get = func(r *typedRequest) (P, error) {
+			return interface{}(r.req).(P), nil
+		}
+	case generate.ConvertResponseWriter:
+		in.get = func(r *typedRequest) (P, error) {
+			return interface{}(r.res).(P), nil
+		}
+	case generate.ConvertBodyReader:
+		in.get = func(r *typedRequest) (P, error) {
+			return interface{}(r.req.Body).(P), nil
+		}
+	case generate.ConvertRawBody:
+		in.get = func(r *typedRequest) (p P, err error) {
+			body, err := ReadBody(r.req)
+			if err != nil {
+				return p, err
+			}
+			return interface{}(body).(P), nil
+		}
+	}
+
+	if in.get == nil {
+		// params, files, and pointers to a new value of their type
+		in.get = func(r *typedRequest) (p P, err error) {
+			val, err := dynamicInput(converter, r.res, r.req, r.query)
+			p, _ = val.Elem().Interface().(P)
+			return p, err
+		}
+	}
+	return in
+}
+
+// decode decodes the argument, keeping validation errors in the request
+// so that every argument is checked before responding
+func (in *typedInput[P]) decode(r *typedRequest) P {
+	var p P
+	if r.err != nil {
+		return p
+	}
+	p, err := in.get(r)
+	if r.errs, r.err = CollectErrors(r.errs, err); r.err != nil {
+		return p
+	}
+	if in.converter.HasValidateTags {
+		if err := ValidateStruct(&p); err != nil {
+			r.errs = append(r.errs, err.(ValidationErrors)...)
+		}
+	}
+	return p
+}
+
+// validate calls the argument's Validate method, if it has one
+func (in *typedInput[P]) validate(r *typedRequest, p *P) {
+	if r.err == nil && in.converter.HasValidate {
+		r.err = Validate(p)
+	}
+}
+
+// respond writes the handler's result, as the response body, a status
+// code, or with its ToResponse method
+func respond[R any](r *typedRequest, info *generate.Info, result R, err error) {
+	res, req := r.res, r.req
+	if err != nil {
+		HandleResponseError(res, req, err)
+		return
+	}
+
+	switch info.Outputs[0].ConversionType {
+	case generate.ConvertCustom:
+		toResponse, ok := interface{}(result).(ToResponse)
+		if !ok {
+			toResponse = interface{}(&result).(ToResponse)
+		}
+		if err := toResponse.ToResponse(res); err != nil {
+			HandleResponseError(res, req, err)
+			return
+		}
+	case generate.ConvertBody:
+		if err := EncodeResponse(res, req, result); err != nil {
+			HandleResponseError(res, req, err)
+			return
+		}
+	}
+
+	if info.NoContent {
+		WriteEmptyResponse(res, req)
+	}
+}
@@ -0,0 +1,510 @@
+package plumbus
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GoClientConfig configures the client made by ServeMux.GoClient
+type GoClientConfig struct {
+	// Package is the name of the client's package, "client" by default
+	Package string
+
+	// ShareTypes makes the client use the handlers' own exported types
+	// for bodies and results, importing their packages, rather than
+	// copying their definitions into the client
+	ShareTypes bool
+}
+
+// GoClient generates the source of a Go package for calling the mux's
+// routes, with a method of its Client for each route. Each method takes
+// the route's path params, body, and other params, and returns its
+// result and an error, as in:
+//
+//	src, err := mux.GoClient(plumbus.GoClientConfig{Package: "orders"})
+//	...
+//	os.WriteFile("orders/client.go", src, 0644)
+//
+// and then:
+//
+//	order, err := orders.New("https://orders.internal").GetOrder(ctx, 12)
+//
+// A response with an error status is returned as a *Error. Params taken
+// by custom FromRequest types, such as credentials, aren't part of the
+// methods, and can be added to every request with the Client's Header.
+// Streaming and websocket routes are left out.
+func (sm *ServeMux) GoClient(config GoClientConfig) ([]byte, error) {
+	if config.Package == "" {
+		config.Package = "client"
+	}
+	g := &goClient{
+		config:  config,
+		imports: map[string]string{},
+		aliases: map[string]bool{config.Package: true, "bytes": true, "context": true, "json": true, "fmt": true, "io": true, "multipart": true, "http": true, "url": true, "strings": true},
+		types:   map[reflect.Type]string{},
+		names:   map[string]bool{"Client": true, "Error": true, "New": true},
+	}
+
+	for _, route := range sm.clientRoutes() {
+		g.method(route)
+	}
+
+	var src strings.Builder
+	fmt.Fprintf(&src, "// Code generated by plumbus. DO NOT EDIT.\n\npackage %s\n\nimport (\n", config.Package)
+	for _, path := range []string{"bytes", "context", "encoding/json", "fmt", "io", "mime/multipart", "net/http", "net/url", "strings"} {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if alias := g.imports[path]; alias != path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(&src, "\t%s %q\n", alias, path)
+		} else {
+			fmt.Fprintf(&src, "\t%q\n", path)
+		}
+	}
+	src.WriteString(")\n")
+	src.WriteString(goClientRuntime)
+	src.WriteString(g.methods.String())
+	for _, def := range g.typeDefs {
+		src.WriteString(def)
+	}
+
+	return format.Source([]byte(src.String()))
+}
+
+type goClient struct {
+	config GoClientConfig
+
+	// local is the path of the package the code is part of, whose types
+	// are referred to by their own names
+	local string
+
+	imports  map[string]string
+	aliases  map[string]bool
+	types    map[reflect.Type]string
+	names    map[string]bool
+	typeDefs []string
+	methods  strings.Builder
+}
+
+func (g *goClient) method(route *clientRoute) {
+	m := &g.methods
+	fmt.Fprintf(m, "\n// %s calls %s %s", route.name, route.method, route.pattern)
+	for _, text := range []string{route.summary, route.description} {
+		if text != "" {
+			fmt.Fprintf(m, "\n//\n// %s", text)
+		}
+	}
+	if route.deprecated {
+		fmt.Fprintf(m, "\n//\n// Deprecated: the route is deprecated.")
+	}
+
+	args := []string{"ctx context.Context"}
+	used := map[string]bool{"ctx": true, "c": true, "body": true, "result": true, "err": true, "path": true, "query": true, "header": true}
+	var build []string
+
+	argNames := make([]string, len(route.params))
+	for i, param := range route.params {
+		name := identifier(param.name)
+		if used[name] || token.Lookup(name).IsKeyword() {
+			name += "Param"
+		}
+		used[name] = true
+		argNames[i] = name
+
+		typ := g.paramType(param.typ)
+		if !param.required {
+			typ = "*" + typ
+		}
+		args = append(args, name+" "+typ)
+	}
+
+	// the path is built from literals and escaped path params
+	var path []string
+	literal := ""
+	i := 0
+	for _, segment := range getSegments(route.pattern) {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			literal += "/" + segment
+			continue
+		}
+		path = append(path, strconv.Quote(literal+"/"))
+		literal = ""
+		value := goParamString(argNames[i], route.params[i].typ)
+		if route.params[i].catchAll {
+			path = append(path, value)
+		} else {
+			path = append(path, "url.PathEscape("+value+")")
+		}
+		i++
+	}
+	if literal != "" || len(path) == 0 {
+		path = append(path, strconv.Quote(literal))
+	}
+	if path[0] == `""` {
+		path[0] = `"/"`
+	}
+
+	for j, param := range route.params[i:] {
+		name := argNames[i+j]
+		var set string
+		switch param.in {
+		case "query":
+			set = fmt.Sprintf("query.Set(%q, %%s)", param.name)
+		case "header":
+			set = fmt.Sprintf("header.Set(%q, %%s)", param.name)
+		case "cookie":
+			set = fmt.Sprintf(`header.Add("Cookie", %q + %%s)`, param.name+"=")
+		default:
+			continue
+		}
+		if param.required {
+			build = append(build, fmt.Sprintf(set, goParamString(name, param.typ)))
+		} else {
+			build = append(build, fmt.Sprintf("if %s != nil {\n%s\n}", name, fmt.Sprintf(set, goParamString("*"+name, param.typ))))
+		}
+	}
+
+	bodyArg := "nil"
+	switch route.bodyKind {
+	case clientJSON:
+		args = append(args, "body "+g.typeName(route.body))
+		bodyArg = "body"
+		if route.body.Kind() == reflect.Ptr {
+			build = append(build, "var reqBody interface{}\nif body != nil {\nreqBody = body\n}")
+			bodyArg = "reqBody"
+		}
+	case clientRaw:
+		args = append(args, "body io.Reader")
+		bodyArg = "body"
+		if route.bodyMediaType != "" {
+			build = append(build, fmt.Sprintf("header.Set(\"Content-Type\", %q)", route.bodyMediaType))
+		}
+	case clientFile:
+		args = append(args, "body io.Reader")
+		bodyArg = fmt.Sprintf("formFile{%q, body}", route.fileField)
+	}
+
+	result, resultArg := "", "nil"
+	switch route.resultKind {
+	case clientJSON:
+		result = g.typeName(route.result)
+	case clientText:
+		result = "string"
+	case clientRaw:
+		result = "[]byte"
+	}
+	if result != "" {
+		resultArg = "&result"
+		fmt.Fprintf(m, "\nfunc (c *Client) %s(%s) (%s, error) {\n", route.name, strings.Join(args, ", "), result)
+	} else {
+		fmt.Fprintf(m, "\nfunc (c *Client) %s(%s) error {\n", route.name, strings.Join(args, ", "))
+	}
+
+	fmt.Fprintf(m, "path := %s\nquery := url.Values{}\nheader := http.Header{}\n", strings.Join(path, " + "))
+	for _, line := range build {
+		m.WriteString(line + "\n")
+	}
+	if result != "" {
+		fmt.Fprintf(m, "var result %s\nerr := c.do(ctx, %q, path, query, header, %s, %s)\nreturn result, err\n}\n", result, route.method, bodyArg, resultArg)
+	} else {
+		fmt.Fprintf(m, "return c.do(ctx, %q, path, query, header, %s, nil)\n}\n", route.method, bodyArg)
+	}
+}
+
+// paramType is the type of a param's argument: a time, or the basic type
+// its own type is defined from, or else a string
+func (g *goClient) paramType(typ reflect.Type) string {
+	if isTimeType(typ) {
+		return g.importPackage("time") + ".Time"
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return typ.Kind().String()
+	}
+	return "string"
+}
+
+// goParamString is the code formatting a param's argument for a request
+func goParamString(expr string, typ reflect.Type) string {
+	switch {
+	case isTimeType(typ) && strings.HasPrefix(expr, "*"):
+		return "(" + expr + ").Format(time.RFC3339)"
+	case isTimeType(typ):
+		return expr + ".Format(time.RFC3339)"
+	case typ.Kind() == reflect.String || !isBasicKind(typ.Kind()):
+		return expr
+	}
+	return "fmt.Sprint(" + expr + ")"
+}
+
+func isBasicKind(kind reflect.Kind) bool {
+	return kind >= reflect.Bool && kind <= reflect.Float64 || kind == reflect.String
+}
+
+// typeName refers to a type in the client, copying its definition or
+// importing its package as needed
+func (g *goClient) typeName(typ reflect.Type) string {
+	if isTimeType(typ) && typ.PkgPath() == "time" {
+		return g.importPackage("time") + ".Time"
+	}
+
+	if typ.Name() != "" && typ.PkgPath() != "" {
+		if typ.PkgPath() == g.local && !strings.Contains(typ.Name(), "[") {
+			return typ.Name()
+		}
+		if name, ok := g.types[typ]; ok {
+			return name
+		}
+		if g.config.ShareTypes && token.IsExported(typ.Name()) && !strings.Contains(typ.Name(), "[") {
+			if pkg := typ.PkgPath(); pkg != "main" && !strings.HasSuffix(pkg, "_test") {
+				name := g.importPackage(pkg) + "." + typ.Name()
+				g.types[typ] = name
+				return name
+			}
+		}
+		return g.copyType(typ)
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return "*" + g.typeName(typ.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeName(typ.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", typ.Len(), g.typeName(typ.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", g.typeName(typ.Key()), g.typeName(typ.Elem()))
+	case reflect.Struct:
+		return g.structType(typ)
+	case reflect.Interface, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return "interface{}"
+	}
+	return typ.Kind().String()
+}
+
+// copyType adds the definition of a named type to the client
+func (g *goClient) copyType(typ reflect.Type) string {
+	name := upperFirst(identifier(typeName(typ)))
+	base := name
+	for i := 2; g.names[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.names[name] = true
+	g.types[typ] = name
+
+	var def string
+	switch {
+	case typ.Implements(openAPIMarshalerType) || reflect.PtrTo(typ).Implements(openAPIMarshalerType):
+		// its JSON doesn't follow from its fields
+		def = "json.RawMessage"
+	case typ.Kind() == reflect.Struct:
+		def = g.structType(typ)
+	case isBasicKind(typ.Kind()):
+		def = typ.Kind().String()
+	default:
+		// the definition of a slice or map of another type
+		switch typ.Kind() {
+		case reflect.Slice:
+			def = "[]" + g.typeName(typ.Elem())
+		case reflect.Array:
+			def = fmt.Sprintf("[%d]%s", typ.Len(), g.typeName(typ.Elem()))
+		case reflect.Map:
+			def = fmt.Sprintf("map[%s]%s", g.typeName(typ.Key()), g.typeName(typ.Elem()))
+		case reflect.Ptr:
+			def = "*" + g.typeName(typ.Elem())
+		default:
+			def = "interface{}"
+		}
+	}
+
+	doc := ""
+	if typ.Kind() == reflect.Struct {
+		doc = fmt.Sprintf("// %s is a copy of %s\n", name, typ)
+	}
+	g.typeDefs = append(g.typeDefs, fmt.Sprintf("\n%stype %s %s\n", doc, name, def))
+	return name
+}
+
+// structType is the definition of a struct with the exported fields of
+// typ and their json tags
+func (g *goClient) structType(typ reflect.Type) string {
+	var def strings.Builder
+	def.WriteString("struct {\n")
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag := ""
+		if json, ok := field.Tag.Lookup("json"); ok {
+			tag = fmt.Sprintf(" `json:%q`", json)
+		}
+		if field.Anonymous {
+			fmt.Fprintf(&def, "%s%s\n", g.typeName(field.Type), tag)
+		} else {
+			fmt.Fprintf(&def, "%s %s%s\n", field.Name, g.typeName(field.Type), tag)
+		}
+	}
+	def.WriteString("}")
+	return def.String()
+}
+
+// importPackage imports a package into the client, returning its alias
+func (g *goClient) importPackage(path string) string {
+	if alias, ok := g.imports[path]; ok {
+		return alias
+	}
+	base := identifier(path[strings.LastIndex(path, "/")+1:])
+	alias := base
+	for i := 2; g.aliases[alias] || token.Lookup(alias).IsKeyword(); i++ {
+		alias = fmt.Sprintf("%s%d", base, i)
+	}
+	g.aliases[alias] = true
+	g.imports[path] = alias
+	return alias
+}
+
+// goClientRuntime is the part of every generated client that sends the
+// requests
+const goClientRuntime = `
+// Client calls the API. Header is added to every request, for
+// credentials and the like, and HTTPClient sends them, or
+// http.DefaultClient if it's nil.
+type Client struct {
+	BaseURL    string
+	Header     http.Header
+	HTTPClient *http.Client
+}
+
+// New makes a Client for the API served at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, Header: http.Header{}}
+}
+
+// Error is the response to a request that failed. Message is the error
+// in its body, if it has one.
+type Error struct {
+	StatusCode int
+	Message    string
+	Body       []byte
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// formFile is a file uploaded as a multipart form
+type formFile struct {
+	field string
+	file  io.Reader
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, header http.Header, body, result interface{}) error {
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = body
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+	case formFile:
+		if body.file == nil {
+			break
+		}
+		var form bytes.Buffer
+		writer := multipart.NewWriter(&form)
+		part, err := writer.CreateFormFile(body.field, body.field)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, body.file); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		reader = &form
+		header.Set("Content-Type", writer.FormDataContentType())
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+
+	u := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		data, _ := io.ReadAll(res.Body)
+		var failure struct {
+			Error string ` + "`json:\"error\"`" + `
+			Title string ` + "`json:\"title\"`" + `
+		}
+		json.Unmarshal(data, &failure)
+		message := failure.Error
+		if message == "" {
+			message = failure.Title
+		}
+		return &Error{StatusCode: res.StatusCode, Message: message, Body: data}
+	}
+
+	switch result := result.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*result, err = io.ReadAll(res.Body)
+		return err
+	case *string:
+		data, err := io.ReadAll(res.Body)
+		*result = string(data)
+		return err
+	}
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+`
@@ -0,0 +1,122 @@
+package plumbus
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseInfo describes a response that the mux has finished writing
+type ResponseInfo struct {
+	// Route is the route that handled the request. Its Pattern is "" if
+	// no route matched.
+	Route RouteInfo
+
+	// Status is the response's status code
+	Status int
+
+	// Duration is how long the request took to handle, including
+	// middleware
+	Duration time.Duration
+
+	// BytesWritten is the size of the response body
+	BytesWritten int64
+}
+
+// AfterResponse adds hooks that are called after each response the mux
+// writes, such as to record metrics or audit requests, as in:
+//
+//	mux.AfterResponse(func(req *http.Request, info plumbus.ResponseInfo) {
+//		requestDuration.WithLabelValues(info.Route.Pattern).Observe(info.Duration.Seconds())
+//	})
+func (sm *ServeMux) AfterResponse(hooks ...func(req *http.Request, info ResponseInfo)) {
+	sm.afterResponse = append(sm.afterResponse, hooks...)
+}
+
+func (sm *ServeMux) runAfterResponse(recorder *responseRecorder, req *http.Request, start time.Time) {
+	info := ResponseInfo{
+		Route:        MatchedRoute(req),
+		Status:       recorder.status,
+		Duration:     time.Since(start),
+		BytesWritten: recorder.bytes,
+	}
+	if info.Status == 0 {
+		info.Status = http.StatusOK
+	}
+	for _, hook := range sm.afterResponse {
+		hook(req, info)
+	}
+}
+
+// MatchedRoute describes the route that matched the request, as it's
+// listed by Routes. For a route with a handler per method, it describes
+// the handler for the request's method. Its Pattern is "" if no route
+// matched.
+func MatchedRoute(req *http.Request) RouteInfo {
+	node, _ := req.Context().Value(routeNodeKey).(*Paths)
+	if node == nil {
+		return RouteInfo{}
+	}
+
+	pattern := RoutePattern(req)
+	routes := routeInfos(pattern, node)
+	method := req.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	for _, route := range routes {
+		if route.Method == "" || route.Method == method {
+			return route
+		}
+	}
+	return RouteInfo{Pattern: pattern, Method: req.Method, Documentation: node.documentation}
+}
+
+// responseRecorder keeps track of the status and size of a response,
+// while still letting handlers flush it or take it over for websockets
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(body []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(body)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T can't be hijacked", r.ResponseWriter)
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap gives the underlying ResponseWriter to http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,148 @@
+package plumbus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InsomniaExport is an Insomnia export (format v4) with a request for
+// each endpoint of the documentation, made by Documentation.Insomnia
+type InsomniaExport struct {
+	Type      string              `json:"_type"`
+	Format    int                 `json:"__export_format"`
+	Source    string              `json:"__export_source"`
+	Resources []*InsomniaResource `json:"resources"`
+}
+
+// InsomniaResource is a workspace, environment, folder ("request_group"),
+// or request, depending on its Type. Each one but the workspace has the
+// ID of the one it's in as its ParentID.
+type InsomniaResource struct {
+	ID             string              `json:"_id"`
+	Type           string              `json:"_type"`
+	ParentID       string              `json:"parentId,omitempty"`
+	Name           string              `json:"name"`
+	Description    string              `json:"description,omitempty"`
+	Data           map[string]string   `json:"data,omitempty"`
+	Method         string              `json:"method,omitempty"`
+	URL            string              `json:"url,omitempty"`
+	Body           *InsomniaBody       `json:"body,omitempty"`
+	Parameters     []InsomniaParameter `json:"parameters,omitempty"`
+	PathParameters []InsomniaParameter `json:"pathParameters,omitempty"`
+	Headers        []InsomniaParameter `json:"headers,omitempty"`
+}
+
+type InsomniaBody struct {
+	MimeType string              `json:"mimeType"`
+	Text     string              `json:"text,omitempty"`
+	Params   []InsomniaParameter `json:"params,omitempty"`
+}
+
+type InsomniaParameter struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// Insomnia exports the documentation for importing into Insomnia, like
+// Postman does for Postman. Requests are grouped in folders by their
+// first tag, and their URLs start with the base_url of the workspace's
+// environment, which is set to baseURL.
+func (d *Documentation) Insomnia(name, baseURL string) *InsomniaExport {
+	export := &InsomniaExport{
+		Type:   "export",
+		Format: 4,
+		Source: "plumbus",
+		Resources: []*InsomniaResource{
+			{
+				ID:          "wrk_plumbus",
+				Type:        "workspace",
+				Name:        name,
+				Description: strings.Join(d.Introduction, "\n\n"),
+			},
+			{
+				ID:       "env_plumbus",
+				Type:     "environment",
+				ParentID: "wrk_plumbus",
+				Name:     "Base Environment",
+				Data:     map[string]string{"base_url": baseURL},
+			},
+		},
+	}
+
+	folders := map[string]string{}
+	for i, e := range d.sortedEndpoints() {
+		request := d.insomniaRequest(e)
+		request.ID = fmt.Sprintf("req_plumbus_%d", i+1)
+		request.ParentID = "wrk_plumbus"
+
+		if len(e.Tags) > 0 {
+			folder, ok := folders[e.Tags[0]]
+			if !ok {
+				folder = fmt.Sprintf("fld_plumbus_%d", len(folders)+1)
+				folders[e.Tags[0]] = folder
+				export.Resources = append(export.Resources, &InsomniaResource{
+					ID:       folder,
+					Type:     "request_group",
+					ParentID: "wrk_plumbus",
+					Name:     e.Tags[0],
+				})
+			}
+			request.ParentID = folder
+		}
+
+		export.Resources = append(export.Resources, request)
+	}
+
+	return export
+}
+
+func (d *Documentation) insomniaRequest(e *Endpoint) *InsomniaResource {
+	example := d.requestExample(e)
+	request := &InsomniaResource{
+		Type:        "request",
+		Name:        e.title(),
+		Description: e.Description,
+		Method:      example.method,
+		URL:         "{{ _.base_url }}" + example.path,
+	}
+
+	var form []InsomniaParameter
+	for _, param := range example.params {
+		p := InsomniaParameter{
+			Name:        param.name,
+			Value:       param.Default,
+			Description: param.Description,
+			Disabled:    !param.Required,
+		}
+		switch param.In {
+		case "path":
+			p.Disabled = false
+			request.PathParameters = append(request.PathParameters, p)
+		case "header":
+			request.Headers = append(request.Headers, p)
+		case "cookie":
+			p.Name, p.Value = "Cookie", param.name+"="+param.Default
+			request.Headers = append(request.Headers, p)
+		case "form":
+			if param.Type == "file" {
+				p.Type = "file"
+			}
+			form = append(form, p)
+		default:
+			request.Parameters = append(request.Parameters, p)
+		}
+	}
+
+	switch {
+	case form != nil:
+		request.Body = &InsomniaBody{MimeType: "multipart/form-data", Params: form}
+	case example.body != "":
+		request.Headers = append(request.Headers, InsomniaParameter{Name: "Content-Type", Value: "application/json"})
+		request.Body = &InsomniaBody{MimeType: "application/json", Text: example.body}
+	}
+
+	return request
+}
@@ -0,0 +1,137 @@
+package plumbus
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+var interceptorErrorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// interceptor is a function added with Intercept, along with the type of
+// argument that it checks. fn is a func(*http.Request, T) error, even if
+// it was added as a value of a named func type, so that adaptors can
+// find the interceptors for an argument with a type assertion.
+type interceptor struct {
+	argType reflect.Type
+	fn      interface{}
+}
+
+// Intercept adds interceptors, which check the arguments of handlers
+// after they're decoded and validated, but before the handler is called.
+// Each one is a function of the request and an argument type, as in:
+//
+//	mux.Intercept(func(req *http.Request, userId userIdPathParam) error {
+//		if string(userId) != currentUser(req).Id {
+//			return plumbus.Error(http.StatusForbidden, "not your account")
+//		}
+//		return nil
+//	})
+//
+// and is called for every handler that takes an argument of that type,
+// which can't be an interface type. If it returns an error, the error is
+// the response and the handler isn't called. Interceptors run in the
+// order they're added, after those of any mux this one is mounted on or
+// is a Host of.
+func (sm *ServeMux) Intercept(interceptors ...interface{}) {
+	for _, fn := range interceptors {
+		val := reflect.ValueOf(fn)
+		typ := val.Type()
+		if typ.Kind() != reflect.Func ||
+			typ.NumIn() != 2 || typ.In(0) != reflect.TypeOf(&http.Request{}) ||
+			typ.NumOut() != 1 || typ.Out(0) != interceptorErrorType {
+			panic(fmt.Errorf(
+				"interceptor %s must be a func(*http.Request, T) error",
+				typ,
+			))
+		}
+		if typ.In(1).Kind() == reflect.Interface {
+			panic(fmt.Errorf(
+				"interceptor %s must take a concrete type, not the interface %s",
+				typ, typ.In(1),
+			))
+		}
+		unnamed := reflect.FuncOf(
+			[]reflect.Type{typ.In(0), typ.In(1)},
+			[]reflect.Type{interceptorErrorType},
+			false,
+		)
+		sm.interceptors = append(sm.interceptors, interceptor{
+			argType: typ.In(1),
+			fn:      val.Convert(unnamed).Interface(),
+		})
+	}
+}
+
+// Arg is a decoded argument of a handler, as adaptors give it to
+// RunInterceptors
+type Arg interface {
+	// Value is the argument itself
+	Value() interface{}
+
+	// intercept calls the interceptor if it checks the argument's type,
+	// reporting whether it did
+	intercept(req *http.Request, ic interceptor) (bool, error)
+}
+
+// ArgOf is the Arg for an argument of type T. Its interceptors are found
+// with a type assertion, so generated adaptors call them without
+// reflection.
+func ArgOf[T any](value T) Arg {
+	return typedArg[T]{value: value}
+}
+
+type typedArg[T any] struct {
+	value T
+}
+
+func (a typedArg[T]) Value() interface{} {
+	return a.value
+}
+
+func (a typedArg[T]) intercept(req *http.Request, ic interceptor) (bool, error) {
+	fn, ok := ic.fn.(func(*http.Request, T) error)
+	if !ok {
+		return false, nil
+	}
+	return true, fn(req, a.value)
+}
+
+// reflectedArg is the Arg of the reflection adaptor, whose arguments are
+// only known as reflect.Values
+type reflectedArg struct {
+	value reflect.Value
+}
+
+func (a reflectedArg) Value() interface{} {
+	return a.value.Interface()
+}
+
+func (a reflectedArg) intercept(req *http.Request, ic interceptor) (bool, error) {
+	if a.value.Type() != ic.argType {
+		return false, nil
+	}
+	result := reflect.ValueOf(ic.fn).Call([]reflect.Value{
+		reflect.ValueOf(req),
+		a.value,
+	})
+	err, _ := result[0].Interface().(error)
+	return true, err
+}
+
+// RunInterceptors calls the interceptors of the muxes that the route was
+// found through with the decoded arguments of a handler, outermost mux
+// first, and then checks the route's requirements with its Authorizer.
+// Adaptors call it just before calling the handler.
+func RunInterceptors(req *http.Request, args ...Arg) error {
+	for _, mux := range routeMuxes(req) {
+		for _, ic := range mux.interceptors {
+			for _, arg := range args {
+				if called, err := arg.intercept(req, ic); called && err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return authorize(req, args)
+}
@@ -0,0 +1,44 @@
+package plumbus
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// AllowIPs is middleware that only lets in clients whose address is in
+// one of the ranges, such as "10.8.0.0/16", and gives everyone else a 403.
+// Clients are found the same way as ClientIP. To restrict a group of
+// routes, mount a mux that uses it, as in:
+//
+//	admin := plumbus.NewServeMux()
+//	admin.Use(plumbus.AllowIPs("10.8.0.0/16"))
+//	mux.Mount("/admin", admin)
+//
+// It panics if a range can't be parsed.
+func AllowIPs(ranges ...string) Middleware {
+	return ipFilter(ranges, true)
+}
+
+// DenyIPs is middleware that gives clients whose address is in one of
+// the ranges a 403, and lets everyone else in. See AllowIPs.
+func DenyIPs(ranges ...string) Middleware {
+	return ipFilter(ranges, false)
+}
+
+func ipFilter(ranges []string, allow bool) Middleware {
+	prefixes, err := parsePrefixes(ranges)
+	if err != nil {
+		panic(fmt.Errorf("parsing ip ranges: %s", err.Error()))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			addr := clientIP(req)
+			if !addr.IsValid() || prefixesContain(prefixes, addr) != allow {
+				HandleResponseError(res, req, Error(http.StatusForbidden, "forbidden"))
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
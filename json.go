@@ -0,0 +1,107 @@
+package plumbus
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// JSONEncoder encodes json values, as *json.Encoder does. The encoders of
+// most other json packages have the same methods.
+type JSONEncoder interface {
+	Encode(v interface{}) error
+	SetEscapeHTML(on bool)
+	SetIndent(prefix, indent string)
+}
+
+// SetJSONEncoder swaps in another json implementation for the mux's
+// responses, as in:
+//
+//	mux.SetJSONEncoder(func(w io.Writer) plumbus.JSONEncoder {
+//		return jsoniter.ConfigCompatibleWithStandardLibrary.NewEncoder(w)
+//	})
+//
+// It's used in place of any encoder registered for application/json.
+func (sm *ServeMux) SetJSONEncoder(newEncoder func(w io.Writer) JSONEncoder) {
+	sm.newJSONEncoder = newEncoder
+}
+
+// SetJSONEscapeHTML sets whether <, >, and & are escaped in json
+// responses, which they are by default
+func (sm *ServeMux) SetJSONEscapeHTML(escape bool) {
+	sm.jsonRawHTML = !escape
+}
+
+// SetJSONIndent sets the indentation of pretty json, which is two spaces
+// by default
+func (sm *ServeMux) SetJSONIndent(indent string) {
+	sm.jsonIndent = indent
+}
+
+// SetPrettyJSON makes json responses indented by default, which is handy
+// during development. Either way, a request can ask for indented json
+// with ?pretty=1, or for compact json with ?pretty=0.
+func (sm *ServeMux) SetPrettyJSON(pretty bool) {
+	sm.prettyJSON = pretty
+}
+
+// prettyJSON checks whether json should be indented for the request,
+// which it is if the query has pretty=1 (or true), or if the mux is set to
+// by SetPrettyJSON and the query doesn't have pretty=0
+func prettyJSON(req *http.Request) bool {
+	if pretty, err := strconv.ParseBool(req.URL.Query().Get("pretty")); err == nil {
+		return pretty
+	}
+	sm := muxFromRequest(req)
+	return sm != nil && sm.prettyJSON
+}
+
+// muxJSON gives the encoder for json responses to the request, if the
+// mux's json settings or the request mean that the encoder registered for
+// application/json can't be used
+func muxJSON(req *http.Request) (EncoderFunc, bool) {
+	sm := muxFromRequest(req)
+	pretty := prettyJSON(req)
+	configured := sm != nil && (sm.newJSONEncoder != nil || sm.jsonRawHTML)
+	if !pretty && !configured {
+		return nil, false
+	}
+
+	return func(w io.Writer, v interface{}) error {
+		return newJSONEncoder(sm, w, pretty).Encode(v)
+	}, true
+}
+
+func newJSONEncoder(sm *ServeMux, w io.Writer, pretty bool) JSONEncoder {
+	if sm == nil {
+		encoder := json.NewEncoder(w)
+		if pretty {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder
+	}
+
+	var encoder JSONEncoder
+	if sm.newJSONEncoder != nil {
+		encoder = sm.newJSONEncoder(w)
+	} else {
+		encoder = json.NewEncoder(w)
+	}
+	if sm.jsonRawHTML {
+		encoder.SetEscapeHTML(false)
+	}
+	if pretty {
+		indent := "  "
+		if sm.jsonIndent != "" {
+			indent = sm.jsonIndent
+		}
+		encoder.SetIndent("", indent)
+	}
+	return encoder
+}
+
+// writeJSON writes v as json with the mux's json settings
+func writeJSON(res http.ResponseWriter, req *http.Request, v interface{}) error {
+	return newJSONEncoder(muxFromRequest(req), res, prettyJSON(req)).Encode(v)
+}
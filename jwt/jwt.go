@@ -0,0 +1,367 @@
+// Package jwt authenticates plumbus requests with JSON Web Tokens. A
+// Verifier checks the bearer token of each request against its keys (or
+// a JWKS URL), issuer, and audience, and handlers take the verified
+// claims as an argument of type Claims.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // for crypto.SHA256
+	_ "crypto/sha512" // for crypto.SHA384 and crypto.SHA512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jargv/plumbus"
+)
+
+// Verifier verifies JSON Web Tokens
+type Verifier struct {
+	// Keys are the keys that tokens may be signed with, by key id. The
+	// key with id "" is used for tokens without a key id. Keys are
+	// []byte for HMAC, or *rsa.PublicKey, *ecdsa.PublicKey, or
+	// ed25519.PublicKey.
+	Keys map[string]interface{}
+
+	// JWKSURL is where to fetch more keys from, as a JSON Web Key Set.
+	// It's fetched when a token has a key id that isn't known yet.
+	JWKSURL string
+
+	// Client fetches the JWKSURL, http.DefaultClient if it's nil
+	Client *http.Client
+
+	// Issuer, if set, must match the token's "iss" claim
+	Issuer string
+
+	// Audience, if set, must be in the token's "aud" claim
+	Audience string
+
+	// Leeway allows for clock skew when checking "exp" and "nbf"
+	Leeway time.Duration
+
+	mu       sync.Mutex
+	jwks     map[string]interface{}
+	fetched  time.Time
+	fetching *jwksFetch
+}
+
+// jwksFetch is a fetch of the JWKSURL in progress, which requests for
+// unknown keys wait on together
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// jwksTimeout limits how long fetching the JWKSURL may take, since the
+// fetch isn't tied to any one request
+const jwksTimeout = 10 * time.Second
+
+// Claims are the claims of a verified token. As a handler argument,
+// they're the claims of the request's bearer token, verified by the
+// Verifier's Middleware. Requests without a token get a 401.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+
+	// Raw are all of the claims, as decoded from json
+	Raw map[string]interface{}
+}
+
+type contextKey struct{}
+
+func (c *Claims) FromRequest(req *http.Request) error {
+	claims, ok := req.Context().Value(contextKey{}).(*Claims)
+	if !ok {
+		return plumbus.ErrorUnauthorized("Bearer", "missing bearer token")
+	}
+	*c = *claims
+	return nil
+}
+
+// SecuritySchemes describes the token in OpenAPI documents as a JWT
+// bearer token, named "jwt"
+func (c *Claims) SecuritySchemes(mux *plumbus.ServeMux) map[string]*plumbus.OpenAPISecurityScheme {
+	return map[string]*plumbus.OpenAPISecurityScheme{
+		"jwt": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+	}
+}
+
+// Middleware verifies the bearer token of each request that has one,
+// so that handlers can take its Claims. Requests with a token that
+// isn't valid get a 401 before their handler runs, while requests
+// without a token are left for handlers that take Claims to reject.
+func (v *Verifier) Middleware() plumbus.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			scheme, token, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+			token = strings.TrimSpace(token)
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			claims, err := v.Verify(req.Context(), token)
+			if err != nil {
+				plumbus.HandleResponseError(res, req, plumbus.ErrorUnauthorized(
+					`Bearer error="invalid_token"`,
+					"invalid bearer token: "+err.Error(),
+				))
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), contextKey{}, claims)
+			next.ServeHTTP(res, req.WithContext(ctx))
+		})
+	}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the token's signature and claims, returning the claims
+// if it's valid
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("malformed header: %s", err.Error())
+	}
+
+	key, err := v.key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("malformed claims: %s", err.Error())
+	}
+	claims := newClaims(raw)
+
+	now := time.Now()
+	if !claims.ExpiresAt.IsZero() && now.After(claims.ExpiresAt.Add(v.Leeway)) {
+		return nil, errors.New("token is expired")
+	}
+	if !claims.NotBefore.IsZero() && now.Before(claims.NotBefore.Add(-v.Leeway)) {
+		return nil, errors.New("token isn't valid yet")
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if v.Audience != "" && !contains(claims.Audience, v.Audience) {
+		return nil, errors.New("token isn't for this audience")
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func newClaims(raw map[string]interface{}) *Claims {
+	claims := &Claims{Raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.ID, _ = raw["jti"].(string)
+	claims.ExpiresAt = numericDate(raw["exp"])
+	claims.NotBefore = numericDate(raw["nbf"])
+	claims.IssuedAt = numericDate(raw["iat"])
+
+	switch aud := raw["aud"].(type) {
+	case string:
+		claims.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				claims.Audience = append(claims.Audience, s)
+			}
+		}
+	}
+	return claims
+}
+
+func numericDate(value interface{}) time.Time {
+	seconds, ok := value.(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// key finds the key for the key id, fetching the JWKS if it's not known
+func (v *Verifier) key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := v.Keys[kid]; ok {
+		return key, nil
+	}
+	if v.JWKSURL == "" {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	v.mu.Lock()
+	if key, ok := v.jwks[kid]; ok {
+		v.mu.Unlock()
+		return key, nil
+	}
+	fetch := v.fetching
+	if fetch == nil {
+		// refetch for unknown keys at most once a minute, so that bad
+		// tokens can't make us hammer the JWKS URL
+		if time.Since(v.fetched) < time.Minute {
+			v.mu.Unlock()
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		fetch = &jwksFetch{done: make(chan struct{})}
+		v.fetching = fetch
+		go v.fetch(fetch)
+	}
+	v.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if fetch.err != nil {
+		return nil, fetch.err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.jwks[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// fetch fetches the JWKS, apart from any request so that a request
+// going away doesn't cancel it for the others waiting on it
+func (v *Verifier) fetch(fetch *jwksFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksTimeout)
+	defer cancel()
+	keys, err := fetchJWKS(ctx, v.Client, v.JWKSURL)
+
+	v.mu.Lock()
+	if err == nil {
+		v.jwks = keys
+		v.fetched = time.Now()
+	}
+	fetch.err = err
+	v.fetching = nil
+	v.mu.Unlock()
+	close(fetch.done)
+}
+
+func verifySignature(alg string, key interface{}, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "HS256", "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "HS384", "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "HS512", "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	}
+
+	invalid := errors.New("invalid signature")
+	switch {
+	case strings.HasPrefix(alg, "HS") && hash != 0:
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("key doesn't match algorithm %s", alg)
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalid
+		}
+		return nil
+	case (strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")) && hash != 0:
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key doesn't match algorithm %s", alg)
+		}
+		digest := hash.New()
+		digest.Write([]byte(signed))
+		if alg[0] == 'P' {
+			if rsa.VerifyPSS(public, hash, digest.Sum(nil), signature, nil) != nil {
+				return invalid
+			}
+			return nil
+		}
+		if rsa.VerifyPKCS1v15(public, hash, digest.Sum(nil), signature) != nil {
+			return invalid
+		}
+		return nil
+	case strings.HasPrefix(alg, "ES") && hash != 0:
+		public, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key doesn't match algorithm %s", alg)
+		}
+		size := (public.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return invalid
+		}
+		digest := hash.New()
+		digest.Write([]byte(signed))
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(public, digest.Sum(nil), r, s) {
+			return invalid
+		}
+		return nil
+	case alg == "EdDSA":
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key doesn't match algorithm %s", alg)
+		}
+		if !ed25519.Verify(public, []byte(signed), signature) {
+			return invalid
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
@@ -0,0 +1,213 @@
+package plumbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Markdown renders the documentation as a Markdown API reference, with a
+// section for each tag listing its endpoints (an endpoint with several
+// tags is listed under each), and an example curl command for each
+// endpoint made against baseURL, as in:
+//
+//	docs := mux.Documentation("The Orders API.").Markdown("Orders", "https://api.example.com")
+//	os.WriteFile("docs/api.md", []byte(docs), 0644)
+//
+// Endpoints without tags are listed last, under "Other", or under
+// "Endpoints" if none have tags.
+func (d *Documentation) Markdown(title, baseURL string) string {
+	var md strings.Builder
+	fmt.Fprintf(&md, "# %s\n", title)
+	for _, paragraph := range d.Introduction {
+		fmt.Fprintf(&md, "\n%s\n", paragraph)
+	}
+
+	var tags []string
+	byTag := map[string][]*Endpoint{}
+	var untagged []*Endpoint
+	for _, e := range d.sortedEndpoints() {
+		if len(e.Tags) == 0 {
+			untagged = append(untagged, e)
+		}
+		for _, tag := range e.Tags {
+			if _, ok := byTag[tag]; !ok {
+				tags = append(tags, tag)
+			}
+			byTag[tag] = append(byTag[tag], e)
+		}
+	}
+	sort.Strings(tags)
+
+	if len(untagged) > 0 {
+		name := "Other"
+		if len(tags) == 0 {
+			name = "Endpoints"
+		}
+		tags = append(tags, name)
+		byTag[name] = untagged
+	}
+
+	for _, tag := range tags {
+		fmt.Fprintf(&md, "\n## %s\n", tag)
+		for _, e := range byTag[tag] {
+			d.markdownEndpoint(&md, e, baseURL)
+		}
+	}
+
+	return md.String()
+}
+
+func (d *Documentation) markdownEndpoint(md *strings.Builder, e *Endpoint, baseURL string) {
+	example := d.requestExample(e)
+	fmt.Fprintf(md, "\n### `%s %s`\n", example.method, example.path)
+	if e.Deprecated {
+		md.WriteString("\n**Deprecated.**\n")
+	}
+	if e.Summary != "" {
+		fmt.Fprintf(md, "\n%s\n", e.Summary)
+	}
+	if e.Description != "" {
+		fmt.Fprintf(md, "\n%s\n", e.Description)
+	}
+	for _, note := range e.Notes {
+		fmt.Fprintf(md, "\n%s\n", note)
+	}
+
+	if len(example.params) > 0 {
+		md.WriteString("\n| Param | In | Type | Required | Description |\n")
+		md.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, param := range example.params {
+			required := "no"
+			if param.Required {
+				required = "yes"
+			}
+			description := param.Description
+			if len(param.Enum) > 0 {
+				description = strings.TrimSpace(description + " One of " + strings.Join(param.Enum, ", ") + ".")
+			}
+			if param.Default != "" {
+				description = strings.TrimSpace(description + " Defaults to " + param.Default + ".")
+			}
+			fmt.Fprintf(md, "| `%s` | %s | %s | %s | %s |\n",
+				param.name, param.In, param.Type, required, strings.ReplaceAll(description, "|", `\|`))
+		}
+	}
+
+	if e.RequestBody != "" {
+		fmt.Fprintf(md, "\nRequest body: `%s`\n", e.RequestBody)
+		d.markdownType(md, e.RequestBody)
+	}
+	if e.ResponseBody != "" {
+		fmt.Fprintf(md, "\nResponse body: `%s`\n", e.ResponseBody)
+		d.markdownType(md, e.ResponseBody)
+	}
+
+	if len(e.Responses) > 0 {
+		codes := make([]int, 0, len(e.Responses))
+		for code := range e.Responses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+
+		md.WriteString("\nOther responses:\n\n")
+		for _, code := range codes {
+			if body := e.Responses[code]; body != "" {
+				fmt.Fprintf(md, "- `%d`: `%s`\n", code, body)
+			} else {
+				fmt.Fprintf(md, "- `%d`\n", code)
+			}
+		}
+	}
+
+	fmt.Fprintf(md, "\n```sh\n%s\n```\n", example.curl(baseURL))
+}
+
+// markdownType writes the docs of a type's fields and its example
+func (d *Documentation) markdownType(md *strings.Builder, name string) {
+	t, ok := d.Types[name]
+	if !ok {
+		return
+	}
+	if t.Description != "" {
+		fmt.Fprintf(md, "\n%s\n", t.Description)
+	}
+
+	if len(t.Fields) > 0 {
+		fields := make([]string, 0, len(t.Fields))
+		for field := range t.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		md.WriteString("\n")
+		for _, field := range fields {
+			fmt.Fprintf(md, "- `%s`: %s\n", field, t.Fields[field])
+		}
+	}
+
+	if example, err := json.MarshalIndent(t.Example, "", "  "); err == nil {
+		fmt.Fprintf(md, "\n```json\n%s\n```\n", example)
+	}
+}
+
+// curl is a curl command making the request, with the required params
+// and the example body. Params without a default are written as {name}.
+func (r *requestExample) curl(baseURL string) string {
+	value := func(param exampleParam) string {
+		if param.Default != "" {
+			return param.Default
+		}
+		return "{" + param.name + "}"
+	}
+
+	segments := getSegments(r.path)
+	var query, args []string
+	for _, param := range r.params {
+		if !param.Required {
+			continue
+		}
+		switch param.In {
+		case "path":
+			for i, segment := range segments {
+				if segment == ":"+param.name {
+					segments[i] = value(param)
+				}
+			}
+		case "query":
+			query = append(query, param.name+"="+value(param))
+		case "header":
+			args = append(args, "-H "+shellQuote(param.name+": "+value(param)))
+		case "cookie":
+			args = append(args, "-b "+shellQuote(param.name+"="+value(param)))
+		case "form":
+			if param.Type == "file" {
+				args = append(args, "-F "+shellQuote(param.name+"=@"+param.name))
+			} else {
+				args = append(args, "-F "+shellQuote(param.name+"="+value(param)))
+			}
+		}
+	}
+
+	url := strings.TrimSuffix(baseURL, "/") + "/" + strings.Join(segments, "/")
+	if len(query) > 0 {
+		url += "?" + strings.Join(query, "&")
+	}
+
+	command := "curl " + shellQuote(url)
+	if r.method != "GET" {
+		command = "curl -X " + r.method + " " + shellQuote(url)
+	}
+	if r.body != "" {
+		var body bytes.Buffer
+		json.Compact(&body, []byte(r.body))
+		args = append(args, "-H 'Content-Type: application/json'", "-d "+shellQuote(body.String()))
+	}
+	return strings.Join(append([]string{command}, args...), " \\\n  ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
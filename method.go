@@ -3,6 +3,7 @@ package plumbus
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -11,8 +12,36 @@ type ByMethod struct {
 }
 
 type method struct {
-	GET, POST, PUT, PATCH, DELETE, OPTIONS http.Handler
-	acceptedMethods                        string
+	GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS http.Handler
+	acceptedMethods                              string
+}
+
+// set assigns the handler for the method, returning false if the method
+// already has a handler or isn't supported
+func (m *ByMethod) set(name string, handler interface{}) bool {
+	var field *interface{}
+	switch name {
+	case "GET":
+		field = &m.GET
+	case "POST":
+		field = &m.POST
+	case "PUT":
+		field = &m.PUT
+	case "PATCH":
+		field = &m.PATCH
+	case "DELETE":
+		field = &m.DELETE
+	case "OPTIONS":
+		field = &m.OPTIONS
+	default:
+		return false
+	}
+
+	if *field != nil {
+		return false
+	}
+	*field = handler
+	return true
 }
 
 func (m *ByMethod) compile() *method {
@@ -29,26 +58,39 @@ func (m *ByMethod) compile() *method {
 	}
 
 	result.GET = handle("GET", m.GET)
+	if result.GET != nil {
+		accepted = append(accepted, "HEAD")
+		result.HEAD = head(result.GET)
+	}
 	result.POST = handle("POST", m.POST)
 	result.PUT = handle("PUT", m.PUT)
 	result.PATCH = handle("PATCH", m.PATCH)
 	result.DELETE = handle("DELETE", m.DELETE)
 	result.OPTIONS = handle("OPTIONS", m.OPTIONS)
 
-	if len(accepted) == 0 {
-		result.acceptedMethods = "<none>"
-	} else {
-		result.acceptedMethods = strings.Join(accepted, ", ")
+	if result.OPTIONS == nil {
+		accepted = append(accepted, "OPTIONS")
+		result.OPTIONS = http.HandlerFunc(result.options)
 	}
 
+	result.acceptedMethods = strings.Join(accepted, ", ")
+
 	return result
 }
 
+// options answers OPTIONS requests for handlers that don't define their own
+func (m *method) options(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Allow", m.acceptedMethods)
+	res.WriteHeader(http.StatusNoContent)
+}
+
 func (m *method) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	var handler http.Handler
 	switch strings.ToUpper(req.Method) {
 	case "GET":
 		handler = m.GET
+	case "HEAD":
+		handler = m.HEAD
 	case "POST":
 		handler = m.POST
 	case "PUT":
@@ -62,10 +104,43 @@ func (m *method) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	}
 
 	if handler == nil {
-		msg := fmt.Sprintf("method %s not allowed, expected {%s}", m.acceptedMethods)
+		res.Header().Set("Allow", m.acceptedMethods)
+		if sm := muxFromRequest(req); sm != nil && sm.methodNotAllowed != nil {
+			sm.methodNotAllowed.ServeHTTP(res, req)
+			return
+		}
+		msg := fmt.Sprintf("method %s not allowed, expected {%s}", req.Method, m.acceptedMethods)
 		http.Error(res, msg, http.StatusMethodNotAllowed)
 		return
 	}
 
 	handler.ServeHTTP(res, req)
 }
+
+// head serves HEAD requests with a GET handler, sending the headers
+// (with a Content-Length) but not the body
+func head(get http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		w := &headResponseWriter{ResponseWriter: res, code: http.StatusOK}
+		get.ServeHTTP(w, req)
+		if res.Header().Get("Content-Length") == "" {
+			res.Header().Set("Content-Length", strconv.Itoa(w.length))
+		}
+		res.WriteHeader(w.code)
+	})
+}
+
+type headResponseWriter struct {
+	http.ResponseWriter
+	code   int
+	length int
+}
+
+func (w *headResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *headResponseWriter) Write(body []byte) (int, error) {
+	w.length += len(body)
+	return len(body), nil
+}
@@ -0,0 +1,31 @@
+// Package msgpack lets plumbus handlers take and return MessagePack
+// bodies. After calling Register, request bodies with a msgpack
+// Content-Type are decoded as msgpack, and responses are encoded as
+// msgpack for requests that accept it.
+package msgpack
+
+import (
+	"io"
+
+	"github.com/jargv/plumbus"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+const MediaType = "application/msgpack"
+
+// Register adds msgpack to plumbus's decoders and encoders, under both
+// application/msgpack and the older application/x-msgpack
+func Register() {
+	for _, mediaType := range []string{MediaType, "application/x-msgpack"} {
+		plumbus.RegisterDecoder(mediaType, decode)
+		plumbus.RegisterEncoder(mediaType, encode)
+	}
+}
+
+func decode(body io.Reader, dst interface{}) error {
+	return msgpack.NewDecoder(body).Decode(dst)
+}
+
+func encode(w io.Writer, v interface{}) error {
+	return msgpack.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,737 @@
+package plumbus
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+// OpenAPI is an OpenAPI 3.1 document describing the routes of a mux,
+// made by ServeMux.OpenAPI
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIInfo is the title and version of an API, along with a
+// description of it
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+
+	// Security lists the ways a request can be authenticated, each one
+	// naming the security schemes it uses along with the scopes and
+	// roles the route requires
+	Security []map[string][]string `json:"security,omitempty"`
+}
+
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Required    bool           `json:"required,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema  *OpenAPISchema `json:"schema,omitempty"`
+	Example interface{}    `json:"example,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// OpenAPISecurityScheme is a way that requests are authenticated, such
+// as with an "http" Type and a "bearer" Scheme, or an "apiKey" Type with
+// the Name of the header or query param it's sent in
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// SecuritySchemer can be implemented by a handler argument type that
+// authenticates requests, to describe how in OpenAPI documents. Each of
+// the schemes it returns, by name, is a way to authenticate, so a
+// request may use any one of them.
+type SecuritySchemer interface {
+	SecuritySchemes(mux *ServeMux) map[string]*OpenAPISecurityScheme
+}
+
+// OpenAPISchema is a JSON Schema, as used by OpenAPI 3.1
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Default              interface{}               `json:"default,omitempty"`
+	Examples             []interface{}             `json:"examples,omitempty"`
+}
+
+// OpenAPI describes the mux's routes as an OpenAPI 3.1 document. Params
+// come from the handlers' param types and bound structs, request and
+// response bodies are described with schemas made from their Go types
+// (honoring json tags), and error responses are listed for the ways each
+// handler can fail. A handler registered without a method is listed as a
+// POST if it takes a body, or a GET otherwise. The document can be served
+// as json by a handler, as in:
+//
+//	mux.Handle("/openapi.json", func() *plumbus.OpenAPI {
+//		return mux.OpenAPI(plumbus.OpenAPIInfo{Title: "Orders", Version: "1.0"})
+//	})
+func (sm *ServeMux) OpenAPI(info OpenAPIInfo) *OpenAPI {
+	b := &openAPIBuilder{
+		doc: &OpenAPI{
+			OpenAPI: "3.1.0",
+			Info:    info,
+			Paths:   map[string]map[string]*OpenAPIOperation{},
+			Components: OpenAPIComponents{
+				Schemas: map[string]*OpenAPISchema{},
+			},
+		},
+		operationIDs: map[string]bool{},
+		emptyCode:    sm.emptyCode,
+		mux:          sm,
+	}
+
+	nodes := sm.Paths.flatten()
+	patterns := make([]string, 0, len(nodes))
+	for pattern := range nodes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		node := nodes[pattern]
+		if _, ok := node.originalHandler.(*docsHandler); ok {
+			continue
+		}
+		for _, route := range routeInfos(pattern, node) {
+			b.addRoute(pattern, route.Method, methodOrHandler(node.originalHandler, route.Method), node)
+		}
+	}
+
+	return b.doc
+}
+
+func methodOrHandler(handler interface{}, method string) interface{} {
+	switch methods := handler.(type) {
+	case ByMethod:
+		return methodHandler(&methods, method)
+	case *ByMethod:
+		return methodHandler(methods, method)
+	}
+	return handler
+}
+
+type openAPIBuilder struct {
+	doc          *OpenAPI
+	operationIDs map[string]bool
+	emptyCode    int
+	mux          *ServeMux
+}
+
+var (
+	openAPIFileType      = reflect.TypeOf(FileResponse{})
+	openAPIRenderType    = reflect.TypeOf(Render{})
+	openAPICreatedType   = reflect.TypeOf(CreatedResponse{})
+	openAPIEventType     = reflect.TypeOf(Event{})
+	openAPIReaderType    = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	openAPIMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (b *openAPIBuilder) addRoute(pattern, method string, handler interface{}, node *Paths) {
+	meta := node.metadataFor(method)
+	op := &OpenAPIOperation{
+		Summary:     meta.summary,
+		Description: cleanupText(strings.Join(node.documentation, "\n")),
+		Tags:        meta.tags,
+		Deprecated:  meta.deprecated,
+		Responses:   map[string]*OpenAPIResponse{},
+	}
+
+	takesBody := false
+	fails := false
+	var results []reflect.Type
+	typ := reflect.TypeOf(handler)
+	if typ != nil && typ.Kind() == reflect.Func && adapted(handler) {
+		info, err := generate.CollectInfo(typ)
+		if err != nil {
+			return
+		}
+		takesBody = b.addInputs(op, info)
+		b.addOutputs(op, info)
+		fails = info.LastIsError
+		op.OperationID = b.operationID(handler)
+		for i := 0; i < typ.NumOut(); i++ {
+			results = append(results, typ.Out(i))
+		}
+	} else {
+		op.Responses["200"] = &OpenAPIResponse{Description: "OK"}
+	}
+
+	b.addPathParams(op, pattern)
+
+	if len(op.Parameters) > 0 || op.RequestBody != nil {
+		op.Responses["400"] = b.errorResponse("The request's params or body are invalid.")
+	}
+	if takesBody {
+		op.Responses["415"] = b.errorResponse("The request body's Content-Type isn't supported.")
+	}
+	required := []string{}
+	for _, key := range []string{"", method} {
+		if r, ok := node.requirements[key]; ok {
+			required = append(required, r.Scopes...)
+			required = append(required, r.Roles...)
+		}
+	}
+	if len(required) > 0 {
+		op.Responses["403"] = b.errorResponse("The client isn't allowed to make the request.")
+	}
+	for _, security := range op.Security {
+		for name := range security {
+			security[name] = required
+		}
+	}
+	if fails {
+		op.Responses["default"] = b.errorResponse("The request failed.")
+	}
+	for code, response := range declaredResponses(node, method, results) {
+		op.Responses[strconv.Itoa(code)] = b.declaredResponse(code, response)
+	}
+
+	if method == "" {
+		method = "GET"
+		if takesBody {
+			method = "POST"
+		}
+	}
+
+	path := openAPIPath(pattern)
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = map[string]*OpenAPIOperation{}
+	}
+	b.doc.Paths[path][strings.ToLower(method)] = op
+}
+
+// addInputs documents the params and body of the handler, saying whether
+// it takes a body
+func (b *openAPIBuilder) addInputs(op *OpenAPIOperation, info *generate.Info) bool {
+	takesBody := false
+	for _, input := range info.Inputs {
+		switch input.ConversionType {
+		case generate.ConvertBody:
+			takesBody = true
+			op.RequestBody = &OpenAPIRequestBody{
+				Required: !input.IsPointer,
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {Schema: b.schema(input.Type)},
+				},
+			}
+		case generate.ConvertRawBody, generate.ConvertBodyReader:
+			takesBody = true
+			op.RequestBody = &OpenAPIRequestBody{
+				Content: map[string]OpenAPIMediaType{
+					"application/octet-stream": {Schema: &OpenAPISchema{Type: "string", Format: "binary"}},
+				},
+			}
+		case generate.ConvertFile:
+			takesBody = true
+			name := input.Name
+			if name == "" {
+				name = "file"
+			}
+			form := &OpenAPISchema{
+				Type: "object",
+				Properties: map[string]*OpenAPISchema{
+					name: {Type: "string", Format: "binary"},
+				},
+			}
+			if !input.IsPointer {
+				form.Required = []string{name}
+			}
+			op.RequestBody = &OpenAPIRequestBody{
+				Required: !input.IsPointer,
+				Content:  map[string]OpenAPIMediaType{"multipart/form-data": {Schema: form}},
+			}
+		case generate.ConvertStruct:
+			if b.addStructParams(op, input.Type) {
+				takesBody = true
+			}
+		case generate.ConvertPlugin:
+			doc := input.PluginDoc()
+			for _, param := range doc.Params {
+				op.Parameters = append(op.Parameters, &OpenAPIParameter{
+					Name:        param.Name,
+					In:          param.Source.String(),
+					Required:    param.Required || param.Source == generate.SourcePath,
+					Description: param.Description,
+					Schema:      b.paramSchema(pluginParamType(param)),
+				})
+			}
+			if doc.BodyMediaType != "" {
+				takesBody = true
+				op.RequestBody = &OpenAPIRequestBody{
+					Required: !input.IsPointer,
+					Content: map[string]OpenAPIMediaType{
+						doc.BodyMediaType: {Schema: &OpenAPISchema{Type: "string", Format: "binary"}},
+					},
+				}
+			}
+		case generate.ConvertCustom:
+			if schemer, ok := reflect.New(reflectElem(input.Type)).Interface().(SecuritySchemer); ok {
+				op.Responses["401"] = b.errorResponse("The request isn't authenticated.")
+				b.addSecurity(op, schemer.SecuritySchemes(b.mux))
+			}
+		case generate.ConvertIntParam, generate.ConvertStringParam, generate.ConvertUintParam,
+			generate.ConvertFloatParam, generate.ConvertBoolParam, generate.ConvertTimeParam,
+			generate.ConvertRegisteredParam:
+			paramType := reflectElem(input.Type)
+			param := &OpenAPIParameter{
+				Name:     input.Name,
+				In:       input.Source.String(),
+				Required: input.Source == generate.SourcePath || (input.Type.Kind() != reflect.Ptr && !input.HasDefault),
+				Schema:   b.paramSchema(paramType),
+			}
+			if doc, ok := reflect.Zero(input.Type).Interface().(documenter); ok {
+				param.Description = cleanupText(doc.Documentation())
+			}
+			if input.HasDefault {
+				param.Schema.Default = reflect.Zero(paramType).Interface().(Defaulter).Default()
+			}
+			op.Parameters = append(op.Parameters, param)
+		}
+	}
+	return takesBody
+}
+
+// addSecurity adds the security schemes of an argument to the ways the
+// operation's requests are authenticated, which must use one of them
+// along with one of the ways of any other arguments
+func (b *openAPIBuilder) addSecurity(op *OpenAPIOperation, schemes map[string]*OpenAPISecurityScheme) {
+	if len(schemes) == 0 {
+		return
+	}
+	if b.doc.Components.SecuritySchemes == nil {
+		b.doc.Components.SecuritySchemes = map[string]*OpenAPISecurityScheme{}
+	}
+
+	names := make([]string, 0, len(schemes))
+	for name, scheme := range schemes {
+		names = append(names, name)
+		if _, ok := b.doc.Components.SecuritySchemes[name]; !ok {
+			b.doc.Components.SecuritySchemes[name] = scheme
+		}
+	}
+	sort.Strings(names)
+
+	before := op.Security
+	if before == nil {
+		before = []map[string][]string{{}}
+	}
+	op.Security = nil
+	for _, requirement := range before {
+		for _, name := range names {
+			combined := map[string][]string{name: {}}
+			for other, scopes := range requirement {
+				combined[other] = scopes
+			}
+			op.Security = append(op.Security, combined)
+		}
+	}
+}
+
+// addStructParams documents the fields of a struct filled by BindStruct,
+// saying whether one of them is the body
+func (b *openAPIBuilder) addStructParams(op *OpenAPIOperation, typ reflect.Type) bool {
+	typ = reflectElem(typ)
+	takesBody := false
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok, err := parseBindTag(field.Tag.Get("plumbus"))
+		if !ok || err != nil {
+			continue
+		}
+
+		if tag.source == "body" {
+			takesBody = true
+			op.RequestBody = &OpenAPIRequestBody{
+				Required: field.Type.Kind() != reflect.Ptr,
+				Content: map[string]OpenAPIMediaType{
+					"application/json": {Schema: b.schema(field.Type)},
+				},
+			}
+			continue
+		}
+
+		param := &OpenAPIParameter{
+			Name:     tag.name,
+			In:       tag.source,
+			Required: tag.source == "path" || (field.Type.Kind() != reflect.Ptr && !tag.hasDefault),
+			Schema:   b.paramSchema(reflectElem(field.Type)),
+		}
+		if tag.hasDefault {
+			param.Schema.Default = tag.def
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+	return takesBody
+}
+
+// addPathParams documents the params in the pattern that the handler
+// doesn't take itself, since every one must be listed
+func (b *openAPIBuilder) addPathParams(op *OpenAPIOperation, pattern string) {
+	for _, segment := range getSegments(pattern) {
+		var name string
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name, _ = parseVariable(segment[1:])
+		case strings.HasPrefix(segment, "*"):
+			name = segment[1:]
+		default:
+			continue
+		}
+
+		found := false
+		for _, param := range op.Parameters {
+			found = found || (param.In == "path" && param.Name == name)
+		}
+		if !found {
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &OpenAPISchema{Type: "string"},
+			})
+		}
+	}
+}
+
+func (b *openAPIBuilder) addOutputs(op *OpenAPIOperation, info *generate.Info) {
+	if info.NoContent {
+		code := http.StatusNoContent
+		if b.emptyCode != 0 {
+			code = b.emptyCode
+		}
+		op.Responses[strconv.Itoa(code)] = &OpenAPIResponse{Description: http.StatusText(code)}
+		return
+	}
+
+	for _, output := range info.Outputs {
+		typ := reflectElem(output.Type)
+		switch {
+		case typ == reflect.TypeOf(Redirect{}):
+			op.Responses["302"] = &OpenAPIResponse{Description: "Redirects to another URL."}
+			return
+		case typ == reflect.TypeOf(Text("")):
+			op.Responses["200"] = b.contentResponse("text/plain", &OpenAPISchema{Type: "string"})
+			return
+		case output.ConversionType == generate.ConvertBody:
+			b.addBodyResponse(op, output.Type)
+			return
+		}
+	}
+
+	op.Responses["200"] = &OpenAPIResponse{Description: "OK"}
+}
+
+func (b *openAPIBuilder) addBodyResponse(op *OpenAPIOperation, typ reflect.Type) {
+	elem := reflectElem(typ)
+	switch {
+	case elem == openAPICreatedType:
+		op.Responses["201"] = &OpenAPIResponse{Description: "Created"}
+	case elem == openAPIFileType:
+		op.Responses["200"] = b.contentResponse("application/octet-stream", &OpenAPISchema{Type: "string", Format: "binary"})
+	case elem == openAPIRenderType:
+		op.Responses["200"] = b.contentResponse("text/html", &OpenAPISchema{Type: "string"})
+	case typ.Implements(openAPIReaderType):
+		op.Responses["200"] = b.contentResponse("application/octet-stream", &OpenAPISchema{Type: "string", Format: "binary"})
+	case typ.Kind() == reflect.Chan && typ.Elem() == openAPIEventType:
+		op.Responses["200"] = b.contentResponse("text/event-stream", &OpenAPISchema{Type: "string"})
+	case typ.Kind() == reflect.Chan:
+		op.Responses["200"] = b.contentResponse("application/x-ndjson", b.schema(typ.Elem()))
+	case typ.Kind() == reflect.String:
+		op.Responses["200"] = b.contentResponse("text/plain", &OpenAPISchema{Type: "string"})
+	default:
+		op.Responses["200"] = b.contentResponse("application/json", b.schema(typ))
+	}
+}
+
+// declaredResponse describes a response documented by Route.Responses
+// or a ResponseDocumenter, with the value as its example
+func (b *openAPIBuilder) declaredResponse(code int, response interface{}) *OpenAPIResponse {
+	description := http.StatusText(code)
+	if description == "" {
+		description = "Status " + strconv.Itoa(code)
+	}
+
+	switch example := response.(type) {
+	case nil:
+		if code >= 400 {
+			return b.errorResponse(description)
+		}
+		return &OpenAPIResponse{Description: description}
+	case error:
+		res := b.errorResponse(description)
+		media := res.Content["application/json"]
+		media.Example = map[string]string{"error": example.Error()}
+		res.Content["application/json"] = media
+		return res
+	case string:
+		return &OpenAPIResponse{
+			Description: description,
+			Content: map[string]OpenAPIMediaType{
+				"text/plain": {Schema: &OpenAPISchema{Type: "string"}, Example: example},
+			},
+		}
+	}
+
+	media := OpenAPIMediaType{Schema: b.schema(reflect.TypeOf(response))}
+	if !reflect.ValueOf(response).IsZero() {
+		media.Example = response
+	}
+	return &OpenAPIResponse{
+		Description: description,
+		Content:     map[string]OpenAPIMediaType{"application/json": media},
+	}
+}
+
+func (b *openAPIBuilder) contentResponse(mediaType string, schema *OpenAPISchema) *OpenAPIResponse {
+	return &OpenAPIResponse{
+		Description: "OK",
+		Content:     map[string]OpenAPIMediaType{mediaType: {Schema: schema}},
+	}
+}
+
+// errorResponse describes an error response, with the body written by
+// WriteError
+func (b *openAPIBuilder) errorResponse(description string) *OpenAPIResponse {
+	if _, ok := b.doc.Components.Schemas["Error"]; !ok {
+		b.doc.Components.Schemas["Error"] = &OpenAPISchema{
+			Type: "object",
+			Properties: map[string]*OpenAPISchema{
+				"error":    {Type: "string"},
+				"error_id": {Type: "string"},
+				"errors": {Type: "array", Items: &OpenAPISchema{
+					Type: "object",
+					Properties: map[string]*OpenAPISchema{
+						"field":   {Type: "string"},
+						"in":      {Type: "string"},
+						"message": {Type: "string"},
+					},
+					Required: []string{"field", "message"},
+				}},
+			},
+			Required: []string{"error"},
+		}
+	}
+	return &OpenAPIResponse{
+		Description: description,
+		Content: map[string]OpenAPIMediaType{
+			"application/json": {Schema: &OpenAPISchema{Ref: "#/components/schemas/Error"}},
+		},
+	}
+}
+
+// operationID names the operation after its handler function, unless
+// it's an anonymous function or already names another operation
+func (b *openAPIBuilder) operationID(handler interface{}) string {
+	name := handlerName(handler)
+	name = name[strings.LastIndex(name, ".")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	if name == "" || strings.HasPrefix(name, "func") && strings.TrimLeft(name[4:], "0123456789") == "" {
+		return ""
+	}
+	if b.operationIDs[name] {
+		return ""
+	}
+	b.operationIDs[name] = true
+	return name
+}
+
+// paramSchema describes the type of a param
+func (b *openAPIBuilder) paramSchema(typ reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: paramTypeName(typ)}
+	if isTimeType(typ) {
+		schema.Format = "date-time"
+	}
+	if enumer, ok := reflect.Zero(typ).Interface().(Enumer); ok {
+		schema.Enum = enumer.Enum()
+	}
+	return schema
+}
+
+// schema describes a type, adding named struct types to the components
+// and referring to them
+func (b *openAPIBuilder) schema(typ reflect.Type) *OpenAPISchema {
+	typ = reflectElem(typ)
+
+	var schema *OpenAPISchema
+	switch {
+	case isTimeType(typ):
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case typ.Implements(openAPIMarshalerType) || reflect.PtrTo(typ).Implements(openAPIMarshalerType):
+		schema = &OpenAPISchema{}
+	case typ.Kind() == reflect.Struct && typ.Name() != "":
+		name := typeName(typ)
+		if _, ok := b.doc.Components.Schemas[name]; !ok {
+			// added before filling it in, for types that refer to themselves
+			b.doc.Components.Schemas[name] = &OpenAPISchema{}
+			*b.doc.Components.Schemas[name] = *b.structSchema(typ)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	case typ.Kind() == reflect.Struct:
+		schema = b.structSchema(typ)
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		schema = &OpenAPISchema{Type: "string", Format: "byte"}
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array:
+		schema = &OpenAPISchema{Type: "array", Items: b.schema(typ.Elem())}
+	case typ.Kind() == reflect.Map:
+		schema = &OpenAPISchema{Type: "object", AdditionalProperties: b.schema(typ.Elem())}
+	case typ.Kind() == reflect.Interface:
+		schema = &OpenAPISchema{}
+	default:
+		schema = &OpenAPISchema{Type: paramTypeName(typ)}
+		switch typ.Kind() {
+		case reflect.Int32, reflect.Uint32:
+			schema.Format = "int32"
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			schema.Format = "int64"
+		case reflect.Float32:
+			schema.Format = "float"
+		case reflect.Float64:
+			schema.Format = "double"
+		}
+	}
+
+	if enumer, ok := reflect.Zero(typ).Interface().(Enumer); ok {
+		schema.Enum = enumer.Enum()
+	}
+	if doc, ok := reflect.Zero(typ).Interface().(documenter); ok {
+		schema.Description = cleanupText(doc.Documentation())
+	}
+	return schema
+}
+
+// structSchema describes the fields of a struct the way encoding/json
+// encodes them
+func (b *openAPIBuilder) structSchema(typ reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	if doc, ok := reflect.Zero(typ).Interface().(documenter); ok {
+		schema.Description = cleanupText(doc.Documentation())
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" && len(tag) == 1 {
+			continue
+		}
+
+		if field.Anonymous && tag[0] == "" && reflectElem(field.Type).Kind() == reflect.Struct {
+			embedded := b.structSchema(reflectElem(field.Type))
+			for name, property := range embedded.Properties {
+				if _, exists := schema.Properties[name]; !exists {
+					schema.Properties[name] = property
+				}
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+
+		property := b.schema(field.Type)
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			switch option {
+			case "omitempty", "omitzero":
+				omitEmpty = true
+			case "string":
+				property = &OpenAPISchema{Type: "string"}
+			}
+		}
+		if doc, ok := field.Tag.Lookup("doc"); ok {
+			property.Description = doc
+		}
+		if example, ok := exampleValue(field); ok {
+			property.Examples = []interface{}{example.Interface()}
+		}
+		schema.Properties[name] = property
+		if !omitEmpty && field.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// openAPIPath turns a pattern like /user/:userId(\d+)/*rest into
+// /user/{userId}/{rest}
+func openAPIPath(pattern string) string {
+	segments := getSegments(pattern)
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name, _ := parseVariable(segment[1:])
+			segments[i] = "{" + name + "}"
+		case strings.HasPrefix(segment, "*"):
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func reflectElem(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
@@ -0,0 +1,219 @@
+package plumbus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// APIChange is a difference between two versions of an OpenAPI document,
+// found by DiffOpenAPI. A Breaking change can break clients written
+// against the earlier version.
+type APIChange struct {
+	Breaking bool
+	Method   string
+	Path     string
+	Message  string
+}
+
+func (c APIChange) String() string {
+	kind := "change"
+	if c.Breaking {
+		kind = "breaking"
+	}
+	return fmt.Sprintf("%s: %s %s: %s", kind, strings.ToUpper(c.Method), c.Path, c.Message)
+}
+
+// DiffOpenAPI compares two versions of an API, reporting removed routes,
+// params, and response fields, new required params and request fields,
+// and changed types as breaking, and added routes and other differences
+// as not. The changes are sorted by path and method, as in:
+//
+//	for _, change := range plumbus.DiffOpenAPI(released, mux.OpenAPI(info)) {
+//		if change.Breaking {
+//			log.Print(change)
+//		}
+//	}
+func DiffOpenAPI(before, after *OpenAPI) []APIChange {
+	d := &openAPIDiff{before: before, after: after}
+
+	for path, beforeOps := range before.Paths {
+		for method, beforeOp := range beforeOps {
+			afterOp, ok := after.Paths[path][method]
+			if !ok {
+				d.add(true, method, path, "route removed")
+				continue
+			}
+			d.operation(method, path, beforeOp, afterOp)
+		}
+	}
+	for path, afterOps := range after.Paths {
+		for method := range afterOps {
+			if _, ok := before.Paths[path][method]; !ok {
+				d.add(false, method, path, "route added")
+			}
+		}
+	}
+
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		a, b := d.changes[i], d.changes[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		return a.Message < b.Message
+	})
+	return d.changes
+}
+
+type openAPIDiff struct {
+	before, after *OpenAPI
+	changes       []APIChange
+
+	method, path string
+}
+
+func (d *openAPIDiff) add(breaking bool, method, path, format string, args ...interface{}) {
+	d.changes = append(d.changes, APIChange{
+		Breaking: breaking,
+		Method:   method,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *openAPIDiff) operation(method, path string, beforeOp, afterOp *OpenAPIOperation) {
+	d.method, d.path = method, path
+	change := func(breaking bool, format string, args ...interface{}) {
+		d.add(breaking, method, path, format, args...)
+	}
+
+	if afterOp.Deprecated && !beforeOp.Deprecated {
+		change(false, "deprecated")
+	}
+
+	beforeParams := map[string]*OpenAPIParameter{}
+	for _, param := range beforeOp.Parameters {
+		beforeParams[param.In+" "+param.Name] = param
+	}
+	for _, param := range afterOp.Parameters {
+		key := param.In + " " + param.Name
+		beforeParam, ok := beforeParams[key]
+		delete(beforeParams, key)
+		switch {
+		case !ok && param.Required:
+			change(true, "required %s param %s added", param.In, param.Name)
+		case !ok:
+			change(false, "%s param %s added", param.In, param.Name)
+		default:
+			if param.Required && !beforeParam.Required {
+				change(true, "%s param %s became required", param.In, param.Name)
+			}
+			d.schema(fmt.Sprintf("%s param %s", param.In, param.Name), beforeParam.Schema, param.Schema, true, map[string]bool{})
+		}
+	}
+	for _, param := range beforeParams {
+		change(false, "%s param %s removed", param.In, param.Name)
+	}
+
+	switch beforeBody, afterBody := beforeOp.RequestBody, afterOp.RequestBody; {
+	case beforeBody == nil && afterBody != nil && afterBody.Required:
+		change(true, "required request body added")
+	case beforeBody != nil && afterBody == nil:
+		change(true, "request body removed")
+	case beforeBody != nil && afterBody != nil:
+		if afterBody.Required && !beforeBody.Required {
+			change(true, "request body became required")
+		}
+		d.content("request body", beforeBody.Content, afterBody.Content, true)
+	}
+
+	for code, beforeRes := range beforeOp.Responses {
+		afterRes, ok := afterOp.Responses[code]
+		if !ok {
+			change(strings.HasPrefix(code, "2"), "%s response removed", code)
+			continue
+		}
+		d.content(code+" response", beforeRes.Content, afterRes.Content, false)
+	}
+	for code := range afterOp.Responses {
+		if _, ok := beforeOp.Responses[code]; !ok {
+			change(false, "%s response added", code)
+		}
+	}
+}
+
+// content compares the media types of a request or response body
+func (d *openAPIDiff) content(what string, before, after map[string]OpenAPIMediaType, request bool) {
+	for mediaType, beforeMedia := range before {
+		afterMedia, ok := after[mediaType]
+		if !ok {
+			d.add(true, d.method, d.path, "%s no longer has media type %s", what, mediaType)
+			continue
+		}
+		d.schema(what, beforeMedia.Schema, afterMedia.Schema, request, map[string]bool{})
+	}
+}
+
+// schema compares what a schema accepts, for a request, or gives, for a
+// response, following refs into the documents' components
+func (d *openAPIDiff) schema(what string, before, after *OpenAPISchema, request bool, seen map[string]bool) {
+	if before == nil || after == nil {
+		return
+	}
+	if before.Ref != "" || after.Ref != "" {
+		key := before.Ref + " " + after.Ref
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+	}
+	before, after = resolveRef(d.before, before), resolveRef(d.after, after)
+	if before == nil || after == nil {
+		return
+	}
+
+	if before.Type != after.Type && before.Type != "" && after.Type != "" {
+		d.add(true, d.method, d.path, "%s changed type from %s to %s", what, before.Type, after.Type)
+		return
+	}
+	if before.Format != after.Format && before.Format != "" && after.Format != "" {
+		d.add(true, d.method, d.path, "%s changed format from %s to %s", what, before.Format, after.Format)
+	}
+
+	for name, beforeProperty := range before.Properties {
+		property := what + " field " + name
+		afterProperty, ok := after.Properties[name]
+		if !ok {
+			d.add(!request, d.method, d.path, "%s removed", property)
+			continue
+		}
+		d.schema(property, beforeProperty, afterProperty, request, seen)
+	}
+
+	if request {
+		beforeRequired := map[string]bool{}
+		for _, name := range before.Required {
+			beforeRequired[name] = true
+		}
+		for _, name := range after.Required {
+			if !beforeRequired[name] {
+				d.add(true, d.method, d.path, "%s field %s became required", what, name)
+			}
+		}
+	}
+
+	d.schema(what+" items", before.Items, after.Items, request, seen)
+	d.schema(what+" values", before.AdditionalProperties, after.AdditionalProperties, request, seen)
+}
+
+// resolveRef finds the schema in the document's components that a
+// schema refers to
+func resolveRef(doc *OpenAPI, schema *OpenAPISchema) *OpenAPISchema {
+	if schema.Ref == "" {
+		return schema
+	}
+	return doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+}
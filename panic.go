@@ -0,0 +1,49 @@
+package plumbus
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicHandler responds to a request whose handler (or middleware)
+// panicked, given the value it panicked with and the stack trace
+type PanicHandler func(res http.ResponseWriter, req *http.Request, recovered interface{}, stack []byte)
+
+// SetPanicHandler replaces how the mux responds when a handler panics,
+// such as to report the panic to an error tracker. By default the panic is
+// handled like an error (see SetErrorHandler) that's logged with its stack
+// trace, and the response is a 500.
+func (sm *ServeMux) SetPanicHandler(handler PanicHandler) {
+	sm.panicHandler = handler
+}
+
+// recoverPanic is deferred around handling each request
+func (sm *ServeMux) recoverPanic(res http.ResponseWriter, req *http.Request) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recovered == http.ErrAbortHandler {
+		// the handler is purposely aborting the response
+		panic(recovered)
+	}
+
+	stack := debug.Stack()
+	if sm.panicHandler != nil {
+		sm.panicHandler(res, req, recovered, stack)
+		return
+	}
+	HandleResponseError(res, req, &panicError{recovered: recovered, stack: stack})
+}
+
+// panicError is the error a panic is handled as, which is logged with its
+// stack trace
+type panicError struct {
+	recovered interface{}
+	stack     []byte
+}
+
+func (pe *panicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", pe.recovered, pe.stack)
+}
@@ -1,107 +1,258 @@
 package plumbus
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 )
 
+// Paths is a tree of routes with one level per path segment, which is
+// how routes are registered and listed. Requests are matched against a
+// radix tree of the static segments under the root and under each path
+// variable, so a path is matched with one comparison per byte of it,
+// however many routes there are, and only path variables are tried
+// one by one.
 type Paths struct {
+	pattern         string
 	handler         http.Handler
 	subpaths        map[string]*Paths
-	variables       map[string]*Paths
+	variables       []*Paths
+	radix           *radixNode
 	documentation   []string
 	originalHandler interface{}
+	mounted         *ServeMux
+	catchAll        *Paths
+	catchAllName    string
+	varSpec         string
+	varName         string
+	constraint      *regexp.Regexp
+	requirements    map[string]*Requirements
+	responses       map[string]map[int]interface{}
+	metadata        map[string]*routeMetadata
+	messages        map[string][]routeMessage
 }
 
 func (p *Paths) Handle(path string, handler interface{}, documentation ...string) {
-	segments := getSegments(path)
-	success := p.insertSegments(segments, handler, documentation)
-	if !success {
-		//todo: add the route to this message
+	p.HandleWith(path, nil, handler, documentation...)
+}
+
+// HandleWith is like Handle, but wraps the handler in middleware that
+// only applies to this route. The middleware runs after routing and
+// before any arguments are decoded, so it can cheaply reject a request.
+func (p *Paths) HandleWith(path string, middleware []Middleware, handler interface{}, documentation ...string) {
+	route := p.insertSegments(getSegments(path))
+	if route.handler != nil || route.mounted != nil {
 		panic(fmt.Errorf("duplicate route for path %s", path))
 	}
+
+	route.pattern = path
+	route.handler = chain(middleware, HandlerFunc(handler))
+	route.originalHandler = typedFunc(handler)
+	route.documentation = documentation
+}
+
+// insertSegments returns the node for the segments, creating it if needed
+func (p *Paths) insertSegments(segments []string) *Paths {
+	if p.radix == nil {
+		p.radix = &radixNode{route: p}
+	}
+	return p.insert(p, "", segments)
 }
 
-func (p *Paths) insertSegments(segments []string, handler interface{}, documentation []string) bool {
+// insert returns the node for the segments under p, creating it if
+// needed. New static nodes are added to the radix tree of root, the
+// nearest node above them that paths are matched from, by their path
+// from it.
+func (p *Paths) insert(root *Paths, key string, segments []string) *Paths {
 	if p.subpaths == nil {
 		p.subpaths = map[string]*Paths{}
 	}
-	if p.variables == nil {
-		p.variables = map[string]*Paths{}
-	}
 
 	if len(segments) == 0 {
-		if p.handler != nil {
-			return false
-		}
-		p.handler = HandlerFunc(handler)
-		p.originalHandler = handler
-		p.documentation = documentation
-		return true
+		return p
 	}
 
 	segment := segments[0]
 
-	insertMap := p.subpaths
-	//todo: check length first
-	if segment[0] == ':' {
-		insertMap = p.variables
-		segment = segment[1:]
+	if strings.HasPrefix(segment, "*") {
+		if len(segments) > 1 {
+			panic(fmt.Errorf("catch-all segment %s must come last", segment))
+		}
+		name := segment[1:]
+		if p.catchAll != nil && p.catchAllName != name {
+			panic(fmt.Errorf("conflicting catch-all segments *%s and *%s", p.catchAllName, name))
+		}
+		if p.catchAll == nil {
+			p.catchAll = &Paths{}
+			p.catchAllName = name
+		}
+		return p.catchAll
+	}
+
+	if strings.HasPrefix(segment, ":") {
+		sub := p.insertVariable(segment[1:])
+		return sub.insert(sub, "", segments[1:])
 	}
 
-	sub, exists := insertMap[segment]
+	key += "/" + segment
+	sub, exists := p.subpaths[segment]
 	if !exists {
 		sub = &Paths{}
-		insertMap[segment] = sub
+		p.subpaths[segment] = sub
+		root.radix.insert(key, sub)
+	}
+
+	return sub.insert(root, key, segments[1:])
+}
+
+// insertVariable returns the node for the variable, creating it if
+// needed. Variables with constraints are kept ahead of those without,
+// so that they're tried first when matching.
+func (p *Paths) insertVariable(spec string) *Paths {
+	for _, sub := range p.variables {
+		if sub.varSpec == spec {
+			return sub
+		}
+	}
+
+	sub := &Paths{varSpec: spec}
+	sub.varName, sub.constraint = parseVariable(spec)
+	sub.radix = &radixNode{route: sub}
+
+	i := len(p.variables)
+	if sub.constraint != nil {
+		for i = 0; i < len(p.variables) && p.variables[i].constraint != nil; i++ {
+		}
 	}
+	p.variables = append(p.variables, nil)
+	copy(p.variables[i+1:], p.variables[i:])
+	p.variables[i] = sub
 
-	return sub.insertSegments(segments[1:], handler, documentation)
+	return sub
 }
 
-func (p *Paths) findHandler(url *url.URL) http.Handler {
-	segments := getSegments(url.Path)
-	vals := url.Query()
-	handler := p.findHandlerSegments(segments, vals)
-	url.RawQuery = vals.Encode()
-	return handler
+// routeMatch is a route matching a path. For a route of a mounted mux,
+// the pattern starts with the prefix the mux is mounted at, and muxes
+// are the muxes whose middleware the request goes through before the
+// handler, outermost first.
+type routeMatch struct {
+	node    *Paths
+	handler http.Handler
+	pattern string
+	muxes   []*ServeMux
 }
 
-func (p *Paths) findHandlerSegments(segments []string, query url.Values) http.Handler {
-	if len(segments) == 0 {
-		return p.handler
+func nodeMatch(node *Paths) *routeMatch {
+	return &routeMatch{node: node, handler: node.handler, pattern: node.pattern}
+}
+
+// find returns the route matching the url, or nil if there is none,
+// along with the path parameters of the match. A path with a trailing
+// slash matches the route without one (and vice versa) if there is no
+// exact match.
+func (p *Paths) find(u *url.URL) (*routeMatch, url.Values) {
+	params := url.Values{}
+	if match := p.lookup(rootedPath(u.Path), params, false); match != nil {
+		return match, params
+	}
+	if alternate, ok := alternatePath(u.Path); ok {
+		params = url.Values{}
+		if match := p.lookup(rootedPath(alternate), params, false); match != nil {
+			return match, params
+		}
 	}
+	return nil, nil
+}
 
-	segment := segments[0]
+// rootedPath makes sure the path starts with a slash
+func rootedPath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
 
-	sub, found := p.subpaths[segment]
-	if found {
-		//if no match, we might have a variable match instead
-		if res := sub.findHandlerSegments(segments[1:], query); res != nil {
-			return res
+// lookup returns the route matching the path, which is either empty or
+// starts with a slash, descending into mounted muxes. Static segments
+// are preferred over path variables, and longer static matches over
+// shorter ones. If foldCase is true, static segments match regardless
+// of case, though an exact match is preferred. Params are only added for
+// the route that matches.
+func (p *Paths) lookup(path string, params url.Values, foldCase bool) *routeMatch {
+	if p.radix == nil {
+		return nil
+	}
+	return p.radix.lookup(path, params, foldCase)
+}
+
+// matchHere matches what's left of the path once the static segments up
+// to the node have matched, with the node's own handler, its mounted mux,
+// or its path variables and catch-all
+func (p *Paths) matchHere(path string, params url.Values, foldCase bool) *routeMatch {
+	if p.mounted != nil {
+		rest := path
+		if rest == "" {
+			rest = "/"
+		}
+		if match := p.mounted.Paths.lookup(rest, params, foldCase); match != nil {
+			match.muxes = append([]*ServeMux{p.mounted}, match.muxes...)
+			match.pattern = p.pattern + match.pattern
+			return match
 		}
+		// routes beside the mount may still match
 	}
 
-	//it's either a variable or not found
-	for varName, sub := range p.variables {
-		if handler := sub.findHandlerSegments(segments[1:], query); handler != nil {
-			query.Add(varName, segment)
-			return handler
+	if path == "" {
+		if p.handler == nil {
+			return nil
+		}
+		return nodeMatch(p)
+	}
+
+	//it's either a variable, the catch-all, or not found
+	segment, rest := path[1:], ""
+	if i := strings.IndexByte(segment, '/'); i != -1 {
+		segment, rest = segment[:i], segment[i:]
+	}
+	for _, sub := range p.variables {
+		if sub.constraint != nil && !sub.constraint.MatchString(segment) {
+			continue
 		}
+		if match := sub.lookup(rest, params, foldCase); match != nil {
+			params.Add(sub.varName, segment)
+			return match
+		}
+	}
+
+	if p.catchAll != nil && p.catchAll.handler != nil {
+		params.Add(p.catchAllName, path[1:])
+		return nodeMatch(p.catchAll)
 	}
 
 	return nil
 }
 
 func (p *Paths) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	handler := p.findHandler(req.URL)
-	if handler == nil {
-		http.Error(res, fmt.Sprintf("not found %s", req.URL.String()), http.StatusNotFound)
+	match, params := p.find(req.URL)
+	if match == nil || match.handler == nil {
+		notFound(res, req)
 		return
 	}
 
-	handler.ServeHTTP(res, req)
+	req = withPathParams(req, params)
+	req = req.WithContext(context.WithValue(req.Context(), routeStageKey, routeStage{
+		muxes:   match.muxes,
+		handler: match.handler,
+	}))
+
+	serveNextStage(res, req)
+}
+
+func notFound(res http.ResponseWriter, req *http.Request) {
+	http.Error(res, fmt.Sprintf("not found %s", req.URL.String()), http.StatusNotFound)
 }
 
 func (p *Paths) flatten() map[string]*Paths {
@@ -114,15 +265,68 @@ func (p *Paths) flattenMap(path string, m map[string]*Paths) {
 	if p.originalHandler != nil {
 		m[path] = p
 	}
+	if p.mounted != nil {
+		p.mounted.Paths.flattenMap(path, m)
+	}
 	for p, sub := range p.subpaths {
 		sub.flattenMap(path+"/"+p, m)
 	}
-	for p, sub := range p.variables {
-		sub.flattenMap(path+"/:"+p, m)
+	for _, sub := range p.variables {
+		sub.flattenMap(path+"/:"+sub.varSpec, m)
+	}
+	if p.catchAll != nil {
+		p.catchAll.flattenMap(path+"/*"+p.catchAllName, m)
 	}
 }
 
+// parseVariable splits a variable segment like "userId(\d+)" into its
+// name and the constraint its values must match, if any
+func parseVariable(segment string) (string, *regexp.Regexp) {
+	open := strings.Index(segment, "(")
+	if open == -1 || !strings.HasSuffix(segment, ")") {
+		return segment, nil
+	}
+
+	name := segment[:open]
+	expr := segment[open+1 : len(segment)-1]
+	constraint, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		panic(fmt.Errorf("bad constraint for path parameter %s: %v", name, err))
+	}
+
+	return name, constraint
+}
+
+// canonicalPath rewrites the path to use the case of the pattern it
+// matched, for the segments that aren't parameters
+func canonicalPath(pattern, path string) string {
+	patternSegments := getSegments(pattern)
+	segments := getSegments(path)
+	for i, segment := range patternSegments {
+		if i >= len(segments) || strings.HasPrefix(segment, "*") {
+			break
+		}
+		if !strings.HasPrefix(segment, ":") {
+			segments[i] = segment
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// getSegments splits a path into segments. A trailing slash results in
+// a final empty segment, so "/users/" and "/users" are distinct.
 func getSegments(path string) []string {
-	sansSlash := strings.TrimPrefix(strings.TrimSuffix(path, "/"), "/")
-	return strings.Split(sansSlash, "/")
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// alternatePath adds a trailing slash to a path without one, or removes
+// it from a path with one. It returns false for the root path.
+func alternatePath(path string) (string, bool) {
+	if path == "/" || path == "" {
+		return "", false
+	}
+	if strings.HasSuffix(path, "/") {
+		return strings.TrimSuffix(path, "/"), true
+	}
+	return path + "/", true
 }
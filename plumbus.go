@@ -5,14 +5,20 @@
 package plumbus
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"reflect"
-	"runtime"
+	"strings"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/jargv/plumbus/generate"
 )
 
@@ -23,6 +29,11 @@ var adaptors map[reflect.Type]adaptorFunc
 type FromRequest generate.FromRequest
 type ToResponse generate.ToResponse
 type HTTPError generate.HTTPError
+type Defaulter generate.Defaulter
+type Enumer generate.Enumer
+type Validator generate.Validator
+type File = generate.File
+type WSConn = generate.WSConn
 
 func RegisterAdaptor(typ reflect.Type, adaptor adaptorFunc) {
 	if adaptors == nil {
@@ -31,8 +42,46 @@ func RegisterAdaptor(typ reflect.Type, adaptor adaptorFunc) {
 	adaptors[typ] = adaptor
 }
 
+// Middleware wraps an http.Handler, as in the common
+// func(http.Handler) http.Handler idiom.
+type Middleware func(http.Handler) http.Handler
+
 type ServeMux struct {
 	*Paths
+	middleware       []Middleware
+	chained          http.Handler
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+	mounts           []*Paths
+	names            map[string]*Paths
+	trailingSlash    TrailingSlashPolicy
+	hosts            map[string]*ServeMux
+	casePolicy       CasePolicy
+	multipartMemory  int64
+	bodyContentTypes []string
+	envelope         func(*http.Request, interface{}) interface{}
+	errorEnvelope    func(*http.Request, HTTPError) interface{}
+	emptyCode        int
+	templates        *Templates
+	eventHeartbeat   time.Duration
+	wsUpgrader       *websocket.Upgrader
+	etags            bool
+	prettyJSON       bool
+	newJSONEncoder   func(io.Writer) JSONEncoder
+	jsonRawHTML      bool
+	jsonIndent       string
+	errorFormat      ErrorFormat
+	errorMappings    []errorMapping
+	errorHandler     func(http.ResponseWriter, *http.Request, error)
+	panicHandler     PanicHandler
+	debug            bool
+	errorIDHook      func(*http.Request, string, error)
+	interceptors     []interceptor
+	afterResponse    []func(*http.Request, ResponseInfo)
+	apiKeyHeader     string
+	apiKeyQuery      string
+	authorizer       Authorizer
+	trustedProxies   []netip.Prefix
 }
 
 func NewServeMux() *ServeMux {
@@ -41,7 +90,7 @@ func NewServeMux() *ServeMux {
 	}
 }
 
-func (sm *ServeMux) Handle(route string, fn interface{}, documentation ...string) {
+func (sm *ServeMux) Handle(route string, fn interface{}, documentation ...string) *Route {
 	defer func() {
 		err := recover()
 		if err, ok := err.(error); ok {
@@ -50,6 +99,504 @@ func (sm *ServeMux) Handle(route string, fn interface{}, documentation ...string
 	}()
 
 	sm.Paths.Handle(route, fn, documentation...)
+	return sm.routeFor(route)
+}
+
+// HandleWith is like Handle, but the middleware only applies to this
+// route. It runs inside of any middleware added with Use.
+func (sm *ServeMux) HandleWith(route string, middleware []Middleware, fn interface{}, documentation ...string) *Route {
+	defer func() {
+		err := recover()
+		if err, ok := err.(error); ok {
+			panic(fmt.Errorf("Error while routing %s: %s", route, err.Error()))
+		}
+	}()
+
+	sm.Paths.HandleWith(route, middleware, fn, documentation...)
+	return sm.routeFor(route)
+}
+
+// GET handles GET requests for the route. It can be combined with the
+// other method helpers on the same route, as if a ByMethod were used.
+func (sm *ServeMux) GET(route string, fn interface{}, documentation ...string) *Route {
+	return sm.handleMethod("GET", route, fn, documentation)
+}
+
+// POST handles POST requests for the route, see GET
+func (sm *ServeMux) POST(route string, fn interface{}, documentation ...string) *Route {
+	return sm.handleMethod("POST", route, fn, documentation)
+}
+
+// PUT handles PUT requests for the route, see GET
+func (sm *ServeMux) PUT(route string, fn interface{}, documentation ...string) *Route {
+	return sm.handleMethod("PUT", route, fn, documentation)
+}
+
+// PATCH handles PATCH requests for the route, see GET
+func (sm *ServeMux) PATCH(route string, fn interface{}, documentation ...string) *Route {
+	return sm.handleMethod("PATCH", route, fn, documentation)
+}
+
+// DELETE handles DELETE requests for the route, see GET
+func (sm *ServeMux) DELETE(route string, fn interface{}, documentation ...string) *Route {
+	return sm.handleMethod("DELETE", route, fn, documentation)
+}
+
+func (sm *ServeMux) handleMethod(method, route string, fn interface{}, documentation []string) *Route {
+	defer func() {
+		err := recover()
+		if err, ok := err.(error); ok {
+			panic(fmt.Errorf("Error while routing %s %s: %s", method, route, err.Error()))
+		}
+	}()
+
+	node := sm.Paths.insertSegments(getSegments(route))
+	if node.handler == nil && node.mounted == nil {
+		sm.Paths.Handle(route, &ByMethod{}, documentation...)
+	} else {
+		node.documentation = append(node.documentation, documentation...)
+	}
+
+	methods, ok := node.originalHandler.(*ByMethod)
+	if !ok || !methods.set(method, fn) {
+		panic(fmt.Errorf("duplicate route for path %s", route))
+	}
+	node.handler = HandlerFunc(methods)
+	r := sm.routeFor(route)
+	r.method = method
+	return r
+}
+
+// Use adds middleware that wraps every request served by the mux,
+// including ones that aren't found. Middleware runs after routing, so
+// RoutePattern can be used to find which route matched. The first
+// middleware added is the outermost.
+func (sm *ServeMux) Use(middleware ...Middleware) {
+	sm.middleware = append(sm.middleware, middleware...)
+	sm.chained = chain(sm.middleware, http.HandlerFunc(serveNextStage))
+}
+
+// Mount serves every path under the prefix with the other mux. The
+// prefix may contain path parameters, and they are available to the
+// other mux's handlers just like its own.
+func (sm *ServeMux) Mount(prefix string, other *ServeMux) {
+	// a mount at "/" belongs to the root itself
+	var segments []string
+	if trimmed := strings.TrimSuffix(prefix, "/"); trimmed != "" {
+		segments = getSegments(trimmed)
+	}
+	mount := sm.Paths.insertSegments(segments)
+	if mount.handler != nil || mount.mounted != nil {
+		panic(fmt.Errorf("duplicate route for mount %s", prefix))
+	}
+
+	mount.pattern = strings.TrimSuffix(prefix, "/")
+	mount.mounted = other
+	sm.mounts = append(sm.mounts, mount)
+}
+
+// NotFound sets the handler used when no route matches the request. It
+// can be any handler accepted by Handle. Responses are sent with a 404
+// status unless the handler chooses another.
+func (sm *ServeMux) NotFound(fn interface{}) {
+	sm.notFound = withStatus(http.StatusNotFound, HandlerFunc(fn))
+}
+
+// MethodNotAllowed sets the handler used when a route handles some
+// methods but not the method of the request. It can be any handler
+// accepted by Handle. Responses are sent with a 405 status unless the
+// handler chooses another.
+func (sm *ServeMux) MethodNotAllowed(fn interface{}) {
+	sm.methodNotAllowed = withStatus(http.StatusMethodNotAllowed, HandlerFunc(fn))
+}
+
+// TrailingSlashPolicy controls how paths that differ from a route only
+// by a trailing slash are treated
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashMatch serves "/users/" with the route for "/users"
+	// when there is no route for "/users/", and vice versa. This is the
+	// default.
+	TrailingSlashMatch TrailingSlashPolicy = iota
+
+	// TrailingSlashRedirect responds to "/users/" with a 301 redirect
+	// to "/users" when there is no route for "/users/", and vice versa
+	TrailingSlashRedirect
+
+	// TrailingSlashStrict treats "/users/" and "/users" as distinct,
+	// so only an exact match is served
+	TrailingSlashStrict
+)
+
+// SetTrailingSlashPolicy sets how the mux treats paths that only
+// match a route if a trailing slash is added or removed
+func (sm *ServeMux) SetTrailingSlashPolicy(policy TrailingSlashPolicy) {
+	sm.trailingSlash = policy
+}
+
+// CasePolicy controls whether paths match routes regardless of case
+type CasePolicy int
+
+const (
+	// CaseSensitive only matches paths with the same case as the
+	// route. This is the default.
+	CaseSensitive CasePolicy = iota
+
+	// CaseInsensitive matches paths regardless of case, though path
+	// parameters keep the case they were sent with
+	CaseInsensitive
+
+	// CaseInsensitiveRedirect responds to paths that only match
+	// regardless of case with a 301 redirect to the path in the case
+	// the route was registered with
+	CaseInsensitiveRedirect
+)
+
+// SetCasePolicy sets whether the mux matches paths regardless of case
+func (sm *ServeMux) SetCasePolicy(policy CasePolicy) {
+	sm.casePolicy = policy
+}
+
+// SetMultipartMemory sets how many bytes of a multipart form are kept in
+// memory, after which uploaded files are stored in temporary files. The
+// default is 32MB.
+func (sm *ServeMux) SetMultipartMemory(bytes int64) {
+	sm.multipartMemory = bytes
+}
+
+// SetBodyContentTypes limits the media types accepted for request bodies
+// that are decoded for a handler, such as "application/json". Other
+// requests get a 415 response. By default form and multipart bodies are
+// accepted, along with any media type that has a decoder registered.
+func (sm *ServeMux) SetBodyContentTypes(mediaTypes ...string) {
+	sm.bodyContentTypes = mediaTypes
+}
+
+// SetEnvelope wraps every response body that's encoded for a handler in
+// a standard envelope, as in:
+//
+//	mux.SetEnvelope(func(req *http.Request, body interface{}) interface{} {
+//		return map[string]interface{}{
+//			"data": body,
+//			"meta": map[string]interface{}{"path": req.URL.Path},
+//		}
+//	})
+//
+// Bodies written by a ToResponse are left alone.
+func (sm *ServeMux) SetEnvelope(envelope func(req *http.Request, body interface{}) interface{}) {
+	sm.envelope = envelope
+}
+
+// SetErrorEnvelope sets the json body written for errors, in place of
+// the default {"error": "..."}. Errors that aren't an HTTPError are
+// given to it as a 500 "internal server error".
+func (sm *ServeMux) SetErrorEnvelope(envelope func(req *http.Request, err HTTPError) interface{}) {
+	sm.errorEnvelope = envelope
+}
+
+// SetEmptyResponseCode sets the status of the response for handlers that
+// return nothing but an error, which is 204 No Content by default. Set it
+// to http.StatusOK for an empty 200 response instead.
+func (sm *ServeMux) SetEmptyResponseCode(code int) {
+	sm.emptyCode = code
+}
+
+// SetEventHeartbeat sets how long an EventStream can be quiet before a
+// heartbeat comment is sent to keep the connection open. The default is 15
+// seconds.
+func (sm *ServeMux) SetEventHeartbeat(interval time.Duration) {
+	sm.eventHeartbeat = interval
+}
+
+// SetErrorHandler replaces how the mux responds to errors, including
+// those returned by handlers and those from converting their params. The
+// handler can call WriteError to fall back to the default response, as in:
+//
+//	mux.SetErrorHandler(func(res http.ResponseWriter, req *http.Request, err error) {
+//		logger.Error("request failed", "path", req.URL.Path, "err", err)
+//		plumbus.WriteError(res, req, err)
+//	})
+func (sm *ServeMux) SetErrorHandler(handler func(res http.ResponseWriter, req *http.Request, err error)) {
+	sm.errorHandler = handler
+}
+
+// SetDebug puts the mux in debug mode, where 500 responses say what went
+// wrong, with the error's message, instead of only "internal server
+// error". The stack trace of a panic is given too, as is the stack of an
+// error with a Stack() []byte method, as some error packages add. It's
+// meant for development, since the details of internal errors shouldn't
+// be shown in production.
+func (sm *ServeMux) SetDebug(debug bool) {
+	sm.debug = debug
+}
+
+// SetErrorIDHook sets a function to call with the ID given to each
+// internal error, such as to attach it to the request's trace. The ID is
+// also logged with the error and sent in the response as "error_id", so
+// that an error someone reports can be found in the logs.
+func (sm *ServeMux) SetErrorIDHook(hook func(req *http.Request, id string, err error)) {
+	sm.errorIDHook = hook
+}
+
+func (sm *ServeMux) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if len(sm.afterResponse) > 0 {
+		recorder := &responseRecorder{ResponseWriter: res}
+		res = recorder
+		start := time.Now()
+		defer func() {
+			sm.runAfterResponse(recorder, req, start)
+		}()
+	}
+
+	match, params := sm.match(req.Host, rootedPath(req.URL.Path))
+
+	if match == nil && sm.trailingSlash != TrailingSlashStrict {
+		if alternate, ok := alternatePath(req.URL.Path); ok {
+			match, params = sm.match(req.Host, rootedPath(alternate))
+			if match != nil && sm.trailingSlash == TrailingSlashRedirect {
+				target := *req.URL
+				target.Path = alternate
+				http.Redirect(res, req, target.RequestURI(), http.StatusMovedPermanently)
+				return
+			}
+		}
+	}
+
+	if match != nil && sm.casePolicy == CaseInsensitiveRedirect {
+		if canonical := canonicalPath(match.pattern, req.URL.Path); canonical != req.URL.Path {
+			target := *req.URL
+			target.Path = canonical
+			http.Redirect(res, req, target.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+	}
+
+	req = withPathParams(req, params)
+
+	ctx := context.WithValue(req.Context(), muxKey, sm)
+	stage := routeStage{muxes: []*ServeMux{sm}}
+	if match == nil {
+		stage.handler = http.HandlerFunc(notFound)
+		if sm.notFound != nil {
+			stage.handler = sm.notFound
+		}
+	} else {
+		stage.handler = match.handler
+		stage.muxes = append(stage.muxes, match.muxes...)
+		ctx = context.WithValue(ctx, routePatternKey, match.pattern)
+		ctx = context.WithValue(ctx, routeNodeKey, match.node)
+	}
+	ctx = context.WithValue(ctx, routeMuxesKey, stage.muxes)
+	req = req.WithContext(context.WithValue(ctx, routeStageKey, stage))
+
+	defer sm.recoverPanic(res, req)
+	serveNextStage(res, req)
+}
+
+// routeStage is where a request is on its way through the middleware of
+// the muxes its route was found through
+type routeStage struct {
+	muxes   []*ServeMux
+	handler http.Handler
+}
+
+// serveNextStage serves a request with the middleware of the next mux
+// its route was found through, or once there are none left, with the
+// route's handler. Each mux's middleware is chained when it's added,
+// with serveNextStage innermost.
+func serveNextStage(res http.ResponseWriter, req *http.Request) {
+	stage := req.Context().Value(routeStageKey).(routeStage)
+	if len(stage.muxes) == 0 {
+		stage.handler.ServeHTTP(res, req)
+		return
+	}
+
+	mux := stage.muxes[0]
+	stage.muxes = stage.muxes[1:]
+	req = req.WithContext(context.WithValue(req.Context(), routeStageKey, stage))
+	if mux.chained == nil {
+		serveNextStage(res, req)
+		return
+	}
+	mux.chained.ServeHTTP(res, req)
+}
+
+// Host returns a mux for routes that only apply to requests for the
+// host, such as "api.example.com". Routes for a host take precedence
+// over the routes registered directly on this mux, which apply to every
+// host. Settings like NotFound are taken from this mux, not the host's.
+func (sm *ServeMux) Host(host string) *ServeMux {
+	host = strings.ToLower(host)
+	if sm.hosts == nil {
+		sm.hosts = map[string]*ServeMux{}
+	}
+	if _, exists := sm.hosts[host]; !exists {
+		sm.hosts[host] = NewServeMux()
+	}
+	return sm.hosts[host]
+}
+
+// match finds the route for the path, preferring routes specific
+// to the host, along with the path params of the match. Each attempt
+// starts with params of its own.
+func (sm *ServeMux) match(host, path string) (*routeMatch, url.Values) {
+	foldCase := sm.casePolicy != CaseSensitive
+	if hostMux, found := sm.hosts[hostname(host)]; found {
+		params := url.Values{}
+		if match := hostMux.Paths.lookup(path, params, foldCase); match != nil {
+			match.muxes = append([]*ServeMux{hostMux}, match.muxes...)
+			return match, params
+		}
+	}
+
+	params := url.Values{}
+	if match := sm.Paths.lookup(path, params, foldCase); match != nil {
+		return match, params
+	}
+	return nil, url.Values{}
+}
+
+// hostname strips any port from the host, and lowercases it
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+type contextKey int
+
+const (
+	routePatternKey contextKey = iota
+	muxKey
+	pathParamsKey
+	routeNodeKey
+	csrfTokenKey
+	routeStageKey
+	routeMuxesKey
+)
+
+// PathParams returns the values of the path parameters matched by the
+// route, such as userId for "/user/:userId/info". For compatibility,
+// they're also added to the request's query string.
+func PathParams(req *http.Request) url.Values {
+	params, _ := req.Context().Value(pathParamsKey).(url.Values)
+	return params
+}
+
+// PathParam returns the value of the named path parameter, or "" if
+// there is none
+func PathParam(req *http.Request, name string) string {
+	return PathParams(req).Get(name)
+}
+
+// withPathParams adds the path params to the request's context and query
+func withPathParams(req *http.Request, params url.Values) *http.Request {
+	if len(params) > 0 {
+		query := req.URL.Query()
+		for name, values := range params {
+			query[name] = append(query[name], values...)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	return req.WithContext(context.WithValue(req.Context(), pathParamsKey, params))
+}
+
+// muxFromRequest returns the ServeMux serving the request, if any
+func muxFromRequest(req *http.Request) *ServeMux {
+	sm, _ := req.Context().Value(muxKey).(*ServeMux)
+	return sm
+}
+
+// routeMuxes returns the muxes the request's route was found through,
+// outermost first, starting with the ServeMux serving the request and
+// followed by any Host mux and mounted muxes
+func routeMuxes(req *http.Request) []*ServeMux {
+	muxes, _ := req.Context().Value(routeMuxesKey).([]*ServeMux)
+	return muxes
+}
+
+// routeMux returns the innermost of the request's route muxes for which
+// has is true, so the settings of a mounted or Host mux win over those of
+// the mux it's part of. It's the ServeMux serving the request if none is.
+func routeMux(req *http.Request, has func(*ServeMux) bool) *ServeMux {
+	muxes := routeMuxes(req)
+	for i := len(muxes) - 1; i >= 0; i-- {
+		if has(muxes[i]) {
+			return muxes[i]
+		}
+	}
+	return muxFromRequest(req)
+}
+
+// RoutePattern returns the pattern of the route that matched the
+// request, such as "/user/:userId/info", or "" if no route matched.
+func RoutePattern(req *http.Request) string {
+	pattern, _ := req.Context().Value(routePatternKey).(string)
+	return pattern
+}
+
+// withStatus makes the handler respond with the code, unless it
+// explicitly writes a different one
+func withStatus(code int, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(&StatusWriter{ResponseWriter: res, Code: code}, req)
+	})
+}
+
+// StatusWriter responds with Code, unless a different status is written
+// explicitly. Adaptors use it for handlers that return their status as an
+// int.
+type StatusWriter struct {
+	http.ResponseWriter
+	Code        int
+	wroteHeader bool
+}
+
+func (w *StatusWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *StatusWriter) Write(body []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.Code)
+	}
+	return w.ResponseWriter.Write(body)
+}
+
+func (w *StatusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.WriteHeader(w.Code)
+		}
+		flusher.Flush()
+	}
+}
+
+// NewStatusWriter makes a StatusWriter that responds with code, or gives
+// an error if code isn't a valid status, between 100 and 599
+func NewStatusWriter(res http.ResponseWriter, code int) (*StatusWriter, error) {
+	if code < 100 || code > 599 {
+		return nil, fmt.Errorf("handler returned invalid status code %d", code)
+	}
+	return &StatusWriter{ResponseWriter: res, Code: code}, nil
+}
+
+// Finish writes Code if nothing has been written yet, for responses
+// without a body
+func (w *StatusWriter) Finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(w.Code)
+	}
+}
+
+func chain(middleware []Middleware, handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
 }
 
 func HandlerFunc(handler interface{}) http.Handler {
@@ -72,10 +619,17 @@ func HandlerFunc(handler interface{}) http.Handler {
 		))
 	}
 
+	info, err := generate.CollectInfo(typ)
+	if err == nil {
+		err = checkInputs(info)
+	}
+	if err != nil {
+		panic(fmt.Errorf("handler %s: %v", handlerName(handler), err))
+	}
+
 	adaptor, exists := adaptors[typ]
 	if !exists {
-		name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
-		log.Printf("WARNING: using slow reflection adaptor for function: %s", name)
+		log.Printf("WARNING: using slow reflection adaptor for function: %s", handlerName(handler))
 		log.Printf("NOTE   : annotate with `//go:generate plumbus <function name>` and run `go generate`")
 		adaptor = makeDynamicAdaptor(typ)
 		if adaptors == nil {
@@ -100,20 +654,84 @@ func makeDynamicAdaptor(typ reflect.Type) adaptorFunc {
 	}
 }
 
+// ReflectionHandler adapts handler with the reflection adaptor, even if
+// it has a generated one, as for comparing the two in benchmarks
+func ReflectionHandler(handler interface{}) http.Handler {
+	return makeDynamicAdaptor(reflect.TypeOf(handler))(handler)
+}
+
+// HandleResponseError responds to a request that failed with err, using
+// the error handler set by SetErrorHandler on the mux the route was found
+// through, or one it's part of, or else WriteError
 func HandleResponseError(res http.ResponseWriter, req *http.Request, err error) {
-	if httperr, ok := err.(HTTPError); ok {
+	hasHandler := func(mux *ServeMux) bool { return mux.errorHandler != nil }
+	if sm := routeMux(req, hasHandler); sm != nil && sm.errorHandler != nil {
+		sm.errorHandler(res, req, err)
+		return
+	}
+	WriteError(res, req, err)
+}
+
+// WriteError writes the response for err the way plumbus does by default.
+// An HTTPError (or one mapped by MapError) sets the status, and the body is
+// written as set by SetErrorEnvelope or SetErrorFormat. Any other error is
+// logged, and gets a 500 response. The settings of a mounted or Host mux
+// win over those of the mux it's part of.
+func WriteError(res http.ResponseWriter, req *http.Request, err error) {
+	if httperr, ok := asHTTPError(err); ok {
+		err = httperr
+	} else if httperr, ok := mapRouteError(req, err); ok {
+		err = httperr
+	}
+	setRetryAfter(res, err)
+	setChallenge(res, err)
+
+	sm := routeMux(req, func(mux *ServeMux) bool {
+		return mux.errorEnvelope != nil || mux.errorFormat != ErrorJSON
+	})
+
+	if sm != nil && (sm.errorEnvelope != nil || sm.errorFormat == ErrorProblemJSON) {
+		httperr, ok := err.(HTTPError)
+		if !ok {
+			httperr = handleInternalError(req, err)
+		}
+		if sm.errorEnvelope == nil {
+			writeProblem(res, req, httperr)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(httperr.ResponseCode())
+		writeJSON(res, req, sm.errorEnvelope(req, httperr))
+		return
+	}
+
+	if verrs, ok := err.(ValidationErrors); ok {
+		res.WriteHeader(verrs.ResponseCode())
+		writeJSON(res, req, map[string]interface{}{
+			"error":  verrs.Error(),
+			"errors": verrs,
+		})
+	} else if se, ok := err.(*StructuredError); ok {
+		res.WriteHeader(se.ResponseCode())
+		body := se.fields()
+		body["error"] = se.message
+		writeJSON(res, req, body)
+	} else if httperr, ok := err.(HTTPError); ok {
 		res.WriteHeader(httperr.ResponseCode())
-		json.NewEncoder(res).Encode(map[string]interface{}{
+		writeJSON(res, req, map[string]interface{}{
 			"error": httperr.Error(),
 		})
 	} else {
-		log.Printf(
-			"error handling request: %s %s: %v",
-			req.Method,
-			req.URL.Path,
-			err,
-		)
-		body := `{"error":"internal server error"}`
-		http.Error(res, body, http.StatusInternalServerError)
+		internal := handleInternalError(req, err)
+		body := map[string]interface{}{
+			"error":    internal.message,
+			"error_id": internal.id,
+		}
+		if internal.stack != "" {
+			body["stack"] = strings.Split(internal.stack, "\n")
+		}
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusInternalServerError)
+		writeJSON(res, req, body)
 	}
 }
@@ -0,0 +1,258 @@
+package plumbus
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// PostmanCollection is a Postman collection (format v2.1) with a request
+// for each endpoint of the documentation, made by Documentation.Postman
+type PostmanCollection struct {
+	Info     PostmanInfo       `json:"info"`
+	Item     []*PostmanItem    `json:"item"`
+	Variable []PostmanKeyValue `json:"variable,omitempty"`
+}
+
+type PostmanInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+// PostmanItem is either a request or, when it has items of its own, a
+// folder of them
+type PostmanItem struct {
+	Name    string          `json:"name"`
+	Request *PostmanRequest `json:"request,omitempty"`
+	Item    []*PostmanItem  `json:"item,omitempty"`
+}
+
+type PostmanRequest struct {
+	Method      string            `json:"method"`
+	Description string            `json:"description,omitempty"`
+	Header      []PostmanKeyValue `json:"header"`
+	URL         PostmanURL        `json:"url"`
+	Body        *PostmanBody      `json:"body,omitempty"`
+}
+
+type PostmanURL struct {
+	Raw      string            `json:"raw"`
+	Host     []string          `json:"host"`
+	Path     []string          `json:"path"`
+	Query    []PostmanKeyValue `json:"query,omitempty"`
+	Variable []PostmanKeyValue `json:"variable,omitempty"`
+}
+
+type PostmanBody struct {
+	Mode     string            `json:"mode"`
+	Raw      string            `json:"raw,omitempty"`
+	FormData []PostmanKeyValue `json:"formdata,omitempty"`
+	Options  interface{}       `json:"options,omitempty"`
+}
+
+type PostmanKeyValue struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// Postman exports the documentation as a Postman collection, so that
+// the routes can be tried out by importing it. Requests are grouped in
+// folders by their first tag, and their URLs start with a baseUrl
+// variable set to baseURL, as in:
+//
+//	mux.Handle("/postman.json", func() *plumbus.PostmanCollection {
+//		return mux.Documentation().Postman("Orders", "http://localhost:8080")
+//	})
+//
+// Optional params are included, but disabled.
+func (d *Documentation) Postman(name, baseURL string) *PostmanCollection {
+	collection := &PostmanCollection{
+		Info: PostmanInfo{
+			Name:        name,
+			Description: strings.Join(d.Introduction, "\n\n"),
+			Schema:      "https://schema.getpostman.com/json/collection/v2.1.0/collection.json",
+		},
+		Item:     []*PostmanItem{},
+		Variable: []PostmanKeyValue{{Key: "baseUrl", Value: baseURL}},
+	}
+
+	folders := map[string]*PostmanItem{}
+	for _, e := range d.sortedEndpoints() {
+		item := &PostmanItem{
+			Name:    e.title(),
+			Request: d.postmanRequest(e),
+		}
+		if len(e.Tags) == 0 {
+			collection.Item = append(collection.Item, item)
+			continue
+		}
+
+		folder, ok := folders[e.Tags[0]]
+		if !ok {
+			folder = &PostmanItem{Name: e.Tags[0]}
+			folders[e.Tags[0]] = folder
+			collection.Item = append(collection.Item, folder)
+		}
+		folder.Item = append(folder.Item, item)
+	}
+
+	return collection
+}
+
+func (d *Documentation) postmanRequest(e *Endpoint) *PostmanRequest {
+	example := d.requestExample(e)
+	request := &PostmanRequest{
+		Method:      example.method,
+		Description: e.Description,
+		Header:      []PostmanKeyValue{},
+		URL: PostmanURL{
+			Raw:  "{{baseUrl}}" + example.path,
+			Host: []string{"{{baseUrl}}"},
+			Path: getSegments(example.path),
+		},
+	}
+
+	for _, param := range example.params {
+		kv := PostmanKeyValue{
+			Key:         param.name,
+			Value:       param.Default,
+			Description: param.Description,
+			Disabled:    !param.Required,
+		}
+		switch param.In {
+		case "path":
+			kv.Disabled = false
+			request.URL.Variable = append(request.URL.Variable, kv)
+		case "header":
+			request.Header = append(request.Header, kv)
+		case "cookie":
+			kv.Key, kv.Value = "Cookie", param.name+"="+param.Default
+			request.Header = append(request.Header, kv)
+		case "form":
+			kv.Type = "text"
+			if param.Type == "file" {
+				kv.Type = "file"
+			}
+			if request.Body == nil {
+				request.Body = &PostmanBody{Mode: "formdata"}
+			}
+			request.Body.FormData = append(request.Body.FormData, kv)
+		default:
+			request.URL.Query = append(request.URL.Query, kv)
+		}
+	}
+
+	if query := example.query(); query != "" {
+		request.URL.Raw += "?" + query
+	}
+
+	if example.body != "" && request.Body == nil {
+		request.Header = append(request.Header, PostmanKeyValue{Key: "Content-Type", Value: "application/json"})
+		request.Body = &PostmanBody{
+			Mode: "raw",
+			Raw:  example.body,
+			Options: map[string]interface{}{
+				"raw": map[string]string{"language": "json"},
+			},
+		}
+	}
+
+	return request
+}
+
+// requestExample is what an exported request is made from: an endpoint
+// with its method settled, its path params written as :name, and its
+// body filled in with the example of the body's type
+type requestExample struct {
+	method string
+	path   string
+	params []exampleParam
+	body   string
+}
+
+type exampleParam struct {
+	name string
+	ParamInfo
+}
+
+func (d *Documentation) requestExample(e *Endpoint) *requestExample {
+	example := &requestExample{method: e.Method}
+
+	segments := getSegments(e.Path)
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name, _ := parseVariable(segment[1:])
+			segments[i] = ":" + name
+		case strings.HasPrefix(segment, "*"):
+			segments[i] = ":" + segment[1:]
+		default:
+			continue
+		}
+
+		if _, ok := e.Params[segments[i][1:]]; !ok {
+			example.params = append(example.params, exampleParam{
+				name:      segments[i][1:],
+				ParamInfo: ParamInfo{In: "path", Type: "string", Required: true},
+			})
+		}
+	}
+	example.path = "/" + strings.Join(segments, "/")
+
+	names := make([]string, 0, len(e.Params))
+	for name := range e.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		example.params = append(example.params, exampleParam{name: name, ParamInfo: e.Params[name]})
+	}
+
+	if t, ok := d.Types[e.RequestBody]; ok && e.RequestBody != "" {
+		body, err := json.MarshalIndent(t.Example, "", "  ")
+		if err == nil {
+			example.body = string(body)
+		}
+	}
+
+	if example.method == "" {
+		example.method = "GET"
+		if example.body != "" {
+			example.method = "POST"
+		}
+	}
+
+	return example
+}
+
+// query is the query string of the required query params
+func (r *requestExample) query() string {
+	var pairs []string
+	for _, param := range r.params {
+		if param.In == "query" && param.Required {
+			pairs = append(pairs, param.name+"="+param.Default)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (d *Documentation) sortedEndpoints() []*Endpoint {
+	endpoints := append([]*Endpoint{}, d.Endpoints...)
+	sort.Sort(docOrder(endpoints))
+	return endpoints
+}
+
+// title names an endpoint by its summary, or its method and path
+func (e *Endpoint) title() string {
+	if e.Summary != "" {
+		return e.Summary
+	}
+	if e.Method == "" {
+		return e.Path
+	}
+	return e.Method + " " + e.Path
+}
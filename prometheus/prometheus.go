@@ -0,0 +1,107 @@
+// Package prometheus exports Prometheus metrics for the requests that a
+// plumbus mux serves. They're labeled by the pattern of the route that
+// matched, such as "/user/:userId/name", rather than by the raw path, so
+// the number of series stays bounded.
+package prometheus
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jargv/plumbus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Unmatched is the route label of requests that didn't match any route
+const Unmatched = "unmatched"
+
+// Instrument records metrics for every request that the mux serves,
+// registering them with registerer, or prometheus.DefaultRegisterer if
+// it's nil:
+//
+//   - http_requests_total, counted by route, method, and status
+//   - http_request_duration_seconds, a histogram by route and method
+//   - http_response_size_bytes, a histogram by route and method
+//   - http_requests_in_flight, a gauge by route and method
+func Instrument(mux *plumbus.ServeMux, registerer prometheus.Registerer) error {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests served.",
+	}, []string{"route", "method", "status"})
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "How long HTTP requests took to serve.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	size := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "Size of HTTP response bodies.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 7),
+	}, []string{"route", "method"})
+
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests being served.",
+	}, []string{"route", "method"})
+
+	for _, collector := range []prometheus.Collector{requests, duration, size, inFlight} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			gauge := inFlight.WithLabelValues(route(req), method(req))
+			gauge.Inc()
+			defer gauge.Dec()
+			next.ServeHTTP(res, req)
+		})
+	})
+
+	mux.AfterResponse(func(req *http.Request, info plumbus.ResponseInfo) {
+		routeLabel, methodLabel := route(req), method(req)
+		requests.WithLabelValues(routeLabel, methodLabel, strconv.Itoa(info.Status)).Inc()
+		duration.WithLabelValues(routeLabel, methodLabel).Observe(info.Duration.Seconds())
+		size.WithLabelValues(routeLabel, methodLabel).Observe(float64(info.BytesWritten))
+	})
+
+	return nil
+}
+
+// Mount serves the metrics gathered by gatherer, or
+// prometheus.DefaultGatherer if it's nil, at path on the mux, as in:
+//
+//	prometheus.Mount(mux, "/metrics", nil)
+func Mount(mux *plumbus.ServeMux, path string, gatherer prometheus.Gatherer) *plumbus.Route {
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+	return mux.Handle(path, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
+
+func route(req *http.Request) string {
+	if pattern := plumbus.RoutePattern(req); pattern != "" {
+		return pattern
+	}
+	return Unmatched
+}
+
+// method limits the method label to the standard methods, since clients
+// can send any method they like
+func method(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions,
+		http.MethodConnect, http.MethodTrace:
+		return req.Method
+	}
+	return "other"
+}
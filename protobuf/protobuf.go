@@ -0,0 +1,111 @@
+// Package protobuf lets plumbus handlers take and return protocol buffer
+// messages. After calling Register, a body parameter or return value that
+// is a proto.Message is decoded and encoded as application/x-protobuf,
+// and as json (with protojson) for requests that ask for json.
+package protobuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/jargv/plumbus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const MediaType = "application/x-protobuf"
+
+// Register adds the protobuf media type to plumbus's decoders and
+// encoders, and makes json bodies of proto messages use protojson
+func Register() {
+	plumbus.RegisterDecoder(MediaType, decode)
+	plumbus.RegisterEncoderFor(MediaType, isMessage, encode)
+	plumbus.RegisterDecoder("application/json", decodeJSON)
+	plumbus.RegisterEncoder("application/json", encodeJSON)
+}
+
+func decode(body io.Reader, dst interface{}) error {
+	msg, ok := message(dst)
+	if !ok {
+		return fmt.Errorf("can't decode protobuf into %T", dst)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return io.EOF
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func isMessage(v interface{}) bool {
+	_, ok := v.(proto.Message)
+	return ok
+}
+
+func encode(w io.Writer, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("can't encode %T as protobuf", v)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func decodeJSON(body io.Reader, dst interface{}) error {
+	msg, ok := message(dst)
+	if !ok {
+		return json.NewDecoder(body).Decode(dst)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return io.EOF
+	}
+	return protojson.Unmarshal(data, msg)
+}
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return json.NewEncoder(w).Encode(v)
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// message finds the proto.Message that dst points to. Since messages are
+// pointers, a body parameter like *pb.User is decoded through a **pb.User,
+// and the message is allocated if it's nil.
+func message(dst interface{}) (proto.Message, bool) {
+	if msg, ok := dst.(proto.Message); ok {
+		return msg, true
+	}
+
+	val := reflect.ValueOf(dst)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Ptr {
+		return nil, false
+	}
+
+	elem := val.Elem()
+	if _, ok := elem.Interface().(proto.Message); !ok {
+		return nil, false
+	}
+	if elem.IsNil() {
+		elem.Set(reflect.New(elem.Type().Elem()))
+	}
+	return elem.Interface().(proto.Message), true
+}
@@ -0,0 +1,134 @@
+package plumbus
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// radixNode is a node of a radix tree of the static nodes under a node of
+// Paths, by their path from it, as in "/users/search". Paths that share a
+// prefix share the nodes for it, so a path is matched with one comparison
+// per byte of it. Edges are split between runes, so that paths can be
+// compared regardless of case.
+type radixNode struct {
+	prefix   string
+	indices  string // the first byte of each child's prefix
+	children []*radixNode
+	route    *Paths
+}
+
+// insert adds the route to the tree under the key
+func (n *radixNode) insert(key string, route *Paths) {
+	for {
+		common := commonPrefix(n.prefix, key)
+		if common < len(n.prefix) {
+			child := &radixNode{
+				prefix:   n.prefix[common:],
+				indices:  n.indices,
+				children: n.children,
+				route:    n.route,
+			}
+			n.prefix = n.prefix[:common]
+			n.indices = child.prefix[:1]
+			n.children = []*radixNode{child}
+			n.route = nil
+		}
+		key = key[common:]
+
+		if key == "" {
+			n.route = route
+			return
+		}
+
+		next := n.child(key)
+		if next == nil {
+			n.indices += key[:1]
+			n.children = append(n.children, &radixNode{prefix: key, route: route})
+			return
+		}
+		n = next
+	}
+}
+
+// child returns the child whose prefix starts with the same rune as
+// path, if there is one
+func (n *radixNode) child(path string) *radixNode {
+	r, _ := utf8.DecodeRuneInString(path)
+	for i := 0; i < len(n.indices); i++ {
+		if n.indices[i] != path[0] {
+			continue
+		}
+		if first, _ := utf8.DecodeRuneInString(n.children[i].prefix); first == r {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+// lookup matches the path, which follows the node's prefix, trying
+// longer static matches before shorter ones, and exact matches before
+// those that only match regardless of case
+func (n *radixNode) lookup(path string, params url.Values, foldCase bool) *routeMatch {
+	var exact *radixNode
+	if path != "" {
+		if child := n.child(path); child != nil && strings.HasPrefix(path, child.prefix) {
+			exact = child
+			if match := child.lookup(path[len(child.prefix):], params, foldCase); match != nil {
+				return match
+			}
+		}
+	}
+
+	if foldCase {
+		for _, child := range n.children {
+			if child == exact {
+				continue
+			}
+			if rest, ok := trimPrefixFold(path, child.prefix); ok {
+				if match := child.lookup(rest, params, foldCase); match != nil {
+					return match
+				}
+			}
+		}
+	}
+
+	// the static segments up to here only match if they end the path or
+	// are followed by another segment
+	if n.route != nil && (path == "" || path[0] == '/') {
+		return n.route.matchHere(path, params, foldCase)
+	}
+	return nil
+}
+
+// commonPrefix is the length of the prefix a and b share, ending
+// between runes
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	for i > 0 && i < len(a) && !utf8.RuneStart(a[i]) {
+		i--
+	}
+	return i
+}
+
+// trimPrefixFold removes the prefix from path if path starts with it,
+// regardless of case
+func trimPrefixFold(path, prefix string) (string, bool) {
+	for prefix != "" {
+		if path == "" {
+			return "", false
+		}
+		want, wantSize := utf8.DecodeRuneInString(prefix)
+		got, gotSize := utf8.DecodeRuneInString(path)
+		if want != got && unicode.ToLower(want) != unicode.ToLower(got) {
+			return "", false
+		}
+		prefix = prefix[wantSize:]
+		path = path[gotSize:]
+	}
+	return path, true
+}
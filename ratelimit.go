@@ -0,0 +1,110 @@
+package plumbus
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit is middleware that lets each client make rate requests per
+// second on average, in bursts of up to burst requests, as in
+// mux.Use(plumbus.RateLimit(10, 20, plumbus.KeyByIP)). Clients are told
+// apart by key, and every request with the same key shares a limit. Over
+// the limit, the response is a 429 with a Retry-After header. It can be
+// used for the whole mux, or for a single route with HandleWith.
+func RateLimit(rate float64, burst int, key func(req *http.Request) string) Middleware {
+	limiter := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if wait, ok := limiter.allow(key(req), time.Now()); !ok {
+				HandleResponseError(res, req, ErrorRetryAfter(
+					http.StatusTooManyRequests,
+					wait,
+					"too many requests",
+				))
+				return
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// KeyByIP rate limits each client IP address separately, finding the
+// address the same way as ClientIP
+func KeyByIP(req *http.Request) string {
+	if addr := clientIP(req); addr.IsValid() {
+		return addr.String()
+	}
+	return req.RemoteAddr
+}
+
+// KeyByHeader rate limits each value of the header separately, such as
+// an API key. Requests without the header share a limit.
+func KeyByHeader(name string) func(req *http.Request) string {
+	return func(req *http.Request) string {
+		return req.Header.Get(name)
+	}
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the key's bucket, or says how long until
+// there will be one
+func (rl *rateLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rl.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		if rl.rate <= 0 {
+			return time.Hour, false
+		}
+		return time.Duration((1 - bucket.tokens) / rl.rate * float64(time.Second)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// sweep forgets the buckets that have filled back up, since they're the
+// same as new ones
+func (rl *rateLimiter) sweep(now time.Time) {
+	if rl.rate <= 0 {
+		return
+	}
+	fill := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	if now.Sub(rl.lastSweep) < fill {
+		return
+	}
+	rl.lastSweep = now
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.last) >= fill {
+			delete(rl.buckets, key)
+		}
+	}
+}
@@ -1,13 +1,10 @@
 package plumbus
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"reflect"
-	"strconv"
 
 	"github.com/jargv/plumbus/generate"
 )
@@ -19,40 +16,64 @@ func infoToDynamicAdaptor(info *generate.Info, handler reflect.Value) http.Handl
 			queryParams = req.URL.Query()
 		}
 
+		var errs ValidationErrors
 		args := make([]reflect.Value, len(info.Inputs))
 		for i, converter := range info.Inputs {
-			val := reflect.New(converter.Type)
-			switch t := converter.ConversionType; t {
-			case generate.ConvertBody:
-				if err := json.NewDecoder(req.Body).Decode(val.Interface()); err != nil {
-					msg := fmt.Sprintf(`{"error": "decoding json: %s"}`, err.Error())
-					http.Error(res, msg, http.StatusBadRequest)
-					return
-				}
-			case generate.ConvertCustom:
-				interfaceVal := val
-				if converter.IsPointer {
-					val.Elem().Set(reflect.New(converter.Type.Elem()))
-					interfaceVal = val.Elem()
-				}
-				err := interfaceVal.Interface().(FromRequest).FromRequest(req)
-				if err != nil {
-					HandleResponseError(res, req, err)
-					return
+			val, err := dynamicInput(converter, res, req, queryParams)
+			if errs, err = CollectErrors(errs, err); err != nil {
+				HandleResponseError(res, req, err)
+				return
+			}
+			if converter.HasValidateTags {
+				if err := ValidateStruct(val.Interface()); err != nil {
+					errs = append(errs, err.(ValidationErrors)...)
 				}
-			case generate.ConvertStringQueryParam, generate.ConvertIntQueryParam:
-				err := getQueryParam(converter, val, queryParams)
-				if err != nil {
+			}
+			args[i] = val.Elem()
+		}
+
+		if len(errs) > 0 {
+			HandleResponseError(res, req, errs)
+			return
+		}
+
+		for i, converter := range info.Inputs {
+			if converter.HasValidate {
+				if err := Validate(args[i].Addr().Interface()); err != nil {
 					HandleResponseError(res, req, err)
 					return
 				}
-			default:
-				log.Fatalf("unexpected Convert Type: %s", t)
 			}
-			args[i] = val.Elem()
 		}
+
+		intercepted := make([]Arg, len(args))
+		for i, arg := range args {
+			intercepted[i] = reflectedArg{value: arg}
+		}
+		if err := RunInterceptors(req, intercepted...); err != nil {
+			HandleResponseError(res, req, err)
+			return
+		}
+
+		if info.WebSocketIndex != -1 {
+			conn, err := UpgradeWebSocket(res, req)
+			if err != nil {
+				return
+			}
+			args[info.WebSocketIndex] = reflect.ValueOf(conn)
+		}
+
 		results := handler.Call(args)
 
+		if info.WebSocketIndex != -1 {
+			var err error
+			if info.LastIsError {
+				err, _ = results[len(results)-1].Interface().(error)
+			}
+			CloseWebSocket(args[info.WebSocketIndex].Interface().(*WSConn), err)
+			return
+		}
+
 		if info.LastIsError {
 			last := results[len(results)-1]
 			if !last.IsNil() {
@@ -62,10 +83,24 @@ func infoToDynamicAdaptor(info *generate.Info, handler reflect.Value) http.Handl
 			}
 		}
 
+		if info.StatusIndex != -1 {
+			if code := int(results[info.StatusIndex].Int()); code != 0 {
+				sw, err := NewStatusWriter(res, code)
+				if err != nil {
+					HandleResponseError(res, req, err)
+					return
+				}
+				defer sw.Finish()
+				res = sw
+			}
+		}
+
 		for i, converter := range info.Outputs {
 			switch t := converter.ConversionType; t {
 			case generate.ConvertError:
 				//this would have been handled above if there were an error
+			case generate.ConvertStatus:
+				//the status is written along with the body
 			case generate.ConvertBody:
 				//do nothing, the response body has to be sent last
 			case generate.ConvertCustom:
@@ -80,54 +115,97 @@ func infoToDynamicAdaptor(info *generate.Info, handler reflect.Value) http.Handl
 		}
 
 		if info.ResponseBodyIndex != -1 {
-			enc := json.NewEncoder(res)
-			err := enc.Encode(results[info.ResponseBodyIndex].Interface())
+			err := EncodeResponse(res, req, results[info.ResponseBodyIndex].Interface())
 			if err != nil {
 				HandleResponseError(res, req, err)
 				return
 			}
 		}
+
+		if info.NoContent {
+			WriteEmptyResponse(res, req)
+		}
 	})
 }
 
-func getQueryParam(converter *generate.Converter, val reflect.Value, queryParams url.Values) error {
-	t := converter.ConversionType
-	_, sent := queryParams[converter.Name]
-
-	if !sent && !converter.IsPointer {
-		return Errorf(
-			http.StatusBadRequest,
-			"missing required query parameter '%s'",
-			converter.Name,
-		)
-	}
-
-	if !sent && converter.IsPointer {
-		return nil
-	}
-
-	paramString := queryParams.Get(converter.Name)
-
-	setVal := val
-	if converter.IsPointer {
-		val.Elem().Set(reflect.New(converter.Type.Elem()))
-		setVal = val.Elem()
-	}
-
-	if t == generate.ConvertStringQueryParam {
-		setVal.Elem().SetString(paramString)
-		return nil
+// dynamicInput decodes an argument of the handler into a new value of its
+// type, returning a pointer to it. A ValidationErrors may be returned
+// along with the value.
+func dynamicInput(converter *generate.Converter, res http.ResponseWriter, req *http.Request, queryParams url.Values) (reflect.Value, error) {
+	val := reflect.New(converter.Type)
+	switch t := converter.ConversionType; t {
+	case generate.ConvertBody:
+		return val, DecodeBody(req, val.Interface())
+	case generate.ConvertCustom:
+		interfaceVal := val
+		if converter.IsPointer {
+			val.Elem().Set(reflect.New(converter.Type.Elem()))
+			interfaceVal = val.Elem()
+		}
+		return val, interfaceVal.Interface().(FromRequest).FromRequest(req)
+	case generate.ConvertContext:
+		val.Elem().Set(reflect.ValueOf(req.Context()))
+	case generate.ConvertRequest:
+		val.Elem().Set(reflect.ValueOf(req))
+	case generate.ConvertResponseWriter:
+		val.Elem().Set(reflect.ValueOf(res))
+	case generate.ConvertRawBody:
+		body, err := ReadBody(req)
+		if err != nil {
+			return val, err
+		}
+		val.Elem().SetBytes(body)
+	case generate.ConvertBodyReader:
+		val.Elem().Set(reflect.ValueOf(req.Body))
+	case generate.ConvertPlugin:
+		arg, err := converter.Plugin.Extract(req, converter.Type)
+		if err != nil {
+			return val, err
+		}
+		if arg != nil {
+			val.Elem().Set(reflect.ValueOf(arg))
+		}
+	case generate.ConvertWebSocket:
+		//the request is upgraded once everything else checks out
+	case generate.ConvertFile:
+		file, err := FormFile(req, converter.Name, !converter.IsPointer)
+		if file != nil && converter.IsPointer {
+			val.Elem().Set(reflect.ValueOf(file).Convert(converter.Type))
+		} else if file != nil {
+			val.Elem().Set(reflect.ValueOf(*file).Convert(converter.Type))
+		}
+		return val, err
+	case generate.ConvertStruct:
+		target := val
+		if converter.IsPointer {
+			val.Elem().Set(reflect.New(converter.Type.Elem()))
+			target = val.Elem()
+		}
+		return val, BindStruct(req, target.Interface())
+	case generate.ConvertStringParam, generate.ConvertIntParam, generate.ConvertUintParam,
+		generate.ConvertFloatParam, generate.ConvertBoolParam, generate.ConvertTimeParam,
+		generate.ConvertRegisteredParam:
+		return val, getParam(converter, val, req, queryParams)
+	default:
+		log.Fatalf("unexpected Convert Type: %s", t)
 	}
+	return val, nil
+}
 
-	paramInt, err := strconv.Atoi(paramString)
-	if err != nil {
-		return Errorf(
-			http.StatusBadRequest,
-			"query param '%s' expected to be integer value",
-			converter.Name,
-		)
+func getParam(converter *generate.Converter, val reflect.Value, req *http.Request, queryParams url.Values) error {
+	var values []string
+	switch converter.Source {
+	case generate.SourceQuery:
+		values = queryParams[converter.Name]
+	case generate.SourceHeader:
+		values = req.Header[converter.Name]
+	case generate.SourcePath:
+		values = PathParams(req)[converter.Name]
+	case generate.SourceCookie:
+		if cookie, err := req.Cookie(converter.Name); err == nil {
+			values = []string{cookie.Value}
+		}
 	}
-	setVal.Elem().SetInt(int64(paramInt))
 
-	return nil
+	return bindParam(val.Elem(), converter.Source.String(), converter.Name, values)
 }
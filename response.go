@@ -0,0 +1,481 @@
+package plumbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EncoderFunc encodes a response body
+type EncoderFunc func(w io.Writer, v interface{}) error
+
+// encoder is a registered EncoderFunc, along with the values it can
+// encode, if it can't encode them all
+type encoder struct {
+	encode  EncoderFunc
+	accepts func(v interface{}) bool
+}
+
+var encoders = struct {
+	sync.RWMutex
+	byMediaType map[string]encoder
+}{
+	byMediaType: map[string]encoder{
+		"application/json": {encode: func(w io.Writer, v interface{}) error {
+			return json.NewEncoder(w).Encode(v)
+		}},
+	},
+}
+
+// RegisterEncoder adds a media type that responses can be encoded as,
+// chosen by the request's Accept header, as in:
+//
+//	plumbus.RegisterEncoder("application/xml", func(w io.Writer, v interface{}) error {
+//		return xml.NewEncoder(w).Encode(v)
+//	})
+//
+// Json is used when the request accepts anything. Encoders can be
+// registered at any time, even while requests are being served.
+func RegisterEncoder(mediaType string, encode EncoderFunc) {
+	encoders.Lock()
+	defer encoders.Unlock()
+	encoders.byMediaType[mediaType] = encoder{encode: encode}
+}
+
+// RegisterEncoderFor is RegisterEncoder for an encoder that can only
+// encode the values accepts is true for. It isn't chosen for any other
+// value, which gets another of the accepted media types, or a 406.
+func RegisterEncoderFor(mediaType string, accepts func(v interface{}) bool, encode EncoderFunc) {
+	encoders.Lock()
+	defer encoders.Unlock()
+	encoders.byMediaType[mediaType] = encoder{encode: encode, accepts: accepts}
+}
+
+func (e encoder) canEncode(v interface{}) bool {
+	return e.encode != nil && (e.accepts == nil || e.accepts(v))
+}
+
+// Text is a plain text response, written as is
+type Text string
+
+func (t Text) ToResponse(res http.ResponseWriter) error {
+	if res.Header().Get("Content-Type") == "" {
+		res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	_, err := io.WriteString(res, string(t))
+	return err
+}
+
+// Headers are response headers for a handler to return, as in:
+//
+//	func getReport() (plumbus.Headers, *Report, error) {
+//		return plumbus.Headers{"Cache-Control": {"max-age=60"}}, report, nil
+//	}
+//
+// Each one replaces any header of the same name set before it.
+type Headers http.Header
+
+func (h Headers) ToResponse(res http.ResponseWriter) error {
+	for name, values := range h {
+		res.Header()[http.CanonicalHeaderKey(name)] = values
+	}
+	return nil
+}
+
+// Redirect redirects the request to URL, with a Code such as
+// http.StatusSeeOther, http.StatusTemporaryRedirect, or
+// http.StatusPermanentRedirect. The Code defaults to http.StatusFound.
+type Redirect struct {
+	URL  string
+	Code int
+}
+
+func (r Redirect) ToResponse(res http.ResponseWriter) error {
+	code := r.Code
+	if code == 0 {
+		code = http.StatusFound
+	}
+	if code < 300 || code > 399 {
+		return fmt.Errorf("redirect to %s with non-redirect status %d", r.URL, code)
+	}
+	if r.URL == "" {
+		return fmt.Errorf("redirect with status %d is missing a URL", code)
+	}
+
+	res.Header().Set("Location", r.URL)
+	res.WriteHeader(code)
+	return nil
+}
+
+// StatusCoder can be implemented by a handler's result to respond with a
+// status other than 200, such as http.StatusCreated
+type StatusCoder interface {
+	ResponseCode() int
+}
+
+// ResponseDocumenter can be implemented by a handler's result to document
+// the responses the handler can give besides the usual one, by status
+// code, as in:
+//
+//	func (*User) Responses() map[int]interface{} {
+//		return map[int]interface{}{
+//			http.StatusNotFound: plumbus.Error(http.StatusNotFound, "no such user"),
+//		}
+//	}
+//
+// Each value is an example of the response body, and its type gives the
+// body's schema. An error is documented as the error body WriteError
+// writes, and nil as a response without a body (or the error body, for an
+// error status).
+type ResponseDocumenter interface {
+	Responses() map[int]interface{}
+}
+
+// Responses documents responses the route can give, like the results of
+// a ResponseDocumenter do. For a route registered with a method helper
+// like POST, they only apply to that method.
+func (r *Route) Responses(responses map[int]interface{}) *Route {
+	if r.node.responses == nil {
+		r.node.responses = map[string]map[int]interface{}{}
+	}
+	if r.node.responses[r.method] == nil {
+		r.node.responses[r.method] = map[int]interface{}{}
+	}
+	for code, response := range responses {
+		r.node.responses[r.method][code] = response
+	}
+	return r
+}
+
+// declaredResponses gathers the responses documented for the method of a
+// route, from its results and then the route itself
+func declaredResponses(node *Paths, method string, results []reflect.Type) map[int]interface{} {
+	declared := map[int]interface{}{}
+	for _, typ := range results {
+		if documenter, ok := reflect.Zero(typ).Interface().(ResponseDocumenter); ok {
+			for code, response := range documenter.Responses() {
+				declared[code] = response
+			}
+		}
+	}
+	for _, key := range []string{"", method} {
+		for code, response := range node.responses[key] {
+			declared[code] = response
+		}
+	}
+	return declared
+}
+
+// WriteEmptyResponse responds without a body, as 204 No Content unless
+// the mux sets a different code with SetEmptyResponseCode
+func WriteEmptyResponse(res http.ResponseWriter, req *http.Request) {
+	code := http.StatusNoContent
+	if sm := muxFromRequest(req); sm != nil && sm.emptyCode != 0 {
+		code = sm.emptyCode
+	}
+	res.WriteHeader(code)
+}
+
+// CreatedResponse is the result of a handler that created a resource,
+// made by Created
+type CreatedResponse struct {
+	Location string
+	Body     interface{}
+}
+
+// Created responds with 201 Created, a Location header, and body encoded
+// as the response body (if it isn't nil), as in:
+//
+//	func createUser(user *User) (*plumbus.CreatedResponse, error) {
+//		// ...
+//		return plumbus.Created("/users/"+user.Id, user), nil
+//	}
+func Created(location string, body interface{}) *CreatedResponse {
+	return &CreatedResponse{Location: location, Body: body}
+}
+
+func (c *CreatedResponse) ResponseCode() int {
+	return http.StatusCreated
+}
+
+// EncodeResponse writes v as the response body, encoded as the media type
+// the request's Accept header prefers among the registered encoders. If
+// the request doesn't accept any of them, it's a 406. A plain string is
+// written as Text instead, a FileResponse is served as a download, a Render
+// is rendered as html, an io.Reader is streamed as is, an EventStream is
+// sent as server-sent events, and the values received from any other
+// channel are streamed as NDJSON. If the mux has an envelope set by
+// SetEnvelope, v is wrapped in it first. If v is a StatusCoder, its code
+// is the status.
+func EncodeResponse(res http.ResponseWriter, req *http.Request, v interface{}) error {
+	return encodeStatusResponse(res, req, v, true)
+}
+
+// EncodeValue is EncodeResponse for a value that can't be a channel, such
+// as a struct or a slice, so it's encoded without reflecting on it first.
+// Generated adaptors use it for results of any type but a channel or an
+// interface.
+func EncodeValue(res http.ResponseWriter, req *http.Request, v interface{}) error {
+	return encodeStatusResponse(res, req, v, false)
+}
+
+func encodeStatusResponse(res http.ResponseWriter, req *http.Request, v interface{}, mayBeChannel bool) error {
+	coder, ok := v.(StatusCoder)
+	if !ok || coder.ResponseCode() == http.StatusOK {
+		return encodeResponse(res, req, v, mayBeChannel)
+	}
+
+	sw, err := NewStatusWriter(res, coder.ResponseCode())
+	if err != nil {
+		return err
+	}
+	if err := encodeResponse(sw, req, v, mayBeChannel); err != nil {
+		return err
+	}
+	sw.Finish()
+	return nil
+}
+
+func encodeResponse(res http.ResponseWriter, req *http.Request, v interface{}, mayBeChannel bool) error {
+	if tagger, ok := v.(ETagger); ok {
+		if notModified(res, req, quoteETag(tagger.ETag())) {
+			return nil
+		}
+	}
+	if modifier, ok := v.(LastModifier); ok {
+		if notModifiedSince(res, req, modifier.LastModified()) {
+			return nil
+		}
+	}
+
+	if created, ok := v.(*CreatedResponse); ok {
+		res.Header().Set("Location", created.Location)
+		if created.Body == nil {
+			return nil
+		}
+		v, mayBeChannel = created.Body, true
+	}
+
+	switch result := v.(type) {
+	case FileResponse:
+		return result.serve(res, req)
+	case *FileResponse:
+		return result.serve(res, req)
+	case Render:
+		return result.render(res, req)
+	case *Render:
+		return result.render(res, req)
+	}
+
+	if r, ok := v.(io.Reader); ok {
+		return streamResponse(res, r)
+	}
+
+	switch events := v.(type) {
+	case EventStream:
+		return streamEvents(res, req, events)
+	case <-chan Event:
+		return streamEvents(res, req, events)
+	}
+
+	if mayBeChannel {
+		if ch := reflect.ValueOf(v); ch.Kind() == reflect.Chan && ch.Type().ChanDir()&reflect.RecvDir != 0 {
+			return streamChannel(res, req, ch)
+		}
+	}
+
+	hasEnvelope := func(mux *ServeMux) bool { return mux.envelope != nil }
+	if sm := routeMux(req, hasEnvelope); sm != nil && sm.envelope != nil {
+		v = sm.envelope(req, v)
+	}
+
+	if s, ok := v.(string); ok {
+		return Text(s).ToResponse(res)
+	}
+
+	mediaType, encoder := negotiate(req.Header.Get("Accept"), v)
+	if encoder == nil {
+		return Errorf(
+			http.StatusNotAcceptable,
+			"can't respond with any of the accepted media types: %s",
+			req.Header.Get("Accept"),
+		)
+	}
+
+	if res.Header().Get("Content-Type") == "" {
+		res.Header().Set("Content-Type", mediaType)
+	}
+	if mediaType == "application/json" {
+		if jsonEncoder, ok := muxJSON(req); ok {
+			encoder = jsonEncoder
+		}
+	}
+
+	sm := muxFromRequest(req)
+	if sm == nil || !sm.etags || req.Method != http.MethodGet || res.Header().Get("ETag") != "" {
+		return encoder(res, v)
+	}
+
+	var body bytes.Buffer
+	if err := encoder(&body, v); err != nil {
+		return err
+	}
+	if notModified(res, req, bodyETag(body.Bytes())) {
+		return nil
+	}
+	_, err := body.WriteTo(res)
+	return err
+}
+
+// FileResponse is a file download, served with http.ServeContent so that
+// it handles Range, If-Modified-Since, and If-None-Match requests. Name is
+// the file name given to the client in the Content-Disposition header, and
+// its extension sets the Content-Type. Unless ModTime is zero, the ETag
+// is made from it and the file's size.
+type FileResponse struct {
+	Name    string
+	ModTime time.Time
+	Content io.ReadSeeker
+}
+
+func (f *FileResponse) serve(res http.ResponseWriter, req *http.Request) error {
+	if closer, ok := f.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if f.Name != "" && res.Header().Get("Content-Disposition") == "" {
+		disposition := mime.FormatMediaType("attachment", map[string]string{
+			"filename": f.Name,
+		})
+		res.Header().Set("Content-Disposition", disposition)
+	}
+
+	if !f.ModTime.IsZero() && res.Header().Get("ETag") == "" {
+		size, err := f.Content.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Content.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		res.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, f.ModTime.UnixNano(), size))
+	}
+
+	http.ServeContent(res, req, f.Name, f.ModTime, f.Content)
+	return nil
+}
+
+// ContentTyper can be implemented by an io.Reader that a handler returns
+// to give the Content-Type of the response, which is otherwise
+// application/octet-stream
+type ContentTyper interface {
+	ContentType() string
+}
+
+// streamResponse copies r to the response without buffering all of it,
+// closing it afterwards if it's an io.Closer
+func streamResponse(res http.ResponseWriter, r io.Reader) error {
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if res.Header().Get("Content-Type") == "" {
+		contentType := "application/octet-stream"
+		if typer, ok := r.(ContentTyper); ok {
+			contentType = typer.ContentType()
+		}
+		res.Header().Set("Content-Type", contentType)
+	}
+
+	_, err := io.Copy(res, r)
+	return err
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate picks the encoder for the most preferred media type in an
+// Accept header that has one
+func negotiate(accept string, v interface{}) (string, EncoderFunc) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(qs, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mt, q: q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	encoders.RLock()
+	defer encoders.RUnlock()
+	for _, r := range ranges {
+		if mt, encoder := encoderFor(r.mediaType, v); encoder != nil {
+			return mt, encoder
+		}
+	}
+	return "", nil
+}
+
+// encoderFor finds an encoder that can encode v for a media range like
+// application/xml, text/*, or */*, preferring json for wildcards. The
+// encoders are read locked by the caller.
+func encoderFor(mediaRange string, v interface{}) (string, EncoderFunc) {
+	if encoder, ok := encoders.byMediaType[mediaRange]; ok {
+		if encoder.canEncode(v) {
+			return mediaRange, encoder.encode
+		}
+		return "", nil
+	}
+
+	prefix := strings.TrimSuffix(mediaRange, "*")
+	if prefix == mediaRange {
+		return "", nil
+	}
+	if mediaRange == "*/*" {
+		prefix = ""
+	}
+
+	jsonEncoder := encoders.byMediaType["application/json"]
+	if strings.HasPrefix("application/json", prefix) && jsonEncoder.canEncode(v) {
+		return "application/json", jsonEncoder.encode
+	}
+
+	var matches []string
+	for mt, encoder := range encoders.byMediaType {
+		if strings.HasPrefix(mt, prefix) && encoder.canEncode(v) {
+			matches = append(matches, mt)
+		}
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+	sort.Strings(matches)
+	return matches[0], encoders.byMediaType[matches[0]].encode
+}
@@ -0,0 +1,212 @@
+package plumbus
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Route is a route registered with a ServeMux. It is returned when
+// registering so the route can be configured further.
+type Route struct {
+	mux    *ServeMux
+	node   *Paths
+	method string
+}
+
+func (sm *ServeMux) routeFor(path string) *Route {
+	return &Route{
+		mux:  sm,
+		node: sm.Paths.insertSegments(getSegments(path)),
+	}
+}
+
+// Name names the route so that URLs for it can be built with
+// ServeMux.URL. Names must be unique within a mux.
+func (r *Route) Name(name string) *Route {
+	if r.mux.names == nil {
+		r.mux.names = map[string]*Paths{}
+	}
+	if _, exists := r.mux.names[name]; exists {
+		panic(fmt.Errorf("duplicate route name %s", name))
+	}
+	r.mux.names[name] = r.node
+	return r
+}
+
+// Summary gives the route a short summary in its documentation, which is
+// otherwise described by the documentation given when registering it.
+// For a route registered with a method helper like GET, it only applies
+// to that method.
+func (r *Route) Summary(summary string) *Route {
+	r.metadata().summary = summary
+	return r
+}
+
+// Tags groups the route under the tags in its documentation, such as
+// "users". For a route registered with a method helper like GET, they
+// only apply to that method.
+func (r *Route) Tags(tags ...string) *Route {
+	meta := r.metadata()
+	meta.tags = appendUnique(meta.tags, tags...)
+	return r
+}
+
+// Deprecated marks the route as deprecated in its documentation, so
+// clients know to stop using it. For a route registered with a method
+// helper like GET, it only applies to that method.
+func (r *Route) Deprecated() *Route {
+	r.metadata().deprecated = true
+	return r
+}
+
+// routeMetadata is what's declared about a route for its documentation
+type routeMetadata struct {
+	summary    string
+	tags       []string
+	deprecated bool
+}
+
+func (r *Route) metadata() *routeMetadata {
+	if r.node.metadata == nil {
+		r.node.metadata = map[string]*routeMetadata{}
+	}
+	meta, ok := r.node.metadata[r.method]
+	if !ok {
+		meta = &routeMetadata{}
+		r.node.metadata[r.method] = meta
+	}
+	return meta
+}
+
+// metadataFor merges what's declared for a whole route with what's
+// declared for one of its methods
+func (p *Paths) metadataFor(method string) routeMetadata {
+	keys := []string{""}
+	if method != "" {
+		keys = append(keys, method)
+	}
+
+	var merged routeMetadata
+	for _, key := range keys {
+		meta, ok := p.metadata[key]
+		if !ok {
+			continue
+		}
+		if meta.summary != "" {
+			merged.summary = meta.summary
+		}
+		merged.tags = appendUnique(merged.tags, meta.tags...)
+		merged.deprecated = merged.deprecated || meta.deprecated
+	}
+	return merged
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			found = found || existing == value
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// URL builds the path to the named route, searching mounted muxes and
+// the muxes of each Host as well. The params are pairs of parameter
+// names and values, such as URL("user.detail", "userId", 42). Params
+// that aren't part of the path are added to the query string. The path
+// of a Host's route doesn't include the host.
+func (sm *ServeMux) URL(name string, params ...interface{}) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("odd number of params building url for %s", name)
+	}
+
+	pattern, found := sm.namedPattern(name)
+	if !found {
+		pattern, found = sm.hostNamedPattern(name)
+	}
+	if !found {
+		return "", fmt.Errorf("no route named %s", name)
+	}
+
+	values := map[string]string{}
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("param name %v building url for %s is not a string", params[i], name)
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+
+	segments := getSegments(pattern)
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			varName, constraint := parseVariable(segment[1:])
+			value, ok := values[varName]
+			if !ok {
+				return "", fmt.Errorf("missing param %s building url for %s", varName, name)
+			}
+			if constraint != nil && !constraint.MatchString(value) {
+				return "", fmt.Errorf("param %s=%q doesn't match the route %s", varName, value, pattern)
+			}
+			segments[i] = url.PathEscape(value)
+			delete(values, varName)
+		case strings.HasPrefix(segment, "*"):
+			value, ok := values[segment[1:]]
+			if !ok {
+				return "", fmt.Errorf("missing param %s building url for %s", segment[1:], name)
+			}
+			segments[i] = value
+			delete(values, segment[1:])
+		}
+	}
+
+	path := "/" + strings.Join(segments, "/")
+	if len(values) == 0 {
+		return path, nil
+	}
+
+	query := url.Values{}
+	for key, value := range values {
+		query.Set(key, value)
+	}
+	return path + "?" + query.Encode(), nil
+}
+
+// namedPattern finds the full pattern of the named route
+func (sm *ServeMux) namedPattern(name string) (string, bool) {
+	if node, found := sm.names[name]; found {
+		return node.pattern, true
+	}
+
+	for _, mount := range sm.mounts {
+		if pattern, found := mount.mounted.namedPattern(name); found {
+			return mount.pattern + pattern, true
+		}
+	}
+
+	return "", false
+}
+
+// hostNamedPattern finds the full pattern of the named route among the
+// routes of each Host, in order of the host names
+func (sm *ServeMux) hostNamedPattern(name string) (string, bool) {
+	hosts := make([]string, 0, len(sm.hosts))
+	for host := range sm.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		if pattern, found := sm.hosts[host].namedPattern(name); found {
+			return pattern, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,133 @@
+package plumbus
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// RouteInfo describes a handler registered with a ServeMux
+type RouteInfo struct {
+	// Host is the host the route is limited to, or "" for any host
+	Host string
+
+	// Pattern is the path as registered, such as "/user/:userId"
+	Pattern string
+
+	// Method is the HTTP method handled, or "" for any method
+	Method string
+
+	// Params are the types of the handler function's parameters
+	Params []reflect.Type
+
+	// Results are the types of the handler function's results
+	Results []reflect.Type
+
+	// Handler is the name of the handler function, or the type of
+	// the handler if it isn't a function
+	Handler string
+
+	// Documentation is the documentation given when registering
+	Documentation []string
+
+	// Summary is the summary given with Route.Summary
+	Summary string
+
+	// Tags are the tags given with Route.Tags
+	Tags []string
+
+	// Deprecated is whether the route was marked with Route.Deprecated
+	Deprecated bool
+}
+
+// Routes lists the registered routes, including those of mounted muxes
+// and hosts, sorted by host, pattern, and then method. A ByMethod
+// handler is listed once per method.
+func (sm *ServeMux) Routes() []RouteInfo {
+	routes := []RouteInfo{}
+	for pattern, node := range sm.Paths.flatten() {
+		routes = append(routes, routeInfos(pattern, node)...)
+	}
+
+	for host, hostMux := range sm.hosts {
+		for _, route := range hostMux.Routes() {
+			route.Host = host
+			routes = append(routes, route)
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern == routes[j].Pattern {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+
+	return routes
+}
+
+func routeInfos(pattern string, node *Paths) []RouteInfo {
+	var methods *ByMethod
+	switch val := node.originalHandler.(type) {
+	case ByMethod:
+		methods = &val
+	case *ByMethod:
+		methods = val
+	default:
+		return []RouteInfo{routeInfo(pattern, "", val, node)}
+	}
+
+	routes := []RouteInfo{}
+	add := func(method string, handler interface{}) {
+		if handler != nil {
+			routes = append(routes, routeInfo(pattern, method, typedFunc(handler), node))
+		}
+	}
+
+	add("GET", methods.GET)
+	add("POST", methods.POST)
+	add("PUT", methods.PUT)
+	add("PATCH", methods.PATCH)
+	add("DELETE", methods.DELETE)
+	add("OPTIONS", methods.OPTIONS)
+
+	return routes
+}
+
+func routeInfo(pattern, method string, handler interface{}, node *Paths) RouteInfo {
+	meta := node.metadataFor(method)
+	info := RouteInfo{
+		Pattern:       pattern,
+		Method:        method,
+		Handler:       handlerName(handler),
+		Documentation: node.documentation,
+		Summary:       meta.summary,
+		Tags:          meta.tags,
+		Deprecated:    meta.deprecated,
+	}
+
+	typ := reflect.TypeOf(handler)
+	if typ.Kind() == reflect.Func {
+		for i := 0; i < typ.NumIn(); i++ {
+			info.Params = append(info.Params, typ.In(i))
+		}
+		for i := 0; i < typ.NumOut(); i++ {
+			info.Results = append(info.Results, typ.Out(i))
+		}
+	}
+
+	return info
+}
+
+// handlerName names a handler function, or its type for other handlers
+func handlerName(handler interface{}) string {
+	val := reflect.ValueOf(handler)
+	if val.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", handler)
+	}
+	return runtime.FuncForPC(val.Pointer()).Name()
+}
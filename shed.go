@@ -0,0 +1,30 @@
+package plumbus
+
+import (
+	"net/http"
+	"time"
+)
+
+// MaxConcurrent is middleware that sheds load by handling at most n
+// requests at once, as in mux.Use(plumbus.MaxConcurrent(100, time.Second)).
+// Requests beyond that get a 503 telling the client to retry after
+// retryAfter. It can be used for the whole mux, or for a single route with
+// HandleWith.
+func MaxConcurrent(n int, retryAfter time.Duration) Middleware {
+	slots := make(chan struct{}, n)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				next.ServeHTTP(res, req)
+			default:
+				HandleResponseError(res, req, ErrorRetryAfter(
+					http.StatusServiceUnavailable,
+					retryAfter,
+					"too many requests in progress",
+				))
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package plumbus
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// Static serves the files in fsys (which may be an embed.FS) under the
+// prefix, so "/assets/css/site.css" serves "css/site.css" for the
+// prefix "/assets". Content types, byte ranges, and conditional
+// requests are handled as by http.FileServer, and requests go through
+// the mux's middleware like any other route.
+func (sm *ServeMux) Static(prefix string, fsys fs.FS, documentation ...string) *Route {
+	files := http.FileServer(http.FS(fsys))
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		r := req.Clone(req.Context())
+		r.URL.Path = "/" + PathParam(req, "filepath")
+		r.URL.RawPath = ""
+		files.ServeHTTP(res, r)
+	})
+
+	return sm.Handle(strings.TrimSuffix(prefix, "/")+"/*filepath", handler, documentation...)
+}
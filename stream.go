@@ -0,0 +1,158 @@
+package plumbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// streamChannel writes each value received from ch as a line of json
+// (NDJSON), flushing after each one, until ch is closed or the client goes
+// away. A handler returning a channel should stop sending on it once the
+// request's context is done.
+func streamChannel(res http.ResponseWriter, req *http.Request, ch reflect.Value) error {
+	if res.Header().Get("Content-Type") == "" {
+		res.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	if ch.IsNil() {
+		return nil
+	}
+	flusher, _ := res.(http.Flusher)
+	encoder := json.NewEncoder(res)
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(req.Context().Done())},
+	}
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		if chosen == 1 || !ok {
+			return nil
+		}
+
+		if err := encoder.Encode(value.Interface()); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// Event is a server-sent event. Data is written as is if it's a string,
+// or else as json, with a data line for each of its lines. ID and Type
+// are left out when empty, and any line breaks in them are dropped.
+type Event struct {
+	ID   string
+	Type string
+	Data interface{}
+}
+
+// EventStream is the result of a handler that sends server-sent events,
+// as in:
+//
+//	func updates(ctx context.Context) plumbus.EventStream {
+//		events := make(chan plumbus.Event)
+//		go func() {
+//			defer close(events)
+//			// send until ctx is done ...
+//		}()
+//		return events
+//	}
+//
+// A handler may return a <-chan Event too.
+type EventStream <-chan Event
+
+const defaultEventHeartbeat = 15 * time.Second
+
+// streamEvents writes the events received from ch as a text/event-stream,
+// with a comment line as a heartbeat whenever it's quiet, until ch is
+// closed or the client goes away
+func streamEvents(res http.ResponseWriter, req *http.Request, ch <-chan Event) error {
+	if ch == nil {
+		return nil
+	}
+
+	heartbeat := defaultEventHeartbeat
+	if sm := muxFromRequest(req); sm != nil && sm.eventHeartbeat != 0 {
+		heartbeat = sm.eventHeartbeat
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := res.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	// send the headers right away so the client knows it's connected
+	res.WriteHeader(http.StatusOK)
+	flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-ticker.C:
+			if _, err := io.WriteString(res, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(res, event); err != nil {
+				return err
+			}
+			ticker.Reset(heartbeat)
+		}
+		flush()
+	}
+}
+
+func writeEvent(w io.Writer, event Event) error {
+	var b strings.Builder
+	if id := stripLineBreaks(event.ID); id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if typ := stripLineBreaks(event.Type); typ != "" {
+		fmt.Fprintf(&b, "event: %s\n", typ)
+	}
+
+	data, ok := event.Data.(string)
+	if !ok {
+		encoded, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		data = string(encoded)
+	}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// stripLineBreaks drops the line breaks from a field's value, since they
+// would end the field and let the rest be read as fields or events of
+// their own
+func stripLineBreaks(value string) string {
+	if !strings.ContainsAny(value, "\r\n") {
+		return value
+	}
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
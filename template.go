@@ -0,0 +1,133 @@
+package plumbus
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"sync"
+)
+
+// Render is the result of a handler that renders the html page template
+// Name (the base name of its file) with Data, using the templates set on
+// the mux with SetTemplates, as in:
+//
+//	func adminUsers() (plumbus.Render, error) {
+//		return plumbus.Render{"users.html", users}, nil
+//	}
+type Render struct {
+	Name string
+	Data interface{}
+}
+
+// Templates are the html templates that handlers render by returning a
+// Render. Each page in FS matching the Pages pattern is parsed along with
+// the templates matching the Layouts pattern, if any, and rendered by
+// executing the template named Layout, or the page itself if that's
+// empty. With Reload set, the templates are parsed again for every render,
+// so that changes show up without restarting during development.
+type Templates struct {
+	FS      fs.FS
+	Pages   string
+	Layouts string
+	Layout  string
+	Funcs   template.FuncMap
+	Reload  bool
+
+	mu    sync.Mutex
+	pages map[string]*template.Template
+}
+
+// SetTemplates sets the html templates rendered for handlers that return a
+// Render, parsing them right away so that any errors show up at startup
+func (sm *ServeMux) SetTemplates(templates *Templates) error {
+	pages, err := templates.parse()
+	if err != nil {
+		return err
+	}
+
+	templates.mu.Lock()
+	templates.pages = pages
+	templates.mu.Unlock()
+
+	sm.templates = templates
+	return nil
+}
+
+func (t *Templates) parse() (map[string]*template.Template, error) {
+	files, err := fs.Glob(t.FS, t.Pages)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates match %q", t.Pages)
+	}
+
+	pages := map[string]*template.Template{}
+	for _, file := range files {
+		name := path.Base(file)
+		patterns := []string{file}
+		if t.Layouts != "" {
+			patterns = []string{t.Layouts, file}
+		}
+
+		tmpl, err := template.New(name).Funcs(t.Funcs).ParseFS(t.FS, patterns...)
+		if err != nil {
+			return nil, err
+		}
+		pages[name] = tmpl
+	}
+
+	return pages, nil
+}
+
+func (t *Templates) lookup(name string) (*template.Template, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Reload {
+		pages, err := t.parse()
+		if err != nil {
+			return nil, err
+		}
+		t.pages = pages
+	}
+
+	tmpl, ok := t.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("no template named %q", name)
+	}
+	return tmpl, nil
+}
+
+// render executes the page into a buffer first, so that a failure partway
+// through is still a clean 500
+func (r *Render) render(res http.ResponseWriter, req *http.Request) error {
+	sm := muxFromRequest(req)
+	if sm == nil || sm.templates == nil {
+		return fmt.Errorf("rendering %q without any templates set with SetTemplates", r.Name)
+	}
+
+	tmpl, err := sm.templates.lookup(r.Name)
+	if err != nil {
+		return err
+	}
+
+	name := r.Name
+	if sm.templates.Layout != "" {
+		name = sm.templates.Layout
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, r.Data); err != nil {
+		return err
+	}
+
+	if res.Header().Get("Content-Type") == "" {
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	_, err = buf.WriteTo(res)
+	return err
+}
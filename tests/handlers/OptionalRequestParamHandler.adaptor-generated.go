@@ -1,100 +1,143 @@
-
 package handlers
 
 //code generated by 'go generate', do not edit
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/jargv/plumbus"
+	"github.com/jargv/plumbus/generate"
+	"io"
+	"log"
 	"net/http"
 	"reflect"
-	"encoding/json"
 	"strconv"
-	"fmt"
-	"log"
+	"unicode/utf8"
 )
 
 // avoid unused import errors
+var _ context.Context
+var _ io.Reader
+var _ generate.File
 var _ json.Delim
 var _ log.Logger
 var _ fmt.Formatter
 var _ strconv.NumError
+var _ = utf8.RuneError
 
-func init(){
+func init() {
 	var dummy func(
-		
-			*amountQueryParam,
-		
-			*foodQueryParam,
-		
-	)(
-		
+
+		*amountQueryParam,
+
+		*foodQueryParam,
+
 	)
 
 	typ := reflect.TypeOf(dummy)
 	plumbus.RegisterAdaptor(typ, func(handler interface{}) http.HandlerFunc {
 		callback := handler.(func(
-			
-				*amountQueryParam,
-			
-				*foodQueryParam,
-			
-		)(
-			
+
+			*amountQueryParam,
+
+			*foodQueryParam,
+
 		))
 
-		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request){
-			
-				queryParams := req.URL.Query()
-			
-			
-			
-				var arg0 *amountQueryParam
-				  {
-						
-							if l, sent := queryParams["amount"]; sent && len(l) > 0 {
-								queryInt, err := strconv.Atoi(l[0])
-								if err != nil {
-									plumbus.HandleResponseError(
-										res, req,
-										plumbus.Errorf(
-											http.StatusBadRequest,
-											"query param 'amount' expected to be integer value",
-										),
-									)
-									return
-								}
-								arg0 = new(amountQueryParam)
-								*arg0 = amountQueryParam(queryInt)
-							}
-						
-					}
-				
-			
-				var arg1 *foodQueryParam
-				  
-						if l, sent := queryParams["food"]; sent && len(l) > 0{
-							arg1 = new(foodQueryParam)
-							*arg1 = (foodQueryParam)(l[0])
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+
+			queryParams := req.URL.Query()
+
+			var errs plumbus.ValidationErrors
+
+			var arg0 *amountQueryParam
+			{
+
+				l := queryParams["amount"]
+
+				if len(l) > 0 {
+					var value amountQueryParam
+
+					var err error
+
+					if err == nil {
+
+						if parsed, perr := strconv.ParseInt(l[0], 10, 64); perr == nil {
+							value = amountQueryParam(parsed)
+						} else {
+							err = fmt.Errorf("expected to be integer value")
 						}
-					
-				
-			
 
-			
-			
+					}
+					if err != nil {
+						errs = append(errs, plumbus.FieldError{
+							Field:   "amount",
+							In:      "query",
+							Message: err.Error(),
+						})
+					} else {
+
+						arg0 = &value
+
+					}
+				}
+			}
+
+			var arg1 *foodQueryParam
+			{
+
+				l := queryParams["food"]
+
+				if len(l) > 0 {
+					var value foodQueryParam
+
+					var err error
+
+					if err == nil {
+
+						value = foodQueryParam(l[0])
+
+					}
+					if err != nil {
+						errs = append(errs, plumbus.FieldError{
+							Field:   "food",
+							In:      "query",
+							Message: err.Error(),
+						})
+					} else {
+
+						arg1 = &value
+
+					}
+				}
+			}
+
+			if len(errs) > 0 {
+				plumbus.HandleResponseError(res, req, errs)
+				return
+			}
+
+			if err := plumbus.RunInterceptors(
+				req,
+
+				plumbus.ArgOf(arg0),
+
+				plumbus.ArgOf(arg1),
+			); err != nil {
+				plumbus.HandleResponseError(res, req, err)
+				return
+			}
 
 			callback(
-				
-					arg0,
-				
-					arg1,
-				
+
+				arg0,
+
+				arg1,
 			)
 
-			
-			
+			plumbus.WriteEmptyResponse(res, req)
 
-			
 		})
 	})
 }
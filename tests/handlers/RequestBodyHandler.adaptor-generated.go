@@ -1,69 +1,79 @@
-
 package handlers
 
 //code generated by 'go generate', do not edit
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/jargv/plumbus"
+	"github.com/jargv/plumbus/generate"
+	"io"
+	"log"
 	"net/http"
 	"reflect"
-	"encoding/json"
 	"strconv"
-	"fmt"
-	"log"
+	"unicode/utf8"
 )
 
 // avoid unused import errors
+var _ context.Context
+var _ io.Reader
+var _ generate.File
 var _ json.Delim
 var _ log.Logger
 var _ fmt.Formatter
 var _ strconv.NumError
+var _ = utf8.RuneError
 
-func init(){
+func init() {
 	var dummy func(
-		
-			*RequestBodyBody,
-		
-	)(
-		
+
+		*RequestBodyBody,
+
 	)
 
 	typ := reflect.TypeOf(dummy)
 	plumbus.RegisterAdaptor(typ, func(handler interface{}) http.HandlerFunc {
 		callback := handler.(func(
-			
-				*RequestBodyBody,
-			
-		)(
-			
+
+			*RequestBodyBody,
+
 		))
 
-		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request){
-			
-			
-			
-				var arg0 *RequestBodyBody
-					if err := json.NewDecoder(req.Body).Decode(&arg0); err != nil {
-						msg := fmt.Sprintf("{\"error\": \"decoding json: %s\"}", err.Error())
-						http.Error(res, msg, http.StatusBadRequest)
-						return
-					}
-				
-			
-
-			
-			
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+
+			var errs plumbus.ValidationErrors
+
+			var arg0 *RequestBodyBody
+			if err := plumbus.DecodeBody(req, &arg0); err != nil {
+				if errs, err = plumbus.CollectErrors(errs, err); err != nil {
+					plumbus.HandleResponseError(res, req, err)
+					return
+				}
+			}
+
+			if len(errs) > 0 {
+				plumbus.HandleResponseError(res, req, errs)
+				return
+			}
+
+			if err := plumbus.RunInterceptors(
+				req,
+
+				plumbus.ArgOf(arg0),
+			); err != nil {
+				plumbus.HandleResponseError(res, req, err)
+				return
+			}
 
 			callback(
-				
-					arg0,
-				
+
+				arg0,
 			)
 
-			
-			
+			plumbus.WriteEmptyResponse(res, req)
 
-			
 		})
 	})
 }
@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/gorilla/websocket"
 	. "github.com/jargv/plumbus"
+	"github.com/jargv/plumbus/generate"
 )
 
 type ReturnStructResult struct {
@@ -97,3 +106,525 @@ func OptionalRequestParamHandler(amount *amountQueryParam, food *foodQueryParam)
 		OptionalRequestParamAmount = int(*amount)
 	}
 }
+
+type contextKey string
+
+var ContextKey = contextKey("value")
+var ContextHandlerValue interface{}
+
+//go:generate plumbus ContextHandler
+func ContextHandler(ctx context.Context) {
+	ContextHandlerValue = ctx.Value(ContextKey)
+}
+
+var RawRequestPath string
+
+//go:generate plumbus RawRequestHandler
+func RawRequestHandler(req *http.Request, food foodQueryParam, res http.ResponseWriter) {
+	RawRequestPath = req.URL.Path
+	res.Header().Set("X-Food", string(food))
+}
+
+type filepath string
+
+func (f *filepath) FromRequest(req *http.Request) error {
+	*f = filepath(req.URL.Query().Get("filepath"))
+	return nil
+}
+
+var CatchAllResult string
+
+//go:generate plumbus CatchAllHandler
+func CatchAllHandler(path filepath) {
+	CatchAllResult = string(path)
+}
+
+type ErrorEnvelope struct {
+	Error string `json:"error"`
+}
+
+//go:generate plumbus NotFoundHandler
+func NotFoundHandler(req *http.Request) ErrorEnvelope {
+	return ErrorEnvelope{Error: "no route for " + req.URL.Path}
+}
+
+type SearchRequest struct {
+	UserId  string           `plumbus:"path=userId"`
+	Limit   int              `plumbus:"query=limit"`
+	Offset  *int             `plumbus:"query=offset"`
+	TraceId string           `plumbus:"header=X-Trace-Id"`
+	Body    *RequestBodyBody `plumbus:"body"`
+}
+
+var SearchResult SearchRequest
+
+//go:generate plumbus BindStructHandler
+func BindStructHandler(search *SearchRequest) {
+	SearchResult = *search
+}
+
+type xTraceIdHeaderParam string
+type retriesHeaderParam int
+
+var HeaderParamTraceId string
+var HeaderParamRetries *int
+
+//go:generate plumbus HeaderParamHandler
+func HeaderParamHandler(traceId xTraceIdHeaderParam, retries *retriesHeaderParam) {
+	HeaderParamTraceId = string(traceId)
+	HeaderParamRetries = (*int)(retries)
+}
+
+type sessionCookieParam string
+
+var CookieParamSession *string
+
+//go:generate plumbus CookieParamHandler
+func CookieParamHandler(session *sessionCookieParam) {
+	CookieParamSession = (*string)(session)
+}
+
+type orderIdPathParam int
+
+var PathParamOrderId int
+
+//go:generate plumbus PathParamHandler
+func PathParamHandler(orderId orderIdPathParam) {
+	PathParamOrderId = int(orderId)
+}
+
+// OrderInterceptor only lets orders under 100 through
+func OrderInterceptor(req *http.Request, orderId orderIdPathParam) error {
+	if orderId >= 100 {
+		return Error(http.StatusForbidden, "not your order")
+	}
+	return nil
+}
+
+type sinceQueryParam time.Time
+type untilQueryParam time.Time
+
+func (untilQueryParam) Layouts() []string {
+	return []string{"2006-01-02"}
+}
+
+var TimeParamSince time.Time
+var TimeParamUntil *time.Time
+
+//go:generate plumbus TimeParamHandler
+func TimeParamHandler(since sinceQueryParam, until *untilQueryParam) {
+	TimeParamSince = time.Time(since)
+	TimeParamUntil = (*time.Time)(until)
+}
+
+type pageQueryParam int
+
+func (pageQueryParam) Default() interface{} {
+	return 1
+}
+
+type SortedListRequest struct {
+	Sort string `plumbus:"query=sort,default=name"`
+}
+
+var DefaultParamPage int
+var DefaultParamSort string
+
+//go:generate plumbus DefaultParamHandler
+func DefaultParamHandler(page pageQueryParam, list *SortedListRequest) {
+	DefaultParamPage = int(page)
+	DefaultParamSort = list.Sort
+}
+
+type orderQueryParam string
+
+func (orderQueryParam) Enum() []string {
+	return []string{"asc", "desc"}
+}
+
+var EnumParamOrder string
+
+//go:generate plumbus EnumParamHandler
+func EnumParamHandler(order orderQueryParam) {
+	EnumParamOrder = string(order)
+}
+
+// Version is registered with plumbus.RegisterParamKind in the tests
+type Version struct {
+	Major, Minor int
+}
+
+type versionHeaderParam Version
+
+var RegisteredParamVersion Version
+
+//go:generate plumbus RegisteredParamHandler
+func RegisteredParamHandler(version versionHeaderParam) {
+	RegisteredParamVersion = Version(version)
+}
+
+type verboseQueryParam bool
+type ratioQueryParam float64
+type countQueryParam uint16
+
+var KindParamVerbose bool
+var KindParamRatio float64
+var KindParamCount uint16
+
+//go:generate plumbus KindParamHandler
+func KindParamHandler(verbose verboseQueryParam, ratio ratioQueryParam, count countQueryParam) {
+	KindParamVerbose = bool(verbose)
+	KindParamRatio = float64(ratio)
+	KindParamCount = uint16(count)
+}
+
+type Transfer struct {
+	Amount int
+}
+
+func (t *Transfer) Validate() error {
+	if t.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	return nil
+}
+
+type currencyQueryParam string
+
+func (c currencyQueryParam) Validate() error {
+	if len(c) != 3 {
+		return Error(http.StatusUnprocessableEntity, "currency must be a 3 letter code")
+	}
+	return nil
+}
+
+var ValidatedTransfer Transfer
+
+//go:generate plumbus ValidateHandler
+func ValidateHandler(currency currencyQueryParam, transfer Transfer) {
+	ValidatedTransfer = transfer
+}
+
+type Signup struct {
+	Name  string  `json:"name" validate:"required,max=8"`
+	Age   int     `json:"age" validate:"min=18"`
+	Plan  string  `json:"plan" validate:"oneof=free pro"`
+	Promo *string `json:"promo" validate:"regexp=^[A-Z]{3,}$"`
+}
+
+var ValidatedSignup Signup
+
+//go:generate plumbus ValidateTagsHandler
+func ValidateTagsHandler(signup Signup) {
+	ValidatedSignup = signup
+}
+
+type Shipment struct {
+	Items    []ShipmentItem           `json:"items" validate:"min=1"`
+	ByDock   map[string]*ShipmentItem `json:"byDock"`
+	Carrier  *Carrier                 `json:"carrier"`
+	Priority int                      `json:"priority" validate:"oneof=1 2 3"`
+	Weight   float64                  `json:"weight" validate:"max=99.5"`
+	Labels   [2]string                `json:"labels" validate:"required"`
+}
+
+type ShipmentItem struct {
+	Sku      string `json:"sku" validate:"required"`
+	Quantity *int   `json:"quantity" validate:"required,min=1"`
+}
+
+// Carrier is nested in itself, so its adaptor checks it by reflection
+type Carrier struct {
+	Name   string   `json:"name" validate:"required,max=12"`
+	Parent *Carrier `json:"parent"`
+}
+
+//go:generate plumbus ShipmentHandler
+func ShipmentHandler(shipment *Shipment) {}
+
+type xSignatureHeaderParam string
+
+var RawBodySignature string
+var RawBody []byte
+
+//go:generate plumbus RawBodyHandler
+func RawBodyHandler(signature xSignatureHeaderParam, body []byte) {
+	RawBodySignature = string(signature)
+	RawBody = body
+}
+
+var BodyReaderContents string
+
+//go:generate plumbus BodyReaderHandler
+func BodyReaderHandler(body io.Reader) error {
+	contents, err := io.ReadAll(body)
+	BodyReaderContents = string(contents)
+	return err
+}
+
+type ContactForm struct {
+	Email   string   `form:"email" validate:"required"`
+	Age     int      `json:"age"`
+	Topics  []string `form:"topic"`
+	Private bool
+}
+
+var SubmittedContact ContactForm
+
+//go:generate plumbus FormBodyHandler
+func FormBodyHandler(contact *ContactForm) {
+	SubmittedContact = *contact
+}
+
+type avatarFile File
+
+type UploadMeta struct {
+	Caption string `form:"caption"`
+}
+
+var UploadedName string
+var UploadedContents string
+var UploadedCaption string
+
+//go:generate plumbus UploadHandler
+func UploadHandler(avatar avatarFile, meta *UploadMeta) error {
+	defer avatar.Close()
+	contents, err := io.ReadAll(avatar)
+	UploadedName = avatar.Name
+	UploadedContents = string(contents)
+	UploadedCaption = meta.Caption
+	return err
+}
+
+type Export struct {
+	Id      int       `json:"id"`
+	Name    string    `csv:"full_name"`
+	Secret  string    `csv:"-"`
+	Created time.Time `json:"created"`
+	Note    *string
+}
+
+//go:generate plumbus ExportHandler
+func ExportHandler() []*Export {
+	note := "a, note"
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []*Export{
+		{Id: 1, Name: "Ann", Secret: "x", Created: created, Note: &note},
+		{Id: 2, Name: "Bo", Secret: "y", Created: created},
+	}
+}
+
+//go:generate plumbus TextHandler
+func TextHandler() Text {
+	return "pong"
+}
+
+type Job struct {
+	Id string `json:"id"`
+}
+
+func (Job) ResponseCode() int {
+	return http.StatusAccepted
+}
+
+//go:generate plumbus StartJobHandler
+func StartJobHandler() Job {
+	return Job{Id: "job-1"}
+}
+
+type Widget struct {
+	Name string `json:"name"`
+}
+
+//go:generate plumbus CreateWidgetHandler
+func CreateWidgetHandler(widget *Widget) (int, *Widget, error) {
+	if widget.Name == "" {
+		return 0, nil, Error(http.StatusBadRequest, "widget needs a name")
+	}
+	return http.StatusCreated, widget, nil
+}
+
+//go:generate plumbus CountWidgetsHandler
+func CountWidgetsHandler() (int, error) {
+	return 5, nil
+}
+
+//go:generate plumbus CachedHandler
+func CachedHandler() (*ReturnStructResult, Headers) {
+	return &ReturnStructResult{Message: "cached"}, Headers{
+		"Cache-Control": {"max-age=60"},
+		"x-request-id":  {"abc"},
+	}
+}
+
+type nextQueryParam string
+
+//go:generate plumbus RedirectHandler
+func RedirectHandler(next nextQueryParam) Redirect {
+	return Redirect{URL: string(next), Code: http.StatusSeeOther}
+}
+
+//go:generate plumbus CreateHandler
+func CreateHandler(widget *Widget) *CreatedResponse {
+	return Created("/widgets/"+widget.Name, widget)
+}
+
+var StreamClosed bool
+
+type Stream struct {
+	io.Reader
+}
+
+func (Stream) ContentType() string {
+	return "text/plain"
+}
+
+func (Stream) Close() error {
+	StreamClosed = true
+	return nil
+}
+
+//go:generate plumbus StreamHandler
+func StreamHandler() (io.ReadCloser, error) {
+	return Stream{strings.NewReader("streamed body")}, nil
+}
+
+//go:generate plumbus DownloadHandler
+func DownloadHandler() *FileResponse {
+	return &FileResponse{
+		Name:    "report.txt",
+		ModTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Content: strings.NewReader("hello, download"),
+	}
+}
+
+type titleQueryParam string
+
+//go:generate plumbus RenderHandler
+func RenderHandler(title titleQueryParam) Render {
+	return Render{Name: "page.html", Data: map[string]string{"Title": string(title)}}
+}
+
+//go:generate plumbus CountdownHandler
+func CountdownHandler(ctx context.Context) <-chan ReturnStructResult {
+	ch := make(chan ReturnStructResult)
+	go func() {
+		defer close(ch)
+		for _, message := range []string{"3", "2", "1"} {
+			select {
+			case ch <- ReturnStructResult{Message: message}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+//go:generate plumbus EventsHandler
+func EventsHandler(ctx context.Context) EventStream {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for _, event := range []Event{
+			{ID: "1", Type: "greeting", Data: "hello\nworld"},
+			{ID: "2", Data: ReturnStructResult{Message: "json"}},
+		} {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+	}()
+	return events
+}
+
+type roomPathParam string
+
+//go:generate plumbus EchoHandler
+func EchoHandler(conn *WSConn, room roomPathParam) error {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return nil
+		}
+		reply := string(room) + ": " + string(message)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(reply)); err != nil {
+			return err
+		}
+	}
+}
+
+type Document struct {
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+func (d *Document) ETag() string {
+	return fmt.Sprintf("v%d", d.Version)
+}
+
+//go:generate plumbus DocumentHandler
+func DocumentHandler() *Document {
+	return &Document{Version: 3, Text: "etagged"}
+}
+
+type Countries []string
+
+func (Countries) LastModified() time.Time {
+	return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+}
+
+//go:generate plumbus CountriesHandler
+func CountriesHandler() Countries {
+	return Countries{"CA", "MX", "US"}
+}
+
+var BasicAuthUser string
+
+//go:generate plumbus BasicAuthHandler
+func BasicAuthHandler(auth BasicAuth) {
+	BasicAuthUser = auth.User
+}
+
+// Tenant is made by the "tenant" plugin from the X-Tenant header, the way
+// a param convention of another package would be
+type Tenant string
+
+func TenantFromRequest(req *http.Request) (Tenant, error) {
+	tenant := req.Header.Get("X-Tenant")
+	if tenant == "" {
+		return "", ValidationErrors{{Field: "X-Tenant", In: "header", Message: "is required"}}
+	}
+	return Tenant(tenant), nil
+}
+
+func init() {
+	generate.RegisterPlugin(&generate.Plugin{
+		Name: "tenant",
+		Match: func(typ reflect.Type) bool {
+			return typ == reflect.TypeOf(Tenant(""))
+		},
+		Extract: func(req *http.Request, typ reflect.Type) (interface{}, error) {
+			return TenantFromRequest(req)
+		},
+		Code: "{{.Var}}, err = TenantFromRequest(req)",
+		Describe: func(typ reflect.Type) generate.PluginDoc {
+			return generate.PluginDoc{
+				Params: []generate.PluginParam{{
+					Name:        "X-Tenant",
+					Source:      generate.SourceHeader,
+					Required:    true,
+					Description: "The tenant making the request.",
+				}},
+			}
+		},
+	})
+}
+
+//go:generate plumbus TenantHandler
+func TenantHandler(tenant Tenant) (string, error) {
+	return "tenant " + string(tenant), nil
+}
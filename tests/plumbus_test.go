@@ -1,14 +1,50 @@
 package plumbus
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"math/big"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/gorilla/websocket"
 	. "github.com/jargv/plumbus"
+	"github.com/jargv/plumbus/generate"
+	"github.com/jargv/plumbus/jwt"
+	"github.com/jargv/plumbus/msgpack"
+	"github.com/jargv/plumbus/prometheus"
+	"github.com/jargv/plumbus/protobuf"
 	. "github.com/jargv/plumbus/tests/handlers"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	vmsgpack "gopkg.in/vmihailenco/msgpack.v2"
 )
 
 func TestReturnStruct(t *testing.T) {
@@ -112,6 +148,10 @@ func TestRequestMethod(t *testing.T) {
 		)
 	}
 
+	if allow := resp.Header.Get("Allow"); allow != "PUT, OPTIONS" {
+		t.Errorf(`Allow != "PUT, OPTIONS", Allow == %q`, allow)
+	}
+
 	req, err := http.NewRequest("PUT", server.URL, nil)
 	if err != nil {
 		t.Errorf("couldn't make request: %#v\n", err)
@@ -201,8 +241,8 @@ func TestOptionalRequestParam(t *testing.T) {
 		t.Fatalf("makeing request: %v\n", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf(`resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, resp.StatusCode)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
 	}
 
 	if OptionalRequestParamResult != "not set" {
@@ -218,8 +258,8 @@ func TestOptionalRequestParam(t *testing.T) {
 		t.Fatalf("makeing request: %v\n", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		t.Fatalf(`resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, resp.StatusCode)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
 	}
 
 	if OptionalRequestParamResult != "nachos" {
@@ -257,6 +297,4782 @@ func TestOptionalRequestParam(t *testing.T) {
 	}
 }
 
+func TestContextParam(t *testing.T) {
+	handler := HandlerFunc(ContextHandler)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), ContextKey, "nachos")
+		handler.ServeHTTP(res, req.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	_, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if ContextHandlerValue != "nachos" {
+		t.Fatalf(`ContextHandlerValue != "nachos", ContextHandlerValue == "%v"`, ContextHandlerValue)
+	}
+}
+
+func TestRawRequestParams(t *testing.T) {
+	server := httptest.NewServer(HandlerFunc(RawRequestHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/raw?food=nachos")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if RawRequestPath != "/raw" {
+		t.Fatalf(`RawRequestPath != "/raw", RawRequestPath == "%v"`, RawRequestPath)
+	}
+
+	if food := resp.Header.Get("X-Food"); food != "nachos" {
+		t.Fatalf(`X-Food != "nachos", X-Food == "%v"`, food)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/user/:userId/name", PathParamsHandler)
+
+	order := ""
+	pattern := ""
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			order += "first,"
+			pattern = RoutePattern(req)
+			next.ServeHTTP(res, req)
+		})
+	}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			order += "second"
+			next.ServeHTTP(res, req)
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/user/11/name")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if order != "first,second" {
+		t.Fatalf(`order != "first,second", order == "%v"`, order)
+	}
+
+	if pattern != "/user/:userId/name" {
+		t.Fatalf(`pattern != "/user/:userId/name", pattern == "%v"`, pattern)
+	}
+
+	if PathParamsResult != "11" {
+		t.Fatalf(`PathParamsResult != "11", PathParamsResult == "%v"`, PathParamsResult)
+	}
+}
+
+func TestMiddlewareChainedOnce(t *testing.T) {
+	built := map[string]int{}
+	var order []string
+	counted := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			built[name]++
+			return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(res, req)
+			})
+		}
+	}
+
+	billing := NewServeMux()
+	billing.Use(counted("billing"))
+	billing.Handle("/invoices", func() {})
+
+	mux := NewServeMux()
+	mux.Use(counted("mux"))
+	mux.Mount("/billing", billing)
+	api := mux.Host("api.example.com")
+	api.Use(counted("api"))
+	api.Mount("/billing", billing)
+
+	for _, host := range []string{"example.com", "api.example.com", "example.com"} {
+		req := httptest.NewRequest("GET", "http://"+host+"/billing/invoices", nil)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNoContent {
+			t.Fatalf(`%s: res.Code != http.StatusNoContent, res.Code == "%v"`, host, res.Code)
+		}
+	}
+
+	expected := map[string]int{"mux": 1, "api": 1, "billing": 1}
+	if !reflect.DeepEqual(built, expected) {
+		t.Fatalf(`built != %v, built == "%v"`, expected, built)
+	}
+
+	expectedOrder := []string{"mux", "billing", "mux", "api", "billing", "mux", "billing"}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Fatalf(`order != %v, order == "%v"`, expectedOrder, order)
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	mux := NewServeMux()
+	denyAll := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			http.Error(res, "forbidden", http.StatusForbidden)
+		})
+	}
+	mux.HandleWith("/admin", []Middleware{denyAll}, ReturnStructHandler)
+	mux.Handle("/health", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/admin")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf(`resp.StatusCode != http.StatusForbidden, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf(`resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestMount(t *testing.T) {
+	billing := NewServeMux()
+	billing.Handle("/user/:userId/name", PathParamsHandler)
+
+	mux := NewServeMux()
+	mux.Mount("/org/:orgId/billing", billing)
+
+	pattern := ""
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			pattern = RoutePattern(req)
+			next.ServeHTTP(res, req)
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/org/3/billing/user/12/name")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if PathParamsResult != "12" {
+		t.Fatalf(`PathParamsResult != "12", PathParamsResult == "%v"`, PathParamsResult)
+	}
+
+	if pattern != "/org/:orgId/billing/user/:userId/name" {
+		t.Fatalf(`pattern != "/org/:orgId/billing/user/:userId/name", pattern == "%v"`, pattern)
+	}
+
+	resp, err = http.Get(server.URL + "/org/3/billing/nachos")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf(`resp.StatusCode != http.StatusNotFound, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestMountFallsBackToSiblings(t *testing.T) {
+	var params url.Values
+	record := func(res http.ResponseWriter, req *http.Request) {
+		params = PathParams(req)
+	}
+
+	billing := NewServeMux()
+	billing.Handle("/user/:userId/name", record)
+
+	mux := NewServeMux()
+	mux.Mount("/org/:orgId/billing", billing)
+	mux.Mount("/team/:teamId/billing", billing)
+	mux.Handle("/org/:orgId/:section/summary", record)
+	mux.Handle("/org/:orgId/*rest", record)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		path     string
+		expected url.Values
+	}{
+		{"/org/3/billing/user/12/name", url.Values{"orgId": {"3"}, "userId": {"12"}}},
+		{"/team/4/billing/user/12/name/", url.Values{"teamId": {"4"}, "userId": {"12"}}},
+		{"/org/3/billing/summary", url.Values{"orgId": {"3"}, "section": {"billing"}}},
+		{"/org/3/billing/nachos", url.Values{"orgId": {"3"}, "rest": {"billing/nachos"}}},
+	} {
+		params = nil
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf(`%s: resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, c.path, resp.StatusCode)
+		}
+
+		if !reflect.DeepEqual(params, c.expected) {
+			t.Fatalf(`%s: params != %v, params == "%v"`, c.path, c.expected, params)
+		}
+	}
+}
+
+func TestMountAtRoot(t *testing.T) {
+	var route string
+	record := func(res http.ResponseWriter, req *http.Request) {
+		route = RoutePattern(req)
+	}
+
+	api := NewServeMux()
+	api.Handle("/", record)
+	api.Handle("/foo", record)
+	api.Handle("/users/:userId", record)
+
+	mux := NewServeMux()
+	mux.Mount("/", api)
+	mux.Handle("/users/me", record)
+
+	for _, c := range []struct {
+		path  string
+		route string
+	}{
+		{"/", "/"},
+		{"/foo", "/foo"},
+		{"/users/7", "/users/:userId"},
+		{"/users/me", "/users/me"},
+	} {
+		route = ""
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest("GET", c.path, nil))
+		if res.Code != http.StatusOK {
+			t.Fatalf(`%s: res.Code != http.StatusOK, res.Code == "%v"`, c.path, res.Code)
+		}
+		if route != c.route {
+			t.Fatalf(`%s: route != %q, route == %q`, c.path, c.route, route)
+		}
+	}
+}
+
+func TestCatchAll(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/files/*filepath", CatchAllHandler)
+	mux.Handle("/files/readme", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/files/docs/2016/notes.txt")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if CatchAllResult != "docs/2016/notes.txt" {
+		t.Fatalf(`CatchAllResult != "docs/2016/notes.txt", CatchAllResult == "%v"`, CatchAllResult)
+	}
+
+	CatchAllResult = ""
+	_, err = http.Get(server.URL + "/files/readme")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if CatchAllResult != "" {
+		t.Fatalf(`CatchAllResult != "", CatchAllResult == "%v"`, CatchAllResult)
+	}
+}
+
+func TestPathParamConstraint(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle(`/user/:userId(\d+)/name`, PathParamsHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/user/nachos/name")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf(`resp.StatusCode != http.StatusNotFound, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	_, err = http.Get(server.URL + "/user/42/name")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if PathParamsResult != "42" {
+		t.Fatalf(`PathParamsResult != "42", PathParamsResult == "%v"`, PathParamsResult)
+	}
+}
+
+func TestMethodHelpers(t *testing.T) {
+	mux := NewServeMux()
+	mux.PUT("/method", RequestMethodHandler)
+	mux.GET("/method", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/method", "", nil)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf(`resp.StatusCode != http.StatusMethodNotAllowed, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/method")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var result ReturnStructResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("couldn't decode: %v\n", err)
+	}
+
+	if result.Message != "Victory!" {
+		t.Fatalf(`result.Message != "Victory!", result.Message == %q`, result.Message)
+	}
+}
+
+func TestAutomaticOptions(t *testing.T) {
+	server := httptest.NewServer(HandlerFunc(&ByMethod{
+		GET: ReturnStructHandler,
+		PUT: RequestMethodHandler,
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest("OPTIONS", server.URL, nil)
+	if err != nil {
+		t.Fatalf("couldn't make request: %v\n", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if allow := resp.Header.Get("Allow"); allow != "GET, HEAD, PUT, OPTIONS" {
+		t.Fatalf(`Allow != "GET, HEAD, PUT, OPTIONS", Allow == %q`, allow)
+	}
+}
+
+func TestAutomaticHead(t *testing.T) {
+	server := httptest.NewServer(HandlerFunc(&ByMethod{
+		GET: ReturnStructHandler,
+	}))
+	defer server.Close()
+
+	resp, err := http.Head(server.URL)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf(`resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	expected := int64(len(`{"Message":"Victory!"}` + "\n"))
+	if resp.ContentLength != expected {
+		t.Fatalf(`resp.ContentLength != %d, resp.ContentLength == "%v"`, expected, resp.ContentLength)
+	}
+}
+
+func TestCustomNotFound(t *testing.T) {
+	mux := NewServeMux()
+	mux.NotFound(NotFoundHandler)
+	mux.MethodNotAllowed(NotFoundHandler)
+	mux.GET("/method", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/nachos")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf(`resp.StatusCode != http.StatusNotFound, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var result ErrorEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("couldn't decode: %v\n", err)
+	}
+
+	if result.Error != "no route for /nachos" {
+		t.Fatalf(`result.Error != "no route for /nachos", result.Error == %q`, result.Error)
+	}
+
+	resp, err = http.Post(server.URL+"/method", "", nil)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf(`resp.StatusCode != http.StatusMethodNotAllowed, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("couldn't decode: %v\n", err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/user/:userId/name", PathParamsHandler, "the user's name")
+	mux.GET("/method", ReturnStructHandler)
+	mux.PUT("/method", RequestMethodHandler)
+
+	routes := mux.Routes()
+	if len(routes) != 3 {
+		t.Fatalf(`len(routes) != 3, len(routes) == %d`, len(routes))
+	}
+
+	get := routes[0]
+	if get.Pattern != "/method" || get.Method != "GET" {
+		t.Fatalf(`routes[0] != GET /method, routes[0] == %s %s`, get.Method, get.Pattern)
+	}
+
+	if get.Handler != "github.com/jargv/plumbus/tests/handlers.ReturnStructHandler" {
+		t.Fatalf(`unexpected handler name %q`, get.Handler)
+	}
+
+	user := routes[2]
+	if user.Pattern != "/user/:userId/name" || user.Method != "" {
+		t.Fatalf(`routes[2] != /user/:userId/name, routes[2] == %s %s`, user.Method, user.Pattern)
+	}
+
+	if len(user.Params) != 1 || user.Params[0].Name() != "userId" {
+		t.Fatalf(`unexpected params %v`, user.Params)
+	}
+}
+
+func TestNamedRoutes(t *testing.T) {
+	billing := NewServeMux()
+	billing.Handle(`/invoice/:invoiceId(\d+)`, ReturnStructHandler).Name("invoice")
+
+	mux := NewServeMux()
+	mux.Handle("/user/:userId/name", PathParamsHandler).Name("user.name")
+	mux.Mount("/org/:orgId/billing", billing)
+
+	url, err := mux.URL("user.name", "userId", 42, "verbose", true)
+	if err != nil {
+		t.Fatalf("building url: %v\n", err)
+	}
+
+	if url != "/user/42/name?verbose=true" {
+		t.Fatalf(`url != "/user/42/name?verbose=true", url == %q`, url)
+	}
+
+	url, err = mux.URL("invoice", "orgId", "acme", "invoiceId", 7)
+	if err != nil {
+		t.Fatalf("building url: %v\n", err)
+	}
+
+	if url != "/org/acme/billing/invoice/7" {
+		t.Fatalf(`url != "/org/acme/billing/invoice/7", url == %q`, url)
+	}
+
+	if _, err := mux.URL("invoice", "orgId", "acme", "invoiceId", "nachos"); err == nil {
+		t.Fatalf("expected an error for a param violating its constraint")
+	}
+
+	if _, err := mux.URL("user.name"); err == nil {
+		t.Fatalf("expected an error for a missing param")
+	}
+}
+
+func TestNamedHostRoutes(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/user/:userId", PathParamsHandler).Name("user")
+	mux.Host("api.example.com").Handle("/v1/user/:userId", PathParamsHandler).Name("api.user")
+	mux.Host("admin.example.com").Handle("/user/:userId", PathParamsHandler).Name("user")
+
+	for _, c := range []struct {
+		name string
+		url  string
+	}{
+		{"api.user", "/v1/user/42"},
+		{"user", "/user/42"},
+	} {
+		url, err := mux.URL(c.name, "userId", 42)
+		if err != nil {
+			t.Fatalf("%s: building url: %v\n", c.name, err)
+		}
+
+		if url != c.url {
+			t.Fatalf(`%s: url != %q, url == %q`, c.name, c.url, url)
+		}
+	}
+
+	if _, err := mux.URL("api.missing"); err == nil {
+		t.Fatalf("expected an error for a route that isn't named")
+	}
+}
+
+func TestTrailingSlashPolicy(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/users", ReturnStructHandler)
+	mux.Handle("/teams/", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	expectStatus := func(path string, code int) *http.Response {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+		if resp.StatusCode != code {
+			t.Fatalf(`%s: resp.StatusCode != %d, resp.StatusCode == "%v"`, path, code, resp.StatusCode)
+		}
+		return resp
+	}
+
+	expectStatus("/users/", http.StatusOK)
+	expectStatus("/teams", http.StatusOK)
+
+	mux.SetTrailingSlashPolicy(TrailingSlashRedirect)
+	resp := expectStatus("/users/?page=2", http.StatusMovedPermanently)
+	if location := resp.Header.Get("Location"); location != "/users?page=2" {
+		t.Fatalf(`Location != "/users?page=2", Location == %q`, location)
+	}
+	expectStatus("/users", http.StatusOK)
+
+	mux.SetTrailingSlashPolicy(TrailingSlashStrict)
+	expectStatus("/users/", http.StatusNotFound)
+	expectStatus("/teams", http.StatusNotFound)
+	expectStatus("/teams/", http.StatusOK)
+}
+
+func TestHostRouting(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/name", ReturnStructHandler)
+	mux.Host("admin.example.com").Handle("/name", NotFoundHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/name", nil)
+	if err != nil {
+		t.Fatalf("couldn't make request: %v\n", err)
+	}
+	req.Host = "ADMIN.example.com:8080"
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var envelope ErrorEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("couldn't decode: %v\n", err)
+	}
+
+	if envelope.Error != "no route for /name" {
+		t.Fatalf(`envelope.Error != "no route for /name", envelope.Error == %q`, envelope.Error)
+	}
+
+	resp, err = http.Get(server.URL + "/name")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var result ReturnStructResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("couldn't decode: %v\n", err)
+	}
+
+	if result.Message != "Victory!" {
+		t.Fatalf(`result.Message != "Victory!", result.Message == %q`, result.Message)
+	}
+}
+
+func TestCasePolicy(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/User/:userId/name", PathParamsHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(server.URL + "/user/AbC/NAME")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf(`resp.StatusCode != http.StatusNotFound, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	mux.SetCasePolicy(CaseInsensitive)
+	resp, err = client.Get(server.URL + "/user/AbC/NAME")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if PathParamsResult != "AbC" {
+		t.Fatalf(`PathParamsResult != "AbC", PathParamsResult == "%v"`, PathParamsResult)
+	}
+
+	mux.SetCasePolicy(CaseInsensitiveRedirect)
+	resp, err = client.Get(server.URL + "/user/AbC/NAME")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if location := resp.Header.Get("Location"); location != "/User/AbC/name" {
+		t.Fatalf(`Location != "/User/AbC/name", Location == %q`, location)
+	}
+}
+
+func TestRadixRouting(t *testing.T) {
+	matched := ""
+	record := func(res http.ResponseWriter, req *http.Request) {
+		matched = RoutePattern(req) + " " + PathParams(req).Encode()
+	}
+
+	mux := NewServeMux()
+	mux.SetCasePolicy(CaseInsensitive)
+	for _, pattern := range []string{
+		"/users",
+		"/users/search",
+		"/users/:id",
+		"/users/:id/posts",
+		"/userstats",
+		"/user/:name/stats",
+		"/café/menu",
+		"/cafe/menu",
+		"/a/b/c",
+		"/a/:x/d",
+	} {
+		mux.Handle(pattern, record)
+	}
+
+	for _, c := range []struct {
+		path     string
+		expected string
+	}{
+		{"/users", "/users "},
+		{"/users/search", "/users/search "},
+		{"/users/searching", "/users/:id id=searching"},
+		{"/users/7/posts", "/users/:id/posts id=7"},
+		{"/userstats", "/userstats "},
+		{"/user/jo/stats", "/user/:name/stats name=jo"},
+		{"/USERS/Search", "/users/search "},
+		{"/CAFÉ/Menu", "/café/menu "},
+		{"/cafe/menu", "/cafe/menu "},
+		{"/a/b/c", "/a/b/c "},
+		{"/a/b/d", "/a/:x/d x=b"},
+		{"/a/b", ""},
+		{"/userstat", ""},
+	} {
+		matched = ""
+		req := httptest.NewRequest("GET", "http://example.com"+(&url.URL{Path: c.path}).EscapedPath(), nil)
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+
+		if matched != c.expected {
+			t.Fatalf(`%s: matched != %q, matched == %q`, c.path, c.expected, matched)
+		}
+	}
+}
+
+func TestStatic(t *testing.T) {
+	mux := NewServeMux()
+	mux.Static("/assets", fstest.MapFS{
+		"css/site.css": &fstest.MapFile{Data: []byte("body {}")},
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/assets/css/site.css", nil)
+	if err != nil {
+		t.Fatalf("couldn't make request: %v\n", err)
+	}
+	req.Header.Set("Range", "bytes=0-3")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf(`resp.StatusCode != http.StatusPartialContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/css; charset=utf-8" {
+		t.Fatalf(`Content-Type != "text/css; charset=utf-8", Content-Type == %q`, contentType)
+	}
+
+	body := bytes.Buffer{}
+	body.ReadFrom(resp.Body)
+	if body.String() != "body" {
+		t.Fatalf(`body != "body", body == %q`, body.String())
+	}
+
+	resp, err = http.Get(server.URL + "/assets/missing.css")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf(`resp.StatusCode != http.StatusNotFound, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestBindStruct(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/user/:userId/search", BindStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body := bytes.Buffer{}
+	json.NewEncoder(&body).Encode(&RequestBodyBody{Message: "nachos"})
+	req, err := http.NewRequest("POST", server.URL+"/user/7/search?limit=10&userId=8", &body)
+	if err != nil {
+		t.Fatalf("couldn't make request: %v\n", err)
+	}
+	req.Header.Set("X-Trace-Id", "abc")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if SearchResult.UserId != "7" || SearchResult.Limit != 10 || SearchResult.TraceId != "abc" {
+		t.Fatalf(`unexpected SearchResult %+v`, SearchResult)
+	}
+
+	if SearchResult.Offset != nil {
+		t.Fatalf(`SearchResult.Offset != nil, SearchResult.Offset == %v`, *SearchResult.Offset)
+	}
+
+	if SearchResult.Body == nil || SearchResult.Body.Message != "nachos" {
+		t.Fatalf(`unexpected SearchResult.Body %+v`, SearchResult.Body)
+	}
+
+	resp, err = http.Get(server.URL + "/user/7/search?limit=ten")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+type badTagRequest struct {
+	Limit int `plumbus:"querystring=limit"`
+}
+
+type badFieldRequest struct {
+	Ids map[string]int `plumbus:"query=ids"`
+}
+
+type idsQueryParam []int
+
+func TestBindStructCheckedWhenRegistered(t *testing.T) {
+	for i, register := range []func(){
+		func() { HandlerFunc(func(r *badTagRequest) {}) },
+		func() { HandlerFunc(func(r badFieldRequest) {}) },
+		func() { HandlerFunc(func(ids idsQueryParam) {}) },
+		func() { Handle1(func(r *badTagRequest) (string, error) { return "", nil }) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic registering handler %d", i)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func TestHeaderParams(t *testing.T) {
+	server := httptest.NewServer(HandlerFunc(HeaderParamHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("couldn't make request: %v\n", err)
+	}
+	req.Header.Set("X-Trace-Id", "abc")
+	req.Header.Set("Retries", "3")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if HeaderParamTraceId != "abc" {
+		t.Fatalf(`HeaderParamTraceId != "abc", HeaderParamTraceId == %q`, HeaderParamTraceId)
+	}
+
+	if HeaderParamRetries == nil || *HeaderParamRetries != 3 {
+		t.Fatalf(`HeaderParamRetries != 3, HeaderParamRetries == %v`, HeaderParamRetries)
+	}
+}
+
+func TestCookieParams(t *testing.T) {
+	server := httptest.NewServer(HandlerFunc(CookieParamHandler))
+	defer server.Close()
+
+	_, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if CookieParamSession != nil {
+		t.Fatalf(`CookieParamSession != nil, CookieParamSession == %q`, *CookieParamSession)
+	}
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("couldn't make request: %v\n", err)
+	}
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s3cr3t"})
+
+	_, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if CookieParamSession == nil || *CookieParamSession != "s3cr3t" {
+		t.Fatalf(`CookieParamSession != "s3cr3t", CookieParamSession == %v`, CookieParamSession)
+	}
+}
+
+func TestPathParamType(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/order/:orderId", PathParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/order/12?orderId=13")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if PathParamOrderId != 12 {
+		t.Fatalf(`PathParamOrderId != 12, PathParamOrderId == %v`, PathParamOrderId)
+	}
+
+	resp, err := http.Get(server.URL + "/order/twelve")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestTimeParams(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/events", TimeParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/events?since=2020-01-02T03:04:05Z&until=2020-02-01")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if !TimeParamSince.Equal(since) {
+		t.Fatalf(`TimeParamSince != %v, TimeParamSince == "%v"`, since, TimeParamSince)
+	}
+
+	until := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	if TimeParamUntil == nil || !TimeParamUntil.Equal(until) {
+		t.Fatalf(`TimeParamUntil != %v, TimeParamUntil == "%v"`, until, TimeParamUntil)
+	}
+
+	resp, err := http.Get(server.URL + "/events?since=yesterday")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestDefaultParams(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/list", DefaultParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/list")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if DefaultParamPage != 1 {
+		t.Fatalf(`DefaultParamPage != 1, DefaultParamPage == "%v"`, DefaultParamPage)
+	}
+
+	if DefaultParamSort != "name" {
+		t.Fatalf(`DefaultParamSort != "name", DefaultParamSort == "%v"`, DefaultParamSort)
+	}
+
+	_, err = http.Get(server.URL + "/list?page=3&sort=date")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if DefaultParamPage != 3 {
+		t.Fatalf(`DefaultParamPage != 3, DefaultParamPage == "%v"`, DefaultParamPage)
+	}
+
+	if DefaultParamSort != "date" {
+		t.Fatalf(`DefaultParamSort != "date", DefaultParamSort == "%v"`, DefaultParamSort)
+	}
+}
+
+func TestEnumParams(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/list", EnumParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/list?order=desc")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if EnumParamOrder != "desc" {
+		t.Fatalf(`EnumParamOrder != "desc", EnumParamOrder == "%v"`, EnumParamOrder)
+	}
+
+	resp, err := http.Get(server.URL + "/list?order=sideways")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	body := map[string]string{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	expected := "query param 'order' expected to be one of asc, desc"
+	if body["error"] != expected {
+		t.Fatalf(`body["error"] != %q, body["error"] == "%v"`, expected, body["error"])
+	}
+}
+
+type pointA struct{ X, Y int }
+type pointB struct{ X, Y int }
+type pointQueryParam pointA
+
+func TestAmbiguousParamKind(t *testing.T) {
+	parse := func(s string) (interface{}, error) {
+		return pointA{}, nil
+	}
+	RegisterParamKind(reflect.TypeOf(pointA{}), parse)
+	RegisterParamKind(reflect.TypeOf(pointB{}), parse)
+
+	defer func() {
+		err, _ := recover().(error)
+		if err == nil || !strings.Contains(err.Error(), "plumbus.pointA, plumbus.pointB") {
+			t.Fatalf("expected a panic naming both kinds, got %v", err)
+		}
+	}()
+	HandlerFunc(func(p pointQueryParam) {})
+}
+
+func TestRegisteredParamKind(t *testing.T) {
+	RegisterParamKind(reflect.TypeOf(Version{}), func(s string) (interface{}, error) {
+		var v Version
+		_, err := fmt.Sscanf(s, "%d.%d", &v.Major, &v.Minor)
+		return v, err
+	})
+
+	mux := NewServeMux()
+	mux.Handle("/", RegisteredParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/", nil)
+	req.Header.Set("Version", "2.5")
+	_, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	expected := Version{Major: 2, Minor: 5}
+	if RegisteredParamVersion != expected {
+		t.Fatalf(`RegisteredParamVersion != %v, RegisteredParamVersion == "%v"`, expected, RegisteredParamVersion)
+	}
+
+	req.Header.Set("Version", "two")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+type colorQueryParam color
+type color struct{ R, G, B uint8 }
+
+func TestParamKindReturningNil(t *testing.T) {
+	RegisterParamKind(reflect.TypeOf(color{}), func(s string) (interface{}, error) {
+		if s != "red" {
+			return nil, nil
+		}
+		return color{R: 255}, nil
+	})
+
+	mux := NewServeMux()
+	mux.Handle("/paint", func(c colorQueryParam) {})
+
+	for _, c := range []struct {
+		query  string
+		status int
+	}{
+		{"red", http.StatusNoContent},
+		{"mauve", http.StatusBadRequest},
+	} {
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest("GET", "/paint?color="+c.query, nil))
+		if res.Code != c.status {
+			t.Fatalf(`%s: res.Code != %d, res.Code == "%v"`, c.query, c.status, res.Code)
+		}
+	}
+}
+
+func TestParamKinds(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/", KindParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/?verbose=true&ratio=0.5&count=3")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if !KindParamVerbose {
+		t.Fatalf(`KindParamVerbose != true, KindParamVerbose == "%v"`, KindParamVerbose)
+	}
+
+	if KindParamRatio != 0.5 {
+		t.Fatalf(`KindParamRatio != 0.5, KindParamRatio == "%v"`, KindParamRatio)
+	}
+
+	if KindParamCount != 3 {
+		t.Fatalf(`KindParamCount != 3, KindParamCount == "%v"`, KindParamCount)
+	}
+
+	for _, query := range []string{
+		"verbose=maybe&ratio=0.5&count=3",
+		"verbose=true&ratio=half&count=3",
+		"verbose=true&ratio=0.5&count=-3",
+		"verbose=true&ratio=0.5&count=70000",
+	} {
+		resp, err := http.Get(server.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf(`%s: resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, query, resp.StatusCode)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/transfer", ValidateHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		query  string
+		body   string
+		status int
+	}{
+		{"currency=USD", `{"Amount": 5}`, http.StatusNoContent},
+		{"currency=USD", `{"Amount": -5}`, http.StatusBadRequest},
+		{"currency=dollars", `{"Amount": 5}`, http.StatusUnprocessableEntity},
+	} {
+		resp, err := http.Post(server.URL+"/transfer?"+c.query, "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf(`%s %s: resp.StatusCode != %d, resp.StatusCode == "%v"`, c.query, c.body, c.status, resp.StatusCode)
+		}
+	}
+
+	if ValidatedTransfer.Amount != 5 {
+		t.Fatalf(`ValidatedTransfer.Amount != 5, ValidatedTransfer.Amount == "%v"`, ValidatedTransfer.Amount)
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/signup", ValidateTagsHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body := `{"name": "jo", "age": 30, "plan": "pro", "promo": "SPRING"}`
+	resp, err := http.Post(server.URL+"/signup", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if ValidatedSignup.Name != "jo" {
+		t.Fatalf(`ValidatedSignup.Name != "jo", ValidatedSignup.Name == "%v"`, ValidatedSignup.Name)
+	}
+
+	body = `{"age": 12, "plan": "gold", "promo": "spring"}`
+	resp, err = http.Post(server.URL+"/signup", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var result struct {
+		Errors []FieldError `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	expected := []FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "age", Message: "must be at least 18"},
+		{Field: "plan", Message: "must be one of free, pro"},
+		{Field: "promo", Message: "must match ^[A-Z]{3,}$"},
+	}
+	if !reflect.DeepEqual(result.Errors, expected) {
+		t.Fatalf(`result.Errors != %v, result.Errors == "%v"`, expected, result.Errors)
+	}
+}
+
+func TestGeneratedValidateTagsMatchReflection(t *testing.T) {
+	generated := NewServeMux()
+	generated.Handle("/", ShipmentHandler)
+	reflected := NewServeMux()
+	reflected.Handle("/", ReflectionHandler(ShipmentHandler))
+
+	for _, c := range []struct {
+		body   string
+		status int
+	}{
+		{`{"items": [{"sku": "a", "quantity": 1}], "priority": 2, "labels": ["x", ""]}`, http.StatusNoContent},
+		{`{"items": [], "priority": 1, "labels": ["", ""]}`, http.StatusBadRequest},
+		{`{
+			"items": [{"sku": "", "quantity": 0}, {"sku": "a"}],
+			"byDock": {"b": {"quantity": 2}, "a": null},
+			"carrier": {"name": "a very long carrier", "parent": {"parent": {}}},
+			"priority": 4,
+			"weight": 100,
+			"labels": ["x", "y"]
+		}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		generated.ServeHTTP(res, req)
+
+		if res.Code != c.status {
+			t.Fatalf(`%s: res.Code != %d, res.Code == "%v"`, c.body, c.status, res.Code)
+		}
+
+		req = httptest.NewRequest("POST", "/", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		expected := httptest.NewRecorder()
+		reflected.ServeHTTP(expected, req)
+
+		if res.Body.String() != expected.Body.String() {
+			t.Fatalf(`%s: res.Body != %q, res.Body == %q`, c.body, expected.Body.String(), res.Body.String())
+		}
+	}
+}
+
+type lineItem struct {
+	Sku      string `json:"sku" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=1"`
+}
+
+type order struct {
+	Note  string              `json:"note" validate:"max=5"`
+	Items []lineItem          `json:"items" validate:"min=1"`
+	Gifts map[string]lineItem `json:"gifts"`
+}
+
+func TestValidateNested(t *testing.T) {
+	err := ValidateStruct(&order{
+		Note:  "héllo",
+		Items: []lineItem{{Sku: "a", Quantity: 1}, {Quantity: 0}},
+		Gifts: map[string]lineItem{"bo": {Sku: "b"}},
+	})
+
+	expected := ValidationErrors{
+		{Field: "items[1].sku", Message: "is required"},
+		{Field: "items[1].quantity", Message: "must be at least 1"},
+		{Field: "gifts[bo].quantity", Message: "must be at least 1"},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Fatalf(`err != %v, err == "%v"`, expected, err)
+	}
+}
+
+type badRuleBody struct {
+	Name string `validate:"requird"`
+}
+
+type badLimitBody struct {
+	Name string `validate:"max=five"`
+}
+
+type badRegexpBody struct {
+	Count int `validate:"regexp=^[0-9]+$"`
+}
+
+type badSizeBody struct {
+	Items []struct {
+		Done bool `validate:"min=1"`
+	}
+}
+
+type badPatternRequest struct {
+	Body struct {
+		Code string `validate:"regexp=^[A-Z+$"`
+	} `plumbus:"body"`
+}
+
+func TestValidateTagsCheckedWhenRegistered(t *testing.T) {
+	for i, register := range []func(){
+		func() { HandlerFunc(func(b *badRuleBody) {}) },
+		func() { HandlerFunc(func(b *badLimitBody) {}) },
+		func() { HandlerFunc(func(b *badRegexpBody) {}) },
+		func() { HandlerFunc(func(b *badSizeBody) {}) },
+		func() { HandlerFunc(func(r *badPatternRequest) {}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic registering handler %d", i)
+				}
+			}()
+			register()
+		}()
+	}
+
+	err := ValidateStruct(&badRuleBody{})
+	if _, ok := err.(ValidationErrors); ok || err == nil {
+		t.Fatalf(`expected an error that isn't ValidationErrors, err == "%v"`, err)
+	}
+}
+
+func TestCollectParamErrors(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/", KindParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/?verbose=maybe&ratio=half")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var result struct {
+		Errors []FieldError `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	expected := []FieldError{
+		{Field: "verbose", In: "query", Message: "expected to be boolean value"},
+		{Field: "ratio", In: "query", Message: "expected to be number value"},
+		{Field: "count", In: "query", Message: "is required"},
+	}
+	if !reflect.DeepEqual(result.Errors, expected) {
+		t.Fatalf(`result.Errors != %v, result.Errors == "%v"`, expected, result.Errors)
+	}
+}
+
+func TestRawBody(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/webhook", RawBodyHandler)
+	mux.Handle("/proxy", BodyReaderHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/webhook", strings.NewReader(`{"event": "push"}`))
+	req.Header.Set("X-Signature", "abc123")
+	_, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if string(RawBody) != `{"event": "push"}` {
+		t.Fatalf(`RawBody != {"event": "push"}, RawBody == "%s"`, RawBody)
+	}
+
+	if RawBodySignature != "abc123" {
+		t.Fatalf(`RawBodySignature != "abc123", RawBodySignature == "%v"`, RawBodySignature)
+	}
+
+	_, err = http.Post(server.URL+"/proxy", "text/plain", strings.NewReader("not json"))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if BodyReaderContents != "not json" {
+		t.Fatalf(`BodyReaderContents != "not json", BodyReaderContents == "%v"`, BodyReaderContents)
+	}
+}
+
+func TestFormBody(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/contact", FormBodyHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := http.PostForm(server.URL+"/contact", url.Values{
+		"email":   {"a@example.com"},
+		"age":     {"33"},
+		"topic":   {"billing", "support"},
+		"Private": {"true"},
+	})
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	expected := ContactForm{
+		Email:   "a@example.com",
+		Age:     33,
+		Topics:  []string{"billing", "support"},
+		Private: true,
+	}
+	if !reflect.DeepEqual(SubmittedContact, expected) {
+		t.Fatalf(`SubmittedContact != %v, SubmittedContact == "%v"`, expected, SubmittedContact)
+	}
+
+	resp, err := http.PostForm(server.URL+"/contact", url.Values{"age": {"old"}})
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var result struct {
+		Errors []FieldError `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	expectedErrors := []FieldError{
+		{Field: "age", In: "form", Message: "expected to be integer value"},
+		{Field: "email", Message: "is required"},
+	}
+	if !reflect.DeepEqual(result.Errors, expectedErrors) {
+		t.Fatalf(`result.Errors != %v, result.Errors == "%v"`, expectedErrors, result.Errors)
+	}
+}
+
+func TestFormBodyFieldOfStructType(t *testing.T) {
+	type address struct {
+		Street string `json:"street"`
+	}
+	type person struct {
+		Name    string            `json:"name"`
+		Address address           `json:"address"`
+		Labels  map[string]string `json:"labels"`
+		Parts   []*address        `json:"parts"`
+	}
+	var received person
+	mux := NewServeMux()
+	mux.POST("/people", func(body *person) {
+		received = *body
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.PostForm(server.URL+"/people", url.Values{
+		"name":    {"ada"},
+		"address": {"1 Main St"},
+		"labels":  {"x"},
+		"parts":   {"y"},
+	})
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var result struct {
+		Errors []FieldError `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	expectedErrors := []FieldError{
+		{Field: "address", In: "form", Message: "can't be set from a form"},
+		{Field: "labels", In: "form", Message: "can't be set from a form"},
+		{Field: "parts", In: "form", Message: "can't be set from a form"},
+	}
+	if !reflect.DeepEqual(result.Errors, expectedErrors) {
+		t.Fatalf(`result.Errors != %v, result.Errors == "%v"`, expectedErrors, result.Errors)
+	}
+	if received.Name != "" {
+		t.Fatalf(`received.Name != "", received.Name == %q`, received.Name)
+	}
+}
+
+func TestFileUpload(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/upload", UploadHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("caption", "me")
+	part, _ := form.CreateFormFile("avatar", "me.png")
+	part.Write([]byte("not really a png"))
+	form.Close()
+
+	resp, err := http.Post(server.URL+"/upload", form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if UploadedName != "me.png" {
+		t.Fatalf(`UploadedName != "me.png", UploadedName == "%v"`, UploadedName)
+	}
+
+	if UploadedContents != "not really a png" {
+		t.Fatalf(`UploadedContents != "not really a png", UploadedContents == "%v"`, UploadedContents)
+	}
+
+	if UploadedCaption != "me" {
+		t.Fatalf(`UploadedCaption != "me", UploadedCaption == "%v"`, UploadedCaption)
+	}
+
+	body.Reset()
+	form = multipart.NewWriter(&body)
+	form.WriteField("caption", "nobody")
+	form.Close()
+
+	resp, err = http.Post(server.URL+"/upload", form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	mux := NewServeMux()
+	mux.Use(MaxBodyBytes(32))
+	mux.Handle("/message", RequestBodyHandler)
+	mux.Handle("/webhook", RawBodyHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body := `{"Message": "short"}`
+	resp, err := http.Post(server.URL+"/message", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	body = `{"Message": "this message is much too long to be accepted"}`
+	resp, err = http.Post(server.URL+"/message", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf(`resp.StatusCode != http.StatusRequestEntityTooLarge, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	//without a content length, the limit is hit while reading
+	req, _ := http.NewRequest("POST", server.URL+"/webhook", io.MultiReader(strings.NewReader(body)))
+	req.Header.Set("X-Signature", "abc123")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf(`resp.StatusCode != http.StatusRequestEntityTooLarge, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestBodyContentTypes(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/message", RequestBodyHandler)
+	mux.Handle("/contact", FormBodyHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body := `{"Message": "hi"}`
+	resp, err := http.Post(server.URL+"/message", "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf(`resp.StatusCode != http.StatusUnsupportedMediaType, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/message", "application/json; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	mux.SetBodyContentTypes("application/json")
+
+	resp, err = http.PostForm(server.URL+"/contact", url.Values{"email": {"a@example.com"}})
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf(`resp.StatusCode != http.StatusUnsupportedMediaType, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder("application/xml", func(body io.Reader, dst interface{}) error {
+		return xml.NewDecoder(body).Decode(dst)
+	})
+
+	mux := NewServeMux()
+	mux.Handle("/message", RequestBodyHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body := `<RequestBodyBody><Message>from xml</Message></RequestBodyBody>`
+	resp, err := http.Post(server.URL+"/message", "application/xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if RequestBodyMessage != "from xml" {
+		t.Fatalf(`RequestBodyMessage != "from xml", RequestBodyMessage == "%v"`, RequestBodyMessage)
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder("application/xml", func(w io.Writer, v interface{}) error {
+		return xml.NewEncoder(w).Encode(v)
+	})
+
+	mux := NewServeMux()
+	mux.Handle("/", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"", http.StatusOK, "application/json", `{"Message":"Victory!"}` + "\n"},
+		{"application/xml", http.StatusOK, "application/xml", `<ReturnStructResult><Message>Victory!</Message></ReturnStructResult>`},
+		{"application/xml;q=0.5, application/json", http.StatusOK, "application/json", `{"Message":"Victory!"}` + "\n"},
+		{"text/html, */*;q=0.1", http.StatusOK, "application/json", `{"Message":"Victory!"}` + "\n"},
+		{"text/html", http.StatusNotAcceptable, "", ""},
+	} {
+		req, _ := http.NewRequest("GET", server.URL+"/", nil)
+		req.Header.Set("Accept", c.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf(`%s: resp.StatusCode != %d, resp.StatusCode == "%v"`, c.accept, c.status, resp.StatusCode)
+		}
+
+		if c.status != http.StatusOK {
+			continue
+		}
+
+		if contentType := resp.Header.Get("Content-Type"); contentType != c.contentType {
+			t.Fatalf(`%s: contentType != %q, contentType == "%v"`, c.accept, c.contentType, contentType)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != c.body {
+			t.Fatalf(`%s: body != %q, body == "%s"`, c.accept, c.body, body)
+		}
+	}
+}
+
+func TestMsgpack(t *testing.T) {
+	msgpack.Register()
+
+	mux := NewServeMux()
+	mux.Handle("/message", RequestBodyHandler)
+	mux.Handle("/result", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body, _ := vmsgpack.Marshal(RequestBodyBody{Message: "packed"})
+	resp, err := http.Post(server.URL+"/message", msgpack.MediaType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if RequestBodyMessage != "packed" {
+		t.Fatalf(`RequestBodyMessage != "packed", RequestBodyMessage == "%v"`, RequestBodyMessage)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/result", nil)
+	req.Header.Set("Accept", msgpack.MediaType)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var result ReturnStructResult
+	if err := vmsgpack.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decoding msgpack: %v\n", err)
+	}
+
+	if result.Message != "Victory!" {
+		t.Fatalf(`result.Message != "Victory!", result.Message == "%v"`, result.Message)
+	}
+}
+
+func TestProtobuf(t *testing.T) {
+	protobuf.Register()
+
+	mux := NewServeMux()
+	mux.Handle("/shout", func(msg *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String(strings.ToUpper(msg.GetValue())), nil
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	body, _ := proto.Marshal(wrapperspb.String("packed"))
+	req, _ := http.NewRequest("POST", server.URL+"/shout", bytes.NewReader(body))
+	req.Header.Set("Content-Type", protobuf.MediaType)
+	req.Header.Set("Accept", protobuf.MediaType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != protobuf.MediaType {
+		t.Fatalf(`contentType != %q, contentType == "%v"`, protobuf.MediaType, contentType)
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	var result wrapperspb.StringValue
+	if err := proto.Unmarshal(data, &result); err != nil {
+		t.Fatalf("decoding protobuf: %v\n", err)
+	}
+
+	if result.GetValue() != "PACKED" {
+		t.Fatalf(`result.Value != "PACKED", result.Value == "%v"`, result.GetValue())
+	}
+
+	resp, err = http.Post(server.URL+"/shout", "application/json", strings.NewReader(`"json"`))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	data, _ = io.ReadAll(resp.Body)
+	if strings.TrimSpace(string(data)) != `"JSON"` {
+		t.Fatalf(`body != "JSON", body == %q`, data)
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	registry := prom.NewRegistry()
+	mux := NewServeMux()
+	if err := prometheus.Instrument(mux, registry); err != nil {
+		t.Fatalf("instrumenting mux: %v\n", err)
+	}
+	prometheus.Mount(mux, "/metrics", registry)
+	mux.Handle("/user/:userId/name", PathParamsHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, path := range []string{"/user/12/name", "/user/13/name", "/nachos"} {
+		if _, err := http.Get(server.URL + path); err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	for _, expected := range []string{
+		`http_requests_total{method="GET",route="/user/:userId/name",status="204"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Fatalf("metrics don't contain %q, metrics == %q", expected, body)
+		}
+	}
+
+	if strings.Contains(string(body), "/user/12/name") {
+		t.Fatalf("metrics are labeled by path, metrics == %q", body)
+	}
+}
+
+func TestRegisterCodecsWhileServing(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/echo", func(body *ReturnStructResult) *ReturnStructResult {
+		return body
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			mediaType := fmt.Sprintf("application/x-test-%d", i)
+			RegisterDecoder(mediaType, func(body io.Reader, dst interface{}) error {
+				return json.NewDecoder(body).Decode(dst)
+			})
+			RegisterEncoder(mediaType, func(w io.Writer, v interface{}) error {
+				return json.NewEncoder(w).Encode(v)
+			})
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		req := httptest.NewRequest("POST", "/echo", strings.NewReader(`{"message":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/x-test-0, application/json;q=0.5")
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			t.Fatalf(`res.Code != http.StatusOK, res.Code == "%v"`, res.Code)
+		}
+	}
+	<-done
+}
+
+func TestCSV(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/export", ExportHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/export", nil)
+	req.Header.Set("Accept", "text/csv")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/csv" {
+		t.Fatalf(`contentType != "text/csv", contentType == "%v"`, contentType)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := "id,full_name,created,Note\n" +
+		"1,Ann,2020-01-02T03:04:05Z,\"a, note\"\n" +
+		"2,Bo,2020-01-02T03:04:05Z,\n"
+	if string(body) != expected {
+		t.Fatalf(`body != %q, body == %q`, expected, body)
+	}
+}
+
+func TestNegotiateSkipsEncodersForOtherBodies(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/export", ExportHandler)
+	mux.Handle("/struct", ReturnStructHandler)
+
+	for _, c := range []struct {
+		path        string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"/export", "text/*", http.StatusOK, "text/csv"},
+		{"/struct", "text/*", http.StatusNotAcceptable, ""},
+		{"/struct", "text/csv", http.StatusNotAcceptable, ""},
+		{"/struct", "text/csv, application/json;q=0.5", http.StatusOK, "application/json"},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept", c.accept)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != c.status {
+			t.Fatalf(`%s %s: res.Code != %d, res.Code == "%v"`, c.path, c.accept, c.status, res.Code)
+		}
+		if c.contentType != "" && res.Header().Get("Content-Type") != c.contentType {
+			t.Fatalf(`%s %s: Content-Type != %q, Content-Type == %q`, c.path, c.accept, c.contentType, res.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestTextResponses(t *testing.T) {
+	mux := NewServeMux()
+	mux.GET("/method", RequestMethodHandler)
+	mux.Handle("/ping", TextHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for path, expected := range map[string]string{
+		"/method": "nachos",
+		"/ping":   "pong",
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if contentType := resp.Header.Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+			t.Fatalf(`%s: contentType != "text/plain; charset=utf-8", contentType == "%v"`, path, contentType)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != expected {
+			t.Fatalf(`%s: body != %q, body == %q`, path, expected, body)
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	mux := NewServeMux()
+	mux.SetEnvelope(func(req *http.Request, body interface{}) interface{} {
+		return map[string]interface{}{
+			"data": body,
+			"meta": map[string]interface{}{"path": req.URL.Path},
+		}
+	})
+	mux.SetErrorEnvelope(func(req *http.Request, err HTTPError) interface{} {
+		return map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    err.ResponseCode(),
+				"message": err.Error(),
+			},
+		}
+	})
+	mux.Handle("/result", ReturnStructHandler)
+	mux.Handle("/error", ReturnErrorHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/result")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var result struct {
+		Data ReturnStructResult
+		Meta struct{ Path string }
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Data.Message != "Victory!" {
+		t.Fatalf(`result.Data.Message != "Victory!", result.Data.Message == "%v"`, result.Data.Message)
+	}
+	if result.Meta.Path != "/result" {
+		t.Fatalf(`result.Meta.Path != "/result", result.Meta.Path == "%v"`, result.Meta.Path)
+	}
+
+	resp, err = http.Get(server.URL + "/error")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var errResult struct {
+		Error struct {
+			Code    int
+			Message string
+		}
+	}
+	json.NewDecoder(resp.Body).Decode(&errResult)
+	if errResult.Error.Code != http.StatusBadRequest || errResult.Error.Message != "result" {
+		t.Fatalf(`errResult.Error != {400 result}, errResult.Error == "%v"`, errResult.Error)
+	}
+}
+
+func TestStatusCoder(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/job", StartJobHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/job", "application/json", nil)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf(`resp.StatusCode != http.StatusAccepted, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	if job.Id != "job-1" {
+		t.Fatalf(`job.Id != "job-1", job.Id == "%v"`, job.Id)
+	}
+}
+
+func TestStatusReturn(t *testing.T) {
+	mux := NewServeMux()
+	mux.POST("/widget", CreateWidgetHandler)
+	mux.GET("/dynamic", func() (int, string, error) {
+		return http.StatusAccepted, "accepted", nil
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/widget", "application/json", strings.NewReader(`{"name":"sprocket"}`))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf(`resp.StatusCode != http.StatusCreated, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var widget Widget
+	json.NewDecoder(resp.Body).Decode(&widget)
+	if widget.Name != "sprocket" {
+		t.Fatalf(`widget.Name != "sprocket", widget.Name == "%v"`, widget.Name)
+	}
+
+	resp, err = http.Post(server.URL+"/widget", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/dynamic")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf(`resp.StatusCode != http.StatusAccepted, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestIntResultIsBody(t *testing.T) {
+	mux := NewServeMux()
+	mux.GET("/generated", CountWidgetsHandler)
+	mux.GET("/reflected", func() (int, error) {
+		return 5, nil
+	})
+	mux.GET("/invalid", func() (int, string, error) {
+		return 5, "five", nil
+	})
+
+	for _, c := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/generated", http.StatusOK, "5\n"},
+		{"/reflected", http.StatusOK, "5\n"},
+		{"/invalid", http.StatusInternalServerError, "internal server error"},
+	} {
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest("GET", c.path, nil))
+		if res.Code != c.status {
+			t.Fatalf(`%s: res.Code != %d, res.Code == "%v"`, c.path, c.status, res.Code)
+		}
+		if !strings.Contains(res.Body.String(), c.body) {
+			t.Fatalf(`%s: body doesn't contain %q, body == "%v"`, c.path, c.body, res.Body.String())
+		}
+	}
+}
+
+func TestHeadersResult(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/cached", CachedHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/cached")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if cacheControl := resp.Header.Get("Cache-Control"); cacheControl != "max-age=60" {
+		t.Fatalf(`cacheControl != "max-age=60", cacheControl == "%v"`, cacheControl)
+	}
+
+	if requestId := resp.Header.Get("X-Request-Id"); requestId != "abc" {
+		t.Fatalf(`requestId != "abc", requestId == "%v"`, requestId)
+	}
+
+	var result ReturnStructResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Message != "cached" {
+		t.Fatalf(`result.Message != "cached", result.Message == "%v"`, result.Message)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/login", RedirectHandler)
+	mux.Handle("/bad", func() Redirect {
+		return Redirect{URL: "/home", Code: http.StatusOK}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(server.URL + "/login?next=/home")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf(`resp.StatusCode != http.StatusSeeOther, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); location != "/home" {
+		t.Fatalf(`location != "/home", location == "%v"`, location)
+	}
+
+	resp, err = client.Get(server.URL + "/bad")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf(`resp.StatusCode != http.StatusInternalServerError, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestCreated(t *testing.T) {
+	mux := NewServeMux()
+	mux.POST("/widgets", CreateHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/widgets", "application/json", strings.NewReader(`{"name":"gear"}`))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf(`resp.StatusCode != http.StatusCreated, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if location := resp.Header.Get("Location"); location != "/widgets/gear" {
+		t.Fatalf(`location != "/widgets/gear", location == "%v"`, location)
+	}
+
+	var widget Widget
+	json.NewDecoder(resp.Body).Decode(&widget)
+	if widget.Name != "gear" {
+		t.Fatalf(`widget.Name != "gear", widget.Name == "%v"`, widget.Name)
+	}
+}
+
+func TestEmptyResponseCode(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/params", OptionalRequestParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/params")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != http.StatusNoContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	mux.SetEmptyResponseCode(http.StatusOK)
+	resp, err = http.Get(server.URL + "/params")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf(`resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/stream", StreamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	StreamClosed = false
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/plain" {
+		t.Fatalf(`contentType != "text/plain", contentType == "%v"`, contentType)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "streamed body" {
+		t.Fatalf(`body != "streamed body", body == %q`, body)
+	}
+
+	if !StreamClosed {
+		t.Fatalf("expected the stream to be closed")
+	}
+}
+
+func TestFileResponse(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/download", DownloadHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/download", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf(`resp.StatusCode != http.StatusPartialContent, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != "attachment; filename=report.txt" {
+		t.Fatalf(`disposition != "attachment; filename=report.txt", disposition == "%v"`, disposition)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello" {
+		t.Fatalf(`body != "hello", body == %q`, body)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected an ETag")
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/download", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf(`resp.StatusCode != http.StatusNotModified, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	files := fstest.MapFS{
+		"layouts/base.html": &fstest.MapFile{Data: []byte(`<h1>{{.Title}}</h1>{{template "content" .}}`)},
+		"pages/page.html":   &fstest.MapFile{Data: []byte(`{{define "content"}}<p>{{.Title}}</p>{{end}}`)},
+	}
+
+	mux := NewServeMux()
+	err := mux.SetTemplates(&Templates{
+		FS:      files,
+		Pages:   "pages/*.html",
+		Layouts: "layouts/*.html",
+		Layout:  "base.html",
+		Reload:  true,
+	})
+	if err != nil {
+		t.Fatalf("setting templates: %v\n", err)
+	}
+	mux.Handle("/page", RenderHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/page?title=<admin>")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Fatalf(`contentType != "text/html; charset=utf-8", contentType == "%v"`, contentType)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := "<h1>&lt;admin&gt;</h1><p>&lt;admin&gt;</p>"
+	if string(body) != expected {
+		t.Fatalf(`body != %q, body == %q`, expected, body)
+	}
+
+	files["pages/page.html"] = &fstest.MapFile{Data: []byte(`{{define "content"}}reloaded{{end}}`)}
+	resp, err = http.Get(server.URL + "/page?title=admin")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	body, _ = io.ReadAll(resp.Body)
+	if string(body) != "<h1>admin</h1>reloaded" {
+		t.Fatalf(`body != "<h1>admin</h1>reloaded", body == %q`, body)
+	}
+}
+
+func TestChannelResponse(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/countdown", CountdownHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/countdown")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Fatalf(`contentType != "application/x-ndjson", contentType == "%v"`, contentType)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := "{\"Message\":\"3\"}\n{\"Message\":\"2\"}\n{\"Message\":\"1\"}\n"
+	if string(body) != expected {
+		t.Fatalf(`body != %q, body == %q`, expected, body)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	mux := NewServeMux()
+	mux.SetEventHeartbeat(10 * time.Millisecond)
+	mux.Handle("/events", EventsHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf(`contentType != "text/event-stream", contentType == "%v"`, contentType)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := "id: 1\nevent: greeting\ndata: hello\ndata: world\n\n" +
+		"id: 2\ndata: {\"Message\":\"json\"}\n\n" +
+		": heartbeat\n\n"
+	if !strings.HasPrefix(string(body), expected) {
+		t.Fatalf(`body doesn't start with %q, body == %q`, expected, body)
+	}
+}
+
+func TestEventLineBreaks(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/events", func() EventStream {
+		events := make(chan Event, 2)
+		events <- Event{Data: "one\rtwo\r\nthree\n\nid: 9"}
+		events <- Event{Type: "update\ndata: injected", Data: "x"}
+		close(events)
+		return events
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := "data: one\ndata: two\ndata: three\ndata: \ndata: id: 9\n\n" +
+		"event: updatedata: injected\ndata: x\n\n"
+	if string(body) != expected {
+		t.Fatalf(`body != %q, body == %q`, expected, body)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/rooms/:room", EchoHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/rooms/lobby"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dialing websocket: %v\n", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatalf("writing message: %v\n", err)
+	}
+
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("reading message: %v\n", err)
+	}
+
+	if string(message) != "lobby: hi" {
+		t.Fatalf(`message != "lobby: hi", message == %q`, message)
+	}
+
+	resp, err := http.Get(server.URL + "/rooms/lobby")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+}
+
+func TestETags(t *testing.T) {
+	mux := NewServeMux()
+	mux.SetETags(true)
+	mux.Handle("/document", DocumentHandler)
+	mux.Handle("/result", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for path, expected := range map[string]string{
+		"/document": `"v3"`,
+		"/result":   "",
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		etag := resp.Header.Get("ETag")
+		if etag == "" || (expected != "" && etag != expected) {
+			t.Fatalf(`%s: etag != %q, etag == %q`, path, expected, etag)
+		}
+
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Header.Set("If-None-Match", "W/"+etag)
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != http.StatusNotModified {
+			t.Fatalf(`%s: resp.StatusCode != http.StatusNotModified, resp.StatusCode == "%v"`, path, resp.StatusCode)
+		}
+
+		req.Header.Set("If-None-Match", `"stale"`)
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf(`%s: resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, path, resp.StatusCode)
+		}
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/countries", CountriesHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/countries")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	lastModified := resp.Header.Get("Last-Modified")
+	if lastModified != "Thu, 02 Jan 2020 03:04:05 GMT" {
+		t.Fatalf(`lastModified != "Thu, 02 Jan 2020 03:04:05 GMT", lastModified == "%v"`, lastModified)
+	}
+
+	for since, status := range map[string]int{
+		lastModified:                    http.StatusNotModified,
+		"Fri, 03 Jan 2020 00:00:00 GMT": http.StatusNotModified,
+		"Wed, 01 Jan 2020 00:00:00 GMT": http.StatusOK,
+	} {
+		req, _ := http.NewRequest("GET", server.URL+"/countries", nil)
+		req.Header.Set("If-Modified-Since", since)
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != status {
+			t.Fatalf(`%s: resp.StatusCode != %d, resp.StatusCode == "%v"`, since, status, resp.StatusCode)
+		}
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/result", ReturnStructHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pretty := "{\n  \"Message\": \"Victory!\"\n}\n"
+	compact := "{\"Message\":\"Victory!\"}\n"
+	for _, c := range []struct {
+		query    string
+		setting  bool
+		expected string
+	}{
+		{"", false, compact},
+		{"?pretty=1", false, pretty},
+		{"", true, pretty},
+		{"?pretty=0", true, compact},
+	} {
+		mux.SetPrettyJSON(c.setting)
+		resp, err := http.Get(server.URL + "/result" + c.query)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != c.expected {
+			t.Fatalf(`%q %v: body != %q, body == %q`, c.query, c.setting, c.expected, body)
+		}
+	}
+}
+
+type countingEncoder struct {
+	JSONEncoder
+	count *int
+}
+
+func (c countingEncoder) Encode(v interface{}) error {
+	*c.count++
+	return c.JSONEncoder.Encode(v)
+}
+
+func TestJSONSettings(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/html", func() map[string]string {
+		return map[string]string{"html": "<b>"}
+	})
+
+	encoded := 0
+	mux.SetJSONEncoder(func(w io.Writer) JSONEncoder {
+		return countingEncoder{json.NewEncoder(w), &encoded}
+	})
+	mux.SetJSONEscapeHTML(false)
+	mux.SetJSONIndent("\t")
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/html?pretty=1")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := "{\n\t\"html\": \"<b>\"\n}\n"
+	if string(body) != expected {
+		t.Fatalf(`body != %q, body == %q`, expected, body)
+	}
+
+	if encoded != 1 {
+		t.Fatalf(`encoded != 1, encoded == "%v"`, encoded)
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	mux := NewServeMux()
+	mux.SetErrorFormat(ErrorProblemJSON)
+	mux.Handle("/error", ReturnErrorHandler)
+	mux.Handle("/signup", ValidateTagsHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/error")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf(`contentType != "application/problem+json", contentType == "%v"`, contentType)
+	}
+
+	var problem Problem
+	json.NewDecoder(resp.Body).Decode(&problem)
+	expected := Problem{
+		Type:     "about:blank",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   "result",
+		Instance: "/error",
+	}
+	if !reflect.DeepEqual(problem, expected) {
+		t.Fatalf(`problem != %+v, problem == %+v`, expected, problem)
+	}
+
+	resp, err = http.Post(server.URL+"/signup", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	problem = Problem{}
+	json.NewDecoder(resp.Body).Decode(&problem)
+	if problem.Status != http.StatusBadRequest || len(problem.Errors) == 0 {
+		t.Fatalf(`expected a 400 problem with errors, problem == %+v`, problem)
+	}
+}
+
+func TestStructuredError(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/user", func() (*ReturnStructResult, error) {
+		return nil, NewError(http.StatusNotFound).
+			Code("USER_NOT_FOUND").
+			Detail("no user with id 7").
+			Meta(map[string]interface{}{"id": 7})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/user")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf(`resp.StatusCode != http.StatusNotFound, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := `{"code":"USER_NOT_FOUND","detail":"no user with id 7","error":"Not Found","meta":{"id":7}}` + "\n"
+	if string(body) != expected {
+		t.Fatalf(`body != %q, body == %q`, expected, body)
+	}
+
+	mux.SetErrorFormat(ErrorProblemJSON)
+	resp, err = http.Get(server.URL + "/user")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var problem Problem
+	json.NewDecoder(resp.Body).Decode(&problem)
+	if problem.Code != "USER_NOT_FOUND" || problem.Detail != "no user with id 7" {
+		t.Fatalf(`problem.Code, problem.Detail != "USER_NOT_FOUND", "no user with id 7", problem == %+v`, problem)
+	}
+}
+
+func TestWrappedHTTPError(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/user", func() (*ReturnStructResult, error) {
+		return nil, fmt.Errorf("loading user: %w", Errorf(http.StatusNotFound, "no such user"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/user")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf(`resp.StatusCode != http.StatusNotFound, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"error":"no such user"}`+"\n" {
+		t.Fatalf(`body != {"error":"no such user"}, body == %q`, body)
+	}
+}
+
+type lookupError struct {
+	key string
+}
+
+func (le *lookupError) Error() string {
+	return "nothing at " + le.key
+}
+
+func TestMapError(t *testing.T) {
+	mux := NewServeMux()
+	mux.MapError(context.DeadlineExceeded, http.StatusGatewayTimeout)
+	mux.MapErrorType(&lookupError{}, http.StatusNotFound)
+	mux.Handle("/slow", func() (*ReturnStructResult, error) {
+		return nil, fmt.Errorf("querying: %w", context.DeadlineExceeded)
+	})
+	mux.Handle("/missing", func() (*ReturnStructResult, error) {
+		return nil, fmt.Errorf("loading: %w", &lookupError{key: "users/7"})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/slow", http.StatusGatewayTimeout, `{"error":"context deadline exceeded"}` + "\n"},
+		{"/missing", http.StatusNotFound, `{"error":"nothing at users/7"}` + "\n"},
+	} {
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf(`%s: resp.StatusCode != %d, resp.StatusCode == "%v"`, c.path, c.status, resp.StatusCode)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != c.body {
+			t.Fatalf(`%s: body != %q, body == %q`, c.path, c.body, body)
+		}
+	}
+}
+
+func TestMountedErrorSettings(t *testing.T) {
+	mux := NewServeMux()
+	mux.MapError(context.DeadlineExceeded, http.StatusGatewayTimeout)
+
+	teapot := NewServeMux()
+	teapot.SetErrorHandler(func(res http.ResponseWriter, req *http.Request, err error) {
+		res.WriteHeader(http.StatusTeapot)
+	})
+	teapot.Handle("/error", ReturnErrorHandler)
+	mux.Mount("/teapot", teapot)
+
+	mapped := NewServeMux()
+	mapped.MapErrorType(&lookupError{}, http.StatusNotFound)
+	mapped.Handle("/missing", func() (*ReturnStructResult, error) {
+		return nil, fmt.Errorf("loading: %w", &lookupError{key: "users/7"})
+	})
+	mapped.Handle("/slow", func() (*ReturnStructResult, error) {
+		return nil, fmt.Errorf("querying: %w", context.DeadlineExceeded)
+	})
+	mux.Mount("/mapped", mapped)
+
+	enveloped := NewServeMux()
+	enveloped.SetEnvelope(func(req *http.Request, body interface{}) interface{} {
+		return map[string]interface{}{"data": body}
+	})
+	enveloped.SetErrorEnvelope(func(req *http.Request, err HTTPError) interface{} {
+		return map[string]interface{}{"problem": err.Error()}
+	})
+	enveloped.Handle("/value", func() ([]int, error) { return []int{1}, nil })
+	enveloped.Handle("/error", func() (*ReturnStructResult, error) {
+		return nil, Error(http.StatusConflict, "taken")
+	})
+	mux.Mount("/enveloped", enveloped)
+
+	for _, c := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/teapot/error", http.StatusTeapot, ""},
+		{"/mapped/missing", http.StatusNotFound, `{"error":"nothing at users/7"}` + "\n"},
+		{"/mapped/slow", http.StatusGatewayTimeout, `{"error":"context deadline exceeded"}` + "\n"},
+		{"/enveloped/value", http.StatusOK, `{"data":[1]}` + "\n"},
+		{"/enveloped/error", http.StatusConflict, `{"problem":"taken"}` + "\n"},
+	} {
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest("GET", c.path, nil))
+		if res.Code != c.status {
+			t.Fatalf(`%s: res.Code != %d, res.Code == "%v"`, c.path, c.status, res.Code)
+		}
+		if res.Body.String() != c.body {
+			t.Fatalf(`%s: body != %q, body == %q`, c.path, c.body, res.Body.String())
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	mux := NewServeMux()
+	var handled error
+	mux.SetErrorHandler(func(res http.ResponseWriter, req *http.Request, err error) {
+		handled = err
+		if httperr, ok := err.(HTTPError); ok && httperr.ResponseCode() == http.StatusBadRequest {
+			res.WriteHeader(http.StatusTeapot)
+			return
+		}
+		WriteError(res, req, err)
+	})
+	mux.Handle("/error", ReturnErrorHandler)
+	mux.Handle("/params", RequiredRequestParamHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/error")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusTeapot {
+		t.Fatalf(`resp.StatusCode != http.StatusTeapot, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if handled == nil || handled.Error() != "result" {
+		t.Fatalf(`handled != "result", handled == "%v"`, handled)
+	}
+
+	resp, err = http.Get(server.URL + "/params")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if _, ok := handled.(ValidationErrors); !ok {
+		t.Fatalf(`expected ValidationErrors, handled == "%v"`, handled)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/panic", func() *ReturnStructResult {
+		panic("boom")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf(`resp.StatusCode != http.StatusInternalServerError, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	var recovered interface{}
+	var stack []byte
+	mux.SetPanicHandler(func(res http.ResponseWriter, req *http.Request, r interface{}, s []byte) {
+		recovered, stack = r, s
+		res.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	resp, err = http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf(`resp.StatusCode != http.StatusServiceUnavailable, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if recovered != "boom" || len(stack) == 0 {
+		t.Fatalf(`recovered != "boom", recovered == "%v"`, recovered)
+	}
+}
+
+type stackedError struct {
+	error
+}
+
+func (se stackedError) Stack() []byte {
+	return []byte("main.go:12\nmain.go:40")
+}
+
+func TestDebugErrors(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/fail", func() (*ReturnStructResult, error) {
+		return nil, errors.New("database is on fire")
+	})
+	mux.Handle("/stacked", func() (*ReturnStructResult, error) {
+		return nil, fmt.Errorf("saving: %w", stackedError{errors.New("database is on fire")})
+	})
+	mux.Handle("/panic", func() {
+		panic("database is on fire")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		path    string
+		debug   bool
+		message string
+		stack   bool
+	}{
+		{"/fail", false, "internal server error", false},
+		{"/fail", true, "database is on fire", false},
+		{"/stacked", true, "saving: database is on fire", true},
+		{"/panic", false, "internal server error", false},
+		{"/panic", true, "panic: database is on fire", true},
+	} {
+		mux.SetDebug(c.debug)
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf(`resp.StatusCode != http.StatusInternalServerError, resp.StatusCode == "%v"`, resp.StatusCode)
+		}
+
+		var body struct {
+			Error string
+			Stack []string
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+
+		if body.Error != c.message {
+			t.Fatalf(`%s debug %v: body.Error != %q, body.Error == %q`, c.path, c.debug, c.message, body.Error)
+		}
+
+		if c.stack != (len(body.Stack) > 0) {
+			t.Fatalf(`%s debug %v: len(body.Stack) == %d`, c.path, c.debug, len(body.Stack))
+		}
+	}
+}
+
+func TestErrorID(t *testing.T) {
+	mux := NewServeMux()
+	var hookID string
+	var hookErr error
+	mux.SetErrorIDHook(func(req *http.Request, id string, err error) {
+		hookID, hookErr = id, err
+	})
+	mux.Handle("/fail", func() (*ReturnStructResult, error) {
+		return nil, errors.New("database is on fire")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/fail")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	var body struct {
+		Error   string
+		ErrorID string `json:"error_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	if body.ErrorID == "" || body.ErrorID != hookID {
+		t.Fatalf(`body.ErrorID != hookID, body.ErrorID == %q, hookID == %q`, body.ErrorID, hookID)
+	}
+
+	if hookErr == nil || hookErr.Error() != "database is on fire" {
+		t.Fatalf(`hookErr != "database is on fire", hookErr == "%v"`, hookErr)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	at := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	mux := NewServeMux()
+	mux.Handle("/limited", func() (*ReturnStructResult, error) {
+		return nil, ErrorRetryAfter(http.StatusTooManyRequests, 1500*time.Millisecond, "slow down")
+	})
+	mux.Handle("/maintenance", func() (*ReturnStructResult, error) {
+		return nil, ErrorRetryAt(http.StatusServiceUnavailable, at, "down for maintenance")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		path       string
+		status     int
+		retryAfter string
+	}{
+		{"/limited", http.StatusTooManyRequests, "2"},
+		{"/maintenance", http.StatusServiceUnavailable, "Wed, 02 Jan 2030 03:04:05 GMT"},
+	} {
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf(`%s: resp.StatusCode != %d, resp.StatusCode == "%v"`, c.path, c.status, resp.StatusCode)
+		}
+
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != c.retryAfter {
+			t.Fatalf(`%s: retryAfter != %q, retryAfter == %q`, c.path, c.retryAfter, retryAfter)
+		}
+	}
+}
+
+type accountIdPathParam string
+
+func TestIntercept(t *testing.T) {
+	var called []string
+	mux := NewServeMux()
+	mux.Intercept(OrderInterceptor)
+	mux.Intercept(func(req *http.Request, accountId accountIdPathParam) error {
+		if req.Header.Get("Account") != string(accountId) {
+			return Error(http.StatusForbidden, "wrong account")
+		}
+		return nil
+	})
+	mux.Handle("/order/:orderId", PathParamHandler)
+	mux.Handle("/account/:accountId", func(accountId accountIdPathParam) {
+		called = append(called, string(accountId))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		path    string
+		account string
+		status  int
+	}{
+		{"/order/12", "", http.StatusNoContent},
+		{"/order/120", "", http.StatusForbidden},
+		{"/account/abc", "abc", http.StatusNoContent},
+		{"/account/abc", "xyz", http.StatusForbidden},
+	} {
+		req, _ := http.NewRequest("GET", server.URL+c.path, nil)
+		req.Header.Set("Account", c.account)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+		if resp.StatusCode != c.status {
+			t.Fatalf(`%s: resp.StatusCode != %d, resp.StatusCode == "%v"`, c.path, c.status, resp.StatusCode)
+		}
+	}
+
+	if PathParamOrderId != 12 {
+		t.Fatalf(`PathParamOrderId != 12, PathParamOrderId == "%v"`, PathParamOrderId)
+	}
+
+	if !reflect.DeepEqual(called, []string{"abc"}) {
+		t.Fatalf(`called != ["abc"], called == "%v"`, called)
+	}
+}
+
+func TestInterceptInterfacePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic intercepting an interface type")
+		}
+	}()
+	NewServeMux().Intercept(func(req *http.Request, s fmt.Stringer) error { return nil })
+}
+
+func TestInterceptNestedMuxes(t *testing.T) {
+	var order []string
+	deny := func(name string) func(*http.Request, accountIdPathParam) error {
+		return func(req *http.Request, accountId accountIdPathParam) error {
+			order = append(order, name)
+			if req.Header.Get("Account") != string(accountId) {
+				return Error(http.StatusForbidden, name+": wrong account")
+			}
+			return nil
+		}
+	}
+	handler := func(accountId accountIdPathParam) {}
+
+	billing := NewServeMux()
+	billing.Intercept(deny("billing"))
+	billing.Handle("/account/:accountId", handler)
+
+	mux := NewServeMux()
+	mux.Intercept(deny("mux"))
+	mux.Mount("/billing", billing)
+	api := mux.Host("api.example.com")
+	api.Intercept(deny("api"))
+	api.Handle("/account/:accountId", handler)
+
+	for _, c := range []struct {
+		url     string
+		account string
+		status  int
+		order   []string
+	}{
+		{"http://example.com/billing/account/abc", "abc", http.StatusNoContent, []string{"mux", "billing"}},
+		{"http://example.com/billing/account/abc", "xyz", http.StatusForbidden, []string{"mux"}},
+		{"http://api.example.com/account/abc", "abc", http.StatusNoContent, []string{"mux", "api"}},
+		{"http://api.example.com/account/abc", "xyz", http.StatusForbidden, []string{"mux"}},
+	} {
+		order = nil
+		req := httptest.NewRequest("GET", c.url, nil)
+		req.Header.Set("Account", c.account)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		if res.Code != c.status {
+			t.Fatalf(`%s: res.Code != %d, res.Code == "%v"`, c.url, c.status, res.Code)
+		}
+
+		if !reflect.DeepEqual(order, c.order) {
+			t.Fatalf(`%s: order != %v, order == "%v"`, c.url, c.order, order)
+		}
+	}
+
+	// the mounted and host muxes' own interceptors deny requests that
+	// the outer mux lets through
+	mux = NewServeMux()
+	mux.Mount("/billing", billing)
+	mux.Host("api.example.com").Intercept(deny("api"))
+	mux.Host("api.example.com").Handle("/account/:accountId", handler)
+	for _, url := range []string{"http://example.com/billing/account/abc", "http://api.example.com/account/abc"} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Account", "xyz")
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		if res.Code != http.StatusForbidden {
+			t.Fatalf(`%s: res.Code != http.StatusForbidden, res.Code == "%v"`, url, res.Code)
+		}
+	}
+}
+
+func TestAfterResponse(t *testing.T) {
+	var infos []ResponseInfo
+	mux := NewServeMux()
+	mux.AfterResponse(func(req *http.Request, info ResponseInfo) {
+		infos = append(infos, info)
+	})
+	mux.GET("/method", ReturnStructHandler)
+	mux.PUT("/method", RequestMethodHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, path := range []string{"/method", "/missing"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf(`len(infos) != 2, len(infos) == %d`, len(infos))
+	}
+
+	found := infos[0]
+	if found.Route.Pattern != "/method" || found.Route.Method != "GET" {
+		t.Fatalf(`found.Route != GET /method, found.Route == %s %s`, found.Route.Method, found.Route.Pattern)
+	}
+
+	if found.Route.Handler != "github.com/jargv/plumbus/tests/handlers.ReturnStructHandler" {
+		t.Fatalf(`unexpected handler name %q`, found.Route.Handler)
+	}
+
+	if found.Status != http.StatusOK || found.BytesWritten == 0 || found.Duration <= 0 {
+		t.Fatalf(`unexpected response info %+v`, found)
+	}
+
+	missing := infos[1]
+	if missing.Route.Pattern != "" || missing.Status != http.StatusNotFound {
+		t.Fatalf(`unexpected response info %+v`, missing)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var logged []interface{}
+	mux := NewServeMux()
+	mux.AfterResponse(AccessLog(func(msg string, keysAndValues ...interface{}) {
+		logged = keysAndValues
+	}))
+	mux.Handle("/user/:userId/name", PathParamsHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/user/10/name")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	resp.Body.Close()
+
+	fields := map[interface{}]interface{}{}
+	for i := 0; i+1 < len(logged); i += 2 {
+		fields[logged[i]] = logged[i+1]
+	}
+
+	if fields["route"] != "/user/:userId/name" {
+		t.Fatalf(`fields["route"] != "/user/:userId/name", fields["route"] == "%v"`, fields["route"])
+	}
+
+	if fields["path"] != "/user/10/name" {
+		t.Fatalf(`fields["path"] != "/user/10/name", fields["path"] == "%v"`, fields["path"])
+	}
+
+	if fields["method"] != "GET" || fields["status"] != resp.StatusCode {
+		t.Fatalf(`unexpected fields %v`, fields)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	mux := NewServeMux()
+	mux.Use(WithTimeout(50 * time.Millisecond))
+	mux.Handle("/slow", func(ctx context.Context) (string, error) {
+		select {
+		case <-time.After(time.Second):
+			return "too late", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+	mux.Handle("/fast", func() (Headers, string) {
+		return Headers{"X-Fast": {"yes"}}, "made it"
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf(`resp.StatusCode != 504, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/fast")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "made it" {
+		t.Fatalf(`body != "made it", body == "%v"`, string(body))
+	}
+
+	if resp.Header.Get("X-Fast") != "yes" {
+		t.Fatalf(`X-Fast != "yes", X-Fast == "%v"`, resp.Header.Get("X-Fast"))
+	}
+}
+
+func TestWithTimeoutFlush(t *testing.T) {
+	release := make(chan struct{})
+	mux := NewServeMux()
+	mux.Use(WithTimeout(time.Minute))
+	mux.Handle("/events", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(res, "data: first\n\n")
+		res.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+		io.WriteString(res, "data: last\n\n")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf(`resp.StatusCode != http.StatusOK, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf(`Content-Type != "text/event-stream", Content-Type == "%v"`, resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	line, _ := reader.ReadString('\n')
+	if line != "data: first\n" {
+		t.Fatalf(`line != "data: first", line == %q`, line)
+	}
+
+	close(release)
+	rest, _ := io.ReadAll(reader)
+	if string(rest) != "\ndata: last\n\n" {
+		t.Fatalf(`rest != "data: last", rest == %q`, rest)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	mux := NewServeMux()
+	mux.Use(RateLimit(1, 2, KeyByHeader("Api-Key")))
+	mux.Handle("/limited", func() {})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		key    string
+		status int
+	}{
+		{"a", http.StatusNoContent},
+		{"a", http.StatusNoContent},
+		{"a", http.StatusTooManyRequests},
+		{"b", http.StatusNoContent},
+	} {
+		req, _ := http.NewRequest("GET", server.URL+"/limited", nil)
+		req.Header.Set("Api-Key", c.key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf(`%s: resp.StatusCode != %d, resp.StatusCode == "%v"`, c.key, c.status, resp.StatusCode)
+		}
+
+		if c.status == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "1" {
+			t.Fatalf(`Retry-After != "1", Retry-After == "%v"`, resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	mux := NewServeMux()
+	mux.Use(CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}))
+	mux.GET("/orders", ReturnStructHandler)
+	mux.POST("/orders", RequestMethodHandler)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest("OPTIONS", server.URL+"/orders", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf(`resp.StatusCode != 204, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	for name, expected := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD, POST",
+		"Access-Control-Allow-Headers":     "Content-Type",
+		"Access-Control-Max-Age":           "3600",
+	} {
+		if actual := resp.Header.Get(name); actual != expected {
+			t.Fatalf(`%s != %q, %s == %q`, name, expected, name, actual)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/orders", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if origin := resp.Header.Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Fatalf(`origin != "", origin == %q`, origin)
+	}
+
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if exposed := resp.Header.Get("Access-Control-Expose-Headers"); exposed != "X-Total" {
+		t.Fatalf(`exposed != "X-Total", exposed == %q`, exposed)
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	type comment struct {
+		Text string `json:"text"`
+	}
+
+	var posted string
+	var token string
+	mux := NewServeMux()
+	mux.Use(CSRF(CSRFOptions{
+		Exempt: func(req *http.Request) bool {
+			return req.Header.Get("Authorization") != ""
+		},
+	}))
+	mux.GET("/form", func(req *http.Request) {
+		token = CSRFToken(req)
+	})
+	mux.POST("/comment", func(c *comment) {
+		posted = c.Text
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/form")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Value != token || token == "" {
+		t.Fatalf(`unexpected cookies %v for token %q`, cookies, token)
+	}
+
+	post := func(form url.Values, authorization string) int {
+		req, _ := http.NewRequest("POST", server.URL+"/comment", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", authorization)
+		req.AddCookie(cookies[0])
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := post(url.Values{"text": {"forged"}}, ""); status != http.StatusForbidden {
+		t.Fatalf(`status != 403, status == "%v"`, status)
+	}
+
+	if status := post(url.Values{"text": {"hello"}, "csrf_token": {token}}, ""); status != http.StatusNoContent {
+		t.Fatalf(`status != 204, status == "%v"`, status)
+	}
+
+	if posted != "hello" {
+		t.Fatalf(`posted != "hello", posted == "%v"`, posted)
+	}
+
+	if status := post(url.Values{"text": {"api"}}, "Bearer abc"); status != http.StatusNoContent {
+		t.Fatalf(`status != 204, status == "%v"`, status)
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := NewServeMux()
+	mux.HandleWith("/busy", []Middleware{MaxConcurrent(1, 5*time.Second)}, func() {
+		started <- struct{}{}
+		<-release
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	done := make(chan int)
+	go func() {
+		resp, err := http.Get(server.URL + "/busy")
+		if err != nil {
+			done <- 0
+			return
+		}
+		done <- resp.StatusCode
+	}()
+	<-started
+
+	resp, err := http.Get(server.URL + "/busy")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf(`resp.StatusCode != 503, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	if resp.Header.Get("Retry-After") != "5" {
+		t.Fatalf(`Retry-After != "5", Retry-After == "%v"`, resp.Header.Get("Retry-After"))
+	}
+
+	close(release)
+	if status := <-done; status != http.StatusNoContent {
+		t.Fatalf(`status != 204, status == "%v"`, status)
+	}
+}
+
+func TestAuthParams(t *testing.T) {
+	var token BearerToken
+	var key APIKey
+	mux := NewServeMux()
+	mux.Handle("/basic", BasicAuthHandler)
+	mux.Handle("/bearer", func(t BearerToken) {
+		token = t
+	})
+	mux.Handle("/key", func(k APIKey) {
+		key = k
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		path      string
+		challenge string
+	}{
+		{"/basic", `Basic realm="restricted", charset="UTF-8"`},
+		{"/bearer", "Bearer"},
+		{"/key", "APIKey"},
+	} {
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf(`%s: resp.StatusCode != 401, resp.StatusCode == "%v"`, c.path, resp.StatusCode)
+		}
+
+		if challenge := resp.Header.Get("WWW-Authenticate"); challenge != c.challenge {
+			t.Fatalf(`%s: challenge != %q, challenge == %q`, c.path, c.challenge, challenge)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/basic", nil)
+	req.SetBasicAuth("jon", "secret")
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if BasicAuthUser != "jon" {
+		t.Fatalf(`BasicAuthUser != "jon", BasicAuthUser == "%v"`, BasicAuthUser)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/bearer", nil)
+	req.Header.Set("Authorization", "Bearer abc123")
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if token != "abc123" {
+		t.Fatalf(`token != "abc123", token == "%v"`, token)
+	}
+
+	if _, err := http.Get(server.URL + "/key?api_key=xyz"); err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+
+	if key != "xyz" {
+		t.Fatalf(`key != "xyz", key == "%v"`, key)
+	}
+}
+
+func signJWT(t *testing.T, alg, kid string, claims map[string]interface{}, sign func([]byte) []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestJWT(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v\n", err)
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "rsa1",
+				"n":   base64.RawURLEncoding.EncodeToString(private.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private.E)).Bytes()),
+			}},
+		})
+	}))
+	defer jwks.Close()
+
+	secret := []byte("shh")
+	verifier := &jwt.Verifier{
+		Keys:     map[string]interface{}{"": secret},
+		JWKSURL:  jwks.URL,
+		Issuer:   "https://auth.example.com",
+		Audience: "orders",
+	}
+
+	var subject string
+	mux := NewServeMux()
+	mux.Use(verifier.Middleware())
+	mux.Handle("/me", func(claims jwt.Claims) {
+		subject = claims.Subject
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+		return signature
+	}
+	hs256 := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+	claims := func(sub, aud string, exp time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"sub": sub,
+			"iss": "https://auth.example.com",
+			"aud": []string{aud},
+			"exp": time.Now().Add(exp).Unix(),
+		}
+	}
+
+	for _, c := range []struct {
+		token   string
+		status  int
+		subject string
+	}{
+		{"", http.StatusUnauthorized, ""},
+		{signJWT(t, "RS256", "rsa1", claims("rsa-user", "orders", time.Hour), rs256), http.StatusNoContent, "rsa-user"},
+		{signJWT(t, "HS256", "", claims("hmac-user", "orders", time.Hour), hs256), http.StatusNoContent, "hmac-user"},
+		{signJWT(t, "HS256", "", claims("expired", "orders", -time.Hour), hs256), http.StatusUnauthorized, ""},
+		{signJWT(t, "HS256", "", claims("other", "billing", time.Hour), hs256), http.StatusUnauthorized, ""},
+		{signJWT(t, "RS256", "rsa1", claims("forged", "orders", time.Hour), hs256), http.StatusUnauthorized, ""},
+		{signJWT(t, "HSX256", "", claims("odd-alg", "orders", time.Hour), hs256), http.StatusUnauthorized, ""},
+	} {
+		subject = ""
+		req, _ := http.NewRequest("GET", server.URL+"/me", nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf(`resp.StatusCode != %d, resp.StatusCode == "%v"`, c.status, resp.StatusCode)
+		}
+
+		if subject != c.subject {
+			t.Fatalf(`subject != %q, subject == %q`, c.subject, subject)
+		}
+	}
+}
+
+func TestJWKSFetchOutlivesRequest(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v\n", err)
+	}
+
+	release := make(chan struct{})
+	var fetches int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "rsa1",
+				"n":   base64.RawURLEncoding.EncodeToString(private.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private.E)).Bytes()),
+			}},
+		})
+	}))
+	defer jwks.Close()
+
+	verifier := &jwt.Verifier{JWKSURL: jwks.URL}
+	token := signJWT(t, "RS256", "rsa1", map[string]interface{}{"sub": "rsa-user"}, func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+		return signature
+	})
+
+	// the first request gives up while the keys are being fetched
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := verifier.Verify(ctx, token); err == nil {
+		t.Fatalf("expected the cancelled request to fail")
+	}
+
+	close(release)
+	claims, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("verifying token: %v\n", err)
+	}
+
+	if claims.Subject != "rsa-user" {
+		t.Fatalf(`claims.Subject != "rsa-user", claims.Subject == "%v"`, claims.Subject)
+	}
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf(`fetches != 1, fetches == "%v"`, n)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	mux := NewServeMux()
+	mux.SetAuthorizer(func(req *http.Request, required Requirements, args []interface{}) bool {
+		for _, arg := range args {
+			if token, ok := arg.(BearerToken); ok {
+				granted := strings.Fields(string(token))
+				for _, scope := range required.Scopes {
+					found := false
+					for _, g := range granted {
+						found = found || g == scope
+					}
+					if !found {
+						return false
+					}
+				}
+				return true
+			}
+		}
+		return false
+	})
+	mux.GET("/orders", func(token BearerToken) {}).RequireScope("orders:read")
+	mux.POST("/orders", func(token BearerToken) {}).RequireScope("orders:write")
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		method string
+		token  string
+		status int
+	}{
+		{"GET", "orders:read", http.StatusNoContent},
+		{"POST", "orders:read", http.StatusForbidden},
+		{"POST", "orders:read orders:write", http.StatusNoContent},
+		{"POST", "", http.StatusUnauthorized},
+	} {
+		req, _ := http.NewRequest(c.method, server.URL+"/orders", nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("making request: %v\n", err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf(`%s %q: resp.StatusCode != %d, resp.StatusCode == "%v"`, c.method, c.token, c.status, resp.StatusCode)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic requiring a scope of a plain http handler")
+		}
+	}()
+	mux.Handle("/plain", func(res http.ResponseWriter, req *http.Request) {}).RequireScope("admin")
+}
+
+func TestRequireScopeMounted(t *testing.T) {
+	authorizer := func(name string, called *[]string) Authorizer {
+		return func(req *http.Request, required Requirements, args []interface{}) bool {
+			*called = append(*called, name)
+			return true
+		}
+	}
+
+	var called []string
+	mux := NewServeMux()
+	mux.SetAuthorizer(authorizer("mux", &called))
+	billing := NewServeMux()
+	billing.SetAuthorizer(authorizer("billing", &called))
+	billing.GET("/invoices", func() {}).RequireScope("billing:read")
+	mux.Mount("/billing", billing)
+	reports := NewServeMux()
+	reports.GET("/sales", func() {}).RequireScope("reports:read")
+	mux.Mount("/reports", reports)
+
+	for _, c := range []struct {
+		path   string
+		called string
+	}{
+		{"/billing/invoices", "[billing]"},
+		{"/reports/sales", "[mux]"},
+	} {
+		called = nil
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest("GET", c.path, nil))
+		if res.Code != http.StatusNoContent {
+			t.Fatalf(`%s: res.Code != http.StatusNoContent, res.Code == "%v"`, c.path, res.Code)
+		}
+		if fmt.Sprint(called) != c.called {
+			t.Fatalf(`%s: called != %s, called == "%v"`, c.path, c.called, called)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	var client ClientIP
+	mux := NewServeMux()
+	mux.Handle("/ip", func(ip ClientIP) {
+		client = ip
+	})
+
+	for _, c := range []struct {
+		trusted []string
+		remote  string
+		header  string
+		value   string
+		client  string
+	}{
+		{nil, "198.51.100.7:5555", "X-Forwarded-For", "203.0.113.9", "198.51.100.7"},
+		{[]string{"10.0.0.0/8"}, "10.1.2.3:5555", "X-Forwarded-For", "203.0.113.9, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{[]string{"10.0.0.0/8"}, "10.1.2.3:5555", "Forwarded", `for=192.0.2.60;proto=http, for="[2001:db8::17]:4711"`, "2001:db8::17"},
+		{[]string{"10.1.2.3"}, "10.1.2.3:5555", "X-Real-IP", "192.0.2.44", "192.0.2.44"},
+		{[]string{"10.1.2.3"}, "10.9.9.9:5555", "X-Real-IP", "192.0.2.44", "10.9.9.9"},
+	} {
+		if err := mux.SetTrustedProxies(c.trusted...); err != nil {
+			t.Fatalf("setting trusted proxies: %v\n", err)
+		}
+
+		req := httptest.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = c.remote
+		req.Header.Set(c.header, c.value)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNoContent {
+			t.Fatalf(`res.Code != 204, res.Code == "%v"`, res.Code)
+		}
+
+		if client.String() != c.client {
+			t.Fatalf(`client != %q, client == %q`, c.client, client.String())
+		}
+	}
+}
+
+func TestIPFilters(t *testing.T) {
+	admin := NewServeMux()
+	admin.Use(AllowIPs("10.8.0.0/16"))
+	admin.Handle("/users", func() {})
+
+	mux := NewServeMux()
+	mux.Use(DenyIPs("192.0.2.66"))
+	mux.Mount("/admin", admin)
+	mux.Handle("/public", func() {})
+
+	for _, c := range []struct {
+		path   string
+		remote string
+		status int
+	}{
+		{"/admin/users", "10.8.3.4:5555", http.StatusNoContent},
+		{"/admin/users", "10.9.3.4:5555", http.StatusForbidden},
+		{"/public", "10.9.3.4:5555", http.StatusNoContent},
+		{"/public", "192.0.2.66:5555", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.RemoteAddr = c.remote
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		if res.Code != c.status {
+			t.Fatalf(`%s from %s: res.Code != %d, res.Code == "%v"`, c.path, c.remote, c.status, res.Code)
+		}
+	}
+}
+
+type openAPIOrder struct {
+	ID    int               `json:"id"`
+	Items []string          `json:"items"`
+	Note  string            `json:"note,omitempty"`
+	Meta  map[string]string `json:"meta,omitempty"`
+	Skip  string            `json:"-"`
+	Next  *openAPIOrder     `json:"next,omitempty"`
+}
+
+type limitQueryParam int
+
+func TestOpenAPI(t *testing.T) {
+	mux := NewServeMux()
+	mux.GET("/message", ReturnStructHandler, "gets a message")
+	mux.POST("/orders", func(order *openAPIOrder) (*openAPIOrder, error) {
+		return order, nil
+	}).RequireScope("orders:write")
+	mux.Handle("/orders/:orderId/items", func(limit *limitQueryParam, token BearerToken) ([]string, error) {
+		return nil, nil
+	})
+
+	doc := mux.OpenAPI(OpenAPIInfo{Title: "Orders", Version: "1.0"})
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("encoding document: %v\n", err)
+	}
+
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	if decoded["openapi"] != "3.1.0" {
+		t.Fatalf(`openapi != "3.1.0", openapi == "%v"`, decoded["openapi"])
+	}
+
+	message := doc.Paths["/message"]["get"]
+	if message == nil || message.OperationID != "ReturnStructHandler" || message.Description != "gets a message" {
+		t.Fatalf(`unexpected /message operation %+v`, message)
+	}
+
+	if ref := message.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/ReturnStructResult" {
+		t.Fatalf(`ref != "#/components/schemas/ReturnStructResult", ref == %q`, ref)
+	}
+
+	create := doc.Paths["/orders"]["post"]
+	if create == nil || create.RequestBody == nil || create.Responses["403"] == nil || create.Responses["default"] == nil {
+		t.Fatalf(`unexpected /orders operation %+v`, create)
+	}
+
+	order := doc.Components.Schemas["openAPIOrder"]
+	if !reflect.DeepEqual(order.Required, []string{"id", "items"}) {
+		t.Fatalf(`order.Required != [id items], order.Required == %v`, order.Required)
+	}
+
+	if _, ok := order.Properties["Skip"]; ok || order.Properties["next"].Ref != "#/components/schemas/openAPIOrder" {
+		t.Fatalf(`unexpected order properties %v`, order.Properties)
+	}
+
+	items := doc.Paths["/orders/{orderId}/items"]["get"]
+	if items == nil || len(items.Parameters) != 2 || items.Responses["401"] == nil {
+		t.Fatalf(`unexpected items operation %+v`, items)
+	}
+
+	limit, orderId := items.Parameters[0], items.Parameters[1]
+	if limit.Name != "limit" || limit.In != "query" || limit.Required || limit.Schema.Type != "integer" {
+		t.Fatalf(`unexpected limit parameter %+v`, limit)
+	}
+
+	if orderId.Name != "orderId" || orderId.In != "path" || !orderId.Required {
+		t.Fatalf(`unexpected orderId parameter %+v`, orderId)
+	}
+}
+
+func TestServeDocs(t *testing.T) {
+	mux := NewServeMux()
+	mux.ServeDocs("/docs", OpenAPIInfo{Title: "Orders", Version: "1.0"})
+	mux.GET("/message", ReturnStructHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/docs/openapi.json")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	var doc OpenAPI
+	json.NewDecoder(res.Body).Decode(&doc)
+	res.Body.Close()
+	if doc.Paths["/message"]["get"] == nil {
+		t.Fatalf(`missing /message operation in %+v`, doc.Paths)
+	}
+	if len(doc.Paths) != 1 {
+		t.Fatalf(`len(doc.Paths) != 1, doc.Paths == %+v`, doc.Paths)
+	}
+
+	res, err = http.Get(server.URL + "/docs")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	page, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.Request.URL.Path != "/docs/" {
+		t.Fatalf(`path != "/docs/", path == %q`, res.Request.URL.Path)
+	}
+	if !strings.Contains(string(page), "<title>Orders</title>") {
+		t.Fatalf(`page doesn't have the title, page == %q`, page)
+	}
+
+	res, err = http.Get(server.URL + "/docs/swagger-ui-bundle.js")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf(`StatusCode != 200, StatusCode == %d`, res.StatusCode)
+	}
+}
+
+type documentedOrder struct {
+	ID int `json:"id"`
+}
+
+func (*documentedOrder) Responses() map[int]interface{} {
+	return map[int]interface{}{
+		http.StatusNotFound: Error(http.StatusNotFound, "no such order"),
+	}
+}
+
+func TestDeclaredResponses(t *testing.T) {
+	mux := NewServeMux()
+	mux.GET("/orders/:orderId", func() (*documentedOrder, error) {
+		return nil, nil
+	})
+	mux.POST("/orders", func(order *documentedOrder) error {
+		return nil
+	}).Responses(map[int]interface{}{
+		http.StatusConflict: documentedOrder{ID: 7},
+		http.StatusAccepted: nil,
+	})
+
+	doc := mux.OpenAPI(OpenAPIInfo{Title: "Orders", Version: "1.0"})
+
+	notFound := doc.Paths["/orders/{orderId}"]["get"].Responses["404"]
+	if notFound == nil || notFound.Content["application/json"].Schema.Ref != "#/components/schemas/Error" {
+		t.Fatalf(`unexpected 404 response %+v`, notFound)
+	}
+	example := notFound.Content["application/json"].Example
+	if !reflect.DeepEqual(example, map[string]string{"error": "no such order"}) {
+		t.Fatalf(`example != {"error": "no such order"}, example == %v`, example)
+	}
+
+	create := doc.Paths["/orders"]["post"]
+	conflict := create.Responses["409"]
+	if conflict == nil || conflict.Content["application/json"].Schema.Ref != "#/components/schemas/documentedOrder" {
+		t.Fatalf(`unexpected 409 response %+v`, conflict)
+	}
+	if accepted := create.Responses["202"]; accepted == nil || accepted.Content != nil {
+		t.Fatalf(`unexpected 202 response %+v`, accepted)
+	}
+	if create.Responses["204"] == nil {
+		t.Fatalf(`missing 204 response in %+v`, create.Responses)
+	}
+
+	for _, e := range mux.Documentation().Endpoints {
+		var expected map[int]string
+		if e.Path == "/orders" {
+			expected = map[int]string{409: "documentedOrder", 202: ""}
+		} else {
+			expected = map[int]string{404: "error"}
+		}
+		if !reflect.DeepEqual(e.Responses, expected) {
+			t.Fatalf(`%s Responses != %v, Responses == %v`, e.Path, expected, e.Responses)
+		}
+	}
+}
+
+func TestRouteMetadata(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/users", ByMethod{
+		GET:  ReturnStructHandler,
+		POST: ReturnStructHandler,
+	}).Tags("users")
+	mux.DELETE("/users/:userId", ReturnStructHandler).
+		Summary("Deletes a user").
+		Tags("users", "admin").
+		Deprecated()
+
+	routes := mux.Routes()
+	if len(routes) != 3 {
+		t.Fatalf(`len(routes) != 3, routes == %+v`, routes)
+	}
+	deleteUser := routes[2]
+	if deleteUser.Summary != "Deletes a user" || !deleteUser.Deprecated || !reflect.DeepEqual(deleteUser.Tags, []string{"users", "admin"}) {
+		t.Fatalf(`unexpected route %+v`, deleteUser)
+	}
+	if !reflect.DeepEqual(routes[0].Tags, []string{"users"}) || routes[0].Deprecated {
+		t.Fatalf(`unexpected route %+v`, routes[0])
+	}
+
+	doc := mux.OpenAPI(OpenAPIInfo{Title: "Users", Version: "1.0"})
+	op := doc.Paths["/users/{userId}"]["delete"]
+	if op.Summary != "Deletes a user" || !op.Deprecated || !reflect.DeepEqual(op.Tags, []string{"users", "admin"}) {
+		t.Fatalf(`unexpected operation %+v`, op)
+	}
+	if tags := doc.Paths["/users"]["post"].Tags; !reflect.DeepEqual(tags, []string{"users"}) {
+		t.Fatalf(`tags != [users], tags == %v`, tags)
+	}
+
+	for _, e := range mux.Documentation().Endpoints {
+		if e.Method == "DELETE" && (e.Summary != "Deletes a user" || !e.Deprecated) {
+			t.Fatalf(`unexpected endpoint %+v`, e)
+		}
+	}
+}
+
+type exampleUser struct {
+	Name   string    `json:"name" example:"Ada" doc:"the user's full name"`
+	Age    int       `json:"age" example:"36"`
+	Emails []string  `json:"emails" example:"[\"ada@example.com\"]"`
+	Joined time.Time `json:"joined" example:"2024-01-02T03:04:05Z"`
+}
+
+func TestDocTags(t *testing.T) {
+	mux := NewServeMux()
+	mux.GET("/user", func() (*exampleUser, error) {
+		return nil, nil
+	})
+
+	doc := mux.OpenAPI(OpenAPIInfo{Title: "Users", Version: "1.0"})
+	user := doc.Components.Schemas["exampleUser"]
+	if name := user.Properties["name"]; name.Description != "the user's full name" || !reflect.DeepEqual(name.Examples, []interface{}{"Ada"}) {
+		t.Fatalf(`unexpected name property %+v`, name)
+	}
+	if age := user.Properties["age"]; !reflect.DeepEqual(age.Examples, []interface{}{36}) {
+		t.Fatalf(`age.Examples != [36], age.Examples == %v`, age.Examples)
+	}
+
+	example := mux.Documentation().Types["exampleUser"]
+	expected := exampleUser{
+		Name:   "Ada",
+		Age:    36,
+		Emails: []string{"ada@example.com"},
+		Joined: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if got, ok := example.Example.(*exampleUser); !ok || !reflect.DeepEqual(*got, expected) {
+		t.Fatalf(`example != %+v, example == %+v`, expected, example.Example)
+	}
+	if !reflect.DeepEqual(example.Fields, map[string]string{"name": "the user's full name"}) {
+		t.Fatalf(`unexpected fields %v`, example.Fields)
+	}
+}
+
+func TestCollectionExports(t *testing.T) {
+	mux := NewServeMux()
+	mux.POST("/users/:userId(\\d+)/orders", func(order *documentedOrder, limit *limitQueryParam) error {
+		return nil
+	}).Summary("Creates an order").Tags("orders")
+	mux.GET("/health", func() string { return "ok" })
+
+	docs := mux.Documentation()
+
+	collection := docs.Postman("Orders", "http://localhost:8080")
+	if collection.Variable[0].Value != "http://localhost:8080" || len(collection.Item) != 2 {
+		t.Fatalf(`unexpected collection %+v`, collection)
+	}
+	if health := collection.Item[0]; health.Name != "GET /health" || health.Request.URL.Raw != "{{baseUrl}}/health" {
+		t.Fatalf(`unexpected item %+v`, health)
+	}
+	folder := collection.Item[1]
+	if folder.Name != "orders" || len(folder.Item) != 1 || folder.Item[0].Name != "Creates an order" {
+		t.Fatalf(`unexpected folder %+v`, folder)
+	}
+	create := folder.Item[0].Request
+	if create.Method != "POST" || create.URL.Raw != "{{baseUrl}}/users/:userId/orders" {
+		t.Fatalf(`unexpected request %+v`, create)
+	}
+	if len(create.URL.Variable) != 1 || create.URL.Variable[0].Key != "userId" {
+		t.Fatalf(`unexpected variables %+v`, create.URL.Variable)
+	}
+	if len(create.URL.Query) != 1 || create.URL.Query[0].Key != "limit" || !create.URL.Query[0].Disabled {
+		t.Fatalf(`unexpected query %+v`, create.URL.Query)
+	}
+	if create.Body == nil || create.Body.Raw != "{\n  \"id\": 0\n}" {
+		t.Fatalf(`unexpected body %+v`, create.Body)
+	}
+
+	export := docs.Insomnia("Orders", "http://localhost:8080")
+	if len(export.Resources) != 5 {
+		t.Fatalf(`len(export.Resources) != 5, export.Resources == %+v`, export.Resources)
+	}
+	folderResource, request := export.Resources[3], export.Resources[4]
+	if folderResource.Type != "request_group" || request.ParentID != folderResource.ID {
+		t.Fatalf(`unexpected resources %+v %+v`, folderResource, request)
+	}
+	if request.URL != "{{ _.base_url }}/users/:userId/orders" || request.Body.MimeType != "application/json" {
+		t.Fatalf(`unexpected request %+v`, request)
+	}
+	if _, err := json.Marshal(export); err != nil {
+		t.Fatalf("encoding export: %v\n", err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	mux := NewServeMux()
+	mux.POST("/users/:userId/orders", func(order *documentedOrder) error {
+		return nil
+	}, "Places an order for the user.").Tags("orders")
+	mux.GET("/health", func() string { return "ok" })
+
+	md := mux.Documentation("The Orders API.").Markdown("Orders", "https://api.example.com/")
+
+	for _, expected := range []string{
+		"# Orders\n\nThe Orders API.\n",
+		"\n## orders\n\n### `POST /users/:userId/orders`\n\nPlaces an order for the user.\n",
+		"| `userId` | path | string | yes |  |\n",
+		"Request body: `documentedOrder`\n\n```json\n{\n  \"id\": 0\n}\n```\n",
+		"curl -X POST 'https://api.example.com/users/{userId}/orders' \\\n  -H 'Content-Type: application/json' \\\n  -d '{\"id\":0}'\n",
+		"\n## Other\n\n### `GET /health`\n",
+		"curl 'https://api.example.com/health'\n",
+	} {
+		if !strings.Contains(md, expected) {
+			t.Fatalf("markdown doesn't contain %q, markdown == %q", expected, md)
+		}
+	}
+}
+
+func TestDiffOpenAPI(t *testing.T) {
+	info := OpenAPIInfo{Title: "Orders", Version: "1.0"}
+
+	before := NewServeMux()
+	before.GET("/orders/:orderId", func() (*documentedOrder, error) { return nil, nil })
+	before.GET("/health", func() string { return "ok" })
+
+	after := NewServeMux()
+	after.GET("/orders/:orderId", func(limit limitQueryParam) (*exampleUser, error) { return nil, nil })
+	after.POST("/orders", func(order *documentedOrder) error { return nil })
+
+	var changes []string
+	for _, change := range DiffOpenAPI(before.OpenAPI(info), after.OpenAPI(info)) {
+		changes = append(changes, change.String())
+	}
+
+	expected := []string{
+		"breaking: GET /health: route removed",
+		"change: POST /orders: route added",
+		"breaking: GET /orders/{orderId}: 200 response field id removed",
+		"change: GET /orders/{orderId}: 404 response removed",
+		"breaking: GET /orders/{orderId}: required query param limit added",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("changes != %q, changes == %q", expected, changes)
+	}
+}
+
+func TestAsyncAPI(t *testing.T) {
+	mux := NewServeMux()
+	mux.GET("/orders/:orderId/updates", func() EventStream {
+		return nil
+	}, "updates to an order").Sends("shipped", documentedOrder{})
+	mux.GET("/orders/feed", func() <-chan *documentedOrder {
+		return nil
+	})
+	mux.GET("/rooms/:room", EchoHandler).
+		Sends("echo", "").
+		Receives("say", "")
+	mux.GET("/message", ReturnStructHandler)
+
+	doc := mux.AsyncAPI(OpenAPIInfo{Title: "Orders", Version: "1.0"})
+	if doc.AsyncAPI != "3.0.0" || len(doc.Channels) != 3 {
+		t.Fatalf(`unexpected document %+v`, doc)
+	}
+
+	updates := doc.Channels["getOrdersOrderIdUpdates"]
+	if updates == nil || updates.Address != "/orders/{orderId}/updates" || updates.Description != "updates to an order" {
+		t.Fatalf(`unexpected updates channel %+v`, updates)
+	}
+	if _, ok := updates.Parameters["orderId"]; !ok {
+		t.Fatalf(`missing orderId parameter in %+v`, updates.Parameters)
+	}
+	if shipped := updates.Messages["shipped"]; shipped == nil || shipped.Payload.Ref != "#/components/schemas/documentedOrder" {
+		t.Fatalf(`unexpected shipped message %+v`, shipped)
+	}
+
+	feed := doc.Channels["getOrdersFeed"]
+	if feed == nil || feed.Messages["documentedOrder"] == nil {
+		t.Fatalf(`unexpected feed channel %+v`, feed)
+	}
+
+	receive := doc.Operations["receiveEchoHandler"]
+	if receive == nil || receive.Action != "receive" || receive.Messages[0].Ref != "#/channels/EchoHandler/messages/say" {
+		t.Fatalf(`unexpected receive operation %+v`, receive)
+	}
+	if send := doc.Operations["sendEchoHandler"]; send == nil || send.Channel.Ref != "#/channels/EchoHandler" {
+		t.Fatalf(`unexpected send operation %+v`, send)
+	}
+	if doc.Components.Schemas["documentedOrder"] == nil {
+		t.Fatalf(`missing documentedOrder schema in %+v`, doc.Components.Schemas)
+	}
+}
+
+func TestOpenAPISecurity(t *testing.T) {
+	mux := NewServeMux()
+	mux.SetAPIKeyParams("X-Key", "")
+	mux.GET("/orders", func(key APIKey, claims jwt.Claims) ([]string, error) {
+		return nil, nil
+	}).RequireScope("orders:read")
+	mux.GET("/admin", func(auth BasicAuth) error {
+		return nil
+	})
+
+	doc := mux.OpenAPI(OpenAPIInfo{Title: "Orders", Version: "1.0"})
+
+	schemes := doc.Components.SecuritySchemes
+	if key := schemes["apiKeyHeader"]; key == nil || key.In != "header" || key.Name != "X-Key" {
+		t.Fatalf(`unexpected apiKeyHeader scheme %+v`, key)
+	}
+	if _, ok := schemes["apiKeyQuery"]; ok {
+		t.Fatalf(`unexpected apiKeyQuery scheme in %+v`, schemes)
+	}
+	if token := schemes["jwt"]; token == nil || token.Scheme != "bearer" || token.BearerFormat != "JWT" {
+		t.Fatalf(`unexpected jwt scheme %+v`, token)
+	}
+
+	expected := []map[string][]string{{"apiKeyHeader": {"orders:read"}, "jwt": {"orders:read"}}}
+	if security := doc.Paths["/orders"]["get"].Security; !reflect.DeepEqual(security, expected) {
+		t.Fatalf(`security != %v, security == %v`, expected, security)
+	}
+
+	expected = []map[string][]string{{"basicAuth": {}}}
+	admin := doc.Paths["/admin"]["get"]
+	if !reflect.DeepEqual(admin.Security, expected) || admin.Responses["401"] == nil {
+		t.Fatalf(`unexpected /admin operation %+v`, admin)
+	}
+}
+
+func TestGenerateAdaptors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plumbus.adaptor-generated.go")
+	err := generate.Adaptors([]interface{}{
+		ParamHandler,
+		RequestMethodHandler,
+		ParamHandler,
+	}, path, "handlers")
+	if err != nil {
+		t.Fatalf("couldn't generate: %v", err)
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		t.Fatalf("generated code doesn't parse: %v", err)
+	}
+	if file.Name.Name != "handlers" {
+		t.Fatalf(`file.Name.Name != "handlers", file.Name.Name == "%v"`, file.Name.Name)
+	}
+
+	inits := 0
+	for _, decl := range file.Decls {
+		if f, ok := decl.(*ast.FuncDecl); ok && f.Name.Name == "init" {
+			inits++
+		}
+	}
+	if inits != 2 {
+		t.Fatalf(`inits != 2, inits == "%v"`, inits)
+	}
+}
+
+func TestVerifyAdaptors(t *testing.T) {
+	err := generate.VerifyAdaptor(ParamHandler, "handlers/ParamHandler.adaptor-generated.go", "handlers")
+	if err != nil {
+		t.Fatalf("checked in adaptor isn't up to date: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "plumbus.adaptor-generated.go")
+	if err := generate.VerifyAdaptor(ParamHandler, path, "handlers"); err == nil {
+		t.Fatalf("missing adaptor was verified")
+	}
+
+	handlers := []interface{}{ParamHandler, RequestMethodHandler}
+	if err := generate.Adaptors(handlers, path, "handlers"); err != nil {
+		t.Fatalf("couldn't generate: %v", err)
+	}
+	if err := generate.VerifyAdaptors(handlers, path, "handlers"); err != nil {
+		t.Fatalf("generated adaptors weren't verified: %v", err)
+	}
+
+	handlers = append(handlers, PathParamsHandler)
+	err = generate.VerifyAdaptors(handlers, path, "handlers")
+	if err == nil || !strings.Contains(err.Error(), "out of date") {
+		t.Fatalf(`err doesn't contain "out of date", err == "%v"`, err)
+	}
+}
+
+type widgetIdPathParam string
+
+type typedWidget struct {
+	Id   string `json:"id"`
+	Name string `json:"name" validate:"required"`
+}
+
+func TestTypedHandlers(t *testing.T) {
+	mux := NewServeMux()
+	mux.PUT("/widgets/:widgetId", Handle3(func(ctx context.Context, id widgetIdPathParam, widget *typedWidget) (*typedWidget, error) {
+		if id == "missing" {
+			return nil, Error(http.StatusNotFound, "no such widget")
+		}
+		widget.Id = string(id)
+		return widget, nil
+	}))
+	mux.GET("/widgets", Handle1(func(limit limitQueryParam) ([]string, error) {
+		return make([]string, limit), nil
+	}))
+	mux.DELETE("/widgets/:widgetId", Handle0(func() (int, error) {
+		// an int that isn't before a body is the body, not the status
+		return 1, nil
+	}))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	do := func(method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("couldn't %s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(data))
+	}
+
+	if code, body := do("PUT", "/widgets/w1", `{"name":"gear"}`); code != 200 || body != `{"id":"w1","name":"gear"}` {
+		t.Fatalf(`unexpected response %d %s`, code, body)
+	}
+	if code, body := do("PUT", "/widgets/w1", `{}`); code != 400 || !strings.Contains(body, "name") {
+		t.Fatalf(`unexpected response %d %s`, code, body)
+	}
+	if code, _ := do("PUT", "/widgets/missing", `{"name":"gear"}`); code != 404 {
+		t.Fatalf(`code != 404, code == "%v"`, code)
+	}
+	if code, body := do("GET", "/widgets?limit=2", ""); code != 200 || body != `["",""]` {
+		t.Fatalf(`unexpected response %d %s`, code, body)
+	}
+	if code, _ := do("GET", "/widgets", ""); code != 400 {
+		t.Fatalf(`code != 400, code == "%v"`, code)
+	}
+	if code, body := do("DELETE", "/widgets/w1", ""); code != 200 || body != "1" {
+		t.Fatalf(`unexpected response %d %s`, code, body)
+	}
+
+	doc := mux.OpenAPI(OpenAPIInfo{Title: "Widgets", Version: "1.0"})
+	put := doc.Paths["/widgets/{widgetId}"]["put"]
+	if put == nil || len(put.Parameters) != 1 || put.Parameters[0].Name != "widgetId" || put.RequestBody == nil {
+		t.Fatalf(`unexpected PUT /widgets/{widgetId} operation %+v`, put)
+	}
+}
+
+func TestGoClient(t *testing.T) {
+	mux := NewServeMux()
+	mux.PUT("/widgets/:widgetId", func(id widgetIdPathParam, widget *typedWidget) (*typedWidget, error) {
+		return widget, nil
+	})
+	mux.GET("/widgets", func(limit *limitQueryParam) ([]typedWidget, error) {
+		return nil, nil
+	})
+	mux.DELETE("/widgets/:widgetId", func(id widgetIdPathParam) error {
+		return nil
+	})
+
+	src, err := mux.GoClient(GoClientConfig{Package: "widgets"})
+	if err != nil {
+		t.Fatalf("couldn't generate client: %v", err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "client.go", src, 0)
+	if err != nil {
+		t.Fatalf("client doesn't parse: %v\n%s", err, src)
+	}
+	if file.Name.Name != "widgets" {
+		t.Fatalf(`file.Name.Name != "widgets", file.Name.Name == "%v"`, file.Name.Name)
+	}
+
+	for _, expected := range []string{
+		"func (c *Client) PutWidgetsWidgetId(ctx context.Context, widgetId string, body *TypedWidget) (*TypedWidget, error) {",
+		`path := "/widgets/" + url.PathEscape(widgetId)`,
+		"func (c *Client) GetWidgets(ctx context.Context, limit *int) ([]TypedWidget, error) {",
+		`query.Set("limit", fmt.Sprint(*limit))`,
+		"func (c *Client) DeleteWidgetsWidgetId(ctx context.Context, widgetId string) error {",
+		"Name string `json:\"name\"`",
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Fatalf("client doesn't contain %q:\n%s", expected, src)
+		}
+	}
+}
+
+func TestTypeScriptClient(t *testing.T) {
+	mux := NewServeMux()
+	mux.PUT("/widgets/:widgetId", func(id widgetIdPathParam, widget *typedWidget) (*typedWidget, error) {
+		return widget, nil
+	})
+	mux.GET("/widgets", func(limit *limitQueryParam) ([]typedWidget, error) {
+		return nil, nil
+	})
+	mux.DELETE("/widgets/:widgetId", func(id widgetIdPathParam) error {
+		return nil
+	})
+
+	src := mux.TypeScriptClient()
+	for _, expected := range []string{
+		"export interface TypedWidget {\n  id: string;\n  name: string;\n}",
+		"putWidgetsWidgetId(widgetId: string, body: TypedWidget, init?: RequestInit): Promise<TypedWidget> {",
+		"`/widgets/${encodeURIComponent(String(widgetId))}`",
+		"getWidgets(params: { limit?: number } = {}, init?: RequestInit): Promise<TypedWidget[]> {",
+		`if (params.limit !== undefined) query.set("limit", String(params.limit));`,
+		"deleteWidgetsWidgetId(widgetId: string, init?: RequestInit): Promise<void> {",
+	} {
+		if !strings.Contains(src, expected) {
+			t.Fatalf("client doesn't contain %q:\n%s", expected, src)
+		}
+	}
+}
+
+// region is made by a plugin without Code, so a generated adaptor calls
+// its Extract func
+type region string
+
+func init() {
+	generate.RegisterPlugin(&generate.Plugin{
+		Name: "region",
+		Match: func(typ reflect.Type) bool {
+			return typ == reflect.TypeOf(region(""))
+		},
+		Extract: func(req *http.Request, typ reflect.Type) (interface{}, error) {
+			return region(req.URL.Query().Get("region")), nil
+		},
+	})
+}
+
+func TestPlugins(t *testing.T) {
+	var got region
+	mux := NewServeMux()
+	mux.Handle("/tenant", TenantHandler)
+	mux.Handle("/region", func(tenant Tenant, r region) {
+		got = r
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/tenant", nil)
+	req.Header.Set("X-Tenant", "acme")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "tenant acme" {
+		t.Fatalf(`string(body) != "tenant acme", string(body) == "%v"`, string(body))
+	}
+
+	resp, err = http.Get(server.URL + "/tenant")
+	if err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf(`resp.StatusCode != http.StatusBadRequest, resp.StatusCode == "%v"`, resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/region?region=eu", nil)
+	req.Header.Set("X-Tenant", "acme")
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("making request: %v\n", err)
+	}
+	if got != "eu" {
+		t.Fatalf(`got != "eu", got == "%v"`, got)
+	}
+
+	op := mux.OpenAPI(OpenAPIInfo{}).Paths["/tenant"]["get"]
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "X-Tenant" || op.Parameters[0].In != "header" || !op.Parameters[0].Required {
+		t.Fatalf("the tenant plugin's param isn't documented: %+v", op.Parameters)
+	}
+
+	path := filepath.Join(t.TempDir(), "plumbus.adaptor-generated.go")
+	if err := generate.Adaptor(func(r region) {}, path, "plumbus"); err != nil {
+		t.Fatalf("couldn't generate: %v", err)
+	}
+	src, _ := os.ReadFile(path)
+	if !strings.Contains(string(src), `generate.PluginExtractor("region", reflect.TypeOf((*region)(nil)).Elem())`) {
+		t.Fatalf("generated adaptor doesn't call the plugin:\n%s", src)
+	}
+}
+
+func TestGeneratedAdaptorsDontReflect(t *testing.T) {
+	// the helpers that reflect on their arguments
+	reflecting := map[string]bool{
+		"SetParam":        true,
+		"SetParamDefault": true,
+		"Validate":        true,
+		"ValidateStruct":  true,
+		"ValidateAt":      true,
+		"EncodeResponse":  true,
+	}
+
+	for _, handler := range []string{
+		"ReturnStructHandler",
+		"RequiredRequestParamHandler",
+		"HeaderParamHandler",
+		"KindParamHandler",
+		"TimeParamHandler",
+		"RequestBodyHandler",
+		"ValidateHandler",
+		"ValidateTagsHandler",
+		"TenantHandler",
+	} {
+		path := "handlers/" + handler + ".adaptor-generated.go"
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			t.Fatalf("couldn't parse %s: %v", path, err)
+		}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			fun, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || fun.Sel.Name != "HandlerFunc" {
+				return true
+			}
+			// what's called while serving a request
+			ast.Inspect(call.Args[0], func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok && (pkg.Name == "reflect" || pkg.Name == "plumbus" && reflecting[sel.Sel.Name]) {
+					t.Fatalf("%s reflects while serving with %s.%s", path, pkg.Name, sel.Sel.Name)
+				}
+				return true
+			})
+			return false
+		})
+	}
+}
+
+func BenchmarkAdaptors(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		handler interface{}
+		method  string
+		target  string
+		header  http.Header
+		body    string
+	}{
+		{"Result", ReturnStructHandler, "GET", "/", nil, ""},
+		{"QueryParams", RequiredRequestParamHandler, "GET", "/?food=apple&amount=3", nil, ""},
+		{"HeaderParams", HeaderParamHandler, "GET", "/", http.Header{"X-Trace-Id": {"abc"}, "Retries": {"3"}}, ""},
+		{"DefaultParam", DefaultParamHandler, "GET", "/", nil, ""},
+		{"Body", RequestBodyHandler, "POST", "/", http.Header{"Content-Type": {"application/json"}}, `{"Message":"hi"}`},
+		{"Validate", ValidateHandler, "POST", "/?currency=usd", http.Header{"Content-Type": {"application/json"}}, `{"Amount":5}`},
+	}
+
+	for _, bm := range benchmarks {
+		adaptors := []struct {
+			name    string
+			handler http.Handler
+		}{
+			{"dynamic", ReflectionHandler(bm.handler)},
+			{"generated", HandlerFunc(bm.handler)},
+		}
+		for _, adaptor := range adaptors {
+			mux := NewServeMux()
+			mux.Handle("/", adaptor.handler)
+			serve := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(bm.method, bm.target, strings.NewReader(bm.body))
+				for key, values := range bm.header {
+					req.Header[key] = values
+				}
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, req)
+				return res
+			}
+
+			b.Run(bm.name+"/"+adaptor.name, func(b *testing.B) {
+				if res := serve(); res.Code >= 300 {
+					b.Fatalf("request failed with %d: %s", res.Code, res.Body)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					serve()
+				}
+			})
+		}
+	}
+}
+
+func TestTestStubs(t *testing.T) {
+	mux := NewServeMux()
+	mux.GET("/struct", ReturnStructHandler)
+	mux.GET("/orders/:orderId", PathParamHandler)
+	mux.POST("/body", RequestBodyHandler)
+	mux.GET("/headers", HeaderParamHandler)
+	mux.GET("/literal", func() (string, error) {
+		return "", nil
+	})
+
+	src, err := mux.TestStubs(TestStubsConfig{Package: "github.com/jargv/plumbus/tests/handlers"})
+	if err != nil {
+		t.Fatalf("couldn't generate tests: %v", err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "handlers_test.go", src, 0)
+	if err != nil {
+		t.Fatalf("tests don't parse: %v\n%s", err, src)
+	}
+	if file.Name.Name != "handlers" {
+		t.Fatalf(`file.Name.Name != "handlers", file.Name.Name == "%v"`, file.Name.Name)
+	}
+
+	for _, expected := range []string{
+		"func TestReturnStructHandler(t *testing.T) {",
+		"var got ReturnStructResult",
+		`mux.GET("/orders/:orderId", PathParamHandler)`,
+		`path := "/orders/" + url.PathEscape(fmt.Sprint(tt.orderId))`,
+		"body   *RequestBodyBody",
+		"data, err := json.Marshal(tt.body)",
+		`req.Header.Set("X-Trace-Id", tt.xTraceId)`,
+		"if tt.retries != nil {",
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Fatalf("tests don't contain %q:\n%s", expected, src)
+		}
+	}
+	if strings.Contains(string(src), "/literal") {
+		t.Fatalf("tests contain the route of a function literal:\n%s", src)
+	}
+
+	src, err = mux.TestStubs(TestStubsConfig{Package: "example.com/elsewhere"})
+	if src != nil || err != nil {
+		t.Fatalf("src != nil || err != nil, src == %q, err == %v", src, err)
+	}
+}
+
+func BenchmarkRouting(b *testing.B) {
+	mux := NewServeMux()
+	for i := 0; i < 400; i++ {
+		mux.Handle("/static/route"+strconv.Itoa(i)+"/name", http.NotFoundHandler())
+		mux.Handle("/params/route"+strconv.Itoa(i)+"/:id/name", http.NotFoundHandler())
+	}
+
+	static := httptest.NewRequest("GET", "/static/route399/name", nil)
+	params := httptest.NewRequest("GET", "/params/route399/10/name", nil)
+	res := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mux.ServeHTTP(res, static)
+		mux.ServeHTTP(res, params)
+		params.URL.RawQuery = ""
+	}
+}
+
 // // type UserId struct {
 // // }
 
@@ -0,0 +1,279 @@
+package plumbus
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TestStubsConfig configures the tests made by ServeMux.TestStubs
+type TestStubsConfig struct {
+	// Package is the path of the package declaring the handlers to test,
+	// which the tests are part of
+	Package string
+
+	// Name is the package's name, the last element of its path by default
+	Name string
+}
+
+// TestStubs generates table-driven tests for the mux's routes whose
+// handlers are declared in a package, to get started on testing new
+// routes. Each test registers its handler on a mux of its own, and has a
+// table with a field for each of the route's params, its body, the
+// status, and the result expected. The cases are left to be filled in.
+// Each case is sent as a request, and its response is decoded into the
+// handler's result type and compared, as in:
+//
+//	src, err := mux.TestStubs(plumbus.TestStubsConfig{Package: "example.com/orders"})
+//	...
+//	os.WriteFile("orders/handlers_test.go", src, 0644)
+//
+// The source is nil if none of the handlers are declared in the package.
+// Handlers that are function literals can't be referred to by the tests,
+// and streaming and websocket routes are left out.
+func (sm *ServeMux) TestStubs(config TestStubsConfig) ([]byte, error) {
+	if config.Name == "" {
+		config.Name = identifier(config.Package[strings.LastIndex(config.Package, "/")+1:])
+	}
+	g := &goClient{
+		config:  GoClientConfig{Package: config.Name, ShareTypes: true},
+		local:   config.Package,
+		imports: map[string]string{},
+		aliases: map[string]bool{config.Name: true},
+		types:   map[reflect.Type]string{},
+		names:   map[string]bool{},
+	}
+	for _, path := range []string{"net/http/httptest", "testing", "github.com/jargv/plumbus"} {
+		g.importPackage(path)
+	}
+
+	var tests strings.Builder
+	for _, route := range sm.clientRoutes() {
+		if handler := stubHandler(route.handler, config.Package); handler != "" {
+			g.testStub(&tests, route, handler)
+		}
+	}
+	if tests.Len() == 0 {
+		return nil, nil
+	}
+
+	var src strings.Builder
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", config.Name)
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if alias := g.imports[path]; alias != path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(&src, "\t%s %q\n", alias, path)
+		} else {
+			fmt.Fprintf(&src, "\t%q\n", path)
+		}
+	}
+	src.WriteString(")\n")
+	src.WriteString(tests.String())
+	for _, def := range g.typeDefs {
+		src.WriteString(def)
+	}
+
+	return format.Source([]byte(src.String()))
+}
+
+// stubHandler is the code referring to a handler from a test in the
+// package pkg, or "" if it's declared elsewhere or can't be referred to
+func stubHandler(handler interface{}, pkg string) string {
+	name := handlerName(handler)
+	if !strings.HasPrefix(name, pkg+".") {
+		return ""
+	}
+	name = name[len(pkg)+1:]
+
+	methodValue := strings.HasSuffix(name, "-fm")
+	name = strings.TrimSuffix(name, "-fm")
+	for _, part := range strings.Split(name, ".") {
+		part = strings.Trim(part, "(*)")
+		if !token.IsIdentifier(part) || strings.HasPrefix(part, "func") && strings.TrimLeft(part[4:], "0123456789") == "" {
+			// a function literal, or a generic function
+			return ""
+		}
+	}
+	if methodValue {
+		dot := strings.LastIndex(name, ".")
+		return fmt.Sprintf("new(%s).%s", strings.Trim(name[:dot], "(*)"), name[dot+1:])
+	}
+	return name
+}
+
+// testStub writes a test of a route, whose handler is referred to as
+// handler
+func (g *goClient) testStub(w *strings.Builder, route *clientRoute, handler string) {
+	plumbus := g.importPackage("github.com/jargv/plumbus")
+
+	fields := []string{"name string"}
+	used := map[string]bool{"name": true, "body": true, "status": true, "want": true}
+	fieldNames := make([]string, len(route.params))
+	for i, param := range route.params {
+		name := identifier(param.name)
+		if used[name] {
+			name += "Param"
+		}
+		used[name] = true
+		fieldNames[i] = name
+
+		typ := g.paramType(param.typ)
+		if !param.required {
+			typ = "*" + typ
+		}
+		fields = append(fields, name+" "+typ)
+	}
+	switch route.bodyKind {
+	case clientJSON:
+		fields = append(fields, "body "+g.typeName(route.body))
+	case clientRaw, clientFile:
+		fields = append(fields, "body []byte")
+	}
+	fields = append(fields, "status int")
+
+	var result string
+	switch route.resultKind {
+	case clientJSON:
+		result = g.typeName(route.result)
+	case clientText:
+		result = "string"
+	case clientRaw:
+		result = "[]byte"
+	}
+	if result != "" {
+		fields = append(fields, "want "+result)
+	}
+
+	register := route.method
+	switch register {
+	case "GET", "POST", "PUT", "PATCH", "DELETE":
+	default:
+		register = "Handle"
+	}
+
+	fmt.Fprintf(w, "\nfunc Test%s(t *testing.T) {\n", route.name)
+	fmt.Fprintf(w, "mux := %s.NewServeMux()\nmux.%s(%q, %s)\n\n", plumbus, register, route.pattern, handler)
+	fmt.Fprintf(w, "tests := []struct {\n%s\n}{\n// TODO: add test cases.\n}\n", strings.Join(fields, "\n"))
+	w.WriteString("for _, tt := range tests {\nt.Run(tt.name, func(t *testing.T) {\n")
+
+	// the path is built from literals and escaped path params
+	var path []string
+	literal := ""
+	i := 0
+	for _, segment := range getSegments(route.pattern) {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			literal += "/" + segment
+			continue
+		}
+		path = append(path, strconv.Quote(literal+"/"))
+		literal = ""
+		value := g.stubParamString("tt."+fieldNames[i], route.params[i].typ)
+		if route.params[i].catchAll {
+			path = append(path, value)
+		} else {
+			path = append(path, g.importPackage("net/url")+".PathEscape("+value+")")
+		}
+		i++
+	}
+	if literal != "" || len(path) == 0 {
+		path = append(path, strconv.Quote(literal))
+	}
+	if path[0] == `""` {
+		path[0] = `"/"`
+	}
+	fmt.Fprintf(w, "path := %s\n", strings.Join(path, " + "))
+
+	var query, header []string
+	for j, param := range route.params[i:] {
+		name := "tt." + fieldNames[i+j]
+		var set string
+		switch param.in {
+		case "query":
+			set = fmt.Sprintf("query.Set(%q, %%s)", param.name)
+		case "header":
+			set = fmt.Sprintf("req.Header.Set(%q, %%s)", param.name)
+		case "cookie":
+			set = fmt.Sprintf("req.AddCookie(&%s.Cookie{Name: %q, Value: %%s})", g.importPackage("net/http"), param.name)
+		default:
+			continue
+		}
+		line := fmt.Sprintf(set, g.stubParamString(name, param.typ))
+		if !param.required {
+			line = fmt.Sprintf("if %s != nil {\n%s\n}", name, fmt.Sprintf(set, g.stubParamString("*"+name, param.typ)))
+		}
+		if param.in == "query" {
+			query = append(query, line)
+		} else {
+			header = append(header, line)
+		}
+	}
+	if len(query) > 0 {
+		fmt.Fprintf(w, "query := %s.Values{}\n%s\n", g.importPackage("net/url"), strings.Join(query, "\n"))
+		w.WriteString("if len(query) > 0 {\npath += \"?\" + query.Encode()\n}\n")
+	}
+
+	bytes := ""
+	if route.bodyKind != clientNone || route.resultKind == clientRaw {
+		bytes = g.importPackage("bytes")
+	}
+	body := "nil"
+	switch route.bodyKind {
+	case clientJSON:
+		fmt.Fprintf(w, "data, err := %s.Marshal(tt.body)\nif err != nil {\nt.Fatalf(\"couldn't encode the body: %%v\", err)\n}\n", g.importPackage("encoding/json"))
+		body = bytes + ".NewReader(data)"
+		header = append([]string{`req.Header.Set("Content-Type", "application/json")`}, header...)
+	case clientRaw:
+		body = bytes + ".NewReader(tt.body)"
+		if route.bodyMediaType != "" {
+			header = append([]string{fmt.Sprintf("req.Header.Set(\"Content-Type\", %q)", route.bodyMediaType)}, header...)
+		}
+	case clientFile:
+		fmt.Fprintf(w, "var form %s.Buffer\nwriter := %s.NewWriter(&form)\n", bytes, g.importPackage("mime/multipart"))
+		fmt.Fprintf(w, "part, err := writer.CreateFormFile(%q, %q)\nif err != nil {\nt.Fatalf(\"couldn't make the form: %%v\", err)\n}\n", route.fileField, route.fileField)
+		w.WriteString("part.Write(tt.body)\nwriter.Close()\n")
+		body = "&form"
+		header = append([]string{"req.Header.Set(\"Content-Type\", writer.FormDataContentType())"}, header...)
+	}
+
+	fmt.Fprintf(w, "req := httptest.NewRequest(%q, path, %s)\n", route.method, body)
+	for _, line := range header {
+		w.WriteString(line + "\n")
+	}
+	w.WriteString("res := httptest.NewRecorder()\nmux.ServeHTTP(res, req)\n\n")
+	w.WriteString("if res.Code != tt.status {\nt.Fatalf(\"res.Code != %v, res.Code == %v: %s\", tt.status, res.Code, res.Body)\n}\n")
+
+	switch route.resultKind {
+	case clientJSON:
+		fmt.Fprintf(w, "if res.Code >= 300 || res.Code == %s.StatusNoContent {\nreturn\n}\n\n", g.importPackage("net/http"))
+		fmt.Fprintf(w, "var got %s\nif err := %s.NewDecoder(res.Body).Decode(&got); err != nil {\nt.Fatalf(\"couldn't decode the response: %%v\", err)\n}\n", result, g.importPackage("encoding/json"))
+		fmt.Fprintf(w, "if !%s.DeepEqual(got, tt.want) {\nt.Fatalf(\"got != tt.want, got == %%+v, tt.want == %%+v\", got, tt.want)\n}\n", g.importPackage("reflect"))
+	case clientText:
+		w.WriteString("if res.Code >= 300 {\nreturn\n}\n\n")
+		w.WriteString("if got := res.Body.String(); got != tt.want {\nt.Fatalf(\"got != tt.want, got == %q, tt.want == %q\", got, tt.want)\n}\n")
+	case clientRaw:
+		w.WriteString("if res.Code >= 300 {\nreturn\n}\n\n")
+		fmt.Fprintf(w, "if got := res.Body.Bytes(); !%s.Equal(got, tt.want) {\nt.Fatalf(\"got != tt.want, got == %%q, tt.want == %%q\", got, tt.want)\n}\n", bytes)
+	}
+	w.WriteString("})\n}\n}\n")
+}
+
+// stubParamString is the code formatting a param's value for a request,
+// importing the packages it uses
+func (g *goClient) stubParamString(expr string, typ reflect.Type) string {
+	value := goParamString(expr, typ)
+	switch {
+	case strings.HasPrefix(value, "fmt."):
+		g.importPackage("fmt")
+	case isTimeType(typ):
+		g.importPackage("time")
+	}
+	return value
+}
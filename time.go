@@ -0,0 +1,57 @@
+package plumbus
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// timeLayouts are tried in order when parsing a time param whose type
+// doesn't name its own layouts
+var timeLayouts = []string{time.RFC3339}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// RegisterTimeLayout adds a layout to try when parsing time params, after
+// RFC3339 and any layouts registered before it
+func RegisterTimeLayout(layout string) {
+	timeLayouts = append(timeLayouts, layout)
+}
+
+// TimeLayouter can be implemented by a time param type to parse with its
+// own layouts instead of the registered ones, as in:
+//
+//	type sinceQueryParam time.Time
+//
+//	func (sinceQueryParam) Layouts() []string {
+//		return []string{"2006-01-02"}
+//	}
+type TimeLayouter interface {
+	Layouts() []string
+}
+
+// ParseTimeParam parses the value of a time param, using the layouts of
+// param if it's a TimeLayouter
+func ParseTimeParam(value string, param interface{}) (time.Time, error) {
+	layouts := timeLayouts
+	if layouter, ok := param.(TimeLayouter); ok {
+		layouts = layouter.Layouts()
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf(
+		"expected to be time value with layout %s",
+		strings.Join(layouts, " or "),
+	)
+}
+
+// isTimeType checks for time.Time or a type defined from it
+func isTimeType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && typ.ConvertibleTo(timeType)
+}
@@ -0,0 +1,137 @@
+package plumbus
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WithTimeout is middleware that limits handlers to d, as in
+// mux.Use(plumbus.WithTimeout(5 * time.Second)), or for a single route
+// with HandleWith. The request's context is canceled once d has passed,
+// and the response is a 504. The handler's response is buffered until it
+// returns or flushes it, so anything it writes after the timeout is
+// discarded. A handler that has flushed its response can't be sent a 504,
+// so streaming routes, which run for as long as the client listens,
+// shouldn't use WithTimeout.
+func WithTimeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+			req = req.WithContext(ctx)
+
+			tw := &timeoutWriter{res: res, header: http.Header{}}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						panicked <- recovered
+					}
+				}()
+				next.ServeHTTP(tw, req)
+				close(done)
+			}()
+
+			select {
+			case recovered := <-panicked:
+				// panic again here, so that the mux recovers it
+				panic(recovered)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.writeBuffered(false)
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if ctx.Err() == context.DeadlineExceeded && !tw.flushed {
+					HandleResponseError(res, req, Errorf(
+						http.StatusGatewayTimeout,
+						"request took longer than %s",
+						d,
+					))
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a response until the handler is done or flushes
+// it, and discards it if the handler took too long
+type timeoutWriter struct {
+	mu       sync.Mutex
+	res      http.ResponseWriter
+	header   http.Header
+	code     int
+	body     bytes.Buffer
+	timedOut bool
+	flushed  bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		// the response is gone, so changes to the header don't matter
+		return http.Header{}
+	}
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.code == 0 && !tw.timedOut {
+		tw.code = code
+	}
+}
+
+func (tw *timeoutWriter) Write(body []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.body.Write(body)
+}
+
+// Flush sends what's been written so far, if the handler hasn't timed
+// out, after which the response can't be replaced with a 504
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeBuffered(true)
+	if flusher, ok := tw.res.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// writeBuffered writes the buffered response, sending the header with
+// the first write. Unless flushing, the header is only sent if the
+// handler set a status, leaving the default to the writer underneath.
+// The caller holds mu.
+func (tw *timeoutWriter) writeBuffered(flushing bool) {
+	if !tw.flushed {
+		for name, values := range tw.header {
+			tw.res.Header()[name] = values
+		}
+		if flushing && tw.code == 0 {
+			tw.code = http.StatusOK
+		}
+		if tw.code != 0 {
+			tw.res.WriteHeader(tw.code)
+		}
+		tw.flushed = flushing
+	}
+	tw.body.WriteTo(tw.res)
+}
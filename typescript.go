@@ -0,0 +1,381 @@
+package plumbus
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TypeScriptClient generates a TypeScript module for calling the mux's
+// routes from a browser or node, with an interface for each body and
+// result type and a method of its Client for each route. Each method
+// takes the route's path params, its body, and an object with its other
+// params, and returns a promise of its result, as in:
+//
+//	os.WriteFile("web/src/api.ts", []byte(mux.TypeScriptClient()), 0644)
+//
+// and then:
+//
+//	const order = await new Client("/api").getOrder(12);
+//
+// The types are made from the same schemas as the OpenAPI document, so
+// they follow json tags and enums the same way. A response with an error
+// status rejects with an ApiError. Cookie params aren't part of the
+// methods, as the browser sends cookies itself, and streaming and
+// websocket routes are left out.
+func (sm *ServeMux) TypeScriptClient() string {
+	ts := &tsClient{
+		schemas: &openAPIBuilder{
+			doc: &OpenAPI{Components: OpenAPIComponents{
+				Schemas: map[string]*OpenAPISchema{},
+			}},
+			operationIDs: map[string]bool{},
+		},
+	}
+	for _, route := range sm.clientRoutes() {
+		ts.method(route)
+	}
+
+	var src strings.Builder
+	src.WriteString("// Code generated by plumbus. DO NOT EDIT.\n")
+
+	components := ts.schemas.doc.Components.Schemas
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := components[name]
+		src.WriteString("\n")
+		tsDoc(&src, "", schema.Description)
+		fmt.Fprintf(&src, "export interface %s %s\n", tsTypeName(name), tsObject(schema, ""))
+	}
+
+	src.WriteString(tsClientRuntime)
+	src.WriteString(ts.methods.String())
+	src.WriteString("}\n")
+	return src.String()
+}
+
+type tsClient struct {
+	schemas *openAPIBuilder
+	methods strings.Builder
+}
+
+func (ts *tsClient) method(route *clientRoute) {
+	m := &ts.methods
+	text := fmt.Sprintf("%s calls %s %s", route.name, route.method, route.pattern)
+	for _, more := range []string{route.summary, route.description} {
+		if more != "" {
+			text += "\n\n" + more
+		}
+	}
+	if route.deprecated {
+		text += "\n\n@deprecated the route is deprecated."
+	}
+	m.WriteString("\n")
+	tsDoc(m, "  ", text)
+
+	var args []string
+	used := map[string]bool{"params": true, "body": true, "init": true, "query": true, "headers": true, "path": true}
+	var build []string
+
+	// the path is a template of literals and encoded path params
+	var path strings.Builder
+	i := 0
+	for _, segment := range getSegments(route.pattern) {
+		path.WriteString("/")
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			path.WriteString(tsTemplateEscaper.Replace(segment))
+			continue
+		}
+		param := route.params[i]
+		name := identifier(param.name)
+		if used[name] || tsKeywords[name] {
+			name += "Param"
+		}
+		used[name] = true
+		args = append(args, name+": "+ts.paramType(param))
+		if param.catchAll {
+			fmt.Fprintf(&path, "${String(%s)}", name)
+		} else {
+			fmt.Fprintf(&path, "${encodeURIComponent(String(%s))}", name)
+		}
+		i++
+	}
+	if path.Len() == 0 {
+		path.WriteString("/")
+	}
+
+	bodyArg := "undefined"
+	switch route.bodyKind {
+	case clientJSON:
+		optional := ""
+		if !route.bodyRequired {
+			optional = "?"
+		}
+		args = append(args, "body"+optional+": "+ts.schemaType(route.body))
+		build = append(build, `headers["Content-Type"] = "application/json";`)
+		bodyArg = "JSON.stringify(body)"
+		if !route.bodyRequired {
+			bodyArg = "body === undefined ? undefined : JSON.stringify(body)"
+		}
+	case clientRaw:
+		args = append(args, "body: BodyInit")
+		bodyArg = "body"
+		if route.bodyMediaType != "" {
+			build = append(build, fmt.Sprintf("headers[\"Content-Type\"] = %q;", route.bodyMediaType))
+		}
+	case clientFile:
+		optional := ""
+		if !route.bodyRequired {
+			optional = "?"
+		}
+		args = append(args, "body"+optional+": Blob")
+		build = append(build, fmt.Sprintf("const form = new FormData();\n    if (body !== undefined) form.append(%q, body);", route.fileField))
+		bodyArg = "form"
+	}
+
+	var fields []string
+	required := false
+	for _, param := range route.params[i:] {
+		var set string
+		switch param.in {
+		case "query":
+			set = fmt.Sprintf("query.set(%q, String(%s))", param.name, tsAccess("params", param.name))
+		case "header":
+			set = fmt.Sprintf("headers[%q] = String(%s)", param.name, tsAccess("params", param.name))
+		default:
+			continue
+		}
+		optional := "?"
+		if param.required {
+			optional, required = "", true
+			build = append(build, set+";")
+		} else {
+			build = append(build, fmt.Sprintf("if (%s !== undefined) %s;", tsAccess("params", param.name), set))
+		}
+		fields = append(fields, fmt.Sprintf("%s%s: %s", tsProperty(param.name), optional, ts.paramType(param)))
+	}
+	if len(fields) > 0 {
+		params := "params: { " + strings.Join(fields, "; ") + " }"
+		if !required {
+			params += " = {}"
+		}
+		args = append(args, params)
+	}
+	args = append(args, "init?: RequestInit")
+
+	result, kind := "void", "none"
+	switch route.resultKind {
+	case clientJSON:
+		result, kind = ts.schemaType(route.result), "json"
+	case clientText:
+		result, kind = "string", "text"
+	case clientRaw:
+		result, kind = "Blob", "blob"
+	}
+
+	fmt.Fprintf(m, "  %s(%s): Promise<%s> {\n", identifier(route.name), strings.Join(args, ", "), result)
+	m.WriteString("    const query = new URLSearchParams();\n    const headers: Record<string, string> = {};\n")
+	for _, line := range build {
+		fmt.Fprintf(m, "    %s\n", line)
+	}
+	fmt.Fprintf(m, "    return this.request(%q, `%s`, query, headers, %s, %q, init);\n  }\n", route.method, path.String(), bodyArg, kind)
+}
+
+func (ts *tsClient) paramType(param *clientParam) string {
+	return tsType(ts.schemas.paramSchema(param.typ), "")
+}
+
+func (ts *tsClient) schemaType(typ reflect.Type) string {
+	return tsType(ts.schemas.schema(typ), "")
+}
+
+// tsType is the TypeScript type of values matching a schema, indented
+// for the line it's on
+func tsType(schema *OpenAPISchema, indent string) string {
+	switch {
+	case schema.Ref != "":
+		return tsTypeName(strings.TrimPrefix(schema.Ref, "#/components/schemas/"))
+	case len(schema.Enum) > 0:
+		values := make([]string, len(schema.Enum))
+		for i, value := range schema.Enum {
+			values[i] = strconv.Quote(value)
+		}
+		return strings.Join(values, " | ")
+	}
+
+	switch schema.Type {
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		items := tsType(schema.Items, indent)
+		if strings.Contains(items, " | ") {
+			return "(" + items + ")[]"
+		}
+		return items + "[]"
+	case "object":
+		if schema.AdditionalProperties != nil {
+			return "Record<string, " + tsType(schema.AdditionalProperties, indent) + ">"
+		}
+		return tsObject(schema, indent)
+	}
+	return "unknown"
+}
+
+// tsObject is the TypeScript type of an object schema's properties
+func tsObject(schema *OpenAPISchema, indent string) string {
+	if len(schema.Properties) == 0 {
+		return "{}"
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	var obj strings.Builder
+	obj.WriteString("{\n")
+	for _, name := range names {
+		property := schema.Properties[name]
+		tsDoc(&obj, indent+"  ", property.Description)
+		optional := "?"
+		if required[name] {
+			optional = ""
+		}
+		fmt.Fprintf(&obj, "%s  %s%s: %s;\n", indent, tsProperty(name), optional, tsType(property, indent+"  "))
+	}
+	obj.WriteString(indent + "}")
+	return obj.String()
+}
+
+// tsTypeName makes a schema's name into the name of an interface
+func tsTypeName(name string) string {
+	return upperFirst(identifier(name))
+}
+
+// tsAccess is the code for a property of an object
+func tsAccess(object, name string) string {
+	if property := tsProperty(name); property == name {
+		return object + "." + name
+	}
+	return object + "[" + strconv.Quote(name) + "]"
+}
+
+// tsProperty quotes a property name that isn't an identifier
+func tsProperty(name string) string {
+	if name != "" && identifier(name) == name {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+func tsDoc(w *strings.Builder, indent, text string) {
+	if text == "" {
+		return
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "*/", "*\\/"), "\n")
+	if len(lines) == 1 {
+		fmt.Fprintf(w, "%s/** %s */\n", indent, lines[0])
+		return
+	}
+	fmt.Fprintf(w, "%s/**\n", indent)
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s *%s\n", indent, strings.TrimRight(" "+line, " "))
+	}
+	fmt.Fprintf(w, "%s */\n", indent)
+}
+
+var tsTemplateEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`", "${", "\\${")
+
+// tsKeywords are the reserved words that can't name an argument
+var tsKeywords = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "debugger": true, "default": true, "delete": true, "do": true,
+	"else": true, "enum": true, "export": true, "extends": true, "false": true,
+	"finally": true, "for": true, "function": true, "if": true, "import": true,
+	"in": true, "instanceof": true, "new": true, "null": true, "return": true,
+	"super": true, "switch": true, "this": true, "throw": true, "true": true,
+	"try": true, "typeof": true, "var": true, "void": true, "while": true,
+	"with": true, "let": true, "static": true, "yield": true, "await": true,
+}
+
+// tsClientRuntime is the part of every generated client that sends the
+// requests. The methods of the Client follow it.
+const tsClientRuntime = `
+/** ApiError is the response to a request that failed */
+export class ApiError extends Error {
+  constructor(
+    readonly status: number,
+    message: string,
+    readonly body: string,
+  ) {
+    super(message);
+    this.name = "ApiError";
+  }
+}
+
+export interface ClientOptions {
+  /** headers are added to every request, for credentials and the like */
+  headers?: Record<string, string>;
+  /** fetch sends the requests, or the global fetch if it's not given */
+  fetch?: typeof fetch;
+}
+
+/** Client calls the API served at baseURL */
+export class Client {
+  constructor(
+    readonly baseURL: string,
+    readonly options: ClientOptions = {},
+  ) {}
+
+  private async request<T>(
+    method: string,
+    path: string,
+    query: URLSearchParams,
+    headers: Record<string, string>,
+    body: BodyInit | undefined,
+    result: "json" | "text" | "blob" | "none",
+    init?: RequestInit,
+  ): Promise<T> {
+    let url = this.baseURL.replace(/\/$/, "") + path;
+    const search = query.toString();
+    if (search) url += "?" + search;
+    const send = this.options.fetch ?? fetch;
+    const res = await send(url, {
+      ...init,
+      method,
+      body,
+      headers: { Accept: "application/json", ...this.options.headers, ...headers, ...(init?.headers as Record<string, string>) },
+    });
+    if (!res.ok) {
+      const text = await res.text();
+      let message = res.statusText;
+      try {
+        message = JSON.parse(text).error || message;
+      } catch {}
+      throw new ApiError(res.status, message, text);
+    }
+    switch (result) {
+      case "json":
+        return (res.status === 204 ? undefined : await res.json()) as T;
+      case "text":
+        return (await res.text()) as T;
+      case "blob":
+        return (await res.blob()) as T;
+    }
+    return undefined as T;
+  }
+`
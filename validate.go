@@ -0,0 +1,416 @@
+package plumbus
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jargv/plumbus/generate"
+)
+
+// Validate calls the Validate method of the value that ptr points to, if
+// it has one. Errors that aren't already an HTTPError are turned into a
+// 400. Nil pointers aren't validated, since they're optional.
+func Validate(ptr interface{}) error {
+	val := reflect.ValueOf(ptr)
+	for {
+		if validator, ok := val.Interface().(Validator); ok {
+			if val.Kind() == reflect.Ptr && val.IsNil() {
+				return nil
+			}
+			return ValidatorError(validator.Validate())
+		}
+		if val.Kind() != reflect.Ptr || val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+}
+
+// ValidatorError is the error responded with for the error returned by
+// a Validate method, for adaptors that call it themselves
+func ValidatorError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := asHTTPError(err); ok {
+		return err
+	}
+	return WrapError(http.StatusBadRequest, err)
+}
+
+// FieldError describes a field or param that failed conversion or
+// validation. In is where a param came from, and is empty for body fields.
+type FieldError struct {
+	Field   string `json:"field"`
+	In      string `json:"in,omitempty"`
+	Message string `json:"message"`
+}
+
+func (fe FieldError) Error() string {
+	if fe.In != "" {
+		return fmt.Sprintf("%s param '%s' %s", fe.In, fe.Field, fe.Message)
+	}
+	return fe.Field + " " + fe.Message
+}
+
+// ValidationErrors lists every field that failed conversion or
+// validation. It's sent as a 400 with the list of fields under "errors".
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func (ve ValidationErrors) ResponseCode() int {
+	return http.StatusBadRequest
+}
+
+// ParamError is the error for a single param that couldn't be converted
+func ParamError(source, name, message string) error {
+	return ValidationErrors{{Field: name, In: source, Message: message}}
+}
+
+// CollectErrors adds err to errs if it's ValidationErrors, so that every
+// bad field is reported at once. Any other error is returned to stop the
+// request.
+func CollectErrors(errs ValidationErrors, err error) (ValidationErrors, error) {
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		return append(errs, verrs...), nil
+	}
+	return errs, err
+}
+
+// ValidateStruct checks the fields of the struct that ptr points to
+// against their `validate` tags, as in:
+//
+//	Name   string   `validate:"required,max=64"`
+//	Amount int      `validate:"min=1,max=1000"`
+//	Kind   string   `validate:"oneof=credit debit"`
+//	Code   *string  `validate:"regexp=^[A-Z]{3}$"`
+//
+// min and max compare numbers by value and strings, slices, and maps by
+// length, counting the characters of strings. Nil pointers are only
+// checked by required. Since regexp may contain commas, it must be the
+// last rule in the tag. Nested structs are checked too, including those
+// in slices, arrays, and maps, and every failure is reported in the
+// ValidationErrors. The tags of each type are parsed once, and a bad tag
+// is returned as an error, or makes registering a handler taking the
+// type panic.
+func ValidateStruct(ptr interface{}) error {
+	var errs ValidationErrors
+	if err := validateValue(reflect.ValueOf(ptr), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateAt checks the `validate` tags of the structs that v holds, like
+// ValidateStruct, naming the fields under name. Generated adaptors check
+// the tags themselves, and only call it for a struct nested in itself.
+func ValidateAt(v interface{}, name string) ValidationErrors {
+	var errs ValidationErrors
+	if err := validateValue(reflect.ValueOf(v), name, &errs); err != nil {
+		// the tags were checked when the handler was registered
+		panic(err)
+	}
+	return errs
+}
+
+// SortedKeys are the keys of m, in the order ValidateStruct checks a
+// map's values in, for generated adaptors
+func SortedKeys[K comparable, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	names := make(map[K]string, len(m))
+	for key := range m {
+		keys = append(keys, key)
+		names[key] = fmt.Sprint(key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return names[keys[i]] < names[keys[j]]
+	})
+	return keys
+}
+
+// IsZero reports whether v is the zero value of its type, for the
+// required rule in generated adaptors
+func IsZero[T comparable](v T) bool {
+	var zero T
+	return v == zero
+}
+
+// ruleRegexps keeps the compiled regexps of validate rules by pattern
+var ruleRegexps sync.Map
+
+// MatchesRule reports whether s matches the pattern of a regexp rule, for
+// generated adaptors. The pattern was checked when the handler was
+// registered, and is compiled once.
+func MatchesRule(pattern, s string) bool {
+	re, ok := ruleRegexps.Load(pattern)
+	if !ok {
+		re, _ = ruleRegexps.LoadOrStore(pattern, regexp.MustCompile(pattern))
+	}
+	return re.(*regexp.Regexp).MatchString(s)
+}
+
+func validateValue(val reflect.Value, name string, errs *ValidationErrors) error {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			if err := validateValue(val.Index(i), fmt.Sprintf("%s[%d]", name, i), errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			if err := validateValue(val.MapIndex(key), fmt.Sprintf("%s[%v]", name, key.Interface()), errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		rules, err := structRulesFor(val.Type())
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		if name != "" {
+			prefix = name + "."
+		}
+		for _, field := range rules.fields {
+			fieldVal := val.Field(field.index)
+			for _, msg := range field.check(fieldVal) {
+				*errs = append(*errs, FieldError{Field: prefix + field.name, Message: msg})
+			}
+			if field.nested {
+				if err := validateValue(fieldVal, prefix+field.name, errs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// structRules are the parsed `validate` tags of a struct type
+type structRules struct {
+	fields []fieldRules
+	err    error
+}
+
+// fieldRules are the rules of a field, and whether its value may hold
+// structs with rules of their own
+type fieldRules struct {
+	index  int
+	name   string
+	rules  []generate.ValidateRule
+	nested bool
+}
+
+// validateRules keeps the structRules of each struct type
+var validateRules sync.Map
+
+func structRulesFor(typ reflect.Type) (*structRules, error) {
+	if rules, ok := validateRules.Load(typ); ok {
+		return rules.(*structRules), rules.(*structRules).err
+	}
+
+	rules := &structRules{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fr := fieldRules{
+			index:  i,
+			name:   generate.FieldName(field),
+			nested: hasRules(field.Type, map[reflect.Type]bool{}),
+		}
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			parsed, err := generate.ParseValidateRules(field.Type, tag)
+			if err != nil {
+				rules = &structRules{err: fmt.Errorf("field %s of %s: %v", field.Name, typ, err)}
+				break
+			}
+			fr.rules = parsed
+		}
+		if len(fr.rules) > 0 || fr.nested {
+			rules.fields = append(rules.fields, fr)
+		}
+	}
+
+	validateRules.Store(typ, rules)
+	return rules, rules.err
+}
+
+// hasRules checks whether values of the type may hold structs with
+// `validate` tags
+func hasRules(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	for {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			typ = typ.Elem()
+			continue
+		}
+		break
+	}
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return false
+	}
+	seen[typ] = true
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("validate"); ok {
+			return true
+		}
+		if hasRules(field.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkValidateTags parses the `validate` tags of every struct that
+// values of the type may hold, returning the first bad one
+func checkValidateTags(typ reflect.Type) error {
+	return checkRules(typ, map[reflect.Type]bool{})
+}
+
+func checkRules(typ reflect.Type, seen map[reflect.Type]bool) error {
+	for {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			typ = typ.Elem()
+			continue
+		}
+		break
+	}
+	if typ.Kind() != reflect.Struct || seen[typ] || !hasRules(typ, map[reflect.Type]bool{}) {
+		return nil
+	}
+	seen[typ] = true
+
+	rules, err := structRulesFor(typ)
+	if err != nil {
+		return err
+	}
+	for _, field := range rules.fields {
+		if field.nested {
+			if err := checkRules(typ.Field(field.index).Type, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// check checks a field's value against its rules, returning a message for
+// each rule that fails
+func (fr *fieldRules) check(val reflect.Value) []string {
+	var msgs []string
+	for i := range fr.rules {
+		rule := &fr.rules[i]
+		if rule.Name == "required" {
+			if val.IsZero() {
+				msgs = append(msgs, "is required")
+			}
+			continue
+		}
+
+		v := val
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				break
+			}
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Ptr {
+			continue
+		}
+
+		if msg := checkRule(rule, v); msg != "" {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// checkRule checks a value against a rule other than required, returning
+// a message if it fails
+func checkRule(r *generate.ValidateRule, val reflect.Value) string {
+	switch r.Name {
+	case "min", "max":
+		n, isLength := validateSize(val)
+		if r.Name == "min" && n < r.Limit {
+			if isLength {
+				return fmt.Sprintf("must have length at least %s", r.Arg)
+			}
+			return fmt.Sprintf("must be at least %s", r.Arg)
+		}
+		if r.Name == "max" && n > r.Limit {
+			if isLength {
+				return fmt.Sprintf("must have length at most %s", r.Arg)
+			}
+			return fmt.Sprintf("must be at most %s", r.Arg)
+		}
+	case "regexp":
+		if !r.Regexp.MatchString(val.String()) {
+			return fmt.Sprintf("must match %s", r.Arg)
+		}
+	case "oneof":
+		value := fmt.Sprint(val.Interface())
+		for _, a := range r.Allowed {
+			if value == a {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(r.Allowed, ", "))
+	}
+	return ""
+}
+
+// validateSize is the number compared by min and max, and whether it's a
+// length rather than the value itself. The kind was checked when the
+// rule was parsed.
+func validateSize(val reflect.Value) (float64, bool) {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), false
+	case reflect.String:
+		return float64(utf8.RuneCountInString(val.String())), true
+	}
+	return float64(val.Len()), true
+}
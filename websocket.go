@@ -0,0 +1,55 @@
+package plumbus
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var defaultUpgrader = &websocket.Upgrader{}
+
+// SetWebSocketUpgrader sets how requests are upgraded for handlers that
+// take a *WSConn, such as which origins are allowed. By default only
+// requests from the same origin are upgraded.
+func (sm *ServeMux) SetWebSocketUpgrader(upgrader *websocket.Upgrader) {
+	sm.wsUpgrader = upgrader
+}
+
+// UpgradeWebSocket upgrades the request to a websocket connection. If it
+// fails, an error response has already been written.
+func UpgradeWebSocket(res http.ResponseWriter, req *http.Request) (*WSConn, error) {
+	upgrader := defaultUpgrader
+	if sm := muxFromRequest(req); sm != nil && sm.wsUpgrader != nil {
+		upgrader = sm.wsUpgrader
+	}
+
+	conn, err := upgrader.Upgrade(res, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &WSConn{Conn: conn}, nil
+}
+
+// CloseWebSocket closes the connection once its handler returns, sending
+// a close message for the error the handler returned. The message of an
+// HTTPError is sent along, but any other error is only logged, as with
+// HandleResponseError.
+func CloseWebSocket(conn *WSConn, err error) {
+	defer conn.Close()
+
+	code, text := websocket.CloseNormalClosure, ""
+	if httperr, ok := asHTTPError(err); ok {
+		code, text = websocket.CloseInternalServerErr, httperr.Error()
+		if httperr.ResponseCode() < http.StatusInternalServerError {
+			code = websocket.ClosePolicyViolation
+		}
+	} else if err != nil {
+		log.Printf("error handling websocket: %v", err)
+		code, text = websocket.CloseInternalServerErr, "internal server error"
+	}
+
+	message := websocket.FormatCloseMessage(code, text)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+}